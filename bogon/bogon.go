@@ -0,0 +1,418 @@
+// Package bogon finds bogons in BGP updates: prefixes of special-purpose
+// (RFC6890) or unallocated address space, prefixes of absurd lengths, and
+// private, reserved and documentation ASes and AS_TRANS in AS paths.
+package bogon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+// Reason is why a prefix or an AS is a bogon.
+type Reason uint8
+
+const (
+	// the prefix is in special-purpose address space
+	REASON_SPECIAL_PREFIX = Reason(iota)
+	// the prefix is in unallocated address space
+	REASON_UNALLOCATED_PREFIX
+	// the prefix is shorter or longer than networks accept
+	REASON_PREFIX_LENGTH
+	REASON_PRIVATE_AS
+	REASON_RESERVED_AS
+	REASON_AS_TRANS
+	REASON_DOCUMENTATION_AS
+)
+
+var reasonNames = map[Reason]string{
+	REASON_SPECIAL_PREFIX:     "special-prefix",
+	REASON_UNALLOCATED_PREFIX: "unallocated-prefix",
+	REASON_PREFIX_LENGTH:      "prefix-length",
+	REASON_PRIVATE_AS:         "private-as",
+	REASON_RESERVED_AS:        "reserved-as",
+	REASON_AS_TRANS:           "as-trans",
+	REASON_DOCUMENTATION_AS:   "documentation-as",
+}
+
+func (r Reason) String() string {
+	if n, ok := reasonNames[r]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(r))
+}
+
+func (r Reason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ParseReason returns the reason named like "special-prefix" or
+// "private-as".
+func ParseReason(name string) (Reason, error) {
+	for r, n := range reasonNames {
+		if strings.EqualFold(name, n) {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown bogon reason %q", name)
+}
+
+// IsAS reports whether r is a reason for an AS to be a bogon.
+func (r Reason) IsAS() bool {
+	return r >= REASON_PRIVATE_AS && r <= REASON_DOCUMENTATION_AS
+}
+
+// Prefix is a prefix of bogon address space.
+type Prefix struct {
+	*net.IPNet
+	Description string
+}
+
+// ASRange is a range of bogon ASes, from First to Last included.
+type ASRange struct {
+	First, Last uint32
+	Reason      Reason
+	Description string
+}
+
+func (r ASRange) String() string {
+	s := fmt.Sprintf("AS%d", r.First)
+	if r.First != r.Last {
+		s += fmt.Sprintf("-AS%d", r.Last)
+	}
+	if r.Description != "" {
+		s += " " + r.Description
+	}
+	return s
+}
+
+// Lengths are the shortest and longest IPv4 and IPv6 prefixes that are
+// not bogons.
+type Lengths struct {
+	V4Min, V4Max uint8
+	V6Min, V6Max uint8
+}
+
+// Match is a bogon found in an update.
+type Match struct {
+	Reason Reason `json:"reason"`
+	// the prefix or AS of the update, like 10.1.0.0/16 or AS64512
+	Value string `json:"value"`
+	// the entry of the list it is in, like "10.0.0.0/8 private use
+	// (RFC1918)", or the bounds of lengths
+	Entry string `json:"entry"`
+}
+
+func (m Match) String() string {
+	return fmt.Sprintf("%s %s in %s", m.Reason, m.Value, m.Entry)
+}
+
+// prefixSet is a list of prefixes in a tree, with their descriptions.
+type prefixSet struct {
+	pt   util.PrefixTree
+	desc map[string]string
+}
+
+func newPrefixSet(prefixes []Prefix) prefixSet {
+	s := prefixSet{pt: util.NewPrefixTree(), desc: make(map[string]string, len(prefixes))}
+	for _, p := range prefixes {
+		ones, bits := p.Mask.Size()
+		if bits == 128 && p.IP.To4() != nil {
+			// IPv4 mapped, that the tree would take for IPv4. ReadPrefixes
+			// does not return them
+			continue
+		}
+		s.pt.Add(p.IP, uint8(ones))
+		s.desc[p.IPNet.String()] = p.Description
+	}
+	return s
+}
+
+// lookup returns the entry of the shortest prefix of the set that covers
+// ip/mask, and false if there is none.
+func (s prefixSet) lookup(ip net.IP, mask uint8) (string, bool) {
+	entry := ""
+	s.pt.WalkAncestors(ip, mask, func(n *net.IPNet) bool {
+		entry = strings.TrimSpace(n.String() + " " + s.desc[n.String()])
+		return true
+	})
+	return entry, entry != ""
+}
+
+// Checker checks prefixes and ASes against lists of bogons, by default
+// the built-in ones with no unallocated prefixes. It is safe for
+// concurrent use and its lists can be replaced while it is used.
+type Checker struct {
+	mu          sync.RWMutex
+	special     prefixSet
+	unallocated prefixSet
+	ases        []ASRange
+	lengths     Lengths
+}
+
+// NewChecker creates a checker with the built-in lists.
+func NewChecker() *Checker {
+	return &Checker{
+		special:     newPrefixSet(DefaultSpecialPrefixes()),
+		unallocated: newPrefixSet(nil),
+		ases:        DefaultASRanges(),
+		lengths:     DEFAULT_LENGTHS,
+	}
+}
+
+// SetSpecialPrefixes replaces the special-purpose prefixes.
+func (c *Checker) SetSpecialPrefixes(prefixes []Prefix) {
+	s := newPrefixSet(prefixes)
+	c.mu.Lock()
+	c.special = s
+	c.mu.Unlock()
+}
+
+// SetUnallocatedPrefixes replaces the unallocated prefixes.
+func (c *Checker) SetUnallocatedPrefixes(prefixes []Prefix) {
+	s := newPrefixSet(prefixes)
+	c.mu.Lock()
+	c.unallocated = s
+	c.mu.Unlock()
+}
+
+// SetASRanges replaces the bogon ASes. Their reasons must be AS reasons.
+func (c *Checker) SetASRanges(ranges []ASRange) error {
+	for _, r := range ranges {
+		if !r.Reason.IsAS() {
+			return fmt.Errorf("%s is not a reason for an AS to be a bogon", r.Reason)
+		}
+		if r.First > r.Last {
+			return fmt.Errorf("bad AS range %d-%d", r.First, r.Last)
+		}
+	}
+	ases := append([]ASRange(nil), ranges...)
+	c.mu.Lock()
+	c.ases = ases
+	c.mu.Unlock()
+	return nil
+}
+
+// SetLengths replaces the bounds of prefix lengths.
+func (c *Checker) SetLengths(l Lengths) {
+	c.mu.Lock()
+	c.lengths = l
+	c.mu.Unlock()
+}
+
+// CheckPrefix returns why the prefix ip/mask is a bogon, if it is. It is
+// in special-purpose or unallocated space if a prefix of that list covers
+// it, and can also have a bad length.
+func (c *Checker) CheckPrefix(ip net.IP, mask uint8) []Match {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value := fmt.Sprintf("%s/%d", ip, mask)
+	var ret []Match
+	if entry, ok := c.special.lookup(ip, mask); ok {
+		ret = append(ret, Match{REASON_SPECIAL_PREFIX, value, entry})
+	} else if entry, ok := c.unallocated.lookup(ip, mask); ok {
+		ret = append(ret, Match{REASON_UNALLOCATED_PREFIX, value, entry})
+	}
+	min, max := c.lengths.V6Min, c.lengths.V6Max
+	if ip.To4() != nil {
+		min, max = c.lengths.V4Min, c.lengths.V4Max
+	}
+	if mask < min || mask > max {
+		ret = append(ret, Match{REASON_PREFIX_LENGTH, value, fmt.Sprintf("/%d-/%d", min, max)})
+	}
+	return ret
+}
+
+// CheckAS returns why as is a bogon, and false if it is not.
+func (c *Checker) CheckAS(as uint32) (Match, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.ases {
+		if as >= r.First && as <= r.Last {
+			return Match{r.Reason, fmt.Sprintf("AS%d", as), r.String()}, true
+		}
+	}
+	return Match{}, false
+}
+
+// checkPath adds the bogons of a path to ret, once for each AS.
+func (c *Checker) checkPath(segs []*pbbgp.BGPUpdate_ASPathSegment, seen map[uint32]bool, ret []Match) []Match {
+	for _, seg := range segs {
+		for _, ases := range [][]uint32{seg.ASSeq, seg.ASSet} {
+			for _, as := range ases {
+				if seen[as] {
+					continue
+				}
+				seen[as] = true
+				if m, ok := c.CheckAS(as); ok {
+					ret = append(ret, m)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// CheckStack returns the bogons in the advertised prefixes and AS paths
+// of an update or the entries of a RIB.
+func (c *Checker) CheckStack(mbs *mrt.MrtBufferStack) ([]Match, error) {
+	routes, rerr := mrt.GetAdvertisedPrefixes(mbs)
+	attrs, aerr := mrt.GetAttributes(mbs)
+	if rerr != nil && aerr != nil {
+		return nil, rerr
+	}
+	var ret []Match
+	for _, r := range routes {
+		ret = append(ret, c.CheckPrefix(r.IP, r.Mask)...)
+	}
+	seen := make(map[uint32]bool)
+	for _, a := range attrs {
+		ret = c.checkPath(a.ASPath, seen, ret)
+	}
+	return ret, nil
+}
+
+// readLines calls fn with the fields of each line of r, without blank
+// lines and comments from a #.
+func readLines(r io.Reader, fn func(fields []string) error) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return sc.Err()
+}
+
+// ReadPrefixes reads a list of prefixes, one per line with an optional
+// description after it, like the bogon lists of Team Cymru:
+//
+//	# fullbogons
+//	0.0.0.0/8
+//	10.0.0.0/8 private use
+//
+// IPv4 mapped IPv6 prefixes like ::ffff:0:0/96 are errors, as a Checker
+// could only take them for IPv4 prefixes.
+func ReadPrefixes(r io.Reader) ([]Prefix, error) {
+	var ret []Prefix
+	err := readLines(r, func(fields []string) error {
+		_, n, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return err
+		}
+		if _, bits := n.Mask.Size(); bits == 128 && n.IP.To4() != nil {
+			return fmt.Errorf("IPv4 mapped prefix %s, write it as the IPv4 prefix", fields[0])
+		}
+		ret = append(ret, Prefix{IPNet: n, Description: strings.Join(fields[1:], " ")})
+		return nil
+	})
+	return ret, err
+}
+
+func parseAS(s string) (uint32, error) {
+	as, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed AS %q", s)
+	}
+	return uint32(as), nil
+}
+
+// ReadASRanges reads a list of AS ranges, one per line with its reason and
+// an optional description:
+//
+//	64512-65534 private-as private use (RFC6996)
+//	AS23456 as-trans
+func ReadASRanges(r io.Reader) ([]ASRange, error) {
+	var ret []ASRange
+	err := readLines(r, func(fields []string) error {
+		if len(fields) < 2 {
+			return fmt.Errorf("missing reason for %s", fields[0])
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		first, err := parseAS(bounds[0])
+		if err != nil {
+			return err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseAS(bounds[1]); err != nil {
+				return err
+			}
+		}
+		reason, err := ParseReason(fields[1])
+		if err != nil {
+			return err
+		}
+		if !reason.IsAS() || first > last {
+			return fmt.Errorf("bad AS range %s %s", fields[0], reason)
+		}
+		ret = append(ret, ASRange{first, last, reason, strings.Join(fields[2:], " ")})
+		return nil
+	})
+	return ret, err
+}
+
+func readFile(fname string, read func(io.Reader) error) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	if err := read(fp); err != nil {
+		return fmt.Errorf("%s: %w", fname, err)
+	}
+	return nil
+}
+
+// LoadSpecialPrefixes replaces the special-purpose prefixes with those of
+// a file in the format of ReadPrefixes.
+func (c *Checker) LoadSpecialPrefixes(fname string) error {
+	return readFile(fname, func(r io.Reader) error {
+		prefixes, err := ReadPrefixes(r)
+		if err == nil {
+			c.SetSpecialPrefixes(prefixes)
+		}
+		return err
+	})
+}
+
+// LoadUnallocatedPrefixes replaces the unallocated prefixes with those of
+// a file in the format of ReadPrefixes.
+func (c *Checker) LoadUnallocatedPrefixes(fname string) error {
+	return readFile(fname, func(r io.Reader) error {
+		prefixes, err := ReadPrefixes(r)
+		if err == nil {
+			c.SetUnallocatedPrefixes(prefixes)
+		}
+		return err
+	})
+}
+
+// LoadASRanges replaces the bogon ASes with those of a file in the format
+// of ReadASRanges.
+func (c *Checker) LoadASRanges(fname string) error {
+	return readFile(fname, func(r io.Reader) error {
+		ranges, err := ReadASRanges(r)
+		if err == nil {
+			err = c.SetASRanges(ranges)
+		}
+		return err
+	})
+}
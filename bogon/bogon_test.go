@@ -0,0 +1,154 @@
+package bogon
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+func reasons(ms []Match) string {
+	names := make([]string, len(ms))
+	for i, m := range ms {
+		names[i] = m.Reason.String()
+	}
+	return strings.Join(names, " ")
+}
+
+func TestCheckPrefix(t *testing.T) {
+	c := NewChecker()
+	cases := []struct {
+		prefix, reasons string
+	}{
+		{"8.8.8.0/24", ""},
+		{"10.1.0.0/16", "special-prefix"},
+		{"192.168.1.0/30", "special-prefix prefix-length"},
+		{"0.0.0.0/0", "prefix-length"},
+		{"11.0.0.0/8", ""},
+		{"2001:db8:1::/48", "special-prefix"},
+		{"2a00::/12", "prefix-length"},
+		{"2a00:1450::/64", "prefix-length"},
+		{"::/128", "special-prefix prefix-length"},
+		{"2a00:1450::/32", ""},
+	}
+	for _, cs := range cases {
+		_, n, _ := net.ParseCIDR(cs.prefix)
+		ones, _ := n.Mask.Size()
+		if got := reasons(c.CheckPrefix(n.IP, uint8(ones))); got != cs.reasons {
+			t.Errorf("%s: expected %q, got %q", cs.prefix, cs.reasons, got)
+		}
+	}
+	if m := c.CheckPrefix(net.ParseIP("10.1.0.0"), 16); m[0].String() != "special-prefix 10.1.0.0/16 in 10.0.0.0/8 private use (RFC1918)" {
+		t.Errorf("bad match %s", m[0])
+	}
+
+	c.SetLengths(Lengths{V4Min: 8, V4Max: 32, V6Min: 16, V6Max: 128})
+	if m := c.CheckPrefix(net.ParseIP("8.8.8.8"), 32); len(m) != 0 {
+		t.Errorf("host route is a bogon %v", m)
+	}
+}
+
+func TestCheckAS(t *testing.T) {
+	c := NewChecker()
+	cases := []struct {
+		as     uint32
+		reason string
+	}{
+		{3356, ""},
+		{0, "reserved-as"},
+		{23456, "as-trans"},
+		{64500, "documentation-as"},
+		{64512, "private-as"},
+		{65535, "reserved-as"},
+		{100000, "reserved-as"},
+		{131072, ""},
+		{4200000001, "private-as"},
+	}
+	for _, cs := range cases {
+		m, ok := c.CheckAS(cs.as)
+		if got := m.Reason.String(); ok != (cs.reason != "") || (ok && got != cs.reason) {
+			t.Errorf("AS%d: expected %q, got %q %v", cs.as, cs.reason, got, ok)
+		}
+	}
+}
+
+// updateBody advertises the IPv4 NLRI routes with an AS4 path of ases.
+func updateBody(routes []byte, ases ...uint32) []byte {
+	path := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}
+	attrs = append(attrs, path...)
+	attrs = append(attrs, 0x40, 3, 4, 192, 0, 2, 1)
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	return append(body, routes...)
+}
+
+func TestCheckStack(t *testing.T) {
+	msg := bgp.NewMessage(bgp.MSG_UPDATE, updateBody([]byte{16, 10, 1}, 3356, 23456, 64512, 64512))
+	peering := &mrt.BGP4MPPeering{PeerAS: 3356, PeerIP: net.ParseIP("192.0.2.1")}
+	mbs, err := mrt.ParseHeaders(mrt.NewBGP4MPMessage(time.Unix(1500000000, 0), peering, true, msg), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := NewChecker().CheckStack(mbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reasons(ms); got != "special-prefix as-trans private-as" {
+		t.Errorf("bad matches %v", ms)
+	}
+}
+
+func TestLoadLists(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		fname := filepath.Join(dir, name)
+		if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fname
+	}
+	c := NewChecker()
+	if err := c.LoadUnallocatedPrefixes(write("fullbogons.txt", "# test list\n\n11.0.0.0/8\n2a10::/12 not allocated # yet\n")); err != nil {
+		t.Fatal(err)
+	}
+	ms := c.CheckPrefix(net.ParseIP("11.1.0.0"), 16)
+	if len(ms) != 1 || ms[0].Reason != REASON_UNALLOCATED_PREFIX || ms[0].Entry != "11.0.0.0/8" {
+		t.Errorf("bad unallocated match %v", ms)
+	}
+	if ms := c.CheckPrefix(net.ParseIP("2a10:1::"), 32); len(ms) != 1 || ms[0].Entry != "2a10::/12 not allocated" {
+		t.Errorf("bad unallocated match %v", ms)
+	}
+
+	if err := c.LoadASRanges(write("ases.txt", "AS64512-AS65534 private-as\n174 reserved-as test\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.CheckAS(23456); ok {
+		t.Errorf("AS ranges not replaced")
+	}
+	if m, ok := c.CheckAS(174); !ok || m.Entry != "AS174 test" {
+		t.Errorf("bad AS match %v", m)
+	}
+
+	if err := c.LoadSpecialPrefixes(write("special.txt", "10.0.0.0/33\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("bad error %v", err)
+	}
+	if _, err := ReadPrefixes(strings.NewReader("2001:db8::/32\n::ffff:0:0/96 mapped\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("bad error %v", err)
+	}
+	for _, bad := range []string{"64512\n", "64512-64511 private-as\n", "AS1 special-prefix\n", "ASx private-as\n"} {
+		if _, err := ReadASRanges(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q read", bad)
+		}
+	}
+}
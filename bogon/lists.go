@@ -0,0 +1,74 @@
+package bogon
+
+import (
+	"net"
+)
+
+// specialPrefixes are the special-purpose prefixes of RFC6890 and its
+// updates that are not globally reachable, with multicast and the
+// deprecated 6to4 relay and site local prefixes. IPv4 mapped addresses are
+// IPv4 addresses to the prefix tree and can not be listed.
+var specialPrefixes = []struct {
+	prefix, desc string
+}{
+	{"0.0.0.0/8", "this network (RFC1122)"},
+	{"10.0.0.0/8", "private use (RFC1918)"},
+	{"100.64.0.0/10", "shared address space (RFC6598)"},
+	{"127.0.0.0/8", "loopback (RFC1122)"},
+	{"169.254.0.0/16", "link local (RFC3927)"},
+	{"172.16.0.0/12", "private use (RFC1918)"},
+	{"192.0.0.0/24", "IETF protocol assignments (RFC6890)"},
+	{"192.0.2.0/24", "documentation (RFC5737)"},
+	{"192.88.99.0/24", "6to4 relay anycast (RFC7526)"},
+	{"192.168.0.0/16", "private use (RFC1918)"},
+	{"198.18.0.0/15", "benchmarking (RFC2544)"},
+	{"198.51.100.0/24", "documentation (RFC5737)"},
+	{"203.0.113.0/24", "documentation (RFC5737)"},
+	{"224.0.0.0/4", "multicast (RFC5771)"},
+	{"240.0.0.0/4", "reserved (RFC1112)"},
+	{"::/128", "unspecified address (RFC4291)"},
+	{"::1/128", "loopback (RFC4291)"},
+	{"64:ff9b:1::/48", "local use IPv4/IPv6 translation (RFC8215)"},
+	{"100::/64", "discard only (RFC6666)"},
+	{"2001:2::/48", "benchmarking (RFC5180)"},
+	{"2001:10::/28", "deprecated ORCHID (RFC4843)"},
+	{"2001:db8::/32", "documentation (RFC3849)"},
+	{"3fff::/20", "documentation (RFC9637)"},
+	{"fc00::/7", "unique local (RFC4193)"},
+	{"fe80::/10", "link local (RFC4291)"},
+	{"fec0::/10", "deprecated site local (RFC3879)"},
+	{"ff00::/8", "multicast (RFC4291)"},
+}
+
+// DefaultSpecialPrefixes returns the built-in list of special-purpose
+// prefixes.
+func DefaultSpecialPrefixes() []Prefix {
+	ret := make([]Prefix, len(specialPrefixes))
+	for i, p := range specialPrefixes {
+		_, n, err := net.ParseCIDR(p.prefix)
+		if err != nil {
+			panic(err)
+		}
+		ret[i] = Prefix{IPNet: n, Description: p.desc}
+	}
+	return ret
+}
+
+// DefaultASRanges returns the built-in list of bogon ASes.
+func DefaultASRanges() []ASRange {
+	return []ASRange{
+		{0, 0, REASON_RESERVED_AS, "reserved (RFC7607)"},
+		{23456, 23456, REASON_AS_TRANS, "AS_TRANS (RFC6793)"},
+		{64496, 64511, REASON_DOCUMENTATION_AS, "documentation (RFC5398)"},
+		{64512, 65534, REASON_PRIVATE_AS, "private use (RFC6996)"},
+		{65535, 65535, REASON_RESERVED_AS, "reserved (RFC7300)"},
+		{65536, 65551, REASON_DOCUMENTATION_AS, "documentation (RFC5398)"},
+		{65552, 131071, REASON_RESERVED_AS, "reserved by IANA"},
+		{4200000000, 4294967294, REASON_PRIVATE_AS, "private use (RFC6996)"},
+		{4294967295, 4294967295, REASON_RESERVED_AS, "reserved (RFC7300)"},
+	}
+}
+
+// DEFAULT_LENGTHS are the built-in bounds of prefix lengths, the ones
+// most networks accept.
+var DEFAULT_LENGTHS = Lengths{V4Min: 8, V4Max: 24, V6Min: 16, V6Max: 48}
@@ -0,0 +1,104 @@
+package protoparse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Layer is the part of a record a ParseError happened in.
+type Layer int
+
+const (
+	LayerMRT = Layer(iota)
+	LayerBGP4MP
+	LayerBGP
+	LayerAttr
+	LayerNLRI
+	LayerRIB
+	LayerBMP
+	LayerRTR
+)
+
+var layerNames = []string{"MRT", "BGP4MP", "BGP", "attr", "NLRI", "RIB", "BMP", "RTR"}
+
+func (l Layer) String() string {
+	if int(l) < len(layerNames) {
+		return layerNames[l]
+	}
+	return fmt.Sprintf("layer%d", int(l))
+}
+
+// These are the categories of a ParseError. They can be matched
+// with errors.Is on any error returned by the parsers.
+var (
+	ErrTruncated   = errors.New("not enough bytes")
+	ErrMalformed   = errors.New("malformed data")
+	ErrUnsupported = errors.New("unsupported type")
+)
+
+// ParseError is returned by all the decoders. Offset is the byte offset
+// of the error from the start of the record (or of the buffer given to
+// the PbVal when it is parsed on its own). AttrType is the BGP path
+// attribute type for errors in the attr and NLRI layers, and 0 otherwise.
+type ParseError struct {
+	Layer    Layer
+	Offset   int
+	AttrType uint8
+	Kind     error
+	Msg      string
+}
+
+// NewParseError creates a ParseError of a kind that happened at offset off
+// of the buffer being decoded.
+func NewParseError(layer Layer, off int, kind error, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Layer:  layer,
+		Offset: off,
+		Kind:   kind,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// WrapParseError turns an error from a helper decoder given the buffer at
+// offset off into a ParseError at that offset, and adds off to the offset
+// of a ParseError. The kind is ErrMalformed unless err wraps one of the
+// other kinds.
+func WrapParseError(err error, layer Layer, off int) error {
+	if err == nil {
+		return nil
+	}
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return AddOffset(err, off)
+	}
+	kind := ErrMalformed
+	if errors.Is(err, ErrTruncated) {
+		kind = ErrTruncated
+	} else if errors.Is(err, ErrUnsupported) {
+		kind = ErrUnsupported
+	}
+	return NewParseError(layer, off, kind, "%s", err)
+}
+
+func (e *ParseError) Error() string {
+	ret := e.Layer.String()
+	if e.AttrType != 0 {
+		ret += fmt.Sprintf(" (type %d)", e.AttrType)
+	}
+	return ret + fmt.Sprintf(" at offset %d: %s", e.Offset, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Kind
+}
+
+// AddOffset adds off to the offset of a ParseError. A decoder that gives
+// buf[off:] to another one calls it on the errors of that one, so that
+// they are located in buf. Other errors are returned as they are.
+func AddOffset(err error, off int) error {
+	var perr *ParseError
+	if err != nil && errors.As(err, &perr) {
+		perr.Offset += off
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bgpstreamElem is a BGPStream elem with the fields of its record.
+type bgpstreamElem struct {
+	Type        string  `json:"type"`
+	Time        float64 `json:"time"`
+	Project     string  `json:"project"`
+	Collector   string  `json:"collector"`
+	PeerAddress string  `json:"peer_address"`
+	PeerASN     uint32  `json:"peer_asn"`
+	Fields      struct {
+		Prefix      string          `json:"prefix"`
+		NextHop     string          `json:"next-hop"`
+		ASPath      string          `json:"as-path"`
+		Communities json.RawMessage `json:"communities"`
+	} `json:"fields"`
+}
+
+// DecodeBGPStream decodes a BGPStream elem, in the layout pybgpstream gives
+// elems with the project and collector of their record added, for example
+//
+//	{"type":"A","time":1500000000.0,"project":"ris","collector":"rrc00",
+//	 "peer_address":"192.0.2.1","peer_asn":65001,
+//	 "fields":{"prefix":"10.0.0.0/8","next-hop":"192.0.2.1",
+//	 "as-path":"65001 3356 {64512,64513}","communities":["65001:100"]}}
+//
+// Announcements (A) and RIB entries (R) decode to an update advertising the
+// prefix and withdrawals (W) to one withdrawing it. Peer state elems (S)
+// have no records. Communities are "AS:value" strings, or "AS:value:value"
+// for large communities, or objects with asn and value members.
+func DecodeBGPStream(msg []byte) ([]*Record, error) {
+	e := bgpstreamElem{}
+	if err := json.Unmarshal(msg, &e); err != nil {
+		return nil, fmt.Errorf("malformed BGPStream elem: %w", err)
+	}
+	if e.Type == "S" {
+		return nil, nil
+	}
+	peer, err := parseIP(e.PeerAddress)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := parsePrefix(e.Fields.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	u := newUpdate(peer)
+	switch e.Type {
+	case "W":
+		u.withdrawn = append(u.withdrawn, prefix)
+	case "A", "R":
+		u.announced = append(u.announced, prefix)
+		if e.Fields.NextHop != "" {
+			if u.nextHop, err = parseNextHop(e.Fields.NextHop); err != nil {
+				return nil, err
+			}
+		}
+		if u.path, err = bgpstreamPath(e.Fields.ASPath); err != nil {
+			return nil, err
+		}
+		if err := u.bgpstreamCommunities(e.Fields.Communities); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown BGPStream elem type %q", e.Type)
+	}
+	return newRecords(e.Collector, floatTime(e.Time), peer, e.PeerASN, u), nil
+}
+
+// bgpstreamPath decodes a path of space separated ASes, with AS_SETs in
+// braces and their ASes separated by commas.
+func bgpstreamPath(path string) ([]pathSegment, error) {
+	segs := []pathSegment{}
+	for _, tok := range strings.Fields(path) {
+		if strings.HasPrefix(tok, "{") && strings.HasSuffix(tok, "}") {
+			set := pathSegment{set: true}
+			for _, s := range strings.Split(strings.Trim(tok, "{}"), ",") {
+				as, err := strconv.ParseUint(s, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("malformed AS set %q", tok)
+				}
+				set.ases = append(set.ases, uint32(as))
+			}
+			segs = append(segs, set)
+			continue
+		}
+		as, err := strconv.ParseUint(tok, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed AS %q in path", tok)
+		}
+		segs = appendSequence(segs, uint32(as))
+	}
+	return segs, nil
+}
+
+func (u *update) bgpstreamCommunities(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	strs := []string{}
+	if err := json.Unmarshal(raw, &strs); err == nil {
+		for _, s := range strs {
+			if err := u.parseCommunity(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	objs := []struct {
+		ASN   uint32 `json:"asn"`
+		Value uint32 `json:"value"`
+	}{}
+	if err := json.Unmarshal(raw, &objs); err != nil {
+		return fmt.Errorf("malformed communities %s", raw)
+	}
+	for _, c := range objs {
+		if err := u.parseCommunity(fmt.Sprintf("%d:%d", c.ASN, c.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
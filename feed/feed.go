@@ -0,0 +1,213 @@
+// Package feed decodes the JSON updates published by public BGP feeds, like
+// RIPE RIS Live and BGPStream, into BGP4MP MRT records. The records are the
+// ones a collector would have written for the updates, so they parse with
+// mrt.ParseHeaders and mrt.MrtToBGPCapturev2 into the same protocol buffers,
+// and filters and analytics work the same on feeds and MRT files.
+package feed
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	monpb "github.com/CSUNetSec/netsec-protobufs/bgpmon/v2"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	"golang.org/x/net/websocket"
+)
+
+// Record is an update from a feed encoded as an MRT record.
+type Record struct {
+	// Collector is the name of the collector that received the update.
+	Collector string
+	// Time is the time of the update, which in the MRT record is
+	// truncated to seconds.
+	Time   time.Time
+	Peer   net.IP
+	PeerAS uint32
+	// MRT is a BGP4MP MESSAGE_AS4 record with the update. The local end of
+	// the session is unknown and set to the unspecified address and AS 0.
+	MRT []byte
+}
+
+// Headers parses the record like an MRT file record.
+func (r *Record) Headers() (*mrt.MrtBufferStack, error) {
+	return mrt.ParseHeaders(r.MRT, false)
+}
+
+// Capture decodes the record into a BGP capture.
+func (r *Record) Capture() (*monpb.BGPCapture, error) {
+	return mrt.MrtToBGPCapturev2(r.MRT)
+}
+
+// newRecords encodes an update received from peer into records.
+func newRecords(collector string, ts time.Time, peer net.IP, peerAS uint32, u *update) []*Record {
+	peering := &mrt.BGP4MPPeering{PeerIP: peer, PeerAS: peerAS}
+	ret := []*Record{}
+	for _, msg := range u.messages() {
+		ret = append(ret, &Record{
+			Collector: collector,
+			Time:      ts,
+			Peer:      peer,
+			PeerAS:    peerAS,
+			MRT:       mrt.NewBGP4MPMessage(ts, peering, true, msg),
+		})
+	}
+	return ret
+}
+
+// floatTime converts fractional unix seconds.
+func floatTime(ts float64) time.Time {
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)).UTC()
+}
+
+// DecodeFunc decodes a JSON message of a feed into records. Messages
+// that don't carry routes, like keepalives, decode to no records.
+type DecodeFunc func(msg []byte) ([]*Record, error)
+
+// Source returns the JSON messages of a feed one by one.
+type Source interface {
+	// Next returns the next message, or io.EOF when the feed ends.
+	Next() ([]byte, error)
+	Close() error
+}
+
+// MAX_MESSAGE_LEN is the largest message a line source accepts.
+const MAX_MESSAGE_LEN = 4 << 20
+
+type lineSource struct {
+	rc      io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// NewLineSource returns a source for a stream with one JSON message per
+// line, like a BGPStream dump or the RIS Live HTTP stream. Empty lines
+// are skipped.
+func NewLineSource(rc io.ReadCloser) Source {
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64<<10), MAX_MESSAGE_LEN)
+	return &lineSource{rc: rc, scanner: scanner}
+}
+
+func (l *lineSource) Next() ([]byte, error) {
+	for l.scanner.Scan() {
+		if line := l.scanner.Bytes(); len(line) > 0 {
+			return line, nil
+		}
+	}
+	if err := l.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (l *lineSource) Close() error {
+	return l.rc.Close()
+}
+
+type websocketSource struct {
+	ws *websocket.Conn
+}
+
+// DialWebsocket connects to a websocket feed, like RIS Live at
+// wss://ris-live.ripe.net/v1/ws/, and sends it the messages in subscribe.
+// Every websocket message the feed sends is a JSON message.
+func DialWebsocket(url string, subscribe ...[]byte) (Source, error) {
+	ws, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", url, err)
+	}
+	for _, msg := range subscribe {
+		if err := websocket.Message.Send(ws, string(msg)); err != nil {
+			ws.Close()
+			return nil, fmt.Errorf("subscribing to %s: %w", url, err)
+		}
+	}
+	return &websocketSource{ws: ws}, nil
+}
+
+func (w *websocketSource) Next() ([]byte, error) {
+	var msg []byte
+	if err := websocket.Message.Receive(w.ws, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (w *websocketSource) Close() error {
+	return w.ws.Close()
+}
+
+// Client reads the records of a feed. Its Scan, Bytes and Err methods work
+// like the ones of a bufio.Scanner splitting an MRT file with mrt.SplitMrt.
+type Client struct {
+	// ErrorHandler, if set, is called with the messages that could not be
+	// decoded. Those messages are skipped.
+	ErrorHandler func(msg []byte, err error)
+
+	src     Source
+	decode  DecodeFunc
+	records []*Record
+	rec     *Record
+	err     error
+}
+
+// NewClient creates a client that decodes the messages of src with decode.
+func NewClient(src Source, decode DecodeFunc) *Client {
+	return &Client{src: src, decode: decode}
+}
+
+// Scan advances to the next record. It returns false when the feed ends
+// or can't be read.
+func (c *Client) Scan() bool {
+	for len(c.records) == 0 {
+		if c.err != nil {
+			c.rec = nil
+			return false
+		}
+		msg, err := c.src.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.err = err
+			}
+			c.rec = nil
+			return false
+		}
+		recs, err := c.decode(msg)
+		if err != nil {
+			if c.ErrorHandler != nil {
+				c.ErrorHandler(msg, err)
+			}
+			continue
+		}
+		c.records = recs
+	}
+	c.rec, c.records = c.records[0], c.records[1:]
+	return true
+}
+
+// Record returns the record of the last Scan.
+func (c *Client) Record() *Record {
+	return c.rec
+}
+
+// Bytes returns the MRT record of the last Scan.
+func (c *Client) Bytes() []byte {
+	if c.rec == nil {
+		return nil
+	}
+	return c.rec.MRT
+}
+
+// Err returns the error that stopped Scan, or nil if the feed ended.
+func (c *Client) Err() error {
+	return c.err
+}
+
+// Close closes the source of the client.
+func (c *Client) Close() error {
+	return c.src.Close()
+}
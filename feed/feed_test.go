@@ -0,0 +1,221 @@
+package feed
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/filter"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+	"golang.org/x/net/websocket"
+)
+
+const risUpdate = `{"type":"ris_message","data":{"timestamp":1550000000.25,"peer":"192.0.2.1","peer_asn":"65001","id":"x","host":"rrc21","type":"UPDATE",
+"path":[65001,3356,[64512,64513]],"community":[[65001,100],[3356,2]],"origin":"IGP","med":10,"aggregator":"64512:192.0.2.9","atomic_aggregate":true,
+"announcements":[{"next_hop":"192.0.2.1","prefixes":["10.0.0.0/8","10.1.0.0/16"]},{"next_hop":"2001:db8::1,fe80::1","prefixes":["2001:db8:1::/48"]}],
+"withdrawals":["172.16.0.0/12","2001:db8:2::/48"]}}`
+
+func routes(t *testing.T, rec *Record, adv bool) []string {
+	mbs, err := rec.Headers()
+	if err != nil {
+		t.Fatalf("record does not parse: %s", err)
+	}
+	var rs []mrt.Route
+	if adv {
+		rs, _ = mrt.GetAdvertisedPrefixes(mbs)
+	} else {
+		rs, _ = mrt.GetWithdrawnPrefixes(mbs)
+	}
+	ret := []string{}
+	for _, r := range rs {
+		ret = append(ret, r.String())
+	}
+	return ret
+}
+
+func TestDecodeRISLive(t *testing.T) {
+	recs, err := DecodeRISLive([]byte(risUpdate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the IPv4 and IPv6 withdrawals, and one update per announcement
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(recs))
+	}
+	if w := routes(t, recs[0], false); strings.Join(w, " ") != "172.16.0.0/12 2001:db8:2::/48" {
+		t.Errorf("bad withdrawn routes %v", w)
+	}
+	if a := routes(t, recs[1], true); strings.Join(a, " ") != "10.0.0.0/8 10.1.0.0/16" {
+		t.Errorf("bad advertised routes %v", a)
+	}
+	if a := routes(t, recs[2], true); strings.Join(a, " ") != "2001:db8:1::/48" {
+		t.Errorf("bad advertised IPv6 routes %v", a)
+	}
+
+	r := recs[1]
+	if r.Collector != "rrc21" || r.PeerAS != 65001 || !r.Time.Equal(time.Unix(1550000000, 250000000)) {
+		t.Errorf("bad record %s %d %s", r.Collector, r.PeerAS, r.Time)
+	}
+	c, err := r.Capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Peer_AS != 65001 || !net.IP(util.GetIP(c.Peer_IP)).Equal(net.ParseIP("192.0.2.1")) || c.Timestamp != 1550000000 {
+		t.Errorf("bad capture header %v", c)
+	}
+	attrs := c.Update.Attrs
+	if len(attrs.ASPath) != 2 || len(attrs.ASPath[0].ASSeq) != 2 || len(attrs.ASPath[1].ASSet) != 2 {
+		t.Errorf("bad AS path %v", attrs.ASPath)
+	}
+	if attrs.MultiExit != 10 || attrs.Aggregator.AS != 64512 {
+		t.Errorf("bad attributes %v", attrs)
+	}
+	if len(attrs.Communities.Communities) != 1 || hex.EncodeToString(attrs.Communities.Communities[0].Community) != "fde900640d1c0002" {
+		t.Errorf("bad communities %v", attrs.Communities)
+	}
+	if !net.IP(util.GetIP(attrs.NextHop)).Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("bad next hop %v", attrs.NextHop)
+	}
+
+	c6, err := recs[2].Capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !net.IP(util.GetIP(c6.Update.Attrs.NextHop)).Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("bad IPv6 next hop %v", c6.Update.Attrs.NextHop)
+	}
+}
+
+func TestDecodeRISLiveRaw(t *testing.T) {
+	body := []byte{0, 0, 0, 14, 0x40, 1, 1, 0, 0x40, 2, 6, 2, 1, 0, 0, 0xfd, 0xe9, 0x40, 3, 4, 192, 0, 2, 1}
+	body[3] = byte(len(body) - 4)
+	body = append(body, 8, 10)
+	msg := bgp.NewMessage(bgp.MSG_UPDATE, body)
+	data, _ := json.Marshal(map[string]interface{}{
+		"timestamp": 1550000000.0, "peer": "192.0.2.1", "peer_asn": "65001", "host": "rrc00",
+		"type": "UPDATE", "raw": hex.EncodeToString(msg),
+	})
+	recs, err := DecodeRISLive(data) //without an envelope
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	if a := routes(t, recs[0], true); len(a) != 1 || a[0] != "10.0.0.0/8" {
+		t.Errorf("bad advertised routes %v", a)
+	}
+
+	for _, m := range []string{`{"type":"ris_message","data":{"type":"KEEPALIVE"}}`, `{"type":"pong","data":null}`} {
+		if recs, err := DecodeRISLive([]byte(m)); err != nil || len(recs) != 0 {
+			t.Errorf("expected no records for %s, got %d %v", m, len(recs), err)
+		}
+	}
+	if _, err := DecodeRISLive([]byte(`{"type":"ris_error","data":{"message":"bad subscription"}}`)); err == nil || !strings.Contains(err.Error(), "bad subscription") {
+		t.Errorf("expected the RIS Live error, got %v", err)
+	}
+}
+
+const bgpstreamElems = `{"type":"A","time":1500000000.5,"project":"ris","collector":"rrc00","peer_address":"2001:db8::5","peer_asn":65005,"fields":{"prefix":"10.0.0.0/8","next-hop":"2001:db8::5","as-path":"65005 3356 {64512,64513}","communities":["65005:1","65005:2:3"]}}
+
+{"type":"W","time":1500000001,"project":"ris","collector":"rrc00","peer_address":"192.0.2.5","peer_asn":65005,"fields":{"prefix":"2001:db8::/32"}}
+{"type":"S","time":1500000002,"project":"ris","collector":"rrc00","peer_address":"192.0.2.5","peer_asn":65005,"fields":{"old-state":"established","new-state":"idle"}}
+{"type":"A","time":1500000003,"peer_address":"192.0.2.5","peer_asn":65005,"fields":{"prefix":"10.0.0.0/33"}}
+{"type":"R","time":1500000004,"project":"routeviews","collector":"route-views2","peer_address":"192.0.2.6","peer_asn":3356,"fields":{"prefix":"192.0.2.0/24","next-hop":"192.0.2.6","as-path":"3356 15169","communities":[{"asn":3356,"value":3}]}}
+`
+
+func TestLineClient(t *testing.T) {
+	c := NewClient(NewLineSource(ioutil.NopCloser(strings.NewReader(bgpstreamElems))), DecodeBGPStream)
+	defer c.Close()
+	bad := 0
+	c.ErrorHandler = func(msg []byte, err error) {
+		bad++
+	}
+	recs := []*Record{}
+	for c.Scan() {
+		recs = append(recs, c.Record())
+	}
+	if c.Err() != nil {
+		t.Fatal(c.Err())
+	}
+	if bad != 1 || len(recs) != 3 {
+		t.Fatalf("expected 3 records and 1 bad elem, got %d and %d", len(recs), bad)
+	}
+
+	// IPv4 prefix from an IPv6 peer, in an MP_REACH
+	if a := routes(t, recs[0], true); len(a) != 1 || a[0] != "10.0.0.0/8" {
+		t.Errorf("bad advertised routes %v", a)
+	}
+	c0, err := recs[0].Capture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c0.Update.Attrs.ASPath) != 2 || c0.Update.Attrs.ASPath[1].ASSet[1] != 64513 {
+		t.Errorf("bad AS path %v", c0.Update.Attrs.ASPath)
+	}
+	if w := routes(t, recs[1], false); len(w) != 1 || w[0] != "2001:db8::/32" {
+		t.Errorf("bad withdrawn routes %v", w)
+	}
+	if recs[2].Collector != "route-views2" {
+		t.Errorf("bad collector %s", recs[2].Collector)
+	}
+
+	// the records go through filters like MRT ones
+	f, _ := filter.NewASFilterFromSlice([]uint32{15169}, filter.AS_SOURCE)
+	n := 0
+	for _, r := range recs {
+		if mbs, err := r.Headers(); err == nil && f.Match(mbs) {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected 1 record originated by AS15169, got %d", n)
+	}
+}
+
+func TestWebsocketClient(t *testing.T) {
+	subscribed := make(chan string, 1)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var sub string
+		websocket.Message.Receive(ws, &sub)
+		subscribed <- sub
+		websocket.Message.Send(ws, `{"type":"ris_subscribe_ok","data":{}}`)
+		websocket.Message.Send(ws, risUpdate)
+		websocket.Message.Send(ws, `{"type":"ris_message","data":{"type":"UPDATE","peer":"nope"}}`)
+	}))
+	defer srv.Close()
+
+	sub := &RISSubscription{Host: "rrc21", Prefix: "10.0.0.0/8", MoreSpecific: true, IncludeRaw: true}
+	src, err := DialWebsocket("ws"+strings.TrimPrefix(srv.URL, "http"), sub.Message())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(src, DecodeRISLive)
+	defer c.Close()
+	bad := 0
+	c.ErrorHandler = func(msg []byte, err error) {
+		bad++
+	}
+	n := 0
+	for c.Scan() {
+		if _, err := mrt.ParseHeaders(c.Bytes(), false); err != nil {
+			t.Errorf("record does not parse: %s", err)
+		}
+		n++
+	}
+	if n != 3 || bad != 1 {
+		t.Errorf("expected 3 records and 1 bad message, got %d and %d", n, bad)
+	}
+	got := <-subscribed
+	want := `{"type":"ris_subscribe","data":{"host":"rrc21","prefix":"10.0.0.0/8","moreSpecific":true,"socketOptions":{"includeRaw":true}}}`
+	if got != want {
+		t.Errorf("bad subscription message %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package feed
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// RIS_LIVE_URL is the websocket endpoint of RIPE RIS Live.
+const RIS_LIVE_URL = "wss://ris-live.ripe.net/v1/ws/"
+
+// risEnvelope is a message of the RIS Live protocol.
+type risEnvelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type risAnnouncement struct {
+	NextHop  string   `json:"next_hop"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// risMessage is the data of a ris_message.
+type risMessage struct {
+	Timestamp       float64           `json:"timestamp"`
+	Peer            string            `json:"peer"`
+	PeerASN         json.Number       `json:"peer_asn"`
+	Host            string            `json:"host"`
+	Type            string            `json:"type"`
+	Path            []json.RawMessage `json:"path"`
+	Community       [][2]uint32       `json:"community"`
+	LargeCommunity  [][3]uint32       `json:"large_community"`
+	Origin          string            `json:"origin"`
+	MED             *uint32           `json:"med"`
+	LocalPref       *uint32           `json:"local_pref"`
+	AtomicAggregate bool              `json:"atomic_aggregate"`
+	Aggregator      string            `json:"aggregator"`
+	Announcements   []risAnnouncement `json:"announcements"`
+	Withdrawals     []string          `json:"withdrawals"`
+	Raw             string            `json:"raw"`
+	Message         string            `json:"message"`
+}
+
+// DecodeRISLive decodes a RIS Live message. It accepts the ris_message and
+// ris_error envelopes of the websocket protocol and bare message data, as
+// in the HTTP stream. UPDATE messages are decoded, from their raw bytes if
+// the subscription included them, and other messages have no records. A
+// ris_error is returned as an error.
+func DecodeRISLive(msg []byte) ([]*Record, error) {
+	env := risEnvelope{}
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return nil, fmt.Errorf("malformed RIS Live message: %w", err)
+	}
+	data := []byte(env.Data)
+	switch {
+	case env.Data == nil: //the data of a ris_message without its envelope
+		data = msg
+	case env.Type == "ris_message":
+	case env.Type == "ris_error":
+		m := risMessage{}
+		json.Unmarshal(data, &m)
+		return nil, fmt.Errorf("RIS Live error: %s", m.Message)
+	default: //pong, ris_subscribe_ok and such
+		return nil, nil
+	}
+	m := risMessage{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("malformed RIS Live message data: %w", err)
+	}
+	if m.Type != "UPDATE" {
+		return nil, nil
+	}
+	peer, err := parseIP(m.Peer)
+	if err != nil {
+		return nil, err
+	}
+	peerAS, err := strconv.ParseUint(string(m.PeerASN), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("malformed peer ASN %q", m.PeerASN)
+	}
+	ts := floatTime(m.Timestamp)
+	if m.Raw != "" {
+		return risRaw(&m, ts, peer, uint32(peerAS))
+	}
+	base := newUpdate(peer)
+	if base.origin, err = parseOrigin(m.Origin); err != nil {
+		return nil, err
+	}
+	if base.path, err = risPath(m.Path); err != nil {
+		return nil, err
+	}
+	base.med, base.localPref, base.atomicAggregate = m.MED, m.LocalPref, m.AtomicAggregate
+	if m.Aggregator != "" {
+		i := strings.Index(m.Aggregator, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("malformed aggregator %q", m.Aggregator)
+		}
+		as, err := strconv.ParseUint(m.Aggregator[:i], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed aggregator %q", m.Aggregator)
+		}
+		if base.aggregatorIP, err = parseIP(m.Aggregator[i+1:]); err != nil {
+			return nil, err
+		}
+		base.aggregatorAS = uint32(as)
+	}
+	for _, c := range m.Community {
+		if c[0] > 0xffff || c[1] > 0xffff {
+			return nil, fmt.Errorf("community %d:%d does not fit in 4 bytes", c[0], c[1])
+		}
+		base.communities = append(base.communities, c[0]<<16|c[1])
+	}
+	base.largeCommunities = m.LargeCommunity
+
+	//every announcement has its own next hop, so it goes in its own update
+	recs := []*Record{}
+	withdrawn := newUpdate(peer)
+	for _, w := range m.Withdrawals {
+		p, err := parsePrefix(w)
+		if err != nil {
+			return nil, err
+		}
+		withdrawn.withdrawn = append(withdrawn.withdrawn, p)
+	}
+	recs = append(recs, newRecords(m.Host, ts, peer, uint32(peerAS), withdrawn)...)
+	for _, a := range m.Announcements {
+		u := *base
+		u.announced = nil
+		if u.nextHop, err = parseNextHop(a.NextHop); err != nil {
+			return nil, err
+		}
+		for _, s := range a.Prefixes {
+			p, err := parsePrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			u.announced = append(u.announced, p)
+		}
+		recs = append(recs, newRecords(m.Host, ts, peer, uint32(peerAS), &u)...)
+	}
+	return recs, nil
+}
+
+// risPath decodes a path of ASes and arrays of ASes for the AS_SETs.
+func risPath(path []json.RawMessage) ([]pathSegment, error) {
+	segs := []pathSegment{}
+	for _, raw := range path {
+		var as uint32
+		if err := json.Unmarshal(raw, &as); err == nil {
+			segs = appendSequence(segs, as)
+			continue
+		}
+		set := []uint32{}
+		if err := json.Unmarshal(raw, &set); err != nil {
+			return nil, fmt.Errorf("malformed AS path element %s", raw)
+		}
+		segs = append(segs, pathSegment{set: true, ases: set})
+	}
+	return segs, nil
+}
+
+// risRaw uses the raw BGP message of an update.
+func risRaw(m *risMessage, ts time.Time, peer net.IP, peerAS uint32) ([]*Record, error) {
+	msg, err := hex.DecodeString(m.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("malformed raw message: %w", err)
+	}
+	if _, mlen, err := bgp.ReadMessageHeader(msg); err != nil {
+		return nil, err
+	} else if mlen != len(msg) {
+		return nil, fmt.Errorf("raw message has %d bytes after the BGP message", len(msg)-mlen)
+	}
+	peering := &mrt.BGP4MPPeering{PeerIP: peer, PeerAS: peerAS}
+	return []*Record{{
+		Collector: m.Host,
+		Time:      ts,
+		Peer:      peer,
+		PeerAS:    peerAS,
+		MRT:       mrt.NewBGP4MPMessage(ts, peering, true, msg),
+	}}, nil
+}
+
+// RISSubscription is the filter of a RIS Live subscription. Empty fields
+// don't filter.
+type RISSubscription struct {
+	Host         string `json:"host,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Require      string `json:"require,omitempty"`
+	Peer         string `json:"peer,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Prefix       string `json:"prefix,omitempty"`
+	MoreSpecific bool   `json:"moreSpecific,omitempty"`
+	LessSpecific bool   `json:"lessSpecific,omitempty"`
+	// IncludeRaw asks for the raw BGP messages, which decode exactly.
+	IncludeRaw bool `json:"-"`
+}
+
+// Message returns the ris_subscribe message for the subscription.
+func (s *RISSubscription) Message() []byte {
+	type options struct {
+		IncludeRaw bool `json:"includeRaw"`
+	}
+	data := struct {
+		*RISSubscription
+		SocketOptions *options `json:"socketOptions,omitempty"`
+	}{RISSubscription: s}
+	if s.IncludeRaw {
+		data.SocketOptions = &options{IncludeRaw: true}
+	}
+	msg, _ := json.Marshal(struct {
+		Type string      `json:"type"`
+		Data interface{} `json:"data"`
+	}{"ris_subscribe", data})
+	return msg
+}
@@ -0,0 +1,398 @@
+package feed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+)
+
+// path attribute type codes used when encoding updates
+const (
+	attrOrigin          = 1
+	attrASPath          = 2
+	attrNextHop         = 3
+	attrMED             = 4
+	attrLocalPref       = 5
+	attrAtomicAggregate = 6
+	attrAggregator      = 7
+	attrCommunity       = 8
+	attrMPReach         = 14
+	attrMPUnreach       = 15
+	attrLargeCommunity  = 32
+)
+
+// the most prefixes encoded in one message, which keeps messages of
+// IPv6 prefixes under the 4096 byte BGP limit
+const MAX_PREFIXES_PER_MESSAGE = 200
+
+// pathSegment is an AS_SEQUENCE or an AS_SET.
+type pathSegment struct {
+	set  bool
+	ases []uint32
+}
+
+// appendSequence adds an AS to the AS_SEQUENCE at the end of a path.
+func appendSequence(segs []pathSegment, as uint32) []pathSegment {
+	if len(segs) == 0 || segs[len(segs)-1].set {
+		segs = append(segs, pathSegment{})
+	}
+	segs[len(segs)-1].ases = append(segs[len(segs)-1].ases, as)
+	return segs
+}
+
+// update holds the routes and attributes of an update as JSON feeds
+// describe them, to be encoded as the BGP messages a collector would
+// have received.
+type update struct {
+	peer   net.IP
+	origin int //-1 if not present
+	path   []pathSegment
+	// the global next hop and an optional link local one
+	nextHop          []net.IP
+	med              *uint32
+	localPref        *uint32
+	atomicAggregate  bool
+	aggregatorAS     uint32
+	aggregatorIP     net.IP
+	communities      []uint32
+	largeCommunities [][3]uint32
+	announced        []*net.IPNet
+	withdrawn        []*net.IPNet
+}
+
+func newUpdate(peer net.IP) *update {
+	return &update{peer: peer, origin: -1}
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+// prefixGroup is a set of prefixes that go in the same NLRI field.
+type prefixGroup struct {
+	v4       bool
+	reach    bool
+	classic  bool //not in an MP attribute
+	prefixes []*net.IPNet
+}
+
+// groups splits the prefixes of the update in the NLRI fields they are
+// encoded in. IPv4 prefixes use the fields of the message itself when the
+// session and the next hop are IPv4, and everything else MP_REACH and
+// MP_UNREACH.
+func (u *update) groups() []*prefixGroup {
+	v4peer := isIPv4(u.peer)
+	classicReach := v4peer && len(u.nextHop) > 0 && isIPv4(u.nextHop[0])
+	var ret []*prefixGroup
+	add := func(g *prefixGroup, p *net.IPNet) {
+		if len(g.prefixes) == 0 {
+			ret = append(ret, g)
+		}
+		g.prefixes = append(g.prefixes, p)
+	}
+	wv4 := &prefixGroup{v4: true, classic: v4peer}
+	wv6 := &prefixGroup{}
+	for _, p := range u.withdrawn {
+		if isIPv4(p.IP) {
+			add(wv4, p)
+		} else {
+			add(wv6, p)
+		}
+	}
+	av4 := &prefixGroup{v4: true, reach: true, classic: classicReach}
+	av6 := &prefixGroup{reach: true}
+	for _, p := range u.announced {
+		if isIPv4(p.IP) {
+			add(av4, p)
+		} else {
+			add(av6, p)
+		}
+	}
+	//split the large ones
+	split := []*prefixGroup{}
+	for _, g := range ret {
+		for len(g.prefixes) > MAX_PREFIXES_PER_MESSAGE {
+			c := *g
+			c.prefixes = g.prefixes[:MAX_PREFIXES_PER_MESSAGE]
+			split = append(split, &c)
+			g.prefixes = g.prefixes[MAX_PREFIXES_PER_MESSAGE:]
+		}
+		split = append(split, g)
+	}
+	return split
+}
+
+// messages encodes the update as BGP UPDATE messages with 4 byte AS
+// paths. More than one message is needed when the prefixes don't fit in
+// the NLRI fields of one, in which case the attributes are repeated.
+func (u *update) messages() [][]byte {
+	type slots struct {
+		withdrawn, nlri, mpReach, mpUnreach *prefixGroup
+	}
+	msgs := []*slots{}
+	for _, g := range u.groups() {
+		var placed bool
+		for _, m := range msgs {
+			slot := &m.mpUnreach
+			switch {
+			case g.classic && g.reach:
+				slot = &m.nlri
+			case g.classic:
+				slot = &m.withdrawn
+			case g.reach:
+				slot = &m.mpReach
+			}
+			if *slot == nil {
+				*slot, placed = g, true
+				break
+			}
+		}
+		if !placed {
+			m := &slots{}
+			switch {
+			case g.classic && g.reach:
+				m.nlri = g
+			case g.classic:
+				m.withdrawn = g
+			case g.reach:
+				m.mpReach = g
+			default:
+				m.mpUnreach = g
+			}
+			msgs = append(msgs, m)
+		}
+	}
+	ret := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		var attrs []byte
+		if m.nlri != nil || m.mpReach != nil {
+			attrs = u.attributes(m.nlri != nil, m.mpReach)
+		}
+		if m.mpUnreach != nil {
+			val := []byte{0, 2, 1}
+			if m.mpUnreach.v4 {
+				val[1] = 1
+			}
+			attrs = append(attrs, attribute(0x80, attrMPUnreach, append(val, encodePrefixes(m.mpUnreach)...))...)
+		}
+		if m.nlri != nil || m.mpReach != nil {
+			//zero length attributes end the attribute decoding, so they go last
+			if len(u.path) == 0 {
+				attrs = append(attrs, attribute(0x40, attrASPath, nil)...)
+			}
+			if u.atomicAggregate {
+				attrs = append(attrs, attribute(0x40, attrAtomicAggregate, nil)...)
+			}
+		}
+		wdr := encodePrefixes(m.withdrawn)
+		body := make([]byte, 2, 4+len(wdr)+len(attrs))
+		binary.BigEndian.PutUint16(body, uint16(len(wdr)))
+		body = append(body, wdr...)
+		body = append(body, byte(len(attrs)>>8), byte(len(attrs)))
+		body = append(body, attrs...)
+		body = append(body, encodePrefixes(m.nlri)...)
+		ret = append(ret, bgp.NewMessage(bgp.MSG_UPDATE, body))
+	}
+	return ret
+}
+
+// attributes encodes the path attributes of the announced routes, with a
+// NEXT_HOP if the message has IPv4 NLRI and an MP_REACH for mp if it is
+// not nil.
+func (u *update) attributes(nlri bool, mp *prefixGroup) []byte {
+	attrs := []byte{}
+	if u.origin >= 0 {
+		attrs = append(attrs, attribute(0x40, attrOrigin, []byte{byte(u.origin)})...)
+	}
+	path := []byte{}
+	for _, seg := range u.path {
+		ases := seg.ases
+		for len(ases) > 0 { //segments hold at most 255 ASes
+			n := len(ases)
+			if n > 255 {
+				n = 255
+			}
+			stype := byte(2)
+			if seg.set {
+				stype = 1
+			}
+			path = append(path, stype, byte(n))
+			for _, as := range ases[:n] {
+				path = append(path, byte(as>>24), byte(as>>16), byte(as>>8), byte(as))
+			}
+			ases = ases[n:]
+		}
+	}
+	if len(path) > 0 {
+		attrs = append(attrs, attribute(0x40, attrASPath, path)...)
+	}
+	if nlri {
+		attrs = append(attrs, attribute(0x40, attrNextHop, u.nextHop[0].To4())...)
+	}
+	if u.med != nil {
+		attrs = append(attrs, attribute(0x80, attrMED, uint32Bytes(*u.med))...)
+	}
+	if u.localPref != nil {
+		attrs = append(attrs, attribute(0x40, attrLocalPref, uint32Bytes(*u.localPref))...)
+	}
+	if u.aggregatorIP != nil {
+		val := uint32Bytes(u.aggregatorAS)
+		if ip := u.aggregatorIP.To4(); ip != nil {
+			val = append(val, ip...)
+		} else {
+			val = append(val, u.aggregatorIP.To16()...)
+		}
+		attrs = append(attrs, attribute(0xc0, attrAggregator, val)...)
+	}
+	if len(u.communities) > 0 {
+		val := []byte{}
+		for _, c := range u.communities {
+			val = append(val, uint32Bytes(c)...)
+		}
+		attrs = append(attrs, attribute(0xc0, attrCommunity, val)...)
+	}
+	if mp != nil {
+		val := []byte{0, 2, 1}
+		if mp.v4 {
+			val[1] = 1
+		}
+		nh := []byte{}
+		if len(u.nextHop) == 0 { //the feed didn't have one
+			nh = net.IPv6zero
+			if mp.v4 {
+				nh = net.IPv4zero.To4()
+			}
+		}
+		for _, ip := range u.nextHop {
+			if len(u.nextHop) == 1 && isIPv4(ip) {
+				nh = append(nh, ip.To4()...)
+			} else {
+				nh = append(nh, ip.To16()...)
+			}
+		}
+		val = append(val, byte(len(nh)))
+		val = append(val, nh...)
+		val = append(val, 0) //no SNPAs
+		attrs = append(attrs, attribute(0x80, attrMPReach, append(val, encodePrefixes(mp)...))...)
+	}
+	if len(u.largeCommunities) > 0 {
+		val := []byte{}
+		for _, c := range u.largeCommunities {
+			val = append(val, uint32Bytes(c[0])...)
+			val = append(val, uint32Bytes(c[1])...)
+			val = append(val, uint32Bytes(c[2])...)
+		}
+		attrs = append(attrs, attribute(0xc0, attrLargeCommunity, val)...)
+	}
+	return attrs
+}
+
+// attribute encodes a path attribute, with an extended length if needed.
+func attribute(flags, atype uint8, val []byte) []byte {
+	if len(val) > 255 {
+		ret := []byte{flags | 0x10, atype, byte(len(val) >> 8), byte(len(val))}
+		return append(ret, val...)
+	}
+	return append([]byte{flags, atype, byte(len(val))}, val...)
+}
+
+func encodePrefixes(g *prefixGroup) []byte {
+	if g == nil {
+		return nil
+	}
+	ret := []byte{}
+	for _, p := range g.prefixes {
+		ones, _ := p.Mask.Size()
+		ip := p.IP.To16()
+		if g.v4 {
+			ip = p.IP.To4()
+		}
+		ret = append(ret, byte(ones))
+		ret = append(ret, ip[:(ones+7)/8]...)
+	}
+	return ret
+}
+
+func uint32Bytes(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// parsePrefix parses a prefix in CIDR notation.
+func parsePrefix(s string) (*net.IPNet, error) {
+	_, p, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("malformed prefix %q", s)
+	}
+	return p, nil
+}
+
+// parseIP parses an address that must be present.
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return nil, fmt.Errorf("malformed IP address %q", s)
+	}
+	return ip, nil
+}
+
+// parseNextHop parses a next hop that may have a link local address after
+// the global one, separated by a comma.
+func parseNextHop(s string) ([]net.IP, error) {
+	ret := []net.IP{}
+	for _, part := range strings.Split(s, ",") {
+		ip, err := parseIP(part)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ip)
+	}
+	if len(ret) > 2 {
+		return nil, fmt.Errorf("malformed next hop %q", s)
+	}
+	return ret, nil
+}
+
+// parseOrigin parses the names of the ORIGIN values in any case.
+func parseOrigin(s string) (int, error) {
+	switch strings.ToUpper(s) {
+	case "":
+		return -1, nil
+	case "IGP":
+		return 0, nil
+	case "EGP":
+		return 1, nil
+	case "INCOMPLETE":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unknown origin %q", s)
+}
+
+// parseCommunity parses an "AS:value" community or an "AS:value:value"
+// large community.
+func (u *update) parseCommunity(s string) error {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	vals := make([]uint32, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return fmt.Errorf("malformed community %q", s)
+		}
+		vals[i] = uint32(v)
+	}
+	switch len(vals) {
+	case 2:
+		if vals[0] > 0xffff || vals[1] > 0xffff {
+			return fmt.Errorf("community %q does not fit in 4 bytes", s)
+		}
+		u.communities = append(u.communities, vals[0]<<16|vals[1])
+	case 3:
+		u.largeCommunities = append(u.largeCommunities, [3]uint32{vals[0], vals[1], vals[2]})
+	default:
+		return fmt.Errorf("malformed community %q", s)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package fileutil
+
+import (
+	"github.com/CSUNetSec/protoparse/feed"
+	"github.com/CSUNetSec/protoparse/filter"
+)
+
+// NewFeedReader wraps a feed client in a reader that returns the updates
+// of the feed that pass filters as BGP captures, like the reader returned
+// by NewMrtFileReader. Closing the reader closes the client.
+func NewFeedReader(c *feed.Client, filters []filter.Filter) *mrtReader {
+	return &mrtReader{
+		in:      c,
+		scanner: c,
+		filters: filters,
+	}
+}
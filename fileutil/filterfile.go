@@ -2,27 +2,106 @@ package fileutil
 
 import (
 	"encoding/json"
+	"fmt"
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
 	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/hijack"
 	"github.com/pkg/errors"
 	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 // FilterFile structs should be populated
-// straight from a json object
+// straight from a json object. A message passes a file if it passes all of
+// its filters and nested files, and the files are checked by
+// ParseFilterFile when they are read.
 type FilterFile struct {
+	// the version of the format, up to FILTERFILE_VERSION, only at the
+	// top. Files without one only have MonitoredPrefixes and the AS lists
+	Version int
+	// prefixes the messages are for
 	MonitoredPrefixes []string
-	SourceASes        []uint32
-	DestASes          []uint32
-	MidPathASes       []uint32
-	AnywhereASes      []uint32
+	// where MonitoredPrefixes are looked for, "advertised" (the default),
+	// "withdrawn" or "any"
+	PrefixLocation string
+	// how MonitoredPrefixes match, one of the names of filter.PrefixMatch
+	PrefixMatch string
+	// bounds on the length of matching prefixes, 0 for none
+	PrefixMinLength uint8
+	PrefixMaxLength uint8
+	// ASes that originate, receive, transit or are anywhere in the path
+	SourceASes   []uint32
+	DestASes     []uint32
+	MidPathASes  []uint32
+	AnywhereASes []uint32
+	// ranges one of which has the timestamp of the message
+	TimeRanges []TimeRange
+	// addresses or prefixes of the peer
+	Peers []string
+	// ASes of the peer
+	PeerASes []uint32
+	// addresses of the collector
+	Collectors []string
+	// communities one of which is in the message, like 65000:* or
+	// NO_EXPORT, 65000:1:2 and rt:65000:100, see filter.NewCommunityFilter
+	Communities      []string
+	LargeCommunities []string
+	ExtCommunities   []string
+	// ORIGIN values, IGP, EGP or INCOMPLETE
+	OriginTypes []string
+	// addresses or prefixes of the next hop
+	NextHops []string
+	// comparisons all of which the attributes pass
+	Attributes []AttrComparison
+	// nested files, the message passes all of And, one of Or if there are
+	// any and not Not, like {"Or": [{"SourceASes": [64512]}, {"Not": {"PeerASes": [174]}}]}
+	And []FilterFile
+	Or  []FilterFile
+	Not *FilterFile
+	// a filter expression, see filter.Compile
+	Expr string
 }
 
-// XXX getFilters now only filters on advertized prefixes. we need to pass an option from filterfile on what
-// types it should invoke
+// AttrComparison compares a numeric attribute, one of the names of
+// filter.Attribute, to a value with a comparison operator like <=.
+type AttrComparison struct {
+	Attribute string
+	Op        string
+	Value     uint32
+}
+
+// TimeRange is a range of timestamps from Start up to End, in RFC 3339 or
+// in seconds since the epoch. Either can be left out for no bound.
+type TimeRange struct {
+	Start string
+	End   string
+}
+
+// getFilters builds the filters of a file that has been validated.
 func (f FilterFile) getFilters() ([]filter.Filter, error) {
 	ret := []filter.Filter{}
 	if len(f.MonitoredPrefixes) > 0 {
-		if fil, err := filter.NewPrefixFilterFromSlice(f.MonitoredPrefixes, filter.AdvPrefix); err != nil {
+		opts := filter.PrefixMatchOptions{MinLength: f.PrefixMinLength, MaxLength: f.PrefixMaxLength}
+		if f.PrefixMatch != "" {
+			m, err := filter.ParsePrefixMatch(f.PrefixMatch)
+			if err != nil {
+				return nil, errors.Wrap(err, "can not create prefix filter from conf")
+			}
+			opts.Match = m
+		}
+		loc := filter.AdvPrefix
+		if f.PrefixLocation != "" {
+			l, err := filter.ParsePrefixLocation(f.PrefixLocation)
+			if err != nil {
+				return nil, errors.Wrap(err, "can not create prefix filter from conf")
+			}
+			loc = l
+		}
+		if fil, err := filter.NewPrefixMatchFilter(f.MonitoredPrefixes, loc, opts); err != nil {
 			return nil, errors.Wrap(err, "can not create prefix filter from conf")
 		} else {
 			ret = append(ret, fil)
@@ -37,7 +116,7 @@ func (f FilterFile) getFilters() ([]filter.Filter, error) {
 	}
 
 	if len(f.DestASes) > 0 {
-		if fil, err := filter.NewASFilterFromSlice(f.SourceASes, filter.AS_DESTINATION); err != nil {
+		if fil, err := filter.NewASFilterFromSlice(f.DestASes, filter.AS_DESTINATION); err != nil {
 			return nil, errors.Wrap(err, "can not create destination AS filter from conf")
 		} else {
 			ret = append(ret, fil)
@@ -45,7 +124,7 @@ func (f FilterFile) getFilters() ([]filter.Filter, error) {
 	}
 
 	if len(f.MidPathASes) > 0 {
-		if fil, err := filter.NewASFilterFromSlice(f.SourceASes, filter.AS_MIDPATH); err != nil {
+		if fil, err := filter.NewASFilterFromSlice(f.MidPathASes, filter.AS_MIDPATH); err != nil {
 			return nil, errors.Wrap(err, "can not create midpath AS filter from conf")
 		} else {
 			ret = append(ret, fil)
@@ -53,23 +132,579 @@ func (f FilterFile) getFilters() ([]filter.Filter, error) {
 	}
 
 	if len(f.AnywhereASes) > 0 {
-		if fil, err := filter.NewASFilterFromSlice(f.SourceASes, filter.AS_ANYWHERE); err != nil {
+		if fil, err := filter.NewASFilterFromSlice(f.AnywhereASes, filter.AS_ANYWHERE); err != nil {
 			return nil, errors.Wrap(err, "can not create anywhere AS filter from conf")
 		} else {
 			ret = append(ret, fil)
 		}
 	}
+
+	if len(f.TimeRanges) > 0 {
+		windows := make([]filter.Filter, len(f.TimeRanges))
+		for i, tr := range f.TimeRanges {
+			start, end, err := tr.bounds()
+			if err != nil {
+				return nil, errors.Wrapf(err, "TimeRanges[%d]", i)
+			}
+			windows[i] = filter.NewTimeFilter(start, end)
+		}
+		ret = append(ret, filter.Or(windows...))
+	}
+
+	if len(f.Peers) > 0 {
+		if fil, err := filter.NewPeerFilter(f.Peers); err != nil {
+			return nil, errors.Wrap(err, "can not create peer filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if len(f.PeerASes) > 0 {
+		ret = append(ret, filter.NewPeerASFilter(f.PeerASes))
+	}
+
+	if len(f.Collectors) > 0 {
+		if fil, err := filter.NewCollectorFilter(f.Collectors); err != nil {
+			return nil, errors.Wrap(err, "can not create collector filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if len(f.Communities) > 0 {
+		if fil, err := filter.NewCommunityFilter(f.Communities); err != nil {
+			return nil, errors.Wrap(err, "can not create community filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if len(f.LargeCommunities) > 0 {
+		if fil, err := filter.NewLargeCommunityFilter(f.LargeCommunities); err != nil {
+			return nil, errors.Wrap(err, "can not create large community filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if len(f.ExtCommunities) > 0 {
+		if fil, err := filter.NewExtendedCommunityFilter(f.ExtCommunities); err != nil {
+			return nil, errors.Wrap(err, "can not create extended community filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if len(f.OriginTypes) > 0 {
+		origins := make([]pbbgp.BGPUpdate_Attributes_Origin, len(f.OriginTypes))
+		for i, o := range f.OriginTypes {
+			var err error
+			if origins[i], err = filter.ParseOriginType(o); err != nil {
+				return nil, errors.Wrap(err, "can not create origin type filter from conf")
+			}
+		}
+		ret = append(ret, filter.NewOriginTypeFilter(origins...))
+	}
+
+	if len(f.NextHops) > 0 {
+		if fil, err := filter.NewNextHopFilter(f.NextHops); err != nil {
+			return nil, errors.Wrap(err, "can not create next hop filter from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	for i, ac := range f.Attributes {
+		attr, err := filter.ParseAttribute(ac.Attribute)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Attributes[%d]", i)
+		}
+		cmp, err := filter.ParseComparison(ac.Op)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Attributes[%d]", i)
+		}
+		ret = append(ret, filter.NewAttrFilter(attr, cmp, ac.Value))
+	}
+
+	for i, sub := range f.And {
+		fils, err := sub.getFilters()
+		if err != nil {
+			return nil, errors.Wrapf(err, "And[%d]", i)
+		}
+		ret = append(ret, filter.And(fils...))
+	}
+
+	if len(f.Or) > 0 {
+		ors := make([]filter.Filter, 0, len(f.Or))
+		for i, sub := range f.Or {
+			fils, err := sub.getFilters()
+			if err != nil {
+				return nil, errors.Wrapf(err, "Or[%d]", i)
+			}
+			ors = append(ors, filter.And(fils...))
+		}
+		ret = append(ret, filter.Or(ors...))
+	}
+
+	if f.Expr != "" {
+		if fil, err := filter.Compile(f.Expr, nil); err != nil {
+			return nil, errors.Wrap(err, "can not compile filter expression from conf")
+		} else {
+			ret = append(ret, fil)
+		}
+	}
+
+	if f.Not != nil {
+		fils, err := f.Not.getFilters()
+		if err != nil {
+			return nil, errors.Wrap(err, "Not")
+		}
+		ret = append(ret, filter.Not(filter.And(fils...)))
+	}
 	return ret, nil
 }
 
+// NewFiltersFromFile reads the filter file a and returns its filters. The
+// file is checked with ParseFilterFile first.
 func NewFiltersFromFile(a string) ([]filter.Filter, error) {
-	var ff FilterFile
-	if contents, err := ioutil.ReadFile(a); err != nil {
+	contents, err := ioutil.ReadFile(a)
+	if err != nil {
 		return nil, err
-	} else {
-		if err := json.Unmarshal(contents, &ff); err != nil {
-			return nil, errors.Wrap(err, "json unmarshal")
-		}
+	}
+	ff, err := ParseFilterFile(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, a)
 	}
 	return ff.getFilters()
 }
+
+// monitoredPrefixes returns the MonitoredPrefixes of the file and of the
+// files in its And and Or, the prefixes it watches. Those of Not are not.
+func (f FilterFile) monitoredPrefixes() []string {
+	ret := append([]string(nil), f.MonitoredPrefixes...)
+	for _, sub := range f.And {
+		ret = append(ret, sub.monitoredPrefixes()...)
+	}
+	for _, sub := range f.Or {
+		ret = append(ret, sub.monitoredPrefixes()...)
+	}
+	return ret
+}
+
+// NewDetectorFromFile reads the filter file a and returns a hijack
+// detector for its MonitoredPrefixes, and those of the files in its And
+// and Or. The detector expects no origins until it is configured or
+// learns them from a baseline RIB, see LearnFromRibFile.
+func NewDetectorFromFile(a string) (*hijack.Detector, error) {
+	contents, err := ioutil.ReadFile(a)
+	if err != nil {
+		return nil, err
+	}
+	ff, err := ParseFilterFile(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, a)
+	}
+	prefixes := ff.monitoredPrefixes()
+	if len(prefixes) == 0 {
+		return nil, errors.Errorf("%s: no MonitoredPrefixes for a detector", a)
+	}
+	return hijack.NewDetector(prefixes)
+}
+
+// FILTERFILE_VERSION is the latest version of the filter file format.
+// Files without a Version are of the format from before it was versioned,
+// and can only have legacyKeys.
+const FILTERFILE_VERSION = 1
+
+// legacyKeys are the keys of files without a Version.
+var legacyKeys = []string{"MonitoredPrefixes", "SourceASes", "DestASes", "MidPathASes", "AnywhereASes"}
+
+// FilterFileError is an error in a filter file, at Path, the keys and list
+// indices that lead to the bad key or value like Or[1].SourceASes[0].
+type FilterFileError struct {
+	Path string
+	Msg  string
+}
+
+func (e *FilterFileError) Error() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+func fileErrorf(path, format string, args ...interface{}) error {
+	return &FilterFileError{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+// ParseFilterFile parses and checks a filter file. Unknown keys, values of
+// the wrong type and values the filters can not be built from are
+// returned as a *FilterFileError.
+func ParseFilterFile(data []byte) (*FilterFile, error) {
+	if err := checkJSON(data, reflect.TypeOf(FilterFile{}), ""); err != nil {
+		return nil, err
+	}
+	ff := &FilterFile{}
+	if err := json.Unmarshal(data, ff); err != nil {
+		return nil, errors.Wrap(err, "json unmarshal")
+	}
+	if ff.Version < 0 || ff.Version > FILTERFILE_VERSION {
+		return nil, fileErrorf("Version", "unsupported version %d, expected up to %d", ff.Version, FILTERFILE_VERSION)
+	}
+	if ff.Version == 0 {
+		if err := checkLegacyKeys(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := ff.validate(""); err != nil {
+		return nil, err
+	}
+	return ff, nil
+}
+
+// checkLegacyKeys checks that a file without a Version only has
+// legacyKeys.
+func checkLegacyKeys(data []byte) error {
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return errors.Wrap(err, "json unmarshal")
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+keys:
+	for _, k := range keys {
+		if strings.EqualFold(k, "Version") {
+			continue
+		}
+		for _, l := range legacyKeys {
+			if strings.EqualFold(k, l) {
+				continue keys
+			}
+		}
+		return fileErrorf(k, "needs \"Version\": %d at the top of the file", FILTERFILE_VERSION)
+	}
+	return nil
+}
+
+// join returns the path of key in the object at path.
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// checkJSON checks that raw can be unmarshaled into a value of type t,
+// with no keys that are not fields of t or of the structs in it. Keys
+// match fields ignoring case, like they do for json.Unmarshal.
+func checkJSON(raw json.RawMessage, t reflect.Type, path string) error {
+	if string(raw) == "null" {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return checkJSON(raw, t.Elem(), path)
+	case reflect.Struct:
+		obj := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return fileErrorf(path, "expected %s, found %s", describeType(t), describeJSON(raw))
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, ok := t.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, k) })
+			if !ok {
+				return fileErrorf(join(path, k), "unknown key%s", suggestKey(k, t))
+			}
+			if err := checkJSON(obj[k], field.Type, join(path, field.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		elems := []json.RawMessage{}
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return fileErrorf(path, "expected %s, found %s", describeType(t), describeJSON(raw))
+		}
+		for i, e := range elems {
+			if err := checkJSON(e, t.Elem(), index(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := json.Unmarshal(raw, reflect.New(t).Interface()); err != nil {
+		return fileErrorf(path, "expected %s, found %s", describeType(t), describeJSON(raw))
+	}
+	return nil
+}
+
+// suggestKey returns a suggestion of the field of t that key is closest
+// to, if one is close.
+func suggestKey(key string, t reflect.Type) string {
+	best, dist := "", 4
+	for i := 0; i < t.NumField(); i++ {
+		n := t.Field(i).Name
+		if d := editDistance(strings.ToLower(key), strings.ToLower(n)); d < dist {
+			best, dist = n, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// describeType describes the JSON values of type t, like a list of
+// strings.
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return describeType(t.Elem())
+	case reflect.Slice:
+		return "a list of " + describeTypes(t.Elem())
+	case reflect.Struct:
+		return "an object"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("a whole number from 0 to %d", uint64(1)<<t.Bits()-1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "a whole number"
+	}
+	return t.String()
+}
+
+// describeTypes is describeType in the plural, for lists.
+func describeTypes(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return describeTypes(t.Elem())
+	case reflect.Slice:
+		return "lists of " + describeTypes(t.Elem())
+	case reflect.Struct:
+		return "objects"
+	case reflect.String:
+		return "strings"
+	case reflect.Bool:
+		return "booleans"
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("whole numbers from 0 to %d", uint64(1)<<t.Bits()-1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "whole numbers"
+	}
+	return t.String() + " values"
+}
+
+// describeJSON describes raw for messages, showing it if it is short.
+func describeJSON(raw json.RawMessage) string {
+	if len(raw) <= 32 {
+		return string(raw)
+	}
+	switch raw[0] {
+	case '{':
+		return "an object"
+	case '[':
+		return "a list"
+	case '"':
+		return "a long string"
+	}
+	return string(raw[:32]) + "..."
+}
+
+// validate checks the values of a file at path and the files in it.
+func (f FilterFile) validate(path string) error {
+	if path != "" && f.Version != 0 {
+		return fileErrorf(join(path, "Version"), "only the top of the file has a version")
+	}
+	for i, p := range f.MonitoredPrefixes {
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return fileErrorf(index(join(path, "MonitoredPrefixes"), i), "malformed prefix %q", p)
+		}
+	}
+	if len(f.MonitoredPrefixes) == 0 {
+		opts := []struct {
+			key string
+			set bool
+		}{
+			{"PrefixLocation", f.PrefixLocation != ""},
+			{"PrefixMatch", f.PrefixMatch != ""},
+			{"PrefixMinLength", f.PrefixMinLength != 0},
+			{"PrefixMaxLength", f.PrefixMaxLength != 0},
+		}
+		for _, o := range opts {
+			if o.set {
+				return fileErrorf(join(path, o.key), "there are no MonitoredPrefixes for it to apply to")
+			}
+		}
+	}
+	if f.PrefixLocation != "" {
+		if _, err := filter.ParsePrefixLocation(f.PrefixLocation); err != nil {
+			return fileErrorf(join(path, "PrefixLocation"), "unknown location %q, expected advertised, withdrawn or any", f.PrefixLocation)
+		}
+	}
+	if f.PrefixMatch != "" {
+		if _, err := filter.ParsePrefixMatch(f.PrefixMatch); err != nil {
+			return fileErrorf(join(path, "PrefixMatch"), "unknown match mode %q, expected or-longer, exact, more-specific, less-specific or covering", f.PrefixMatch)
+		}
+	}
+	if f.PrefixMinLength > 128 {
+		return fileErrorf(join(path, "PrefixMinLength"), "%d is longer than any prefix", f.PrefixMinLength)
+	}
+	if f.PrefixMaxLength > 128 {
+		return fileErrorf(join(path, "PrefixMaxLength"), "%d is longer than any prefix", f.PrefixMaxLength)
+	}
+	if f.PrefixMaxLength != 0 && f.PrefixMinLength > f.PrefixMaxLength {
+		return fileErrorf(join(path, "PrefixMinLength"), "%d is more than PrefixMaxLength %d", f.PrefixMinLength, f.PrefixMaxLength)
+	}
+	for i, tr := range f.TimeRanges {
+		if _, _, err := tr.bounds(); err != nil {
+			return fileErrorf(index(join(path, "TimeRanges"), i), "%s", err)
+		}
+	}
+	// lists of values that the filter constructors check one by one
+	lists := []struct {
+		key  string
+		vals []string
+		newf func([]string) (filter.Filter, error)
+	}{
+		{"Peers", f.Peers, filter.NewPeerFilter},
+		{"Collectors", f.Collectors, filter.NewCollectorFilter},
+		{"Communities", f.Communities, filter.NewCommunityFilter},
+		{"LargeCommunities", f.LargeCommunities, filter.NewLargeCommunityFilter},
+		{"ExtCommunities", f.ExtCommunities, filter.NewExtendedCommunityFilter},
+		{"NextHops", f.NextHops, filter.NewNextHopFilter},
+	}
+	for _, l := range lists {
+		for i, v := range l.vals {
+			if _, err := l.newf([]string{v}); err != nil {
+				return fileErrorf(index(join(path, l.key), i), "%s", err)
+			}
+		}
+	}
+	for i, o := range f.OriginTypes {
+		if _, err := filter.ParseOriginType(o); err != nil {
+			return fileErrorf(index(join(path, "OriginTypes"), i), "%s", err)
+		}
+	}
+	for i, ac := range f.Attributes {
+		p := index(join(path, "Attributes"), i)
+		if _, err := filter.ParseAttribute(ac.Attribute); err != nil {
+			return fileErrorf(join(p, "Attribute"), "%s", err)
+		}
+		if _, err := filter.ParseComparison(ac.Op); err != nil {
+			return fileErrorf(join(p, "Op"), "unknown comparison %q, expected one of ==, !=, <, <=, >, >=", ac.Op)
+		}
+	}
+	if f.Expr != "" {
+		if _, err := filter.Compile(f.Expr, nil); err != nil {
+			return fileErrorf(join(path, "Expr"), "%s", err)
+		}
+	}
+	// an empty file would pass every message, which is never what an And,
+	// Or or Not entry is meant for, and an empty Or passes none
+	if f.Or != nil && len(f.Or) == 0 {
+		return fileErrorf(join(path, "Or"), "empty list, no message would pass it")
+	}
+	for i, sub := range f.And {
+		if err := sub.validateNested(index(join(path, "And"), i)); err != nil {
+			return err
+		}
+	}
+	for i, sub := range f.Or {
+		if err := sub.validateNested(index(join(path, "Or"), i)); err != nil {
+			return err
+		}
+	}
+	if f.Not != nil {
+		return f.Not.validateNested(join(path, "Not"))
+	}
+	return nil
+}
+
+// validateNested validates a file nested at path, which must not be empty.
+func (f FilterFile) validateNested(path string) error {
+	if f.isEmpty() {
+		return fileErrorf(path, "empty filter file")
+	}
+	return f.validate(path)
+}
+
+// isEmpty returns whether the file has no filters, like {} or
+// {"SourceASes": []}.
+func (f FilterFile) isEmpty() bool {
+	v := reflect.ValueOf(f)
+	for i := 0; i < v.NumField(); i++ {
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Slice {
+			if fv.Len() > 0 {
+				return false
+			}
+		} else if !fv.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// bounds returns the start and end of the range, zero if they are left
+// out.
+func (tr TimeRange) bounds() (start, end time.Time, err error) {
+	if tr.Start == "" && tr.End == "" {
+		return start, end, errors.New("a time range needs a Start or an End")
+	}
+	if tr.Start != "" {
+		if start, err = filter.ParseTime(tr.Start); err != nil {
+			return start, end, errors.Errorf("malformed Start %q, expected RFC 3339 or seconds since the epoch", tr.Start)
+		}
+	}
+	if tr.End != "" {
+		if end, err = filter.ParseTime(tr.End); err != nil {
+			return start, end, errors.Errorf("malformed End %q, expected RFC 3339 or seconds since the epoch", tr.End)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return start, end, errors.Errorf("End %s is not after Start %s", tr.End, tr.Start)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,125 @@
+package fileutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// updateMessage returns an update that advertises the IPv4 prefix with an
+// AS4 path of ases, or withdraws it if there are none.
+func updateMessage(prefix string, ases ...uint32) []byte {
+	_, n, _ := net.ParseCIDR(prefix)
+	ones, _ := n.Mask.Size()
+	routes := append([]byte{byte(ones)}, n.IP.To4()[:(ones+7)/8]...)
+	if len(ases) == 0 {
+		body := []byte{0, byte(len(routes))}
+		body = append(body, routes...)
+		return bgp.NewMessage(bgp.MSG_UPDATE, append(body, 0, 0))
+	}
+	path := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}
+	attrs = append(attrs, path...)
+	attrs = append(attrs, 0x40, 3, 4, 192, 0, 2, 1)
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	return bgp.NewMessage(bgp.MSG_UPDATE, append(body, routes...))
+}
+
+// updateStack returns the headers of a record of the update of
+// updateMessage that AS3356 sent from 192.0.2.1.
+func updateStack(t *testing.T, prefix string, ases ...uint32) *mrt.MrtBufferStack {
+	peering := &mrt.BGP4MPPeering{PeerAS: 3356, PeerIP: net.ParseIP("192.0.2.1")}
+	mbs, err := mrt.ParseHeaders(mrt.NewBGP4MPMessage(time.Unix(1500000000, 0), peering, true, updateMessage(prefix, ases...)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mbs
+}
+
+func fileFilters(t *testing.T, data string) []filter.Filter {
+	ff, err := ParseFilterFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fils, err := ff.getFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fils
+}
+
+func TestFilterFile(t *testing.T) {
+	adv := updateStack(t, "10.1.0.0/16", 3356, 174, 64512)
+	wdr := updateStack(t, "10.1.0.0/16")
+	cases := []struct {
+		file     string
+		adv, wdr bool
+	}{
+		{`{"MonitoredPrefixes": ["10.0.0.0/8"]}`, true, false},
+		{`{"Version": 1, "MonitoredPrefixes": ["10.0.0.0/8"], "PrefixLocation": "withdrawn"}`, false, true},
+		{`{"Version": 1, "MonitoredPrefixes": ["10.0.0.0/8"], "PrefixLocation": "any"}`, true, true},
+		{`{"DestASes": [3356]}`, true, false},
+		{`{"DestASes": [64512]}`, false, false},
+		{`{"MidPathASes": [174]}`, true, false},
+		{`{"AnywhereASes": [64512]}`, true, false},
+		{`{"Version": 1, "SourceASes": [64512], "PeerASes": [3356], "Peers": ["192.0.2.0/24"]}`, true, false},
+		{`{"Version": 1, "TimeRanges": [{"End": "1400000000"}, {"Start": "2017-07-14T02:00:00Z", "End": "2017-07-14T03:00:00Z"}]}`, true, true},
+		{`{"Version": 1, "TimeRanges": [{"Start": "2017-07-14T03:00:00Z"}]}`, false, false},
+	}
+	for _, c := range cases {
+		fils := fileFilters(t, c.file)
+		if filter.FilterAll(fils, adv) != c.adv || filter.FilterAll(fils, wdr) != c.wdr {
+			t.Errorf("%s: expected %v %v", c.file, c.adv, c.wdr)
+		}
+	}
+}
+
+func TestFilterFileErrors(t *testing.T) {
+	cases := []struct {
+		file, msg string
+	}{
+		{`{"SourceAS": [1]}`, `SourceAS: unknown key, did you mean SourceASes?`},
+		{`{"Or": [{}, {"Not": {"Prefixes": []}}]}`, `Or[1].Not.Prefixes: unknown key`},
+		{`{"SourceASes": [1, "2"]}`, `SourceASes[1]: expected a whole number from 0 to 4294967295, found "2"`},
+		{`{"PrefixMinLength": 300}`, `PrefixMinLength: expected a whole number from 0 to 255, found 300`},
+		{`{"Peers": "192.0.2.1"}`, `Peers: expected a list of strings, found "192.0.2.1"`},
+		{`{"And": {}}`, `And: expected a list of objects, found {}`},
+		{`{"Version": 2}`, `Version: unsupported version 2, expected up to 1`},
+		{`{"Version": 1, "And": [{"Version": 1}]}`, `And[0].Version: only the top of the file has a version`},
+		{`{"MonitoredPrefixes": ["10.0.0.0/8", "10.0.0/8"]}`, `MonitoredPrefixes[1]: malformed prefix "10.0.0/8"`},
+		{`{"Version": 1, "PrefixMatch": "exact"}`, `PrefixMatch: there are no MonitoredPrefixes for it to apply to`},
+		{`{"Version": 1, "MonitoredPrefixes": ["10.0.0.0/8"], "PrefixLocation": "both"}`, `PrefixLocation: unknown location "both"`},
+		{`{"Version": 1, "MonitoredPrefixes": ["10.0.0.0/8"], "PrefixMinLength": 24, "PrefixMaxLength": 16}`, `PrefixMinLength: 24 is more than PrefixMaxLength 16`},
+		{`{"Version": 1, "Communities": ["65000:1", "65000:x"]}`, `Communities[1]: malformed community "65000:x"`},
+		{`{"Version": 1, "TimeRanges": [{"Start": "2020-01-02T00:00:00Z", "End": "2020-01-01T00:00:00Z"}]}`, `TimeRanges[0]: End 2020-01-01T00:00:00Z is not after Start`},
+		{`{"Version": 1, "Attributes": [{"Attribute": "med", "Op": "=>", "Value": 1}]}`, `Attributes[0].Op: unknown comparison "=>"`},
+		{`{"Version": 1, "Expr": "origin 1 or"}`, `Expr: filter expression column 12: expected a predicate`},
+		{`{"Version": 1, "Or": [{"SourceASes": [1]}, {}]}`, `Or[1]: empty filter file`},
+		{`{"Version": 1, "And": [{"SourceASes": []}]}`, `And[0]: empty filter file`},
+		{`{"Version": 1, "Not": {}}`, `Not: empty filter file`},
+		{`{"Version": 1, "Or": []}`, `Or: empty list`},
+		{`{"Peers": ["192.0.2.1"]}`, `Peers: needs "Version": 1 at the top of the file`},
+	}
+	for _, c := range cases {
+		_, err := ParseFilterFile([]byte(c.file))
+		var fe *FilterFileError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected a filter file error, got %v", c.file, err)
+			continue
+		}
+		if got := fe.Error(); len(got) < len(c.msg) || got[:len(c.msg)] != c.msg {
+			t.Errorf("%s: expected %q, got %q", c.file, c.msg, got)
+		}
+	}
+}
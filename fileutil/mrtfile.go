@@ -3,19 +3,33 @@ package fileutil
 import (
 	"bufio"
 	"compress/bzip2"
+	"encoding/binary"
 	monpb "github.com/CSUNetSec/netsec-protobufs/bgpmon/v2"
 	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/hijack"
 	"github.com/CSUNetSec/protoparse/protocol/mrt"
 	"github.com/pkg/errors"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+// recordScanner returns MRT records, like a bufio.Scanner splitting an
+// MRT file or a pcap.Reader.
+type recordScanner interface {
+	Scan() bool
+	Bytes() []byte
+	Err() error
+}
+
 type mrtReader struct {
-	in         io.ReadCloser
-	scanner    *bufio.Scanner
+	in         io.Closer
+	scanner    recordScanner
 	filters    []filter.Filter
+	window     *filter.TimeWindow
+	detector   *hijack.Detector
+	emit       func(hijack.Event)
 	err        error
 	lastTok    *monpb.BGPCapture
 	lastTokErr error
@@ -60,10 +74,27 @@ rescan:
 		return false //this error will be checked on the Err() call
 	}
 	bytes := m.scanner.Bytes()
+	if m.window != nil && len(bytes) >= 4 { //the timestamp is the first field of the MRT header
+		ts := time.Unix(int64(binary.BigEndian.Uint32(bytes[:4])), 0)
+		if m.window.Relative() { //relative windows start at the first record
+			m.window = m.window.Anchor(ts)
+		}
+		if m.window.Past(ts) {
+			return false
+		}
+		if !m.window.Contains(ts) {
+			goto rescan
+		}
+	}
 	if mbs, err := mrt.ParseHeaders(bytes, false); err != nil { //false for no rib.
 		m.lastTok = nil
 		m.lastTokErr = errors.Wrap(err, "parseHeaders")
 	} else {
+		if m.detector != nil && m.emit != nil { //the detector sees the records the filters drop too
+			for _, ev := range m.detector.Check(mbs) {
+				m.emit(ev)
+			}
+		}
 		if filter.FilterAll(m.filters, mbs) { //passes filters?
 			if pb, err := mrt.MrtToBGPCapturev2(m.scanner.Bytes()); err != nil {
 				m.lastTok = nil
@@ -79,6 +110,22 @@ rescan:
 	return true
 }
 
+//SetTimeWindow makes Scan skip the records outside of w, and finish at the
+//first record past its end. That is only right if the records are in time
+//order, like in the update dumps of collectors. A relative window is
+//anchored at the timestamp of the first record Scan reads.
+func (m *mrtReader) SetTimeWindow(w *filter.TimeWindow) {
+	m.window = w
+}
+
+//SetDetector makes Scan check every record in the time window with d,
+//whether it passes the filters or not, and call emit with the hijacks it
+//finds before Scan returns. A nil d or emit turns the checks off.
+func (m *mrtReader) SetDetector(d *hijack.Detector, emit func(hijack.Event)) {
+	m.detector = d
+	m.emit = emit
+}
+
 //GetCapture returns the current scanned capture along with a possible error while
 //unmarshalling it from the binary data.
 func (m *mrtReader) GetCapture() (*monpb.BGPCapture, error) {
@@ -0,0 +1,88 @@
+package fileutil
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/hijack"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// testUpdates writes an update file with an update that advertises
+// 10.0.0.0/8 at each of the offsets from 1500000000.
+func testUpdates(t *testing.T, offsets ...time.Duration) string {
+	msg := updateMessage("10.0.0.0/8", 3356, 64512)
+	peering := &mrt.BGP4MPPeering{PeerAS: 3356, PeerIP: net.ParseIP("192.0.2.1"), LocalIP: net.ParseIP("192.0.2.254")}
+	var data []byte
+	for _, off := range offsets {
+		data = append(data, mrt.NewBGP4MPMessage(time.Unix(1500000000, 0).Add(off), peering, true, msg)...)
+	}
+	fname := filepath.Join(t.TempDir(), "updates")
+	if err := os.WriteFile(fname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestTimeWindow(t *testing.T) {
+	fname := testUpdates(t, 0, 5*time.Minute, 10*time.Minute, 15*time.Minute, 20*time.Minute)
+	cases := []struct {
+		name   string
+		window *filter.TimeWindow
+		scans  int
+	}{
+		{"absolute", filter.NewTimeWindow(time.Unix(1500000300, 0), time.Unix(1500000900, 0)), 2},
+		{"relative to the first record", filter.NewRelativeTimeWindow(5*time.Minute, 15*time.Minute), 2},
+		{"open relative", filter.NewRelativeTimeWindow(10*time.Minute, 0), 3},
+	}
+	for _, c := range cases {
+		r, err := NewMrtFileReader(fname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetTimeWindow(c.window)
+		scans := 0
+		for r.Scan() {
+			if _, err := r.GetCapture(); err != nil {
+				t.Errorf("%s: %s", c.name, err)
+			}
+			scans++
+		}
+		r.Close()
+		if scans != c.scans || r.Err() != nil {
+			t.Errorf("%s: scanned %d records, expected %d: %v", c.name, scans, c.scans, r.Err())
+		}
+	}
+}
+
+func TestScanDetector(t *testing.T) {
+	fname := testUpdates(t, 0, time.Minute)
+	d, err := hijack.NewDetector([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Expect("10.0.0.0/8", 174); err != nil {
+		t.Fatal(err)
+	}
+	var evs []hijack.Event
+	for _, emit := range []func(hijack.Event){func(ev hijack.Event) { evs = append(evs, ev) }, nil} {
+		r, err := NewMrtFileReader(fname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetDetector(d, emit)
+		for r.Scan() {
+		}
+		r.Close()
+		if r.Err() != nil {
+			t.Error(r.Err())
+		}
+	}
+	if len(evs) != 2 || evs[0].Type != hijack.EVENT_MOAS {
+		t.Errorf("bad events %v", evs)
+	}
+}
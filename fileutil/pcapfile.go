@@ -0,0 +1,35 @@
+package fileutil
+
+import (
+	"compress/bzip2"
+	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/protocol/pcap"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// NewPcapFileReader creates a wrapper around an open pcap or pcapng file that
+// returns the BGP updates of the sessions in the capture as BGP captures.
+// It is used like the reader returned by NewMrtFileReader.
+func NewPcapFileReader(fname string, filters []filter.Filter) (*mrtReader, error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return nil, errors.Wrap(err, "open")
+	}
+	var in io.Reader = fp
+	if filepath.Ext(fname) == ".bz2" {
+		in = bzip2.NewReader(fp)
+	}
+	pr, err := pcap.NewReader(in)
+	if err != nil {
+		fp.Close()
+		return nil, errors.Wrap(err, "pcap")
+	}
+	return &mrtReader{
+		in:      fp,
+		scanner: pr,
+		filters: filters,
+	}, nil
+}
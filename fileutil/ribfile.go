@@ -0,0 +1,59 @@
+package fileutil
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/CSUNetSec/protoparse"
+	"github.com/CSUNetSec/protoparse/hijack"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	"github.com/pkg/errors"
+)
+
+// ScanRibFile calls fn with each IPv4 and IPv6 RIB entry of a
+// TABLE_DUMP_V2 file, like the RIB dumps of collectors, and stops at the
+// first error fn returns. Records of other types are skipped.
+func ScanRibFile(fname string, fn func(*mrt.MrtBufferStack) error) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	defer fp.Close()
+	var index protoparse.PbVal
+	scanner := getScanner(fp)
+	for n := 1; scanner.Scan(); n++ {
+		data := scanner.Bytes()
+		if len(data) < mrt.MRT_HEADER_LEN || binary.BigEndian.Uint16(data[4:6]) != mrt.TABLE_DUMP_V2 {
+			continue
+		}
+		subtype := binary.BigEndian.Uint16(data[6:8])
+		if subtype == mrt.PEER_INDEX_TABLE {
+			mbs, err := mrt.ParseHeaders(data, true)
+			if err != nil {
+				return errors.Wrapf(err, "%s: record %d", fname, n)
+			}
+			index = mbs.Ribbuf
+			continue
+		}
+		if subtype < mrt.RIB_IPV4_UNICAST || subtype > mrt.RIB_IPV6_MULTICAST {
+			continue
+		}
+		if index == nil {
+			return errors.Errorf("%s: record %d: RIB entry before the peer index table", fname, n)
+		}
+		mbs, err := mrt.ParseRibHeaders(data, index)
+		if err != nil {
+			return errors.Wrapf(err, "%s: record %d", fname, n)
+		}
+		if err := fn(mbs); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// LearnFromRibFile makes d expect the origins of the entries of a
+// baseline RIB in a TABLE_DUMP_V2 file.
+func LearnFromRibFile(d *hijack.Detector, fname string) error {
+	return ScanRibFile(fname, d.Learn)
+}
@@ -0,0 +1,73 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// testRib writes a TABLE_DUMP_V2 file with the peer 192.0.2.1 AS3356 and
+// an entry of 10.0.0.0/8 with path 3356 64512.
+func testRib(t *testing.T) string {
+	ts := time.Unix(1500000000, 0)
+	index := []byte{
+		192, 0, 2, 254, // collector BGP ID
+		0, 0, // view name
+		0, 1, // peer count
+		0x2, 192, 0, 2, 1, 192, 0, 2, 1, 0, 0, 0x0d, 0x1c, // AS4 IPv4 peer
+	}
+	attrs := []byte{
+		0x40, 1, 1, 0, // ORIGIN IGP
+		0x40, 2, 10, 2, 2, 0, 0, 0x0d, 0x1c, 0, 0, 0xfc, 0x00, // AS_PATH 3356 64512
+		0x40, 3, 4, 192, 0, 2, 1, // NEXT_HOP
+	}
+	entry := []byte{
+		0, 0, 0, 0, // sequence
+		8, 10, // 10.0.0.0/8
+		0, 1, // entry count
+		0, 0, 0x59, 0x68, 0x2f, 0x00, 0, byte(len(attrs)),
+	}
+	var data []byte
+	data = append(data, mrt.NewMrtRecord(ts, mrt.TABLE_DUMP_V2, mrt.PEER_INDEX_TABLE, index)...)
+	data = append(data, mrt.NewMrtRecord(ts, mrt.TABLE_DUMP_V2, mrt.RIB_IPV4_UNICAST, append(entry, attrs...))...)
+	fname := filepath.Join(t.TempDir(), "rib")
+	if err := os.WriteFile(fname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func TestDetectorFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	ffile := filepath.Join(dir, "filter.json")
+	if err := os.WriteFile(ffile, []byte(`{"Version": 1, "Or": [{"MonitoredPrefixes": ["10.0.0.0/8"]}, {"SourceASes": [174]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDetectorFromFile(ffile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := 0
+	if err := ScanRibFile(testRib(t), func(*mrt.MrtBufferStack) error { entries++; return nil }); err != nil || entries != 1 {
+		t.Fatalf("scanned %d entries: %v", entries, err)
+	}
+	if err := LearnFromRibFile(d, testRib(t)); err != nil {
+		t.Fatal(err)
+	}
+	if evs := d.Check(updateStack(t, "10.1.0.0/16", 3356, 64512)); len(evs) != 0 {
+		t.Errorf("unexpected %v", evs)
+	}
+	if evs := d.Check(updateStack(t, "10.1.0.0/16", 3356, 64666)); len(evs) != 1 || evs[0].Expected != "10.0.0.0/8" {
+		t.Errorf("expected a sub-prefix event, got %v", evs)
+	}
+
+	if err := os.WriteFile(ffile, []byte(`{"SourceASes": [174]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDetectorFromFile(ffile); err == nil {
+		t.Errorf("detector without prefixes")
+	}
+}
@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// pathBoundary is what the underscore of router AS path regexes matches:
+// the start or end of the path or a separator between ASes.
+const pathBoundary = `(?:^|$|[ ,{}()])`
+
+// ASPathRegex matches AS paths with a router style regular expression,
+// like ^174_.*_13335$ or _[0-9]+_65000$. The path is matched as text, the
+// ASes in decimal separated by spaces from the neighbor AS to the origin,
+// with the ASes of an AS_SET between braces and separated by commas as in
+// {64512,64513}. An underscore matches the start or end of the path or
+// any separator, and the rest is the RE2 syntax of the regexp package, so
+// the braces of AS_SETs must be escaped to match them literally.
+type ASPathRegex struct {
+	expr string
+	re   *regexp.Regexp
+	name string
+}
+
+// CompileASPathRegex compiles a router style AS path regex.
+func CompileASPathRegex(expr string) (*ASPathRegex, error) {
+	for i, r := range expr {
+		if !strings.ContainsRune(`0123456789_^$.*+?[]()|{},- \`, r) {
+			return nil, fmt.Errorf("unexpected character %q at %d in AS path regex %q", r, i+1, expr)
+		}
+	}
+	re, err := regexp.Compile(strings.Replace(expr, "_", pathBoundary, -1))
+	if err != nil {
+		// the error quotes the rewritten regex, so only its code is kept
+		if serr, ok := err.(*syntax.Error); ok {
+			return nil, fmt.Errorf("malformed AS path regex %q: %s", expr, serr.Code)
+		}
+		return nil, fmt.Errorf("malformed AS path regex %q: %w", expr, err)
+	}
+	return &ASPathRegex{expr: expr, re: re, name: "path ~ " + expr}, nil
+}
+
+func (r *ASPathRegex) String() string {
+	return r.expr
+}
+
+// MatchPath matches a path of AS_SEQUENCEs, like the one GetASPath
+// returns.
+func (r *ASPathRegex) MatchPath(path []uint32) bool {
+	buf := make([]byte, 0, len(path)*6)
+	for i, as := range path {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendUint(buf, uint64(as), 10)
+	}
+	return r.re.Match(buf)
+}
+
+// MatchSegments matches the AS_PATH of an update.
+func (r *ASPathRegex) MatchSegments(segs []*pbbgp.BGPUpdate_ASPathSegment) bool {
+	return r.re.Match(appendSegments(make([]byte, 0, 64), segs))
+}
+
+// appendSegments appends an AS_PATH to buf as text as it is matched.
+func appendSegments(buf []byte, segs []*pbbgp.BGPUpdate_ASPathSegment) []byte {
+	for _, seg := range segs {
+		if len(seg.ASSet) > 0 {
+			if len(buf) > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, '{')
+			for i, as := range seg.ASSet {
+				if i > 0 {
+					buf = append(buf, ',')
+				}
+				buf = strconv.AppendUint(buf, uint64(as), 10)
+			}
+			buf = append(buf, '}')
+			continue
+		}
+		for _, as := range seg.ASSeq {
+			if len(buf) > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = strconv.AppendUint(buf, uint64(as), 10)
+		}
+	}
+	return buf
+}
+
+// NewASPathRegexFilter returns a filter that passes updates whose AS path
+// matches the router style regex expr, and RIB entries where the path of
+// one of the entries does.
+func NewASPathRegexFilter(expr string) (Filter, error) {
+	r, err := CompileASPathRegex(expr)
+	if err != nil {
+		return nil, err
+	}
+	return withCost(r.filter, COST_ATTRS), nil
+}
+
+func (r *ASPathRegex) filter(mbs *mrt.MrtBufferStack, t *trace) bool {
+	attrs, err := mrt.GetAttributes(mbs)
+	if err != nil {
+		return t.explain(r.name, false, err.Error)
+	}
+	for _, a := range attrs {
+		if r.MatchSegments(a.ASPath) {
+			return t.explain(r.name, true, func() string {
+				return "path " + string(appendSegments(nil, a.ASPath))
+			})
+		}
+	}
+	return t.explain(r.name, false, func() string {
+		if len(attrs) == 1 {
+			return "path " + string(appendSegments(nil, attrs[0].ASPath))
+		}
+		return fmt.Sprintf("none of %d paths match", len(attrs))
+	})
+}
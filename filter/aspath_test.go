@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"testing"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+)
+
+func TestASPathRegex(t *testing.T) {
+	cases := []struct {
+		re    string
+		path  []uint32
+		match bool
+	}{
+		{"^174_.*_13335$", []uint32{174, 3356, 13335}, true},
+		{"^174_.*_13335$", []uint32{1174, 3356, 13335}, false},
+		{"_[0-9]+_65000$", []uint32{174, 65000}, true},
+		{"_[0-9]+_65000$", []uint32{65000}, false},
+		{"_3356_", []uint32{174, 3356, 65000}, true},
+		{"_3356_", []uint32{174, 33560}, false},
+		{"^$", []uint32{}, true},
+		{"^(174_)+65000$", []uint32{174, 174, 174, 65000}, true},
+		{"^[0-9]+$", []uint32{65000}, true},
+		{"^6451[2-9]_", []uint32{64515, 1}, true},
+		{"^6451[2-9]_", []uint32{64511, 1}, false},
+		{"^([0-9]+_){2}[0-9]+$", []uint32{1, 2, 3}, true},
+	}
+	for _, c := range cases {
+		r, err := CompileASPathRegex(c.re)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.MatchPath(c.path) != c.match {
+			t.Errorf("%s on %v: expected %v", c.re, c.path, c.match)
+		}
+	}
+
+	// AS_SETs are in braces, and an underscore matches their separators
+	segs := []*pbbgp.BGPUpdate_ASPathSegment{{ASSeq: []uint32{174, 3356}}, {ASSet: []uint32{64512, 64513}}}
+	for re, match := range map[string]bool{
+		"^174_3356__64512_64513_$":   true,
+		"_64513_$":                   true,
+		`^174 3356 \{64512,64513\}$`: true,
+		"_3356$":                     false,
+	} {
+		r, err := CompileASPathRegex(re)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.MatchSegments(segs) != match {
+			t.Errorf("%s on the path with a set: expected %v", re, match)
+		}
+	}
+
+	if _, err := CompileASPathRegex("^174 AS3356"); err == nil {
+		t.Errorf("regex with letters compiled")
+	}
+	if _, err := CompileASPathRegex("^(174_"); err == nil || err.Error() != `malformed AS path regex "^(174_": missing closing )` {
+		t.Errorf("bad error for unbalanced parentheses %v", err)
+	}
+}
+
+func TestASPathRegexFilter(t *testing.T) {
+	f, err := Compile(`path ~ "^3356_.*_64512$" and path !~ _174_`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(testStack(t, "10.0.0.0/8", "3356 1299 64512")) {
+		t.Errorf("path did not match")
+	}
+	if f.Match(testStack(t, "10.0.0.0/8", "3356 174 64512")) || f.Match(testStack(t, "10.0.0.0/8", "3356 {1299,64512}")) {
+		t.Errorf("path matched")
+	}
+	if _, err := Compile(`path ~ "(174"`, nil); err == nil {
+		t.Errorf("bad regex compiled")
+	}
+}
@@ -0,0 +1,233 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+	"github.com/pkg/errors"
+)
+
+// Comparison is a comparison of a number to a value.
+type Comparison int
+
+const (
+	CMP_EQ = Comparison(iota)
+	CMP_NE
+	CMP_LT
+	CMP_LE
+	CMP_GT
+	CMP_GE
+)
+
+var comparisonOps = []string{"==", "!=", "<", "<=", ">", ">="}
+
+func (c Comparison) String() string {
+	if int(c) < len(comparisonOps) {
+		return comparisonOps[c]
+	}
+	return "?"
+}
+
+// ParseComparison parses an operator like <= or >. = is the same as ==.
+func ParseComparison(op string) (Comparison, error) {
+	if op == "=" {
+		return CMP_EQ, nil
+	}
+	for i, o := range comparisonOps {
+		if o == op {
+			return Comparison(i), nil
+		}
+	}
+	return 0, errors.Errorf("unknown comparison %q", op)
+}
+
+// Compare reports whether n compares to val.
+func (c Comparison) Compare(n, val uint32) bool {
+	switch c {
+	case CMP_EQ:
+		return n == val
+	case CMP_NE:
+		return n != val
+	case CMP_LT:
+		return n < val
+	case CMP_LE:
+		return n <= val
+	case CMP_GT:
+		return n > val
+	case CMP_GE:
+		return n >= val
+	}
+	return false
+}
+
+// Attribute is a numeric path attribute, or a number computed from one.
+type Attribute int
+
+const (
+	ATTR_MED = Attribute(iota)
+	ATTR_LOCAL_PREF
+	// the length of the AS path as in the BGP decision process, where an
+	// AS_SET counts as one
+	ATTR_PATH_LENGTH
+)
+
+var attributeNames = []string{"med", "local-pref", "path-length"}
+
+func (a Attribute) String() string {
+	if int(a) < len(attributeNames) {
+		return attributeNames[a]
+	}
+	return "unknown"
+}
+
+// ParseAttribute parses the name of an attribute, med, local-pref or
+// path-length.
+func ParseAttribute(name string) (Attribute, error) {
+	for i, n := range attributeNames {
+		if strings.EqualFold(n, name) {
+			return Attribute(i), nil
+		}
+	}
+	return 0, errors.Errorf("unknown attribute %q, expected one of %s", name, strings.Join(attributeNames, ", "))
+}
+
+// value returns the value of the attribute in attrs, and false if attrs do
+// not have it.
+func (a Attribute) value(attrs *pbbgp.BGPUpdate_Attributes) (uint32, bool) {
+	switch a {
+	case ATTR_MED:
+		return attrs.MultiExit, hasAttr(attrs, pbbgp.BGPUpdate_Attributes_MULTI_EXIT)
+	case ATTR_LOCAL_PREF:
+		return attrs.LocalPref, hasAttr(attrs, pbbgp.BGPUpdate_Attributes_LOCAL_PREF)
+	case ATTR_PATH_LENGTH:
+		l := 0
+		for _, seg := range attrs.ASPath {
+			if len(seg.ASSet) > 0 {
+				l++
+			} else {
+				l += len(seg.ASSeq)
+			}
+		}
+		return uint32(l), hasAttr(attrs, pbbgp.BGPUpdate_Attributes_AS_PATH)
+	}
+	return 0, false
+}
+
+func hasAttr(attrs *pbbgp.BGPUpdate_Attributes, t pbbgp.BGPUpdate_Attributes_Type) bool {
+	for _, at := range attrs.Types {
+		if at == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAttrFilter returns a filter that passes updates that have the
+// attribute attr and where it compares to val, like MED > 1000, and RIB
+// entries where one of the entries does.
+func NewAttrFilter(attr Attribute, cmp Comparison, val uint32) Filter {
+	name := fmt.Sprintf("%s %s %d", attr, cmp, val)
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		attrs, err := mrt.GetAttributes(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, a := range attrs {
+			if n, ok := attr.value(a); ok && cmp.Compare(n, val) {
+				return t.explain(name, true, func() string { return fmt.Sprintf("%s %d", attr, n) })
+			}
+		}
+		return t.explain(name, false, func() string {
+			if len(attrs) != 1 {
+				return noneMatch(len(attrs), "entries")
+			}
+			if n, ok := attr.value(attrs[0]); ok {
+				return fmt.Sprintf("%s %d", attr, n)
+			}
+			return fmt.Sprintf("no %s", attr)
+		})
+	}
+	return withCost(f, COST_ATTRS)
+}
+
+// ParseOriginType parses the ORIGIN attribute values IGP, EGP and
+// INCOMPLETE, or INC.
+func ParseOriginType(s string) (pbbgp.BGPUpdate_Attributes_Origin, error) {
+	name := strings.ToUpper(s)
+	if name == "INCOMPLETE" {
+		name = "INC"
+	}
+	if o, ok := pbbgp.BGPUpdate_Attributes_Origin_value[name]; ok {
+		return pbbgp.BGPUpdate_Attributes_Origin(o), nil
+	}
+	return 0, errors.Errorf("unknown origin %q, expected IGP, EGP or INCOMPLETE", s)
+}
+
+// NewOriginTypeFilter returns a filter that passes updates whose ORIGIN
+// attribute is one of origins.
+func NewOriginTypeFilter(origins ...pbbgp.BGPUpdate_Attributes_Origin) Filter {
+	names := make([]string, len(origins))
+	for i, o := range origins {
+		names[i] = o.String()
+	}
+	name := "origin-type " + strings.Join(names, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		attrs, err := mrt.GetAttributes(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, a := range attrs {
+			if !hasAttr(a, pbbgp.BGPUpdate_Attributes_ORIGIN) {
+				continue
+			}
+			for _, o := range origins {
+				if a.Origin == o {
+					return t.explain(name, true, func() string { return "origin " + o.String() })
+				}
+			}
+		}
+		return t.explain(name, false, func() string {
+			if len(attrs) == 1 && hasAttr(attrs[0], pbbgp.BGPUpdate_Attributes_ORIGIN) {
+				return "origin " + attrs[0].Origin.String()
+			}
+			return noneMatch(len(attrs), "entries")
+		})
+	}
+	return withCost(f, COST_ATTRS)
+}
+
+// NewNextHopFilter returns a filter that passes updates whose next hop is
+// one of the addresses or in one of the prefixes of nextHops. The next hop
+// of MP_REACH_NLRI is the one of updates that have both.
+func NewNextHopFilter(nextHops []string) (Filter, error) {
+	nets, err := parseIPNets(nextHops)
+	if err != nil {
+		return nil, err
+	}
+	name := "next-hop " + strings.Join(nextHops, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		attrs, err := mrt.GetAttributes(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, a := range attrs {
+			if a.NextHop == nil {
+				continue
+			}
+			if nh := net.IP(util.GetIP(a.NextHop)); netsContain(nets, nh) {
+				return t.explain(name, true, func() string { return "next hop " + nh.String() })
+			}
+		}
+		return t.explain(name, false, func() string {
+			if len(attrs) == 1 && attrs[0].NextHop != nil {
+				return "next hop " + net.IP(util.GetIP(attrs[0].NextHop)).String()
+			}
+			return noneMatch(len(attrs), "entries")
+		})
+	}
+	return withCost(f, COST_ATTRS), nil
+}
@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// attrStack returns the headers of an update with the attributes attrs
+// that advertises the IPv4 NLRI routes.
+func attrStack(t *testing.T, routes []byte, attrs ...[]byte) *mrt.MrtBufferStack {
+	body := []byte{0, 0, 0, 0}
+	for _, a := range attrs {
+		body = append(body, a...)
+	}
+	binary.BigEndian.PutUint16(body[2:4], uint16(len(body)-4))
+	return updateStack(t, append(body, routes...))
+}
+
+func TestAttrFilters(t *testing.T) {
+	nh := attr(0x40, 3, []byte{192, 0, 2, 1})
+	a := attrStack(t, []byte{8, 10}, attr(0x40, 1, []byte{2}), asPath("65001 3356 {64512,64513}"), nh, attr(0x80, 4, []byte{0, 0, 0x05, 0xdc}))
+	b := attrStack(t, []byte{8, 10}, attr(0x40, 1, []byte{0}), asPath("65001 1 2 3 4 5 6 7 8 9 10 11"), nh, attr(0x40, 5, []byte{0, 0, 0, 200}))
+	cases := []struct {
+		expr string
+		a, b bool
+	}{
+		{"med > 1000", true, false},
+		{"med <= 1500", true, false},
+		{"med != 0", true, false},
+		{"local-pref == 200", false, true},
+		{"path-length > 10", false, true},
+		{"path-length = 3", true, false},
+		{"origin-type incomplete", true, false},
+		{"origin-type != INCOMPLETE", false, true},
+		{"origin-type in IGP, EGP", false, true},
+		{"next-hop 192.0.2.0/24", true, true},
+		{"next-hop 192.0.2.2", false, false},
+	}
+	for _, c := range cases {
+		f, err := Compile(c.expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Match(a) != c.a || f.Match(b) != c.b {
+			t.Errorf("%s: expected %v %v, got %v %v", c.expr, c.a, c.b, f.Match(a), f.Match(b))
+		}
+	}
+
+	// the IPv6 announcement has its next hop in MP_REACH_NLRI, followed by
+	// a link-local one
+	mp := append([]byte{0, 2, 1, 32}, net.ParseIP("2001:db8::1")...)
+	mp = append(mp, net.ParseIP("fe80::1")...)
+	mp = append(mp, 0, 48, 0x20, 0x01, 0x0d, 0xb8, 0, 1)
+	mbs := attrStack(t, nil, attr(0x40, 1, []byte{0}), asPath("65001"), attr(0x80, 14, mp))
+	f, err := NewNextHopFilter([]string{"2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(mbs) {
+		t.Errorf("MP_REACH_NLRI next hop did not match")
+	}
+
+	for _, bad := range []string{"med > x", "med in 1", "origin-type BGP", "next-hop 192.0.2.0/33"} {
+		if _, err := Compile(bad, nil); err == nil {
+			t.Errorf("%s compiled", bad)
+		}
+	}
+	if _, err := ParseAttribute("weight"); err == nil {
+		t.Errorf("unknown attribute parsed")
+	}
+	if c, err := ParseComparison(">="); err != nil || !c.Compare(10, 10) || c.Compare(9, 10) {
+		t.Errorf("bad comparison %s %v", c, err)
+	}
+}
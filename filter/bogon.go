@@ -0,0 +1,36 @@
+package filter
+
+import (
+	"strings"
+
+	"github.com/CSUNetSec/protoparse/bogon"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// NewBogonFilter returns a filter that passes updates and RIB entries
+// with a bogon prefix or AS for one of reasons, or for any reason if there
+// are none.
+func NewBogonFilter(c *bogon.Checker, reasons ...bogon.Reason) Filter {
+	names := make([]string, len(reasons))
+	for i, r := range reasons {
+		names[i] = r.String()
+	}
+	name := strings.TrimSpace("bogon " + strings.Join(names, ", "))
+	return withCost(func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		matches, err := c.CheckStack(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, m := range matches {
+			if len(reasons) == 0 {
+				return t.explain(name, true, m.String)
+			}
+			for _, r := range reasons {
+				if m.Reason == r {
+					return t.explain(name, true, m.String)
+				}
+			}
+		}
+		return t.explain(name, false, func() string { return noneMatch(len(matches), "bogons") })
+	}, COST_PREFIXES)
+}
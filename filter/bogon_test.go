@@ -0,0 +1,50 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/CSUNetSec/protoparse/bogon"
+)
+
+func TestBogonFilter(t *testing.T) {
+	a := testStack(t, "10.1.0.0/16", "3356 174")
+	b := testStack(t, "8.8.8.0/24", "3356 64512")
+	c := testStack(t, "8.8.8.0/24", "3356 15169")
+	cases := []struct {
+		expr    string
+		a, b, c bool
+	}{
+		{"bogon", true, true, false},
+		{"not bogon", false, false, true},
+		{"bogon special-prefix", true, false, false},
+		{"bogon in private-as, as-trans", false, true, false},
+		{"bogon != private-as", true, false, true},
+	}
+	for _, cs := range cases {
+		f, err := Compile(cs.expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Match(a) != cs.a || f.Match(b) != cs.b || f.Match(c) != cs.c {
+			t.Errorf("%s: expected %v %v %v", cs.expr, cs.a, cs.b, cs.c)
+		}
+	}
+
+	e := Explain(NewBogonFilter(bogon.NewChecker()), b)
+	if !e.Passed || e.Reason != "private-as AS64512 in AS64512-AS65534 private use (RFC6996)" {
+		t.Errorf("bad explanation %s", e)
+	}
+
+	checker := bogon.NewChecker()
+	checker.SetSpecialPrefixes(nil)
+	f, err := Compile("bogon", &CompileOptions{Bogons: checker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Match(a) {
+		t.Errorf("special prefixes not replaced")
+	}
+	if _, err := Compile("bogon martian", nil); err == nil {
+		t.Errorf("unknown reason compiled")
+	}
+}
@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"sort"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// Cost is an estimate of how expensive a filter is to run. And and Or run
+// the cheaper filters first, so that they decide without running the
+// expensive ones as often as possible.
+type Cost int
+
+const (
+	// filters on the MRT and BGP4MP headers
+	COST_HEADER = Cost(10)
+	// filters on the AS path or other attributes
+	COST_ATTRS = Cost(20)
+	// filters that go through the advertised or withdrawn prefixes
+	COST_PREFIXES = Cost(40)
+	// filters that look up prefixes or paths in external data, like RPKI
+	COST_LOOKUP = Cost(80)
+	// And, Or and Not, and filters with unknown costs
+	COST_COMPOUND = Cost(100)
+)
+
+// filter is a filter of this package, with the cost of its kind. match
+// explains itself in the trace it is given, if it is not nil.
+type filter struct {
+	cost  Cost
+	match func(mbs *mrt.MrtBufferStack, t *trace) bool
+}
+
+func (f *filter) Match(mbs *mrt.MrtBufferStack) bool {
+	return f.match(mbs, nil)
+}
+
+func (f *filter) Cost() Cost {
+	return f.cost
+}
+
+// withCost returns match as a filter that costs c.
+func withCost(match func(mbs *mrt.MrtBufferStack, t *trace) bool, c Cost) Filter {
+	return &filter{cost: c, match: match}
+}
+
+// byCost returns the non nil filters ordered by their cost.
+func byCost(filters []Filter) []Filter {
+	ret := make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		if f != nil {
+			ret = append(ret, f)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Cost() < ret[j].Cost()
+	})
+	return ret
+}
+
+// And returns a filter that passes messages that pass all of filters. It
+// passes all messages if there are none. nil filters are ignored, like
+// in FilterAll.
+func And(filters ...Filter) Filter {
+	ordered := byCost(filters)
+	if len(ordered) == 1 {
+		return ordered[0]
+	}
+	return explained("and", func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		for _, f := range ordered {
+			if !traced(f, mbs, t) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or returns a filter that passes messages that pass any of filters. It
+// passes no messages if there are none.
+func Or(filters ...Filter) Filter {
+	ordered := byCost(filters)
+	if len(ordered) == 1 {
+		return ordered[0]
+	}
+	return explained("or", func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		for _, f := range ordered {
+			if traced(f, mbs, t) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not returns a filter that passes the messages f does not. Not of a nil
+// filter is nil, which And, Or and FilterAll ignore like f itself.
+func Not(f Filter) Filter {
+	if f == nil {
+		return nil
+	}
+	return explained("not", func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		return !traced(f, mbs, t)
+	})
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// attr encodes a path attribute with an extended length if it needs one.
+func attr(flags, code uint8, val []byte) []byte {
+	if len(val) > 255 {
+		return append([]byte{flags | 0x10, code, byte(len(val) >> 8), byte(len(val))}, val...)
+	}
+	return append([]byte{flags, code, byte(len(val))}, val...)
+}
+
+// asPath encodes an AS4 AS_PATH written like "3356 {64512,64513}", an
+// AS_SEQUENCE with an optional AS_SET.
+func asPath(path string) []byte {
+	seq, set := path, ""
+	if i := strings.Index(path, "{"); i >= 0 {
+		seq, set = path[:i], strings.Trim(path[i:], "{}")
+	}
+	segs := asSegment(2, strings.Fields(seq))
+	if set != "" {
+		segs = append(segs, asSegment(1, strings.Split(set, ","))...)
+	}
+	return attr(0x40, 2, segs)
+}
+
+func asSegment(stype uint8, ases []string) []byte {
+	seg := []byte{stype, byte(len(ases))}
+	for _, as := range ases {
+		n, _ := strconv.ParseUint(as, 10, 32)
+		seg = append(seg, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(seg[len(seg)-4:], uint32(n))
+	}
+	return seg
+}
+
+// nlri encodes a prefix as updates carry it, and returns whether it is an
+// IPv6 prefix.
+func nlri(prefix string) ([]byte, bool) {
+	_, n, _ := net.ParseCIDR(prefix)
+	ones, bits := n.Mask.Size()
+	ip := n.IP.To4()
+	if bits == 128 {
+		ip = n.IP
+	}
+	return append([]byte{byte(ones)}, ip[:(ones+7)/8]...), bits == 128
+}
+
+// testUpdate returns the body of an update that advertises prefix with an
+// IGP origin, path and extra attributes. IPv6 prefixes are advertised in an
+// MP_REACH_NLRI with the next hop 2001:db8::1, others with 192.0.2.1.
+func testUpdate(prefix, path string, extra ...[]byte) []byte {
+	attrs := append(attr(0x40, 1, []byte{0}), asPath(path)...)
+	routes, v6 := nlri(prefix)
+	if v6 {
+		mp := append([]byte{0, 2, 1, 16}, net.ParseIP("2001:db8::1")...)
+		mp = append(mp, 0)
+		attrs = append(attrs, attr(0x80, 14, append(mp, routes...))...)
+		routes = nil
+	} else {
+		attrs = append(attrs, attr(0x40, 3, []byte{192, 0, 2, 1})...)
+	}
+	for _, a := range extra {
+		attrs = append(attrs, a...)
+	}
+	body := []byte{0, 0, byte(len(attrs) >> 8), byte(len(attrs))}
+	body = append(body, attrs...)
+	return append(body, routes...)
+}
+
+// updateStack returns the headers of a record of the update body that
+// AS3356 sent from 192.0.2.1.
+func updateStack(t *testing.T, body []byte) *mrt.MrtBufferStack {
+	peering := &mrt.BGP4MPPeering{PeerAS: 3356, PeerIP: net.ParseIP("192.0.2.1")}
+	rec := mrt.NewBGP4MPMessage(time.Unix(1500000000, 0), peering, true, bgp.NewMessage(bgp.MSG_UPDATE, body))
+	mbs, err := mrt.ParseHeaders(rec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mbs
+}
+
+// testStack returns the headers of an update that advertises prefix with
+// path.
+func testStack(t *testing.T, prefix, path string) *mrt.MrtBufferStack {
+	return updateStack(t, testUpdate(prefix, path))
+}
+
+func TestCombinators(t *testing.T) {
+	pref, _ := NewPrefixFilterFromSlice([]string{"10.0.0.0/8"}, AdvPrefix)
+	src, _ := NewASFilterFromSlice([]uint32{64512}, AS_SOURCE)
+	via, _ := NewASFilterFromSlice([]uint32{174}, AS_ANYWHERE)
+	// (prefix in 10/8 and not originated by 64512) or 174 in the path
+	f := Or(And(pref, Not(src)), via)
+
+	cases := []struct {
+		prefix, path string
+		pass         bool
+	}{
+		{"10.1.0.0/16", "3356 64513", true},
+		{"10.1.0.0/16", "3356 64512", false},
+		{"192.0.2.0/24", "3356 64513", false},
+		{"192.0.2.0/24", "3356 174 64512", true},
+	}
+	for _, c := range cases {
+		if got := f.Match(testStack(t, c.prefix, c.path)); got != c.pass {
+			t.Errorf("%s %s: expected %v, got %v", c.prefix, c.path, c.pass, got)
+		}
+	}
+	if !And().Match(nil) || Or().Match(nil) {
+		t.Errorf("empty And should pass and empty Or should not")
+	}
+	if Not(nil) != nil || !And(Not(nil), pref).Match(testStack(t, "10.1.0.0/16", "3356 64512")) {
+		t.Errorf("Not of a nil filter should be ignored like it")
+	}
+}
+
+func TestCostOrder(t *testing.T) {
+	src, _ := NewASFilterFromSlice([]uint32{64512}, AS_SOURCE)
+	pref, _ := NewPrefixFilterFromSlice([]string{"10.0.0.0/8"}, AdvPrefix)
+	if src.Cost() != COST_ATTRS || pref.Cost() != COST_PREFIXES || Not(src).Cost() != COST_COMPOUND {
+		t.Errorf("bad costs %d %d %d", src.Cost(), pref.Cost(), Not(src).Cost())
+	}
+
+	calls := 0
+	expensive := FilterFunc(func(mbs *mrt.MrtBufferStack) bool {
+		calls++
+		return true
+	})
+	mbs := testStack(t, "10.0.0.0/8", "3356 64513")
+	// the AS filter fails first even though it comes last
+	if And(expensive, pref, src).Match(mbs) || calls != 0 {
+		t.Errorf("expensive filter was run %d times", calls)
+	}
+	if !Or(expensive, pref).Match(mbs) || calls != 0 {
+		t.Errorf("expensive filter was run %d times", calls)
+	}
+}
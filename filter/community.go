@@ -0,0 +1,217 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// communityPattern matches the parts of a community, each either a value
+// or a wildcard.
+type communityPattern struct {
+	vals []uint32
+	wild []bool
+}
+
+// parseCommunityPattern parses parts values of bits bits separated by
+// colons, any of which can be a * wildcard.
+func parseCommunityPattern(s string, parts, bits int) (communityPattern, error) {
+	strs := strings.Split(s, ":")
+	if len(strs) != parts {
+		return communityPattern{}, fmt.Errorf("malformed community %q, expected %d values separated by colons", s, parts)
+	}
+	p := communityPattern{vals: make([]uint32, parts), wild: make([]bool, parts)}
+	for i, str := range strs {
+		if str == "*" {
+			p.wild[i] = true
+			continue
+		}
+		v, err := strconv.ParseUint(str, 10, bits)
+		if err != nil {
+			return communityPattern{}, fmt.Errorf("malformed community %q: %s is not a %d bit number or *", s, str, bits)
+		}
+		p.vals[i] = uint32(v)
+	}
+	return p, nil
+}
+
+func (p communityPattern) match(vals ...uint32) bool {
+	for i, v := range vals {
+		if !p.wild[i] && p.vals[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStandardPattern parses a community like 65000:666, a wildcard like
+// 65000:* or the name of a well known community like NO_EXPORT.
+func parseStandardPattern(s string) (communityPattern, error) {
+	if c, ok := bgp.WellKnownCommunities[strings.ToUpper(s)]; ok {
+		return communityPattern{vals: []uint32{uint32(c.AS()), uint32(c.Value())}, wild: []bool{false, false}}, nil
+	}
+	return parseCommunityPattern(s, 2, 16)
+}
+
+func parseLargePattern(s string) (communityPattern, error) {
+	return parseCommunityPattern(s, 3, 32)
+}
+
+// extendedPattern matches the route targets or origins of extended
+// communities. An empty global or a nil local matches any.
+type extendedPattern struct {
+	name   string
+	global string
+	local  *uint32
+}
+
+// parseExtendedPattern parses an extended community like rt:65000:100 or
+// soo:192.0.2.1:7, where the administrators can be * wildcards, or just
+// the type like rt to match any route target.
+func parseExtendedPattern(s string) (extendedPattern, error) {
+	strs := strings.Split(s, ":")
+	p := extendedPattern{name: strings.ToLower(strs[0])}
+	if p.name != "rt" && p.name != "soo" {
+		return extendedPattern{}, fmt.Errorf("malformed extended community %q, expected it to start with rt or soo", s)
+	}
+	switch {
+	case len(strs) == 1, len(strs) == 2 && strs[1] == "*":
+		return p, nil
+	case len(strs) != 3:
+		return extendedPattern{}, fmt.Errorf("malformed extended community %q, expected %s:ADMIN:VALUE", s, p.name)
+	}
+	if strs[1] != "*" {
+		if as, err := strconv.ParseUint(strs[1], 10, 32); err == nil {
+			p.global = fmt.Sprint(as)
+		} else if ip := net.ParseIP(strs[1]).To4(); ip != nil {
+			p.global = ip.String()
+		} else {
+			return extendedPattern{}, fmt.Errorf("malformed extended community %q: %s is not an AS, an IPv4 address or *", s, strs[1])
+		}
+	}
+	if strs[2] != "*" {
+		l, err := strconv.ParseUint(strs[2], 10, 32)
+		if err != nil {
+			return extendedPattern{}, fmt.Errorf("malformed extended community %q: %s is not a number or *", s, strs[2])
+		}
+		local := uint32(l)
+		p.local = &local
+	}
+	return p, nil
+}
+
+func (p extendedPattern) match(c bgp.ExtendedCommunity) bool {
+	if c.Name() != p.name {
+		return false
+	}
+	global, local, _ := c.Admin()
+	return (p.global == "" || p.global == global) && (p.local == nil || *p.local == local)
+}
+
+// NewCommunityFilter returns a filter that passes updates with one of the
+// standard communities comms, and RIB entries where one of the entries
+// has one. Communities are like 65000:666, or have wildcards like
+// 65000:* and *:666, or are the names of well known communities like
+// NO_EXPORT and BLACKHOLE.
+func NewCommunityFilter(comms []string) (Filter, error) {
+	pats := make([]communityPattern, len(comms))
+	for i, s := range comms {
+		p, err := parseStandardPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		pats[i] = p
+	}
+	name := "community " + strings.Join(comms, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		attrs, err := mrt.GetAttributes(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		n := 0
+		for _, a := range attrs {
+			for _, c := range bgp.GetCommunities(a) {
+				n++
+				for _, p := range pats {
+					if p.match(uint32(c.AS()), uint32(c.Value())) {
+						return t.explain(name, true, c.String)
+					}
+				}
+			}
+		}
+		return t.explain(name, false, func() string { return noneMatch(n, "communities") })
+	}
+	return withCost(f, COST_ATTRS), nil
+}
+
+// NewLargeCommunityFilter returns a filter that passes updates with one
+// of the large communities comms, like 65000:1:2 or 65000:*:2.
+func NewLargeCommunityFilter(comms []string) (Filter, error) {
+	pats := make([]communityPattern, len(comms))
+	for i, s := range comms {
+		p, err := parseLargePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		pats[i] = p
+	}
+	name := "large-community " + strings.Join(comms, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		extras, err := mrt.GetExtraAttrs(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		n := 0
+		for _, e := range extras {
+			for _, c := range e.LargeCommunities {
+				n++
+				for _, p := range pats {
+					if p.match(c.GlobalAdmin, c.LocalData1, c.LocalData2) {
+						return t.explain(name, true, c.String)
+					}
+				}
+			}
+		}
+		return t.explain(name, false, func() string { return noneMatch(n, "large communities") })
+	}
+	return withCost(f, COST_ATTRS), nil
+}
+
+// NewExtendedCommunityFilter returns a filter that passes updates with
+// one of the route target or route origin extended communities comms,
+// like rt:65000:100, soo:192.0.2.1:7 or rt:65000:* for any route target
+// of AS 65000. A bare rt or soo matches any of that type.
+func NewExtendedCommunityFilter(comms []string) (Filter, error) {
+	pats := make([]extendedPattern, len(comms))
+	for i, s := range comms {
+		p, err := parseExtendedPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		pats[i] = p
+	}
+	name := "ext-community " + strings.Join(comms, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		attrs, err := mrt.GetAttributes(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		n := 0
+		for _, a := range attrs {
+			for _, c := range bgp.GetExtendedCommunities(a) {
+				n++
+				for _, p := range pats {
+					if p.match(c) {
+						return t.explain(name, true, c.String)
+					}
+				}
+			}
+		}
+		return t.explain(name, false, func() string { return noneMatch(n, "extended communities") })
+	}
+	return withCost(f, COST_ATTRS), nil
+}
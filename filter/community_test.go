@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// communityStack returns the headers of an update with comms, standard
+// communities like "65000:666" and large ones like "65000:1:2".
+func communityStack(t *testing.T, comms ...string) *mrt.MrtBufferStack {
+	var std, large []byte
+	for _, c := range comms {
+		parts := strings.Split(c, ":")
+		for _, p := range parts {
+			n, _ := strconv.ParseUint(p, 10, 32)
+			if len(parts) == 2 {
+				std = append(std, byte(n>>8), byte(n))
+			} else {
+				large = append(large, 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(large[len(large)-4:], uint32(n))
+			}
+		}
+	}
+	var extra [][]byte
+	if len(std) > 0 {
+		extra = append(extra, attr(0xc0, 8, std))
+	}
+	if len(large) > 0 {
+		extra = append(extra, attr(0xc0, 32, large))
+	}
+	return updateStack(t, testUpdate("10.0.0.0/8", "3356 64512", extra...))
+}
+
+func TestCommunityFilters(t *testing.T) {
+	cases := []struct {
+		expr  string
+		comms []string
+		pass  bool
+	}{
+		{"community 65000:666", []string{"3356:1", "65000:666"}, true},
+		{"community 65000:666", []string{"65000:667"}, false},
+		{"community 65000:*", []string{"65000:667"}, true},
+		{"community *:666", []string{"64512:666"}, true},
+		{"community no_export, BLACKHOLE", []string{"65535:666"}, true},
+		{"community NO_EXPORT", []string{"65535:666"}, false},
+		{"not community 65000:666", nil, true},
+		{"community != 65000:*", []string{"65000:1"}, false},
+		{"large-community 65000:1:2", []string{"65000:1:2"}, true},
+		{"large-community 65000:*:2", []string{"65000:7:2", "3356:1"}, true},
+		{"large-community 65000:1:*", []string{"65000:2:1"}, false},
+		{"large-community 65000:1:2", []string{"65000:1"}, false},
+	}
+	for _, c := range cases {
+		f, err := Compile(c.expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Match(communityStack(t, c.comms...)); got != c.pass {
+			t.Errorf("%s on %v: expected %v", c.expr, c.comms, c.pass)
+		}
+	}
+
+	for _, bad := range []string{"community 65536:1", "community 1:2:3", "large-community 1:2", "ext-community rd:1:2", "ext-community rt:1.2.3:4"} {
+		if _, err := Compile(bad, nil); err == nil {
+			t.Errorf("%s compiled", bad)
+		}
+	}
+}
+
+func TestExtendedCommunityPatterns(t *testing.T) {
+	coms := map[string]bgp.ExtendedCommunity{
+		"rt:65000:100":     {0x00, 0x02, 0xfd, 0xe8, 0, 0, 0, 100},
+		"soo:192.0.2.1:7":  {0x01, 0x03, 192, 0, 2, 1, 0, 7},
+		"rt:4200000000:5":  {0x02, 0x02, 0xfa, 0x56, 0xea, 0x00, 0, 5},
+		"06000000000a0000": {0x06, 0x00, 0, 0, 0, 0x0a, 0, 0},
+	}
+	for s, c := range coms {
+		if c.String() != s {
+			t.Errorf("expected %s, got %s", s, c)
+		}
+	}
+	cases := []struct {
+		pat  string
+		com  string
+		pass bool
+	}{
+		{"rt:65000:100", "rt:65000:100", true},
+		{"rt:65000:*", "rt:65000:100", true},
+		{"rt:65001:*", "rt:65000:100", false},
+		{"rt", "rt:4200000000:5", true},
+		{"rt:*", "soo:192.0.2.1:7", false},
+		{"soo:192.0.2.1:*", "soo:192.0.2.1:7", true},
+		{"rt:*:5", "rt:4200000000:5", true},
+		{"rt:*:*", "06000000000a0000", false},
+	}
+	for _, c := range cases {
+		p, err := parseExtendedPattern(c.pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.match(coms[c.com]) != c.pass {
+			t.Errorf("%s on %s: expected %v", c.pat, c.com, c.pass)
+		}
+	}
+}
@@ -0,0 +1,717 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/bogon"
+	"github.com/CSUNetSec/protoparse/rpki"
+)
+
+// CompileOptions holds the data that some predicates of filter
+// expressions need.
+type CompileOptions struct {
+	// ROV validates origins for the rov predicate
+	ROV *rpki.ROV
+	// ASPA verifies paths for the aspa predicate
+	ASPA *rpki.ASPAValidator
+	// Bogons checks bogons for the bogon predicate, with the built-in
+	// lists if it is nil
+	Bogons *bogon.Checker
+	// Start is the time the elapsed predicate counts from
+	Start time.Time
+}
+
+type compiler struct {
+	expr string
+	opts CompileOptions
+}
+
+type predicateCompiler func(c *compiler, a *argReader) (Filter, error)
+
+// predicates are the fields of filter expressions.
+var predicates = map[string]predicateCompiler{
+	"prefix":          prefixPredicate(AdvPrefix),
+	"withdrawn":       prefixPredicate(WdrPrefix),
+	"any-prefix":      prefixPredicate(AnyPrefix),
+	"origin":          asPredicate(AS_SOURCE),
+	"dest-as":         asPredicate(AS_DESTINATION),
+	"midpath-as":      asPredicate(AS_MIDPATH),
+	"path":            pathPredicate,
+	"rov":             rovPredicate,
+	"aspa":            aspaPredicate,
+	"bogon":           bogonPredicate,
+	"community":       communityPredicate(NewCommunityFilter),
+	"large-community": communityPredicate(NewLargeCommunityFilter),
+	"ext-community":   communityPredicate(NewExtendedCommunityFilter),
+	"time":            timePredicate,
+	"elapsed":         elapsedPredicate,
+	"peer":            ipPredicate(NewPeerFilter),
+	"peer-as":         peerASPredicate,
+	"collector":       ipPredicate(NewCollectorFilter),
+	"mrt-type":        mrtTypePredicate,
+	"med":             attrPredicate(ATTR_MED),
+	"local-pref":      attrPredicate(ATTR_LOCAL_PREF),
+	"path-length":     attrPredicate(ATTR_PATH_LENGTH),
+	"origin-type":     originTypePredicate,
+	"next-hop":        ipPredicate(NewNextHopFilter),
+}
+
+// Compile compiles a filter expression like
+//
+//	prefix in 10.0.0.0/8 and not (origin 64512 or path ~ "_3356_")
+//
+// to a filter. The fields are:
+//
+//	prefix in P[, P...]            an advertised prefix is one of P or more specific
+//	prefix exact P[, P...]         an advertised prefix is one of P
+//	prefix more-specific-of P[,..] an advertised prefix is more specific than one of P
+//	prefix less-specific-of P[,..] an advertised prefix is less specific than one of P
+//	prefix covering P[, P...]      an advertised prefix is one of P or less specific
+//	withdrawn MODE P[, P...]       the same for withdrawn prefixes
+//	any-prefix MODE P[, P...]      the same for advertised or withdrawn prefixes
+//	origin [in|==|!=] AS[, AS...]  the last AS of the path is one of the ASes
+//	dest-as [in|==|!=] AS[, ...]   the first AS of the path is one of the ASes
+//	midpath-as [in|==|!=] AS[,...] an AS between the first and last is
+//	path contains AS[, AS...]      an AS anywhere in the path is
+//	path ~ "REGEX"                 the path matches a router style regex
+//	path !~ "REGEX"                the path does not match it
+//	rov [in|==|!=] STATE[, ...]    an advertised prefix has a ROV state
+//	aspa [in|==|!=] STATE[, ...]   the path has an ASPA verification state
+//	bogon [[in|==|!=] R[, R...]]   a prefix or path AS is a bogon, for reason R
+//	community [in|==|!=] C[, C...] the update has one of the communities
+//	large-community [...] C[, ...] the update has one of the large communities
+//	ext-community [...] C[, ...]   the update has one of the extended communities
+//	time OP T [OP T]               the timestamp compares to T, like >= T1 < T2
+//	elapsed OP D [OP D]            the time since the start of the options compares to D
+//	peer [in|==|!=] IP[, IP...]    the peer is one of the addresses or prefixes
+//	peer-as [in|==|!=] AS[, ...]   the AS of the peer is one of the ASes
+//	collector [in|==|!=] IP[, ...] the local IP of the collector is
+//	mrt-type [in|==|!=] T[, T...]  the MRT type is one of T, like bgp4mp/4 or 13
+//	med OP N                       the MED compares to N, like med > 1000
+//	local-pref OP N                the LOCAL_PREF compares to N
+//	path-length OP N               the AS path length, counting sets as one, does
+//	origin-type [in|==|!=] O[,...] the ORIGIN is one of IGP, EGP or INCOMPLETE
+//	next-hop [in|==|!=] IP[, ...]  the next hop is one of the addresses or prefixes
+//
+// Communities are like 65000:666 or NO_EXPORT, large communities like
+// 65000:1:2 and extended communities like rt:65000:100 or soo:192.0.2.1:7,
+// and any of their values can be a * wildcard.
+//
+// Times are in RFC 3339 like 2020-01-01T00:00:00Z or in seconds since the
+// epoch, and durations are like 90s or 1h30m. elapsed counts from the
+// Start of the options, which it needs.
+//
+// The reasons of bogons are special-prefix, unallocated-prefix,
+// prefix-length, private-as, reserved-as, as-trans and documentation-as.
+// They are checked with the built-in lists of the bogon package unless the
+// options have a checker.
+//
+// Prefix predicates can end with bounds on the length of the prefixes that
+// match, like length <= 24 or length > 8 length < 24.
+//
+// Errors in the expression are returned as a *SyntaxError. opts can be nil
+// if the expression has no rov or aspa predicates.
+func Compile(expr string, opts *CompileOptions) (Filter, error) {
+	n, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{expr: expr}
+	if opts != nil {
+		c.opts = *opts
+	}
+	return c.compile(n)
+}
+
+func (c *compiler) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{c.expr, t.col, fmt.Sprintf(format, args...)}
+}
+
+func (c *compiler) compile(n node) (Filter, error) {
+	switch n := n.(type) {
+	case andNode:
+		fils, err := c.compileAll(n)
+		if err != nil {
+			return nil, err
+		}
+		return And(fils...), nil
+	case orNode:
+		fils, err := c.compileAll(n)
+		if err != nil {
+			return nil, err
+		}
+		return Or(fils...), nil
+	case notNode:
+		f, err := c.compile(n.n)
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+	case *predicate:
+		pc, ok := predicates[strings.ToLower(n.field.text)]
+		if !ok {
+			return nil, c.errorf(n.field, "unknown field %s, expected one of %s", n.field, fieldNames())
+		}
+		a := &argReader{c: c, p: n}
+		f, err := pc(c, a)
+		if err != nil {
+			return nil, err
+		}
+		if t := a.peek(); t != n.end {
+			return nil, c.errorf(t, "unexpected %s after the arguments of %s", t, n.field.text)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown filter expression node %T", n)
+}
+
+func (c *compiler) compileAll(nodes []node) ([]Filter, error) {
+	fils := make([]Filter, len(nodes))
+	for i, n := range nodes {
+		f, err := c.compile(n)
+		if err != nil {
+			return nil, err
+		}
+		fils[i] = f
+	}
+	return fils, nil
+}
+
+func fieldNames() string {
+	names := make([]string, 0, len(predicates))
+	for n := range predicates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// argReader reads the arguments of a predicate.
+type argReader struct {
+	c *compiler
+	p *predicate
+	i int
+}
+
+func (a *argReader) peek() token {
+	if a.i < len(a.p.args) {
+		return a.p.args[a.i]
+	}
+	return a.p.end
+}
+
+// op reads an operator if the next argument is one of ops, and returns
+// the empty string otherwise.
+func (a *argReader) op(ops ...string) string {
+	t := a.peek()
+	for _, o := range ops {
+		if a.i < len(a.p.args) && t.is(o) {
+			a.i++
+			return strings.ToLower(o)
+		}
+	}
+	return ""
+}
+
+// mustOp reads one of ops, which must be next.
+func (a *argReader) mustOp(ops ...string) (string, error) {
+	if o := a.op(ops...); o != "" {
+		return o, nil
+	}
+	want := ops[0]
+	if len(ops) > 1 {
+		want = "one of " + strings.Join(ops, ", ")
+	}
+	return "", a.c.errorf(a.peek(), "expected %s after %s, found %s", want, a.p.field.text, a.peek())
+}
+
+// values reads the rest of the arguments, or up to one of the words
+// stop, one or more words or strings that can be separated by commas.
+func (a *argReader) values(stop ...string) ([]token, error) {
+	ret := []token{}
+	comma := false
+	end := a.p.end
+loop:
+	for ; a.i < len(a.p.args); a.i++ {
+		t := a.p.args[a.i]
+		for _, s := range stop {
+			if t.kind == tokWord && t.is(s) && !comma {
+				end = t
+				break loop
+			}
+		}
+		switch {
+		case t.kind == tokComma && len(ret) > 0 && !comma:
+			comma = true
+		case t.kind == tokWord || t.kind == tokString:
+			ret, comma = append(ret, t), false
+		default:
+			return nil, a.c.errorf(t, "expected a value for %s, found %s", a.p.field.text, t)
+		}
+	}
+	if len(ret) == 0 || comma {
+		return nil, a.c.errorf(end, "expected a value for %s, found %s", a.p.field.text, end)
+	}
+	return ret, nil
+}
+
+// negate returns Not(f) if the operator op is !=.
+func negate(f Filter, op string) Filter {
+	if op == "!=" {
+		return Not(f)
+	}
+	return f
+}
+
+func parseAS(s string) (uint32, error) {
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	as, err := strconv.ParseUint(s, 10, 32)
+	return uint32(as), err
+}
+
+func (a *argReader) asValues() ([]uint32, error) {
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	ases := make([]uint32, len(vals))
+	for i, v := range vals {
+		if ases[i], err = parseAS(v.text); err != nil {
+			return nil, a.c.errorf(v, "malformed AS number %s", v)
+		}
+	}
+	return ases, nil
+}
+
+func (a *argReader) prefixValues(stop ...string) ([]string, error) {
+	vals, err := a.values(stop...)
+	if err != nil {
+		return nil, err
+	}
+	prefs := make([]string, len(vals))
+	for i, v := range vals {
+		if _, _, err := net.ParseCIDR(v.text); err != nil {
+			return nil, a.c.errorf(v, "malformed prefix %s", v)
+		}
+		prefs[i] = v.text
+	}
+	return prefs, nil
+}
+
+// prefixMatchOps are the operators of prefix predicates and their match
+// modes.
+var prefixMatchOps = map[string]PrefixMatch{
+	"in":               MATCH_OR_LONGER,
+	"exact":            MATCH_EXACT,
+	"==":               MATCH_EXACT,
+	"more-specific-of": MATCH_MORE_SPECIFIC,
+	"less-specific-of": MATCH_LESS_SPECIFIC,
+	"covering":         MATCH_COVERING,
+}
+
+func prefixPredicate(loc int) predicateCompiler {
+	return func(c *compiler, a *argReader) (Filter, error) {
+		op, err := a.mustOp("in", "exact", "==", "more-specific-of", "less-specific-of", "covering")
+		if err != nil {
+			return nil, err
+		}
+		opts := PrefixMatchOptions{Match: prefixMatchOps[op]}
+		prefs, err := a.prefixValues("length")
+		if err != nil {
+			return nil, err
+		}
+		for a.op("length") != "" {
+			if err := a.lengthBound(&opts); err != nil {
+				return nil, err
+			}
+		}
+		return NewPrefixMatchFilter(prefs, loc, opts)
+	}
+}
+
+// lengthBound reads a comparison of the length of prefixes, like <= 24,
+// into the bounds of opts.
+func (a *argReader) lengthBound(opts *PrefixMatchOptions) error {
+	op, err := a.mustOp("<=", "<", ">=", ">", "==", "=")
+	if err != nil {
+		return err
+	}
+	t := a.peek()
+	n, err := strconv.ParseUint(t.text, 10, 8)
+	if t.kind != tokWord || err != nil || n > 128 {
+		return a.c.errorf(t, "expected a prefix length, found %s", t)
+	}
+	a.i++
+	l := uint8(n)
+	switch {
+	case op == "<" && l == 0, op == ">" && l == 128:
+		return a.c.errorf(t, "no prefix length is %s %d", op, l)
+	case op == "<":
+		l--
+		fallthrough
+	case op == "<=":
+		opts.MaxLength = l
+	case op == ">":
+		l++
+		fallthrough
+	case op == ">=":
+		opts.MinLength = l
+	default:
+		opts.MinLength, opts.MaxLength = l, l
+	}
+	return nil
+}
+
+func asPredicate(pos ASPosition) predicateCompiler {
+	return func(c *compiler, a *argReader) (Filter, error) {
+		op := a.op("in", "==", "=", "!=")
+		ases, err := a.asValues()
+		if err != nil {
+			return nil, err
+		}
+		f, err := NewASFilterFromSlice(ases, pos)
+		if err != nil {
+			return nil, err
+		}
+		return negate(f, op), nil
+	}
+}
+
+func pathPredicate(c *compiler, a *argReader) (Filter, error) {
+	op, err := a.mustOp("contains", "~", "!~")
+	if err != nil {
+		return nil, err
+	}
+	if op != "contains" {
+		vals, err := a.values()
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) != 1 {
+			return nil, c.errorf(vals[1], "expected one AS path regex, quote it if it has spaces")
+		}
+		f, err := NewASPathRegexFilter(vals[0].text)
+		if err != nil {
+			return nil, c.errorf(vals[0], "%s", err)
+		}
+		if op == "!~" {
+			return Not(f), nil
+		}
+		return f, nil
+	}
+	ases, err := a.asValues()
+	if err != nil {
+		return nil, err
+	}
+	return NewASFilterFromSlice(ases, AS_ANYWHERE)
+}
+
+func rovPredicate(c *compiler, a *argReader) (Filter, error) {
+	if c.opts.ROV == nil {
+		return nil, c.errorf(a.p.field, "rov needs VRPs in the compile options")
+	}
+	op := a.op("in", "==", "=", "!=")
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]rpki.ROVState, len(vals))
+	for i, v := range vals {
+		if states[i], err = rpki.ParseROVState(v.text); err != nil {
+			return nil, c.errorf(v, "unknown ROV state %s, expected valid, invalid or not-found", v)
+		}
+	}
+	return negate(NewROVFilter(c.opts.ROV, states...), op), nil
+}
+
+func aspaPredicate(c *compiler, a *argReader) (Filter, error) {
+	if c.opts.ASPA == nil {
+		return nil, c.errorf(a.p.field, "aspa needs ASPAs in the compile options")
+	}
+	op := a.op("in", "==", "=", "!=")
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]rpki.ASPAState, len(vals))
+	for i, v := range vals {
+		if states[i], err = rpki.ParseASPAState(v.text); err != nil {
+			return nil, c.errorf(v, "unknown ASPA state %s, expected valid, invalid or unknown", v)
+		}
+	}
+	return negate(NewASPAFilter(c.opts.ASPA, states...), op), nil
+}
+
+func bogonPredicate(c *compiler, a *argReader) (Filter, error) {
+	checker := c.opts.Bogons
+	if checker == nil {
+		checker = bogon.NewChecker()
+	}
+	if a.i == len(a.p.args) {
+		return NewBogonFilter(checker), nil
+	}
+	op := a.op("in", "==", "=", "!=")
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	reasons := make([]bogon.Reason, len(vals))
+	for i, v := range vals {
+		if reasons[i], err = bogon.ParseReason(v.text); err != nil {
+			return nil, c.errorf(v, "unknown bogon reason %s, expected one like special-prefix or private-as", v)
+		}
+	}
+	return negate(NewBogonFilter(checker, reasons...), op), nil
+}
+
+// communityPredicate compiles community predicates with the filter
+// constructor newf, checking each value on its own to point errors at it.
+func communityPredicate(newf func([]string) (Filter, error)) predicateCompiler {
+	return func(c *compiler, a *argReader) (Filter, error) {
+		op := a.op("in", "==", "=", "!=")
+		vals, err := a.values()
+		if err != nil {
+			return nil, err
+		}
+		comms := make([]string, len(vals))
+		for i, v := range vals {
+			if _, err := newf([]string{v.text}); err != nil {
+				return nil, c.errorf(v, "%s", err)
+			}
+			comms[i] = v.text
+		}
+		f, err := newf(comms)
+		if err != nil {
+			return nil, err
+		}
+		return negate(f, op), nil
+	}
+}
+
+// timeBound reads a comparison like >= 2020-01-01T00:00:00Z or < 1h, and
+// returns its operator and value.
+func (a *argReader) timeBound() (string, token, error) {
+	op, err := a.mustOp("<=", "<", ">=", ">", "==", "=")
+	if err != nil {
+		return "", token{}, err
+	}
+	t := a.peek()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", token{}, a.c.errorf(t, "expected a value for %s, found %s", a.p.field.text, t)
+	}
+	a.i++
+	return op, t, nil
+}
+
+// ParseTime parses a time in RFC 3339 or in seconds since the epoch.
+func ParseTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// timePredicate compiles comparisons of the timestamp. Timestamps are in
+// seconds, so == T is the second from T.
+func timePredicate(c *compiler, a *argReader) (Filter, error) {
+	var (
+		start, end time.Time
+		w          windowBounds
+	)
+	for {
+		op, t, err := a.timeBound()
+		if err != nil {
+			return nil, err
+		}
+		v, err := ParseTime(t.text)
+		if err != nil {
+			return nil, c.errorf(t, "malformed time %s, expected RFC 3339 or seconds since the epoch", t)
+		}
+		if err := w.add(c, op, t); err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			end = v
+		case "<=":
+			end = v.Add(time.Nanosecond)
+		case ">":
+			start = v.Add(time.Nanosecond)
+		case ">=":
+			start = v
+		default:
+			start, end = v, v.Add(time.Second)
+		}
+		if w.start != "" && w.end != "" && !end.After(start) {
+			return nil, c.errorf(t, "empty time window, no time is %s and %s", w.start, w.end)
+		}
+		if a.i == len(a.p.args) {
+			return NewTimeFilter(start, end), nil
+		}
+	}
+}
+
+// elapsedPredicate compiles comparisons of the time since the start of
+// the options.
+func elapsedPredicate(c *compiler, a *argReader) (Filter, error) {
+	var (
+		from, to time.Duration
+		w        windowBounds
+	)
+	for {
+		op, t, err := a.timeBound()
+		if err != nil {
+			return nil, err
+		}
+		v, err := time.ParseDuration(t.text)
+		if err != nil || v < 0 {
+			return nil, c.errorf(t, "malformed duration %s, expected one like 90s or 1h30m", t)
+		}
+		if err := w.add(c, op, t); err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			to = v
+		case "<=":
+			to = v + time.Nanosecond
+		case ">":
+			from = v + time.Nanosecond
+		case ">=":
+			from = v
+		default:
+			from, to = v, v+time.Second
+		}
+		if op == "<" && v == 0 {
+			return nil, c.errorf(t, "no elapsed time is < 0")
+		}
+		if w.start != "" && w.end != "" && to <= from {
+			return nil, c.errorf(t, "empty elapsed window, no time is %s and %s", w.start, w.end)
+		}
+		if a.i == len(a.p.args) {
+			if c.opts.Start.IsZero() {
+				return nil, c.errorf(a.p.field, "elapsed needs a start time in the options")
+			}
+			return NewRelativeTimeFilter(c.opts.Start, from, to), nil
+		}
+	}
+}
+
+// windowBounds holds the comparisons that bound the start and end of a
+// window, like >= 5m, as they are written.
+type windowBounds struct {
+	start, end string
+}
+
+// add records the comparison op t, and returns an error at t if it
+// bounds a side of the window that is already bounded.
+func (w *windowBounds) add(c *compiler, op string, t token) error {
+	bound := op + " " + t.text
+	lower := op != "<" && op != "<="
+	upper := op != ">" && op != ">="
+	if lower && w.start != "" {
+		return c.errorf(t, "%s bounds the start of the window again after %s", bound, w.start)
+	}
+	if upper && w.end != "" {
+		return c.errorf(t, "%s bounds the end of the window again after %s", bound, w.end)
+	}
+	if lower {
+		w.start = bound
+	}
+	if upper {
+		w.end = bound
+	}
+	return nil
+}
+
+// ipPredicate compiles predicates on addresses with the filter constructor
+// newf.
+func ipPredicate(newf func([]string) (Filter, error)) predicateCompiler {
+	return func(c *compiler, a *argReader) (Filter, error) {
+		op := a.op("in", "==", "=", "!=")
+		vals, err := a.values()
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]string, len(vals))
+		for i, v := range vals {
+			if _, err := parseIPNets([]string{v.text}); err != nil {
+				return nil, c.errorf(v, "%s", err)
+			}
+			ips[i] = v.text
+		}
+		f, err := newf(ips)
+		if err != nil {
+			return nil, err
+		}
+		return negate(f, op), nil
+	}
+}
+
+func peerASPredicate(c *compiler, a *argReader) (Filter, error) {
+	op := a.op("in", "==", "=", "!=")
+	ases, err := a.asValues()
+	if err != nil {
+		return nil, err
+	}
+	return negate(NewPeerASFilter(ases), op), nil
+}
+
+func mrtTypePredicate(c *compiler, a *argReader) (Filter, error) {
+	op := a.op("in", "==", "=", "!=")
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]MrtType, len(vals))
+	for i, v := range vals {
+		if types[i], err = ParseMrtType(v.text); err != nil {
+			return nil, c.errorf(v, "%s", err)
+		}
+	}
+	return negate(NewMrtTypeFilter(types), op), nil
+}
+
+// attrPredicate compiles comparisons of the numeric attribute attr.
+func attrPredicate(attr Attribute) predicateCompiler {
+	return func(c *compiler, a *argReader) (Filter, error) {
+		op, err := a.mustOp("==", "=", "!=", "<=", "<", ">=", ">")
+		if err != nil {
+			return nil, err
+		}
+		cmp, err := ParseComparison(op)
+		if err != nil {
+			return nil, err
+		}
+		t := a.peek()
+		n, err := strconv.ParseUint(t.text, 10, 32)
+		if t.kind != tokWord || err != nil {
+			return nil, c.errorf(t, "expected a number for %s, found %s", a.p.field.text, t)
+		}
+		a.i++
+		return NewAttrFilter(attr, cmp, uint32(n)), nil
+	}
+}
+
+func originTypePredicate(c *compiler, a *argReader) (Filter, error) {
+	op := a.op("in", "==", "=", "!=")
+	vals, err := a.values()
+	if err != nil {
+		return nil, err
+	}
+	origins := make([]pbbgp.BGPUpdate_Attributes_Origin, len(vals))
+	for i, v := range vals {
+		if origins[i], err = ParseOriginType(v.text); err != nil {
+			return nil, c.errorf(v, "%s", err)
+		}
+	}
+	return negate(NewOriginTypeFilter(origins...), op), nil
+}
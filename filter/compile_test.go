@@ -0,0 +1,98 @@
+package filter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse/protocol/rtr"
+	"github.com/CSUNetSec/protoparse/rpki"
+)
+
+func TestLex(t *testing.T) {
+	toks, err := lex(`prefix in 10.0.0.0/8, 2001:db8::/32 && !(path ~ "_3356\"_")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, tok := range toks[:len(toks)-1] {
+		got = append(got, tok.text)
+	}
+	want := `prefix|in|10.0.0.0/8|,|2001:db8::/32|&&|!|(|path|~|_3356"_|)`
+	if strings.Join(got, "|") != want {
+		t.Errorf("bad tokens %s", strings.Join(got, "|"))
+	}
+	if toks[4].col != 23 || toks[len(toks)-1].col != 60 {
+		t.Errorf("bad columns %d %d", toks[4].col, toks[len(toks)-1].col)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	rov := rpki.NewROV([]rtr.VRP{{Prefix: []byte{10, 0, 0, 0}, Length: 8, MaxLength: 16, AS: 64512}})
+	f, err := Compile(`prefix in 10.0.0.0/8, 192.0.2.0/24 and not (origin 64513 or path contains AS174) and rov != invalid`, &CompileOptions{ROV: rov})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		prefix, path string
+		pass         bool
+	}{
+		{"10.1.0.0/16", "3356 64512", true},
+		{"10.1.2.0/24", "3356 64512", false}, //ROV invalid
+		{"192.0.2.0/24", "3356 64514", true},
+		{"192.0.2.0/24", "3356 64513", false},
+		{"192.0.2.0/24", "174 64514", false},
+		{"198.51.100.0/24", "3356 64514", false},
+	}
+	for _, c := range cases {
+		if got := f.Match(testStack(t, c.prefix, c.path)); got != c.pass {
+			t.Errorf("%s %s: expected %v, got %v", c.prefix, c.path, c.pass, got)
+		}
+	}
+
+	// or binds looser than and
+	f, _ = Compile("origin 1 and origin 2 or dest-as 3356", nil)
+	if !f.Match(testStack(t, "10.0.0.0/8", "3356 64512")) {
+		t.Errorf("or bound tighter than and")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		expr   string
+		column int
+		msg    string
+	}{
+		{"prefix in 10.0.0.0/8 and", 25, "expected a predicate"},
+		{"prefix 10.0.0.0/8", 8, "expected one of in, exact"},
+		{"prefix in 10.0.0.0/33", 11, "malformed prefix"},
+		{"origin 64512 and (dest-as 1", 28, "expected ) to close the ( at column 18"},
+		{"comunity 65000:1", 1, "unknown field \"comunity\""},
+		{"origin 1,", 10, "expected a value for origin"},
+		{"origin 1 2)", 11, "expected and, or or the end"},
+		{`path contains "174`, 15, "unterminated string"},
+		{"origin 1 # 2", 10, "unexpected character '#'"},
+		{"rov invalid", 1, "rov needs VRPs"},
+		{"origin == x", 11, "malformed AS number"},
+		{"time > 5 < 3", 12, "empty time window, no time is > 5 and < 3"},
+		{"time >= 1 >= 2", 14, ">= 2 bounds the start of the window again after >= 1"},
+		{"elapsed >= 10m < 5m", 18, "empty elapsed window"},
+		{"elapsed == 1m > 0s", 17, "bounds the start of the window again"},
+	}
+	for _, c := range cases {
+		_, err := Compile(c.expr, nil)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: expected a syntax error, got %v", c.expr, err)
+			continue
+		}
+		if se.Column != c.column || !strings.Contains(se.Msg, c.msg) {
+			t.Errorf("%s: expected %q at column %d, got %q at %d", c.expr, c.msg, c.column, se.Msg, se.Column)
+		}
+	}
+
+	_, err := Compile("origin 1 and dest-as x", nil)
+	if se, ok := err.(*SyntaxError); !ok || se.Caret() != "origin 1 and dest-as x\n                     ^" {
+		t.Errorf("bad caret for %v", err)
+	}
+}
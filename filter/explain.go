@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// Explanation is how a filter decided on a message: whether it passed,
+// why, and the explanations of the filters it is made of, in the order
+// they ran. Filters that And and Or did not need to run have none.
+type Explanation struct {
+	// the filter, like "origin 64512" or "and"
+	Filter string `json:"filter"`
+	Passed bool   `json:"passed"`
+	// what the filter found in the message, like the prefix or AS that
+	// matched, or what it found instead if nothing did
+	Reason string         `json:"reason,omitempty"`
+	Sub    []*Explanation `json:"sub,omitempty"`
+}
+
+func (e *Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, depth int) {
+	result := "fail"
+	if e.Passed {
+		result = "pass"
+	}
+	fmt.Fprintf(b, "%s%s %s", strings.Repeat("  ", depth), result, e.Filter)
+	if e.Reason != "" {
+		fmt.Fprintf(b, ": %s", e.Reason)
+	}
+	b.WriteByte('\n')
+	for _, s := range e.Sub {
+		s.write(b, depth+1)
+	}
+}
+
+// Find returns the first explanation of e and its subexplanations, depth
+// first, of a filter that starts with name, or nil if there is none.
+func (e *Explanation) Find(name string) *Explanation {
+	if strings.HasPrefix(e.Filter, name) {
+		return e
+	}
+	for _, s := range e.Sub {
+		if f := s.Find(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// trace is the explanation being made for a message, with the
+// explanations of the compound filters that are running on top. The
+// filters of this package are given the trace of the message they run on,
+// which is nil when it is not being explained.
+type trace struct {
+	stack []*Explanation
+}
+
+func newTrace(root *Explanation) *trace {
+	return &trace{stack: []*Explanation{root}}
+}
+
+func (t *trace) add(e *Explanation) {
+	top := t.stack[len(t.stack)-1]
+	top.Sub = append(top.Sub, e)
+}
+
+// explain returns passed, the result of the filter name, after adding it
+// to t if there is one. Only then is why called for the reason.
+func (t *trace) explain(name string, passed bool, why func() string) bool {
+	if t != nil {
+		t.add(&Explanation{Filter: name, Passed: passed, Reason: why()})
+	}
+	return passed
+}
+
+// group runs a compound filter, adding the explanations of the filters it
+// runs under its own if there is a trace.
+func (t *trace) group(name string, run func() bool) bool {
+	if t == nil {
+		return run()
+	}
+	e := &Explanation{Filter: name}
+	t.add(e)
+	t.stack = append(t.stack, e)
+	e.Passed = run()
+	t.stack = t.stack[:len(t.stack)-1]
+	return e.Passed
+}
+
+// traced runs f on mbs, explaining it in t if it is a filter of this
+// package. Other filters are left to the caller to explain.
+func traced(f Filter, mbs *mrt.MrtBufferStack, t *trace) bool {
+	if pf, ok := f.(*filter); ok {
+		return pf.match(mbs, t)
+	}
+	return f.Match(mbs)
+}
+
+// noneMatch is the reason of filters that found none of the n things
+// they look for in a message to match.
+func noneMatch(n int, what string) string {
+	if n == 0 {
+		return "no " + what
+	}
+	return fmt.Sprintf("none of %d %s match", n, what)
+}
+
+// explained returns match as a compound filter that explains itself as name.
+func explained(name string, match func(mbs *mrt.MrtBufferStack, t *trace) bool) Filter {
+	return withCost(func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		return t.group(name, func() bool { return match(mbs, t) })
+	}, COST_COMPOUND)
+}
+
+// Explain runs f on mbs and returns how it decided. The filters of this
+// package explain themselves, and others are explained only by their
+// result.
+func Explain(f Filter, mbs *mrt.MrtBufferStack) *Explanation {
+	root := &Explanation{Filter: "filter"}
+	root.Passed = traced(f, mbs, newTrace(root))
+	if len(root.Sub) == 1 && root.Sub[0].Passed == root.Passed {
+		return root.Sub[0]
+	}
+	return root
+}
+
+// ExplainAll explains filters like FilterAll would run them on mbs, as an
+// explanation named "all" with one for each filter. Unlike FilterAll it
+// runs the filters after one fails, so that it tells all those that pass.
+func ExplainAll(filters []Filter, mbs *mrt.MrtBufferStack) *Explanation {
+	root := &Explanation{Filter: "all", Passed: true}
+	t := newTrace(root)
+	for i, fil := range filters {
+		if fil == nil {
+			continue
+		}
+		n := len(root.Sub)
+		passed := traced(fil, mbs, t)
+		if len(root.Sub) == n {
+			root.Sub = append(root.Sub, &Explanation{Filter: fmt.Sprintf("filter %d", i), Passed: passed})
+		}
+		root.Passed = root.Passed && passed
+	}
+	return root
+}
@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+func TestExplain(t *testing.T) {
+	mbs := testStack(t, "10.1.0.0/16", "3356 174 64512")
+	f, err := Compile("prefix in 10.0.0.0/8 and (origin 64513 or path contains 174) and not peer-as 174", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Explain(f, mbs)
+	if !e.Passed || e.Filter != "and" {
+		t.Fatalf("bad explanation:\n%s", e)
+	}
+	cases := []struct {
+		filter, reason string
+		passed         bool
+	}{
+		{"advertised prefix or-longer 10.0.0.0/8", "advertised 10.1.0.0/16", true},
+		{"origin 64513", "path 3356 174 64512", false},
+		{"path contains 174", "AS174 at hop 2 of path 3356 174 64512", true},
+		{"peer-as 174", "peer AS3356", false},
+	}
+	for _, c := range cases {
+		sub := e.Find(c.filter)
+		if sub == nil || sub.Passed != c.passed || sub.Reason != c.reason {
+			t.Errorf("%s: expected %v %q in:\n%s", c.filter, c.passed, c.reason, e)
+		}
+	}
+	if not := e.Find("not"); not == nil || !not.Passed || len(not.Sub) != 1 {
+		t.Errorf("bad not in:\n%s", e)
+	}
+	if !strings.Contains(e.String(), "\n    fail origin 64513: path 3356 174 64512\n") {
+		t.Errorf("bad explanation text:\n%s", e)
+	}
+	if _, err := json.Marshal(e); err != nil {
+		t.Error(err)
+	}
+
+	// And runs the cheaper peer-as first and stops
+	e = Explain(And(NewPeerASFilter([]uint32{174}), f), mbs)
+	if e.Passed || len(e.Sub) != 1 || e.Sub[0].Filter != "peer-as 174" {
+		t.Errorf("bad short circuit:\n%s", e)
+	}
+
+	custom := FilterFunc(func(*mrt.MrtBufferStack) bool { return true })
+	all := ExplainAll([]Filter{NewPeerASFilter([]uint32{174}), nil, custom}, mbs)
+	if all.Passed || len(all.Sub) != 2 || all.Sub[1].Filter != "filter 2" || !all.Sub[1].Passed {
+		t.Errorf("bad explanation of all:\n%s", all)
+	}
+
+	// messages can be explained while others are filtered
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			f.Match(mbs)
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		if e := Explain(f, mbs); !e.Passed || len(e.Sub) != 3 {
+			t.Fatalf("bad explanation while filtering:\n%s", e)
+		}
+	}
+	<-done
+}
+
+func TestStats(t *testing.T) {
+	src, _ := NewASFilterFromSlice([]uint32{64512}, AS_SOURCE)
+	fils, stats := InstrumentAll([]Filter{src, nil})
+	if fils[1] != nil || stats[1] != nil || stats[0].Name != "filter 0" {
+		t.Fatalf("bad instrumented filters")
+	}
+	for _, path := range []string{"3356 64512", "3356 64513", "174 64512"} {
+		FilterAll(fils, testStack(t, "10.0.0.0/8", path))
+	}
+	s := stats[0]
+	if s.Evaluated() != 3 || s.Passed() != 2 || s.Time() <= 0 {
+		t.Errorf("bad stats %s", s)
+	}
+	if b, err := json.Marshal(s); err != nil || !strings.Contains(string(b), `"evaluated":3,"passed":2`) {
+		t.Errorf("bad stats JSON %s %v", b, err)
+	}
+	s.Reset()
+	if s.Evaluated() != 0 || s.PassRate() != 0 {
+		t.Errorf("stats not reset")
+	}
+}
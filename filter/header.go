@@ -0,0 +1,282 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CSUNetSec/protoparse"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	"github.com/pkg/errors"
+)
+
+// TimeWindow is a range of record timestamps, from its start up to but
+// not including its end. A zero start or end leaves the window open on
+// that side. The bounds of a relative window are offsets from a start
+// time that Anchor sets, and it contains no timestamps until then.
+type TimeWindow struct {
+	start, end time.Time
+	relative   bool
+	from, to   time.Duration
+	name       string
+}
+
+// NewTimeWindow returns the window from start up to end.
+func NewTimeWindow(start, end time.Time) *TimeWindow {
+	name := "time"
+	if !start.IsZero() {
+		name += " >= " + start.UTC().Format(time.RFC3339)
+	}
+	if !end.IsZero() {
+		name += " < " + end.UTC().Format(time.RFC3339)
+	}
+	return &TimeWindow{start: start, end: end, name: name}
+}
+
+// NewRelativeTimeWindow returns the window from its start time plus from,
+// up to its start time plus to, or open ended if to is zero.
+func NewRelativeTimeWindow(from, to time.Duration) *TimeWindow {
+	name := fmt.Sprintf("elapsed >= %s", from)
+	if to != 0 {
+		name += fmt.Sprintf(" < %s", to)
+	}
+	return &TimeWindow{relative: true, from: from, to: to, name: name}
+}
+
+// Relative reports whether w is a relative window that is not anchored.
+func (w *TimeWindow) Relative() bool {
+	return w.relative
+}
+
+// Anchor returns the window of the relative window w that starts at
+// start. Other windows are returned as they are.
+func (w *TimeWindow) Anchor(start time.Time) *TimeWindow {
+	if !w.relative {
+		return w
+	}
+	ret := &TimeWindow{start: start.Add(w.from), from: w.from, to: w.to, name: w.name}
+	if w.to != 0 {
+		ret.end = start.Add(w.to)
+	}
+	return ret
+}
+
+// Contains reports whether t is in the window.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	if w.relative {
+		return false
+	}
+	return (w.start.IsZero() || !t.Before(w.start)) && (w.end.IsZero() || t.Before(w.end))
+}
+
+// Past reports whether t is at or after the end of the window, so that
+// no later timestamp is in it.
+func (w *TimeWindow) Past(t time.Time) bool {
+	return !w.relative && !w.end.IsZero() && !t.Before(w.end)
+}
+
+// Filter returns a filter that passes records with a timestamp in the
+// window.
+func (w *TimeWindow) Filter() Filter {
+	return withCost(w.filter, COST_HEADER)
+}
+
+func (w *TimeWindow) filter(mbs *mrt.MrtBufferStack, t *trace) bool {
+	ts := mrt.GetTimestamp(mbs)
+	return t.explain(w.name, w.Contains(ts), func() string {
+		return "timestamp " + ts.UTC().Format(time.RFC3339)
+	})
+}
+
+// NewTimeFilter returns a filter that passes records with a timestamp from
+// start up to end. Either can be zero for no bound.
+func NewTimeFilter(start, end time.Time) Filter {
+	return NewTimeWindow(start, end).Filter()
+}
+
+// NewRelativeTimeFilter returns a filter that passes records with a
+// timestamp from start plus from up to start plus to, or any later one if
+// to is zero.
+func NewRelativeTimeFilter(start time.Time, from, to time.Duration) Filter {
+	return NewRelativeTimeWindow(from, to).Anchor(start).Filter()
+}
+
+// parseIPNets parses IP addresses and prefixes. An address is the prefix
+// of its full length.
+func parseIPNets(strs []string) ([]*net.IPNet, error) {
+	ret := make([]*net.IPNet, len(strs))
+	for i, s := range strs {
+		if strings.Contains(s, "/") {
+			_, n, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, errors.Errorf("malformed prefix %s", s)
+			}
+			ret[i] = n
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.Errorf("malformed IP address %s", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		ret[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+	return ret, nil
+}
+
+func netsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPeerFilter returns a filter that passes updates from a peer with one
+// of the IP addresses, or an address in one of the prefixes, of peers, and
+// RIB entries where one of the entries is from one.
+func NewPeerFilter(peers []string) (Filter, error) {
+	nets, err := parseIPNets(peers)
+	if err != nil {
+		return nil, err
+	}
+	name := "peer " + strings.Join(peers, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		ps, err := mrt.GetPeers(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, p := range ps {
+			if netsContain(nets, p.IP) {
+				return t.explain(name, true, func() string { return "peer " + p.IP.String() })
+			}
+		}
+		return t.explain(name, false, func() string {
+			if len(ps) == 1 {
+				return "peer " + ps[0].IP.String()
+			}
+			return noneMatch(len(ps), "peers")
+		})
+	}
+	return withCost(f, COST_HEADER), nil
+}
+
+// NewPeerASFilter returns a filter that passes updates from a peer with
+// one of the ASes, and RIB entries where one of the entries is from one.
+func NewPeerASFilter(ases []uint32) Filter {
+	asmap := make(map[uint32]bool, len(ases))
+	for _, as := range ases {
+		asmap[as] = true
+	}
+	name := "peer-as " + joinASes(ases, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		ps, err := mrt.GetPeers(mbs)
+		if err != nil {
+			return t.explain(name, false, err.Error)
+		}
+		for _, p := range ps {
+			if asmap[p.AS] {
+				return t.explain(name, true, func() string { return fmt.Sprintf("peer AS%d", p.AS) })
+			}
+		}
+		return t.explain(name, false, func() string {
+			if len(ps) == 1 {
+				return fmt.Sprintf("peer AS%d", ps[0].AS)
+			}
+			return noneMatch(len(ps), "peers")
+		})
+	}
+	return withCost(f, COST_HEADER)
+}
+
+// NewCollectorFilter returns a filter that passes BGP4MP records whose
+// local IP, the address of the collector, is one of collectors or in one
+// of them if they are prefixes. RIB entries have no local IP and never
+// pass.
+func NewCollectorFilter(collectors []string) (Filter, error) {
+	nets, err := parseIPNets(collectors)
+	if err != nil {
+		return nil, err
+	}
+	name := "collector " + strings.Join(collectors, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		if b4mph, ok := mbs.Bgp4mpbuf.(protoparse.BGP4MPHeaderer); !ok || b4mph.GetHeader() == nil {
+			return t.explain(name, false, func() string { return "not a BGP4MP record" })
+		}
+		local := mrt.GetCollector(mbs)
+		return t.explain(name, netsContain(nets, local), func() string { return "collector " + local.String() })
+	}
+	return withCost(f, COST_HEADER), nil
+}
+
+// MrtType is a type of MRT record, and its subtype unless AnySubtype is
+// set.
+type MrtType struct {
+	Type       uint16
+	Subtype    uint16
+	AnySubtype bool
+}
+
+// mrtTypeNames are the names of the MRT types that ParseMrtType accepts.
+var mrtTypeNames = map[string]uint16{
+	"bgp4mp":        mrt.BGP4MP,
+	"bgp4mp_et":     mrt.BGP4MP_ET,
+	"table_dump":    mrt.TABLE_DUMP,
+	"table_dump_v2": mrt.TABLE_DUMP_V2,
+}
+
+// ParseMrtType parses a type like 16 or BGP4MP for any subtype, or a type
+// and subtype like 16/4 or bgp4mp/4.
+func ParseMrtType(s string) (MrtType, error) {
+	parts := strings.SplitN(s, "/", 2)
+	t := MrtType{AnySubtype: len(parts) == 1}
+	if v, ok := mrtTypeNames[strings.ToLower(parts[0])]; ok {
+		t.Type = v
+	} else if v, err := strconv.ParseUint(parts[0], 10, 16); err == nil {
+		t.Type = uint16(v)
+	} else {
+		return MrtType{}, errors.Errorf("malformed MRT type %s", s)
+	}
+	if len(parts) == 2 {
+		v, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return MrtType{}, errors.Errorf("malformed MRT subtype in %s", s)
+		}
+		t.Subtype = uint16(v)
+	}
+	return t, nil
+}
+
+func (t MrtType) String() string {
+	if t.AnySubtype {
+		return fmt.Sprint(t.Type)
+	}
+	return fmt.Sprintf("%d/%d", t.Type, t.Subtype)
+}
+
+// NewMrtTypeFilter returns a filter that passes records of one of the
+// types.
+func NewMrtTypeFilter(types []MrtType) Filter {
+	names := make([]string, len(types))
+	for i, mt := range types {
+		names[i] = mt.String()
+	}
+	name := "mrt-type " + strings.Join(names, ", ")
+	f := func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		h := mbs.MrthBuf.(protoparse.MRTHeaderer).GetHeader()
+		passed := false
+		for _, mt := range types {
+			if uint32(mt.Type) == h.Type && (mt.AnySubtype || uint32(mt.Subtype) == h.Subtype) {
+				passed = true
+				break
+			}
+		}
+		return t.explain(name, passed, func() string { return fmt.Sprintf("type %d/%d", h.Type, h.Subtype) })
+	}
+	return withCost(f, COST_HEADER)
+}
@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// headerStack returns the headers of an update recorded at ts, from peer
+// to the collector local.
+func headerStack(t *testing.T, ts int64, peer string, peerAS uint32, local string) *mrt.MrtBufferStack {
+	msg := bgp.NewMessage(bgp.MSG_UPDATE, testUpdate("10.0.0.0/8", "3356 64512"))
+	peering := &mrt.BGP4MPPeering{PeerAS: peerAS, PeerIP: net.ParseIP(peer), LocalIP: net.ParseIP(local)}
+	mbs, err := mrt.ParseHeaders(mrt.NewBGP4MPMessage(time.Unix(ts, 0), peering, true, msg), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mbs
+}
+
+func TestHeaderFilters(t *testing.T) {
+	a := headerStack(t, 1500000000, "192.0.2.1", 3356, "198.51.100.1")
+	b := headerStack(t, 1500000600, "203.0.113.5", 64512, "198.51.100.2")
+	cases := []struct {
+		expr string
+		a, b bool
+	}{
+		{"time >= 2017-07-14T02:40:00Z", true, true},
+		{"time > 1500000000", false, true},
+		{"time >= 1500000000 < 1500000600", true, false},
+		{"time == 1500000600", false, true},
+		{"peer 192.0.2.1", true, false},
+		{"peer in 2001:db8::/32, 203.0.113.0/24", false, true},
+		{"peer-as != AS3356", false, true},
+		{"collector 198.51.100.2", false, true},
+		{"collector 198.51.100.0/24", true, true},
+		{"mrt-type bgp4mp/4", true, true},
+		{"mrt-type table_dump_v2, 16/1", false, false},
+	}
+	for _, c := range cases {
+		f, err := Compile(c.expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Match(a) != c.a || f.Match(b) != c.b {
+			t.Errorf("%s: expected %v %v, got %v %v", c.expr, c.a, c.b, f.Match(a), f.Match(b))
+		}
+	}
+
+	for _, bad := range []string{"time < yesterday", "elapsed < -1m", "elapsed < 0s", "peer 192.0.2", "mrt-type bgp5"} {
+		if _, err := Compile(bad, nil); err == nil {
+			t.Errorf("%s compiled", bad)
+		}
+	}
+}
+
+func TestTimeWindows(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	w := NewTimeWindow(start, start.Add(time.Hour))
+	if w.Contains(start.Add(-time.Second)) || !w.Contains(start) || w.Contains(start.Add(time.Hour)) {
+		t.Errorf("bad absolute window bounds")
+	}
+	if w.Past(start.Add(time.Minute)) || !w.Past(start.Add(time.Hour)) {
+		t.Errorf("bad absolute window end")
+	}
+	if NewTimeWindow(start, time.Time{}).Past(start.Add(1000 * time.Hour)) {
+		t.Errorf("open window ended")
+	}
+
+	r := NewRelativeTimeWindow(time.Minute, time.Hour)
+	if !r.Relative() || r.Contains(start.Add(time.Minute)) || r.Past(start.Add(2*time.Hour)) {
+		t.Errorf("relative window used before it is anchored")
+	}
+	r = r.Anchor(start)
+	if r.Relative() || r.Contains(start) || !r.Contains(start.Add(time.Minute)) || r.Past(start.Add(59*time.Minute)) || !r.Past(start.Add(time.Hour)) {
+		t.Errorf("bad relative window")
+	}
+
+	// elapsed counts from the start of the options
+	if _, err := Compile("elapsed >= 5m", nil); err == nil {
+		t.Errorf("elapsed compiled without a start time")
+	}
+	f, err := Compile("peer-as 64512 and elapsed >= 5m < 15m", &CompileOptions{Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Match(headerStack(t, 1500000000, "192.0.2.1", 64512, "")) {
+		t.Errorf("record at the start passed")
+	}
+	if !f.Match(headerStack(t, 1500000600, "192.0.2.1", 64512, "")) || f.Match(headerStack(t, 1500000900, "192.0.2.1", 64512, "")) {
+		t.Errorf("bad elapsed window")
+	}
+}
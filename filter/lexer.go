@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError is an error in a filter expression, at a column counted in
+// characters from 1.
+type SyntaxError struct {
+	Expr   string
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter expression column %d: %s", e.Column, e.Msg)
+}
+
+// Caret returns the expression with a caret under the column of the error
+// on the next line.
+func (e *SyntaxError) Caret() string {
+	return e.Expr + "\n" + strings.Repeat(" ", e.Column-1) + "^"
+}
+
+type tokenKind int
+
+const (
+	tokEOF = tokenKind(iota)
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	col  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// is reports whether t is the word w, ignoring case, or the operator w.
+func (t token) is(w string) bool {
+	return (t.kind == tokWord || t.kind == tokOp) && strings.EqualFold(t.text, w)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".:/*-_+", r)
+}
+
+// operators, longest first so that they match greedily
+var operators = []string{"&&", "||", "==", "!=", "!~", "<=", ">=", "~", "=", "<", ">", "!"}
+
+// lex splits a filter expression into tokens. Words are runs of letters,
+// digits and the characters of prefixes and communities, strings are
+// double quoted with Go escapes.
+func lex(expr string) ([]token, error) {
+	src := []rune(expr)
+	toks := []token{}
+	for i := 0; i < len(src); {
+		r, col := src[i], i+1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", col})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", col})
+			i++
+		case r == ',':
+			toks = append(toks, token{tokComma, ",", col})
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(src) {
+				return nil, &SyntaxError{expr, col, "unterminated string"}
+			}
+			s, err := strconv.Unquote(string(src[i : j+1]))
+			if err != nil {
+				return nil, &SyntaxError{expr, col, "malformed string: " + err.Error()}
+			}
+			toks = append(toks, token{tokString, s, col})
+			i = j + 1
+		case isWordRune(r):
+			j := i
+			for j < len(src) && isWordRune(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokWord, string(src[i:j]), col})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(src[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &SyntaxError{expr, col, fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{tokOp, op, col})
+			i += len([]rune(op))
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src) + 1}), nil
+}
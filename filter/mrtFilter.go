@@ -11,7 +11,24 @@ import (
 	"strings"
 )
 
-type Filter func(mbs *mrt.MrtBufferStack) bool
+// Filter decides which messages pass. Cost is an estimate of how
+// expensive Match is, that And and Or use to order the filters they run.
+type Filter interface {
+	Match(mbs *mrt.MrtBufferStack) bool
+	Cost() Cost
+}
+
+// FilterFunc is a func used as a Filter. Its cost is unknown, so it costs
+// COST_COMPOUND.
+type FilterFunc func(mbs *mrt.MrtBufferStack) bool
+
+func (f FilterFunc) Match(mbs *mrt.MrtBufferStack) bool {
+	return f(mbs)
+}
+
+func (f FilterFunc) Cost() Cost {
+	return COST_COMPOUND
+}
 
 const (
 	AdvPrefix = iota
@@ -19,10 +36,86 @@ const (
 	AnyPrefix
 )
 
+var prefixLocationNames = []string{"advertised", "withdrawn", "any"}
+
+func prefixLocationName(loc int) string {
+	if loc >= 0 && loc < len(prefixLocationNames) {
+		return prefixLocationNames[loc]
+	}
+	return fmt.Sprintf("unknown(%d)", loc)
+}
+
+// ParsePrefixLocation returns the location AdvPrefix, WdrPrefix or
+// AnyPrefix named "advertised", "withdrawn" or "any".
+func ParsePrefixLocation(name string) (int, error) {
+	for loc, n := range prefixLocationNames {
+		if strings.EqualFold(name, n) {
+			return loc, nil
+		}
+	}
+	return 0, errors.Errorf("unknown prefix location %q", name)
+}
+
 type PrefixFilter struct {
+	name      string
 	prefixes  []string
 	pt        pu.PrefixTree
 	prefixLoc int
+	match     PrefixMatch
+	minLen    uint8
+	maxLen    uint8
+}
+
+// PrefixMatch is how the prefixes of messages are compared to the prefixes
+// of a filter.
+type PrefixMatch int
+
+const (
+	// the prefix is one of the filter's or more specific, the default
+	MATCH_OR_LONGER = PrefixMatch(iota)
+	// the prefix is one of the filter's
+	MATCH_EXACT
+	// the prefix is more specific than one of the filter's
+	MATCH_MORE_SPECIFIC
+	// the prefix is less specific than one of the filter's
+	MATCH_LESS_SPECIFIC
+	// the prefix is one of the filter's or less specific
+	MATCH_COVERING
+)
+
+var prefixMatchNames = map[PrefixMatch]string{
+	MATCH_OR_LONGER:     "or-longer",
+	MATCH_EXACT:         "exact",
+	MATCH_MORE_SPECIFIC: "more-specific",
+	MATCH_LESS_SPECIFIC: "less-specific",
+	MATCH_COVERING:      "covering",
+}
+
+func (m PrefixMatch) String() string {
+	if n, ok := prefixMatchNames[m]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", int(m))
+}
+
+// ParsePrefixMatch returns the match mode named "or-longer", "exact",
+// "more-specific", "less-specific" or "covering".
+func ParsePrefixMatch(name string) (PrefixMatch, error) {
+	for m, n := range prefixMatchNames {
+		if strings.EqualFold(name, n) {
+			return m, nil
+		}
+	}
+	return 0, errors.Errorf("unknown prefix match mode %q", name)
+}
+
+// PrefixMatchOptions are the options of a prefix filter. Prefixes of
+// messages only match if their length is between MinLength and
+// MaxLength, when MaxLength is not 0.
+type PrefixMatchOptions struct {
+	Match     PrefixMatch
+	MinLength uint8
+	MaxLength uint8
 }
 
 func NewPrefixFilterFromString(raw string, sep string, loc int) (Filter, error) {
@@ -31,7 +124,19 @@ func NewPrefixFilterFromString(raw string, sep string, loc int) (Filter, error)
 }
 
 func NewPrefixFilterFromSlice(prefstrings []string, loc int) (Filter, error) {
-	pf := PrefixFilter{prefixLoc: loc}
+	return NewPrefixMatchFilter(prefstrings, loc, PrefixMatchOptions{})
+}
+
+// NewPrefixMatchFilter returns a filter that passes messages with a
+// prefix at loc that matches one of prefstrings as set by opts.
+func NewPrefixMatchFilter(prefstrings []string, loc int, opts PrefixMatchOptions) (Filter, error) {
+	if _, ok := prefixMatchNames[opts.Match]; !ok {
+		return nil, errors.Errorf("unknown prefix match mode %d", opts.Match)
+	}
+	pf := PrefixFilter{prefixLoc: loc, match: opts.Match, minLen: opts.MinLength, maxLen: opts.MaxLength}
+	if pf.maxLen == 0 {
+		pf.maxLen = 128
+	}
 	pf.pt = pu.NewPrefixTree()
 	for _, p := range prefstrings {
 		parts := strings.Split(p, "/")
@@ -49,36 +154,87 @@ func NewPrefixFilterFromSlice(prefstrings []string, loc int) (Filter, error) {
 		pf.pt.Add(parsedIP, mask)
 	}
 	pf.prefixes = prefstrings
-	return pf.filterBySeen, nil
+	pf.name = fmt.Sprintf("%s prefix %s %s", prefixLocationName(loc), pf.match, strings.Join(prefstrings, ", "))
+	if opts.MinLength != 0 || opts.MaxLength != 0 {
+		pf.name += fmt.Sprintf(" length %d-%d", pf.minLen, pf.maxLen)
+	}
+	return withCost(pf.filterBySeen, COST_PREFIXES), nil
 }
 
-func (pf PrefixFilter) filterBySeen(mbs *mrt.MrtBufferStack) bool {
+func (pf PrefixFilter) filterBySeen(mbs *mrt.MrtBufferStack, t *trace) bool {
+	var (
+		match mrt.Route
+		loc   string
+		seen  int
+	)
+	found := false
 	if pf.prefixLoc == AdvPrefix || pf.prefixLoc == AnyPrefix {
 		advPrefs, err := mrt.GetAdvertisedPrefixes(mbs)
 		if err == nil {
+			seen += len(advPrefs)
 			for _, pref := range advPrefs {
-				if pf.pt.ContainsIPMask(pref.IP, pref.Mask) {
-					return true
+				if pf.matches(pref) {
+					match, loc, found = pref, "advertised", true
+					break
 				}
 			}
 		}
 	}
 
-	if pf.prefixLoc == WdrPrefix || pf.prefixLoc == AnyPrefix {
+	if !found && (pf.prefixLoc == WdrPrefix || pf.prefixLoc == AnyPrefix) {
 		wdnPrefs, err := mrt.GetWithdrawnPrefixes(mbs)
 		if err == nil {
+			seen += len(wdnPrefs)
 			for _, pref := range wdnPrefs {
-				if pf.pt.ContainsIPMask(pref.IP, pref.Mask) {
-					return true
+				if pf.matches(pref) {
+					match, loc, found = pref, "withdrawn", true
+					break
 				}
 			}
 		}
 	}
-	return false
+	return t.explain(pf.name, found, func() string {
+		if !found {
+			return fmt.Sprintf("none of %d prefixes match", seen)
+		}
+		return fmt.Sprintf("%s %s", loc, match)
+	})
+}
+
+func (pf PrefixFilter) matches(pref mrt.Route) bool {
+	if pref.Mask < pf.minLen || pref.Mask > pf.maxLen {
+		return false
+	}
+	found := false
+	switch pf.match {
+	case MATCH_OR_LONGER:
+		return pf.pt.ContainsIPMask(pref.IP, pref.Mask)
+	case MATCH_EXACT:
+		return pf.pt.Exact(pref.IP, pref.Mask)
+	case MATCH_MORE_SPECIFIC:
+		pf.pt.WalkAncestors(pref.IP, pref.Mask, func(n *net.IPNet) bool {
+			ones, _ := n.Mask.Size()
+			found = ones < int(pref.Mask)
+			return found
+		})
+	case MATCH_LESS_SPECIFIC:
+		pf.pt.WalkDescendants(pref.IP, pref.Mask, func(n *net.IPNet) bool {
+			ones, _ := n.Mask.Size()
+			found = ones > int(pref.Mask)
+			return found
+		})
+	case MATCH_COVERING:
+		pf.pt.WalkDescendants(pref.IP, pref.Mask, func(n *net.IPNet) bool {
+			found = true
+			return true
+		})
+	}
+	return found
 }
 
 type ASFilter struct {
 	asList []uint32
+	name   string
 }
 
 type ASPosition uint32
@@ -90,6 +246,8 @@ const (
 	AS_ANYWHERE
 )
 
+var asPositionNames = []string{"origin", "dest-as", "midpath-as", "path contains"}
+
 // Returns an AS filter with the list of AS's in the form "1,2,3,4"
 // If src is true, filters messages by source AS number
 // otherwise filters by destination AS number
@@ -102,66 +260,115 @@ func NewASFilter(list string, pos ASPosition) (Filter, error) {
 }
 
 func NewASFilterFromSlice(aslist []uint32, pos ASPosition) (Filter, error) {
-	asf := ASFilter{aslist}
+	if int(pos) >= len(asPositionNames) {
+		return nil, errors.New("unsupported AS position argument")
+	}
+	asf := ASFilter{aslist, asPositionNames[pos] + " " + joinASes(aslist, ", ")}
 	switch pos {
 	case AS_SOURCE:
-		return asf.FilterBySource, nil
+		return withCost(asf.bySource, COST_ATTRS), nil
 	case AS_DESTINATION:
-		return asf.FilterByDest, nil
+		return withCost(asf.byDest, COST_ATTRS), nil
 	case AS_MIDPATH:
-		return asf.FilterByMidPath, nil
-	case AS_ANYWHERE:
-		return asf.FilterByAnywhere, nil
+		return withCost(asf.byMidPath, COST_ATTRS), nil
+	default:
+		return withCost(asf.byAnywhere, COST_ATTRS), nil
+	}
+}
+
+func joinASes(ases []uint32, sep string) string {
+	strs := make([]string, len(ases))
+	for i, as := range ases {
+		strs[i] = strconv.FormatUint(uint64(as), 10)
 	}
-	return nil, errors.New("unsupported AS position argument")
+	return strings.Join(strs, sep)
+}
+
+// explainPath explains the result of asf on path, where the AS at hop
+// matched if it is not negative.
+func (asf ASFilter) explainPath(t *trace, path []uint32, minLen int, hop int) bool {
+	return t.explain(asf.name, hop >= 0, func() string {
+		if len(path) == 0 {
+			return "no AS path"
+		}
+		if len(path) < minLen {
+			return fmt.Sprintf("path %s is too short", joinASes(path, " "))
+		}
+		if hop < 0 {
+			return fmt.Sprintf("path %s", joinASes(path, " "))
+		}
+		return fmt.Sprintf("AS%d at hop %d of path %s", path[hop], hop+1, joinASes(path, " "))
+	})
 }
 
 func (asf ASFilter) FilterBySource(mbs *mrt.MrtBufferStack) bool {
+	return asf.bySource(mbs, nil)
+}
+
+func (asf ASFilter) bySource(mbs *mrt.MrtBufferStack, t *trace) bool {
 	path, err := mrt.GetASPath(mbs)
 	if err != nil || len(path) < 1 {
-		return false
+		return asf.explainPath(t, path, 1, -1)
 	}
 
-	return asf.matchesOne(path[len(path)-1])
+	if asf.matchesOne(path[len(path)-1]) {
+		return asf.explainPath(t, path, 1, len(path)-1)
+	}
+	return asf.explainPath(t, path, 1, -1)
 }
 
 func (asf ASFilter) FilterByDest(mbs *mrt.MrtBufferStack) bool {
+	return asf.byDest(mbs, nil)
+}
+
+func (asf ASFilter) byDest(mbs *mrt.MrtBufferStack, t *trace) bool {
 	path, err := mrt.GetASPath(mbs)
 	if err != nil || len(path) < 1 {
-		return false
+		return asf.explainPath(t, path, 1, -1)
 	}
 
-	return asf.matchesOne(path[0])
+	if asf.matchesOne(path[0]) {
+		return asf.explainPath(t, path, 1, 0)
+	}
+	return asf.explainPath(t, path, 1, -1)
 }
 
 func (asf ASFilter) FilterByMidPath(mbs *mrt.MrtBufferStack) bool {
+	return asf.byMidPath(mbs, nil)
+}
+
+func (asf ASFilter) byMidPath(mbs *mrt.MrtBufferStack, t *trace) bool {
 	path, err := mrt.GetASPath(mbs)
 	if err != nil || len(path) < 3 {
-		return false
+		return asf.explainPath(t, path, 3, -1)
 	}
 
-	for _, as := range path[1 : len(path)-1] {
-		if asf.matchesOne(as) {
-			return true
+	for i := 1; i < len(path)-1; i++ {
+		if asf.matchesOne(path[i]) {
+			return asf.explainPath(t, path, 3, i)
 		}
 	}
 
-	return false
+	return asf.explainPath(t, path, 3, -1)
 }
 
 func (asf ASFilter) FilterByAnywhere(mbs *mrt.MrtBufferStack) bool {
+	return asf.byAnywhere(mbs, nil)
+}
+
+func (asf ASFilter) byAnywhere(mbs *mrt.MrtBufferStack, t *trace) bool {
 	path, err := mrt.GetASPath(mbs)
 	if err != nil || len(path) < 1 {
-		return false
+		return asf.explainPath(t, path, 1, -1)
 	}
 
-	for _, as := range path {
+	for i, as := range path {
 		if asf.matchesOne(as) {
-			return true
+			return asf.explainPath(t, path, 1, i)
 		}
 	}
 
-	return false
+	return asf.explainPath(t, path, 1, -1)
 }
 
 // Convenience function used by both FilterBySrc/Dest
@@ -191,7 +398,7 @@ func parseASList(str string) ([]uint32, error) {
 
 func FilterAll(filters []Filter, mbs *mrt.MrtBufferStack) bool {
 	for _, fil := range filters {
-		if fil != nil && !fil(mbs) {
+		if fil != nil && !fil.Match(mbs) {
 			return false
 		}
 	}
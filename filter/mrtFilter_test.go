@@ -0,0 +1,49 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestPrefixMatchModes(t *testing.T) {
+	monitored := []string{"10.1.0.0/16", "2001:db8::/32"}
+	routes := []string{"10.1.0.0/16", "10.1.2.0/24", "10.0.0.0/8", "192.0.2.0/24", "2001:db8:1::/48", "2001::/16"}
+	cases := []struct {
+		opts PrefixMatchOptions
+		want []bool
+	}{
+		{PrefixMatchOptions{}, []bool{true, true, false, false, true, false}},
+		{PrefixMatchOptions{Match: MATCH_EXACT}, []bool{true, false, false, false, false, false}},
+		{PrefixMatchOptions{Match: MATCH_MORE_SPECIFIC}, []bool{false, true, false, false, true, false}},
+		{PrefixMatchOptions{Match: MATCH_LESS_SPECIFIC}, []bool{false, false, true, false, false, true}},
+		{PrefixMatchOptions{Match: MATCH_COVERING}, []bool{true, false, true, false, false, true}},
+		{PrefixMatchOptions{Match: MATCH_MORE_SPECIFIC, MaxLength: 24}, []bool{false, true, false, false, false, false}},
+		{PrefixMatchOptions{MinLength: 17}, []bool{false, true, false, false, true, false}},
+	}
+	for _, c := range cases {
+		f, err := NewPrefixMatchFilter(monitored, AdvPrefix, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range routes {
+			if got := f.Match(testStack(t, r, "3356 64512")); got != c.want[i] {
+				t.Errorf("%s %d-%d on %s: expected %v", c.opts.Match, c.opts.MinLength, c.opts.MaxLength, r, c.want[i])
+			}
+		}
+	}
+
+	f, err := Compile("prefix more-specific-of 10.1.0.0/16 length <= 24 or prefix covering 2001:db8::/32 length > 16", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true, false, false, false, false} {
+		if got := f.Match(testStack(t, routes[i], "3356 64512")); got != want {
+			t.Errorf("expression on %s: expected %v", routes[i], want)
+		}
+	}
+	if _, err := Compile("prefix exact 10.0.0.0/8 length < 0", nil); err == nil {
+		t.Errorf("impossible length bound compiled")
+	}
+	if m, err := ParsePrefixMatch("More-Specific"); err != nil || m != MATCH_MORE_SPECIFIC {
+		t.Errorf("bad parsed match mode %s %v", m, err)
+	}
+}
@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"fmt"
+)
+
+// A filter expression is predicates combined with and, or, not and
+// parentheses, with not binding tighter than and, and and tighter than or:
+//
+//	expr      = and { ("or" | "||") and }
+//	and       = unary { ("and" | "&&") unary }
+//	unary     = ("not" | "!") unary | "(" expr ")" | predicate
+//	predicate = field { argument }
+//
+// The arguments of a predicate are the words, strings, operators and
+// commas up to the next and, or, closing parenthesis or the end. Each
+// field reads its own arguments when the expression is compiled.
+
+type node interface{}
+
+type andNode []node
+
+type orNode []node
+
+type notNode struct {
+	n node
+}
+
+type predicate struct {
+	field token
+	args  []token
+	end   token //the token after the arguments, for errors about missing ones
+}
+
+type parser struct {
+	expr string
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{p.expr, t.col, fmt.Sprintf(format, args...)}
+}
+
+func isAnd(t token) bool {
+	return t.is("and") || t.is("&&")
+}
+
+func isOr(t token) bool {
+	return t.is("or") || t.is("||")
+}
+
+func isNot(t token) bool {
+	return t.is("not") || t.is("!")
+}
+
+// parse parses a whole filter expression.
+func parse(expr string) (node, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: expr, toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "expected and, or or the end of the expression, found %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	ors := orNode{n}
+	for isOr(p.peek()) {
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		ors = append(ors, n)
+	}
+	if len(ors) == 1 {
+		return ors[0], nil
+	}
+	return ors, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	ands := andNode{n}
+	for isAnd(p.peek()) {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		ands = append(ands, n)
+	}
+	if len(ands) == 1 {
+		return ands[0], nil
+	}
+	return ands, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	switch {
+	case isNot(t):
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case t.kind == tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, p.errorf(c, "expected ) to close the ( at column %d, found %s", t.col, c)
+		}
+		return n, nil
+	case t.kind == tokWord:
+		return p.parsePredicate()
+	}
+	return nil, p.errorf(t, "expected a predicate, not or (, found %s", t)
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	pred := &predicate{field: p.next()}
+	for {
+		t := p.peek()
+		if t.kind == tokEOF || t.kind == tokRParen || isAnd(t) || isOr(t) {
+			pred.end = t
+			return pred, nil
+		}
+		if t.kind == tokLParen {
+			return nil, p.errorf(t, "unexpected ( in the arguments of %s", pred.field.text)
+		}
+		pred.args = append(pred.args, p.next())
+	}
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	"github.com/CSUNetSec/protoparse/rpki"
+)
+
+// joinStates joins the names of states, like ROVStates or ASPAStates.
+func joinStates(states []fmt.Stringer) string {
+	strs := make([]string, len(states))
+	for i, s := range states {
+		strs[i] = s.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+// NewROVFilter returns a filter that passes updates and RIB entries that
+// advertise a prefix whose origin validation state is one of states.
+func NewROVFilter(v *rpki.ROV, states ...rpki.ROVState) Filter {
+	names := make([]fmt.Stringer, len(states))
+	for i, s := range states {
+		names[i] = s
+	}
+	name := "rov " + joinStates(names)
+	return withCost(func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		res, err := v.ValidateStack(mbs)
+		if err != nil || res == nil {
+			return t.explain(name, false, func() string { return "no advertised prefixes" })
+		}
+		for _, rv := range res.Routes {
+			for _, s := range states {
+				if rv.State == s {
+					return t.explain(name, true, func() string {
+						return fmt.Sprintf("%s from AS%d is %s", rv.Prefix, rv.Origin, rv.State)
+					})
+				}
+			}
+		}
+		return t.explain(name, false, func() string { return fmt.Sprintf("advertised prefixes are %s", res.State) })
+	}, COST_LOOKUP)
+}
+
+// NewASPAFilter returns a filter that passes updates and RIB entries that
+// advertise prefixes with a path whose ASPA verification state is one of
+// states.
+func NewASPAFilter(v *rpki.ASPAValidator, states ...rpki.ASPAState) Filter {
+	names := make([]fmt.Stringer, len(states))
+	for i, s := range states {
+		names[i] = s
+	}
+	name := "aspa " + joinStates(names)
+	return withCost(func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		res, err := v.ValidateStack(mbs)
+		if err != nil || res == nil {
+			return t.explain(name, false, func() string { return "no advertised prefixes" })
+		}
+		passed := false
+		for _, s := range states {
+			if res.State == s {
+				passed = true
+				break
+			}
+		}
+		return t.explain(name, passed, func() string {
+			return fmt.Sprintf("%s path is %s", res.Direction, res.State)
+		})
+	}, COST_LOOKUP)
+}
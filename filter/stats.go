@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// Stats counts the messages a filter ran on and passed, and the time it
+// took on them. It is safe to use from multiple goroutines.
+type Stats struct {
+	Name      string
+	evaluated uint64
+	passed    uint64
+	nanos     int64
+}
+
+// Evaluated returns the number of messages the filter ran on.
+func (s *Stats) Evaluated() uint64 {
+	return atomic.LoadUint64(&s.evaluated)
+}
+
+// Passed returns the number of messages that passed the filter.
+func (s *Stats) Passed() uint64 {
+	return atomic.LoadUint64(&s.passed)
+}
+
+// Time returns the total time the filter took.
+func (s *Stats) Time() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.nanos))
+}
+
+// PassRate returns the fraction of messages that passed, or 0 if the
+// filter has not run.
+func (s *Stats) PassRate() float64 {
+	ev := s.Evaluated()
+	if ev == 0 {
+		return 0
+	}
+	return float64(s.Passed()) / float64(ev)
+}
+
+// Reset zeroes the counters.
+func (s *Stats) Reset() {
+	atomic.StoreUint64(&s.evaluated, 0)
+	atomic.StoreUint64(&s.passed, 0)
+	atomic.StoreInt64(&s.nanos, 0)
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%s: %d evaluated, %d passed (%.1f%%) in %s", s.Name, s.Evaluated(), s.Passed(), 100*s.PassRate(), s.Time())
+}
+
+// MarshalJSON marshals the name and counters of s, with the time in
+// nanoseconds.
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name      string `json:"name"`
+		Evaluated uint64 `json:"evaluated"`
+		Passed    uint64 `json:"passed"`
+		Nanos     int64  `json:"nanos"`
+	}{s.Name, s.Evaluated(), s.Passed(), int64(s.Time())})
+}
+
+// Instrument returns a filter that runs f and counts its results and the
+// time it takes in the returned stats. It costs what f costs.
+func Instrument(name string, f Filter) (Filter, *Stats) {
+	s := &Stats{Name: name}
+	return withCost(func(mbs *mrt.MrtBufferStack, t *trace) bool {
+		start := time.Now()
+		passed := traced(f, mbs, t)
+		atomic.AddInt64(&s.nanos, int64(time.Since(start)))
+		atomic.AddUint64(&s.evaluated, 1)
+		if passed {
+			atomic.AddUint64(&s.passed, 1)
+		}
+		return passed
+	}, f.Cost()), s
+}
+
+// InstrumentAll instruments each of filters, like those FilterAll runs,
+// naming them by their index. nil filters stay nil and have nil stats.
+func InstrumentAll(filters []Filter) ([]Filter, []*Stats) {
+	ret := make([]Filter, len(filters))
+	stats := make([]*Stats, len(filters))
+	for i, f := range filters {
+		if f != nil {
+			ret[i], stats[i] = Instrument(fmt.Sprintf("filter %d", i), f)
+		}
+	}
+	return ret, stats
+}
@@ -1,9 +1,11 @@
 module github.com/CSUNetSec/protoparse
 
+go 1.16
+
 require (
 	github.com/CSUNetSec/netsec-protobufs v0.1.4
 	github.com/armon/go-radix v1.0.0
-	github.com/pkg/errors v0.8.1
-	golang.org/x/net v0.0.0-20190501004415-9ce7a6920f09 // indirect
+	github.com/pkg/errors v0.9.1
+	golang.org/x/net v0.0.0-20190501004415-9ce7a6920f09
 	google.golang.org/grpc v1.20.1 // indirect
 )
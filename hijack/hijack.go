@@ -0,0 +1,363 @@
+// Package hijack detects prefix hijacks in BGP updates: announcements of
+// monitored prefixes, or of more specific prefixes in them, by origin ASes
+// other than the expected ones, and announcements of monitored space that
+// is expected to be unannounced.
+package hijack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse"
+	"github.com/CSUNetSec/protoparse/filter"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+// EventType is the kind of a hijack.
+type EventType uint8
+
+const (
+	// a prefix with expected origins is announced by another AS, a
+	// multiple origin AS conflict
+	EVENT_MOAS = EventType(iota)
+	// a more specific of a prefix with expected origins is announced by
+	// another AS
+	EVENT_SUBPREFIX
+	// monitored space that is expected to be unannounced is announced
+	EVENT_SQUATTING
+)
+
+var eventTypeNames = map[EventType]string{
+	EVENT_MOAS:      "moas",
+	EVENT_SUBPREFIX: "sub-prefix",
+	EVENT_SQUATTING: "squatting",
+}
+
+func (t EventType) String() string {
+	if n, ok := eventTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event is a hijack seen in an update or a RIB entry.
+type Event struct {
+	Type EventType `json:"type"`
+	// the announced prefix
+	Prefix string `json:"prefix"`
+	// the prefix with the expected origins that Prefix is in, or the
+	// monitored prefix for squatting
+	Expected        string    `json:"expected_prefix"`
+	ExpectedOrigins []uint32  `json:"expected_origins,omitempty"`
+	Origin          uint32    `json:"origin_as"`
+	Peer            mrt.Peer  `json:"peer"`
+	Timestamp       time.Time `json:"timestamp"`
+	// the update with the announcement, nil for a RIB entry
+	Update *pbbgp.BGPUpdate `json:"update,omitempty"`
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s %s %s from AS%d via %s AS%d", e.Timestamp.UTC().Format(time.RFC3339), e.Type, e.Prefix, e.Origin, e.Peer.IP, e.Peer.AS)
+	if e.Type == EVENT_SQUATTING {
+		return s + fmt.Sprintf(" in unannounced %s", e.Expected)
+	}
+	ases := make([]string, len(e.ExpectedOrigins))
+	for i, as := range e.ExpectedOrigins {
+		ases[i] = fmt.Sprintf("AS%d", as)
+	}
+	return s + fmt.Sprintf(", expected %s from %s", e.Expected, strings.Join(ases, ", "))
+}
+
+// Detector checks updates against the expected origins of the monitored
+// prefixes. It learns them from a configuration with Expect or from the
+// entries of a baseline RIB with Learn. Monitored space with no expected
+// origins is expected to be unannounced. It is safe for concurrent use.
+type Detector struct {
+	watch     filter.Filter
+	monitored util.PrefixTree
+	mu        sync.RWMutex
+	// the prefixes with expected origins, and the origins by the
+	// prefixes' strings
+	expected util.PrefixTree
+	origins  map[string]map[uint32]bool
+}
+
+// NewDetector creates a detector for the monitored prefixes.
+func NewDetector(prefixes []string) (*Detector, error) {
+	watch, err := filter.NewPrefixFilterFromSlice(prefixes, filter.AdvPrefix)
+	if err != nil {
+		return nil, err
+	}
+	d := &Detector{
+		watch:     watch,
+		monitored: util.NewPrefixTree(),
+		expected:  util.NewPrefixTree(),
+		origins:   make(map[string]map[uint32]bool),
+	}
+	for _, p := range prefixes {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, err
+		}
+		ones, _ := n.Mask.Size()
+		d.monitored.Add(n.IP, uint8(ones))
+	}
+	return d, nil
+}
+
+// prefixKey returns the key of ip/mask in the origins, the string of the
+// prefix as the trees return it.
+func prefixKey(ip net.IP, mask uint8) string {
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(int(mask), bits)), Mask: net.CIDRMask(int(mask), bits)}
+	return n.String()
+}
+
+// expect adds origins to those of ip/mask, which must be monitored. The
+// lock must be held.
+func (d *Detector) expect(ip net.IP, mask uint8, origins ...uint32) {
+	key := prefixKey(ip, mask)
+	set, ok := d.origins[key]
+	if !ok {
+		set = make(map[uint32]bool)
+		d.origins[key] = set
+		d.expected.Add(ip, mask)
+	}
+	for _, as := range origins {
+		set[as] = true
+	}
+}
+
+// Expect adds origins to the expected origins of prefix, which must be
+// monitored. With no origins, prefix is expected to be unannounced unless
+// origins are added to it later.
+func (d *Detector) Expect(prefix string, origins ...uint32) error {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	ones, _ := n.Mask.Size()
+	if !d.monitored.ContainsIPMask(n.IP, uint8(ones)) {
+		return fmt.Errorf("%s is not monitored", prefix)
+	}
+	d.mu.Lock()
+	d.expect(n.IP, uint8(ones), origins...)
+	d.mu.Unlock()
+	return nil
+}
+
+// ReadOrigins reads a configuration of expected origins, a JSON object of
+// prefixes and the ASes expected to originate them:
+//
+//	{"192.0.2.0/24": [64496], "198.51.100.0/24": [64497, 64498], "203.0.113.0/24": []}
+func ReadOrigins(r io.Reader) (map[string][]uint32, error) {
+	ret := make(map[string][]uint32)
+	if err := json.NewDecoder(r).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("malformed origins: %w", err)
+	}
+	for p := range ret {
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// LoadOrigins adds the expected origins of a configuration file in the
+// format of ReadOrigins.
+func (d *Detector) LoadOrigins(fname string) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	origins, err := ReadOrigins(fp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fname, err)
+	}
+	// in order for the first error to always be the same
+	prefixes := make([]string, 0, len(origins))
+	for p := range origins {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	for _, p := range prefixes {
+		if err := d.Expect(p, origins[p]...); err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+	}
+	return nil
+}
+
+// announcement is an advertised prefix, with its origin and the peer it
+// was received from.
+type announcement struct {
+	mrt.Route
+	origin    uint32
+	hasOrigin bool
+	peer      mrt.Peer
+}
+
+// originAS returns the AS that originated a route, and false if it is
+// unknown because the path is empty or ends in an AS_SET.
+func originAS(attrs *pbbgp.BGPUpdate_Attributes) (uint32, bool) {
+	if attrs == nil || len(attrs.ASPath) == 0 {
+		return 0, false
+	}
+	last := attrs.ASPath[len(attrs.ASPath)-1]
+	if len(last.ASSeq) == 0 {
+		return 0, false
+	}
+	return last.ASSeq[len(last.ASSeq)-1], true
+}
+
+// announcements returns the announcements of an update, or of the entries
+// of a RIB, and the update.
+func announcements(mbs *mrt.MrtBufferStack) ([]announcement, *pbbgp.BGPUpdate, error) {
+	var ret []announcement
+	if mbs.IsRibStack() {
+		rib := mbs.Ribbuf.(protoparse.RIBHeaderer).GetHeader()
+		if rib == nil {
+			return nil, nil, fmt.Errorf("Error parsing RIB entries")
+		}
+		var peers []*pbbgp.PeerEntry
+		if pr, ok := mbs.Ribbuf.(interface{ GetPeers() []*pbbgp.PeerEntry }); ok {
+			peers = pr.GetPeers()
+		}
+		for i, ent := range rib.RouteEntry {
+			a := announcement{Route: mrt.Route{IP: net.IP(util.GetIP(ent.Prefix.GetPrefix())), Mask: uint8(ent.Prefix.GetMask())}}
+			a.origin, a.hasOrigin = originAS(ent.Attrs)
+			if i < len(peers) && peers[i] != nil {
+				a.peer = mrt.Peer{IP: net.IP(util.GetIP(peers[i].Peer_IP)), AS: peers[i].Peer_AS}
+			}
+			ret = append(ret, a)
+		}
+		return ret, nil, nil
+	}
+	routes, err := mrt.GetAdvertisedPrefixes(mbs)
+	if err != nil {
+		return nil, nil, err
+	}
+	update := mbs.Bgpupbuf.(protoparse.BGPUpdater).GetUpdate()
+	origin, hasOrigin := originAS(update.Attrs)
+	var peer mrt.Peer
+	if peers, err := mrt.GetPeers(mbs); err == nil && len(peers) == 1 {
+		peer = peers[0]
+	}
+	for _, r := range routes {
+		ret = append(ret, announcement{r, origin, hasOrigin, peer})
+	}
+	return ret, update, nil
+}
+
+// Learn adds the origins of the announcements of an update or of the
+// entries of a RIB to the expected ones. Announcements of a monitored
+// prefix or of one in it are expected for their prefix, and those of a
+// prefix that covers monitored ones for each of them.
+func (d *Detector) Learn(mbs *mrt.MrtBufferStack) error {
+	anns, _, err := announcements(mbs)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, a := range anns {
+		if !a.hasOrigin {
+			continue
+		}
+		if d.monitored.ContainsIPMask(a.IP, a.Mask) {
+			d.expect(a.IP, a.Mask, a.origin)
+			continue
+		}
+		for _, n := range d.monitored.Descendants(a.IP, a.Mask) {
+			ones, _ := n.Mask.Size()
+			d.expect(n.IP, uint8(ones), a.origin)
+		}
+	}
+	return nil
+}
+
+// check returns the event of an announcement, and false if there is none.
+// The read lock must be held.
+func (d *Detector) check(a announcement) (Event, bool) {
+	ev := Event{Prefix: a.Route.String(), Origin: a.origin, Peer: a.peer}
+	var (
+		exp    *net.IPNet
+		expLen int
+	)
+	d.expected.WalkAncestors(a.IP, a.Mask, func(n *net.IPNet) bool {
+		exp = n
+		return false
+	})
+	if exp != nil {
+		expLen, _ = exp.Mask.Size()
+		ev.Expected = exp.String()
+		for as := range d.origins[ev.Expected] {
+			ev.ExpectedOrigins = append(ev.ExpectedOrigins, as)
+		}
+	}
+	if len(ev.ExpectedOrigins) == 0 {
+		ev.Type = EVENT_SQUATTING
+		if exp == nil {
+			d.monitored.WalkAncestors(a.IP, a.Mask, func(n *net.IPNet) bool {
+				ev.Expected = n.String()
+				return true
+			})
+		}
+		return ev, true
+	}
+	if !a.hasOrigin {
+		return Event{}, false
+	}
+	sort.Slice(ev.ExpectedOrigins, func(i, j int) bool { return ev.ExpectedOrigins[i] < ev.ExpectedOrigins[j] })
+	if d.origins[ev.Expected][a.origin] {
+		return Event{}, false
+	}
+	ev.Type = EVENT_MOAS
+	if int(a.Mask) > expLen {
+		ev.Type = EVENT_SUBPREFIX
+	}
+	return ev, true
+}
+
+// Check returns the hijacks in the announcements of an update or of the
+// entries of a RIB.
+func (d *Detector) Check(mbs *mrt.MrtBufferStack) []Event {
+	if !d.watch.Match(mbs) {
+		return nil
+	}
+	anns, update, err := announcements(mbs)
+	if err != nil {
+		return nil
+	}
+	ts := mrt.GetTimestamp(mbs)
+	var ret []Event
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, a := range anns {
+		if !d.monitored.ContainsIPMask(a.IP, a.Mask) {
+			continue
+		}
+		if ev, ok := d.check(a); ok {
+			ev.Timestamp, ev.Update = ts, update
+			ret = append(ret, ev)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,142 @@
+package hijack
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// announce returns the headers of an update that the peer 192.0.2.1 AS3356
+// sent to announce prefix with path, an AS_SEQUENCE like "3356 64512".
+// IPv6 prefixes are announced in an MP_REACH_NLRI.
+func announce(t *testing.T, prefix, path string) *mrt.MrtBufferStack {
+	ases := strings.Fields(path)
+	seg := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		n, _ := strconv.ParseUint(as, 10, 32)
+		seg = append(seg, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(seg[len(seg)-4:], uint32(n))
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(seg))}
+	attrs = append(attrs, seg...)
+
+	_, n, _ := net.ParseCIDR(prefix)
+	ones, bits := n.Mask.Size()
+	var routes []byte
+	if bits == 128 {
+		mp := append([]byte{0, 2, 1, 16}, net.ParseIP("2001:db8::1")...)
+		mp = append(mp, 0, byte(ones))
+		mp = append(mp, n.IP[:(ones+7)/8]...)
+		attrs = append(attrs, 0x80, 14, byte(len(mp)))
+		attrs = append(attrs, mp...)
+	} else {
+		attrs = append(attrs, 0x40, 3, 4, 192, 0, 2, 1)
+		routes = append([]byte{byte(ones)}, n.IP.To4()[:(ones+7)/8]...)
+	}
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	body = append(body, routes...)
+
+	peering := &mrt.BGP4MPPeering{PeerAS: 3356, PeerIP: net.ParseIP("192.0.2.1")}
+	rec := mrt.NewBGP4MPMessage(time.Unix(1500000000, 0), peering, true, bgp.NewMessage(bgp.MSG_UPDATE, body))
+	mbs, err := mrt.ParseHeaders(rec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mbs
+}
+
+func TestDetector(t *testing.T) {
+	d, err := NewDetector([]string{"10.0.0.0/8", "198.51.100.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Expect("10.0.0.0/8", 64512, 64513); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Expect("2001:db8::/32", 64514); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Learn(announce(t, "10.2.0.0/16", "3356 65001")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Expect("192.0.2.0/24", 64512); err == nil {
+		t.Errorf("unmonitored prefix expected")
+	}
+
+	cases := []struct {
+		prefix, path string
+		event        string
+		expected     string
+	}{
+		{"10.0.0.0/8", "3356 64512", "", ""},
+		{"10.0.0.0/8", "3356 174 64513", "", ""},
+		{"10.0.0.0/8", "3356 64666", "moas", "10.0.0.0/8"},
+		{"10.1.0.0/16", "3356 64666", "sub-prefix", "10.0.0.0/8"},
+		{"10.1.0.0/16", "3356 64512", "", ""},
+		{"10.2.0.0/16", "3356 65001", "", ""},
+		{"10.2.1.0/24", "3356 64512", "sub-prefix", "10.2.0.0/16"},
+		{"198.51.100.0/25", "3356 64666", "squatting", "198.51.100.0/24"},
+		{"2001:db8:1::/48", "3356 64666", "sub-prefix", "2001:db8::/32"},
+		{"8.8.8.0/24", "3356 15169", "", ""},
+	}
+	for _, c := range cases {
+		evs := d.Check(announce(t, c.prefix, c.path))
+		if c.event == "" {
+			if len(evs) != 0 {
+				t.Errorf("%s %s: unexpected %v", c.prefix, c.path, evs)
+			}
+			continue
+		}
+		if len(evs) != 1 || evs[0].Type.String() != c.event || evs[0].Expected != c.expected || evs[0].Prefix != c.prefix {
+			t.Errorf("%s %s: expected %s of %s, got %v", c.prefix, c.path, c.event, c.expected, evs)
+			continue
+		}
+		ev := evs[0]
+		if ev.Update == nil || ev.Peer.AS != 3356 || ev.Timestamp.Unix() != 1500000000 {
+			t.Errorf("%s: missing update, peer or timestamp in %+v", c.prefix, ev)
+		}
+	}
+
+	ev := d.Check(announce(t, "10.0.0.0/8", "3356 64666"))[0]
+	if s := ev.String(); s != "2017-07-14T02:40:00Z moas 10.0.0.0/8 from AS64666 via 192.0.2.1 AS3356, expected 10.0.0.0/8 from AS64512, AS64513" {
+		t.Errorf("bad event string %s", s)
+	}
+}
+
+func TestLoadOrigins(t *testing.T) {
+	d, err := NewDetector([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "origins.json")
+	if err := os.WriteFile(fname, []byte(`{"10.0.0.0/8": [64512], "10.1.0.0/16": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadOrigins(fname); err != nil {
+		t.Fatal(err)
+	}
+	if evs := d.Check(announce(t, "10.1.2.0/24", "3356 64512")); len(evs) != 1 || evs[0].Type != EVENT_SQUATTING {
+		t.Errorf("expected squatting in unannounced space, got %v", evs)
+	}
+
+	for _, bad := range []string{`{"10.0.0/8": [1]}`, `["10.0.0.0/8"]`} {
+		if _, err := ReadOrigins(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s read", bad)
+		}
+	}
+	if err := os.WriteFile(fname, []byte(`{"192.0.2.0/24": [64512]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadOrigins(fname); err == nil || !strings.Contains(err.Error(), "not monitored") {
+		t.Errorf("bad error %v", err)
+	}
+}
@@ -10,13 +10,14 @@ import (
 	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
 	"github.com/CSUNetSec/protoparse"
 	"github.com/CSUNetSec/protoparse/util"
-	"log"
 	"net"
 )
 
 const (
-	AFI_IP  = 1
-	AFI_IP6 = 2
+	AFI_IP         = 1
+	AFI_IP6        = 2
+	SAFI_UNICAST   = 1
+	SAFI_MULTICAST = 2
 )
 
 type bgpHeaderBuf struct {
@@ -31,6 +32,7 @@ type bgpUpdateBuf struct {
 	buf   []byte
 	isv6  bool
 	isAS4 bool
+	extra *ExtraAttrs
 }
 
 func NewBgpHeaderBuf(buf []byte, v6, AS4 bool) *bgpHeaderBuf {
@@ -48,6 +50,7 @@ func NewBgpUpdateBuf(buf []byte, v6, AS4 bool) *bgpUpdateBuf {
 		dest:  new(pbbgp.BGPUpdate),
 		isv6:  v6,
 		isAS4: AS4,
+		extra: new(ExtraAttrs),
 	}
 }
 
@@ -56,13 +59,21 @@ func (bgph *bgpHeaderBuf) MarshalJSON() ([]byte, error) {
 }
 
 func (bgpup *bgpUpdateBuf) MarshalJSON() ([]byte, error) {
-	return json.Marshal(NewUpdateWrapper(bgpup.dest))
+	uw := NewUpdateWrapper(bgpup.dest)
+	if uw.Attrs != nil {
+		uw.Attrs.setMPNextHop(bgpup.extra.MPNextHop)
+	}
+	if !bgpup.extra.isEmpty() {
+		uw.ExtraAttrs = bgpup.extra
+	}
+	return json.Marshal(uw)
 }
 
 type UpdateWrapper struct {
 	AdvertisedRoutes []*PrefixWrapper `json:"advertised_routes,omitempty"`
 	WithdrawnRoutes  []*PrefixWrapper `json:"withdrawn_routes,omitempty"`
 	Attrs            *AttrsWrapper    `json:"attrs,omitempty"`
+	*ExtraAttrs
 }
 
 func NewUpdateWrapper(update *pbbgp.BGPUpdate) *UpdateWrapper {
@@ -100,8 +111,10 @@ func NewPrefixWrapper(pw *pbcom.PrefixWrapper) *PrefixWrapper {
 
 type AttrsWrapper struct {
 	*pbbgp.BGPUpdate_Attributes
-	NextHop    net.IP             `json:"next_hop,omitempty"`
-	Aggregator *AggregatorWrapper `json:"aggregator,omitempty"`
+	NextHop          net.IP              `json:"next_hop,omitempty"`
+	NextHopLinkLocal net.IP              `json:"next_hop_link_local,omitempty"`
+	NextHopRD        *RouteDistinguisher `json:"next_hop_rd,omitempty"`
+	Aggregator       *AggregatorWrapper  `json:"aggregator,omitempty"`
 }
 
 func NewAttrsWrapper(base *pbbgp.BGPUpdate_Attributes) *AttrsWrapper {
@@ -109,7 +122,16 @@ func NewAttrsWrapper(base *pbbgp.BGPUpdate_Attributes) *AttrsWrapper {
 	if base.NextHop != nil {
 		nexthop = net.IP(util.GetIP(base.NextHop))
 	}
-	return &AttrsWrapper{base, nexthop, NewAggregatorWrapper(base.Aggregator)}
+	return &AttrsWrapper{BGPUpdate_Attributes: base, NextHop: nexthop, Aggregator: NewAggregatorWrapper(base.Aggregator)}
+}
+
+// setMPNextHop adds the parts of an MP_REACH next hop that the protobuf can't hold.
+func (aw *AttrsWrapper) setMPNextHop(nh *MPNextHop) {
+	if nh == nil {
+		return
+	}
+	aw.NextHopLinkLocal = nh.LinkLocal
+	aw.NextHopRD = nh.RD
 }
 
 type AggregatorWrapper struct {
@@ -157,7 +179,10 @@ func (b *bgpUpdateBuf) String() string {
 				ret += fmt.Sprintf(" {%v} ", seg.ASSet)
 			}
 		}
-		if b.dest.Attrs.NextHop != nil {
+		if b.extra.MPNextHop != nil {
+			ret += "\nNext-Hop:"
+			ret += b.extra.MPNextHop.String()
+		} else if b.dest.Attrs.NextHop != nil {
 			ret += "\nNext-Hop:"
 			ret += fmt.Sprintf("%s", net.IP(util.GetIP(b.dest.Attrs.NextHop)))
 		}
@@ -188,6 +213,7 @@ func (b *bgpUpdateBuf) String() string {
 		}
 		ret += "\n"
 	}
+	ret += b.extra.String()
 	return ret
 }
 
@@ -239,7 +265,7 @@ func AttrToString(attrs *pbbgp.BGPUpdate_Attributes) string {
 
 func (b *bgpHeaderBuf) Parse() (protoparse.PbVal, error) {
 	if len(b.buf) < 19 {
-		return nil, errors.New("not enough bytes to decode BGP header")
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrTruncated, "not enough bytes to decode BGP header")
 	}
 	b.dest.Marker = b.buf[:16]
 	b.dest.Length = uint32(binary.BigEndian.Uint16(b.buf[16:18]))
@@ -255,21 +281,24 @@ func itob(a uint8) bool {
 	return ret
 }
 
-func readPrefix(buf []byte, v6 bool) []*pbcom.PrefixWrapper {
+func readPrefix(buf []byte, v6 bool) ([]*pbcom.PrefixWrapper, error) {
 	wpslice := []*pbcom.PrefixWrapper{}
+	off := 0
 
 	//fmt.Printf("blen:%d buf:%+v\n", len(buf), buf)
-	for len(buf) > 1 { //can read the bytelen
+	for len(buf) > 0 { //can read the bytelen
 		route := new(pbcom.PrefixWrapper)
 		addr := new(pbcom.IPAddressWrapper)
 		//read pref mask in bits
 		bitlen := uint8(buf[0])
-		buf = buf[1:]
-		bytelen := (bitlen + 7) / 8
-		if int(bytelen) > len(buf) || int(bytelen) < 1 {
-			log.Printf("error in readPrefix [v6:%v].bytelen %d requested is more than length of buffer %d\n", v6, bytelen, len(buf))
-			return wpslice
+		if (v6 && bitlen > 128) || (!v6 && bitlen > 32) {
+			return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrMalformed, "prefix length %d is too long [v6:%v]", bitlen, v6)
+		}
+		bytelen := (int(bitlen) + 7) / 8
+		if bytelen > len(buf)-1 {
+			return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrTruncated, "not enough bytes for a prefix of length %d [v6:%v]", bitlen, v6)
 		}
+		buf = buf[1:]
 		//fmt.Println("bitlen: ", bitlen, "bytelen ", bytelen)
 		pbuf := make([]byte, bytelen)
 		copy(pbuf, buf[:bytelen])
@@ -294,29 +323,60 @@ func readPrefix(buf []byte, v6 bool) []*pbcom.PrefixWrapper {
 		route.Prefix = addr
 		wpslice = append(wpslice, route)
 		buf = buf[bytelen:] //advance the buffer to the next withdrawn route
+		off += 1 + bytelen
 	}
-	return wpslice
+	return wpslice, nil
 }
 
 func ParseAttrs(buf []byte, AS4, v6 bool) (*pbbgp.BGPUpdate_Attributes, error, []*pbcom.PrefixWrapper, []*pbcom.PrefixWrapper) {
-	return readAttrs(buf, AS4, v6)
+	return readAttrs(buf, AS4, v6, new(ExtraAttrs))
+}
+
+// ParseAttrsExtra is ParseAttrs that also returns what was decoded from
+// the attributes that doesn't fit in the protocol buffer.
+func ParseAttrsExtra(buf []byte, AS4, v6 bool) (*pbbgp.BGPUpdate_Attributes, *ExtraAttrs, error) {
+	extra := new(ExtraAttrs)
+	attrs, err, _, _ := readAttrs(buf, AS4, v6, extra)
+	return attrs, extra, err
 }
 
 //this function returns the attributes but also the withdrawn prefixes or advertised prefixes found in MP_REACH/UNREACH
 //because RFC2283 decided to shove that in the attributes. thanks ietf.
-func readAttrs(buf []byte, AS4, v6 bool) (*pbbgp.BGPUpdate_Attributes, error, []*pbcom.PrefixWrapper, []*pbcom.PrefixWrapper) {
+//anything decoded that the attributes protobuf can't hold is stored in extra.
+func readAttrs(buf []byte, AS4, v6 bool, extra *ExtraAttrs) (*pbbgp.BGPUpdate_Attributes, error, []*pbcom.PrefixWrapper, []*pbcom.PrefixWrapper) {
 	attrs := new(pbbgp.BGPUpdate_Attributes)
 	var (
 		attrlen uint16
 		tempAS  uint32
 		mpadv   []*pbcom.PrefixWrapper
 		mpwdr   []*pbcom.PrefixWrapper
+		// set before each attribute is decoded so errors can carry it
+		typebyte pbbgp.BGPUpdate_Attributes_Type
 	)
+	// buf is advanced as it is decoded, so it always starts at this offset of the attributes
+	all := buf
+	off := func() int {
+		return len(all) - len(buf)
+	}
+	attrErr := func(kind error, format string, args ...interface{}) error {
+		perr := protoparse.NewParseError(protoparse.LayerAttr, off(), kind, format, args...)
+		perr.AttrType = uint8(typebyte)
+		return perr
+	}
+	// errors from the NLRI and attribute decoders given buf
+	wrapErr := func(err error, layer protoparse.Layer) error {
+		err = protoparse.WrapParseError(err, layer, off())
+		var perr *protoparse.ParseError
+		if errors.As(err, &perr) && perr.AttrType == 0 {
+			perr.AttrType = uint8(typebyte)
+		}
+		return err
+	}
 	//fmt.Printf("\ncalled with buflen:%d\n", len(buf))
 
 	if len(buf) < 2 {
 		//fmt.Printf(" ret here ")
-		return attrs, errors.New("not enough bytes for attr flags and code"), nil, nil
+		return attrs, attrErr(protoparse.ErrTruncated, "not enough bytes for attr flags and code"), nil, nil
 	}
 readattr:
 	//fmt.Printf("\nreadattr buf %+v buflen:%d\n", buf, len(buf))
@@ -328,11 +388,11 @@ readattr:
 	attrs.TransitiveBit = itob(flagbyte & (1 << 6))
 	attrs.PartialBit = itob(flagbyte & (1 << 5))
 	attrs.ExtendedBit = itob(flagbyte & (1 << 4))
-	typebyte := pbbgp.BGPUpdate_Attributes_Type(uint8(buf[1]))
+	typebyte = pbbgp.BGPUpdate_Attributes_Type(uint8(buf[1]))
 	//fmt.Printf(" TYPE %d ", typebyte)
 	if attrs.ExtendedBit == true {
 		if len(buf) < 4 {
-			return nil, errors.New("not enough bytes for extended attribute"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for extended attribute length"), nil, nil
 		}
 		attrlen = uint16(binary.BigEndian.Uint16(buf[2:4]))
 		//fmt.Printf("in attrlen ext. attrlen:%d\n", attrlen)
@@ -341,11 +401,11 @@ readattr:
 			buf = buf[4:]
 		} else {
 			//fmt.Printf(" ret here1 ")
-			return attrs, nil, mpadv, mpwdr
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for attribute of length %d", attrlen), nil, nil
 		}
 	} else {
 		if len(buf) < 3 {
-			return nil, errors.New("not enough bytes for extended attribute"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for attribute length"), nil, nil
 		}
 		attrlen = uint16(buf[2])
 		//fmt.Printf("in attrlen. attrlen:%d\n", attrlen)
@@ -354,7 +414,7 @@ readattr:
 			buf = buf[3:]
 		} else {
 			//fmt.Printf(" ret here2 attrlen:%d and lenbuf:%d", attrlen, len(buf))
-			return attrs, nil, mpadv, mpwdr
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for attribute of length %d", attrlen), nil, nil
 		}
 	}
 	if attrlen == 0 {
@@ -373,7 +433,7 @@ readattr:
 		if attrlen != 1 {
 			//XXX: when i have MP_REACH and unreach this is 2 bytes long. why?
 			//maybe it's related to the stackoverflow attribute i commented on this patch...?
-			return nil, fmt.Errorf("origin attribute should be 1 byte long and it is:%d", attrlen), nil, nil
+			return nil, attrErr(protoparse.ErrMalformed, "origin attribute should be 1 byte long and it is:%d", attrlen), nil, nil
 		}
 		//attrs.Origin = new(pb.BGPUpdate_Attributes_Origin)
 		attrs.Origin = pbbgp.BGPUpdate_Attributes_Origin(buf[0])
@@ -385,7 +445,7 @@ readattr:
 	readseg:
 		seg := new(pbbgp.BGPUpdate_ASPathSegment)
 		if len(buf) < 2 {
-			return nil, errors.New("not enough bytes for path segment type and path length"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for path segment type and path length"), nil, nil
 		}
 		ptype := uint8(buf[0])
 		setp := false
@@ -396,16 +456,16 @@ readattr:
 			setp = false
 		default:
 			//fmt.Printf("\n--err ASpath--\n")
-			return nil, fmt.Errorf("unknown path segment type %d", ptype), nil, nil
+			return nil, attrErr(protoparse.ErrUnsupported, "unknown path segment type %d", ptype), nil, nil
 		}
 		plen := int(buf[1])
 		buf = buf[2:]
 		totskip += 2
 		switch {
 		case !AS4 && len(buf) < int(plen)*2:
-			return nil, fmt.Errorf("not enough bytes for an AS2 path segment of length %d", plen), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for an AS2 path segment of length %d", plen), nil, nil
 		case AS4 && len(buf) < int(plen)*4:
-			return nil, fmt.Errorf("not enough bytes for an AS4 path segment of length %d", plen), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for an AS4 path segment of length %d", plen), nil, nil
 		}
 
 		for pind := 0; pind < plen; pind++ {
@@ -446,7 +506,7 @@ readattr:
 			addr.IPv4 = IPbuf
 		default:
 			//fmt.Sprintf("got fail")
-			return nil, fmt.Errorf("nexthop IP bytes don't agree in length with function invocation IP type"), nil, nil
+			return nil, attrErr(protoparse.ErrMalformed, "nexthop IP bytes don't agree in length with function invocation IP type"), nil, nil
 		}
 		//fmt.Printf(":IP:%s / %d:\n", net.IP(addr.IPv4).To4().String(), bitlen)
 		attrs.NextHop = addr
@@ -455,7 +515,7 @@ readattr:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_MULTI_EXIT)
 		//fmt.Printf(" [multi-exit] ")
 		if attrlen != 4 {
-			return nil, fmt.Errorf("multi-exit discriminator should be 4 bytes"), nil, nil
+			return nil, attrErr(protoparse.ErrMalformed, "multi-exit discriminator should be 4 bytes"), nil, nil
 		}
 		me := binary.BigEndian.Uint32(buf[:attrlen])
 		attrs.MultiExit = me
@@ -463,7 +523,7 @@ readattr:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_LOCAL_PREF)
 		//fmt.Printf(" [local-pref] ")
 		if attrlen != 4 {
-			return nil, fmt.Errorf("local-pref should be 4 bytes"), nil, nil
+			return nil, attrErr(protoparse.ErrMalformed, "local-pref should be 4 bytes"), nil, nil
 		}
 		lp := binary.BigEndian.Uint32(buf[:attrlen])
 		attrs.LocalPref = lp
@@ -503,7 +563,7 @@ readattr:
 			copy(IPbuf, buf[4:20])
 			addr.IPv6 = IPbuf
 		default:
-			return nil, fmt.Errorf("not correct amount of bytes for Aggregator Attribute"), nil, nil
+			return nil, attrErr(protoparse.ErrMalformed, "not correct amount of bytes for Aggregator Attribute"), nil, nil
 		}
 		aggr.IP = addr
 		attrs.Aggregator = aggr
@@ -523,45 +583,30 @@ readattr:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_MP_REACH_NLRI)
 
 		if len(buf) < 4 {
-			return nil, fmt.Errorf("not enough bytes for MP_REACH"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for MP_REACH"), nil, nil
 		}
+		afi := binary.BigEndian.Uint16(buf[:2])
+		safi := uint8(buf[2])
 		nhl := uint8(buf[3])
-		buf = buf[4:] //skup over AFI SAFI and length of next hop
+		buf = buf[4:] //skip over AFI SAFI and length of next hop
 		totskip += 4
-		if nhl > 0 && int(nhl) < len(buf) { //set next hop
-			attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_NEXT_HOP)
-			//fmt.Printf(" [next-hop] ", attrlen, v6)
-			addr := new(pbcom.IPAddressWrapper)
-			switch {
-			case v6 == true && nhl == 16:
-				IPbuf := make([]byte, 16)
-				copy(IPbuf, buf[:nhl])
-				//fmt.Sprintf("got v6 :%v", IPbuf)
-				addr.IPv6 = IPbuf
-			//http://networkengineering.stackexchange.com/questions/12556/how-to-interpret-mp-reach-nlri-attribute-with-address-length-of-32-bytes-contain
-			//this is the global IPv6 and the linklocal IPv6
-			//RFC- 2545 Use of BGP-4 Multiprotocol Extensions for IPv6 Inter-Domain Routing"
-			case v6 == true && nhl == 32:
-				IPbuf := make([]byte, 16)
-				copy(IPbuf, buf[:16])
-				addr.IPv6 = IPbuf //XXX for now ignoring the link local ipv6
-			case v6 == false && nhl == 4:
-				IPbuf := make([]byte, 4)
-				copy(IPbuf, buf[:nhl])
-				//fmt.Sprintf("got v4 :%v", IPbuf)
-				addr.IPv4 = IPbuf
-			default:
-				//fmt.Sprintf("got fail")
-				return nil, fmt.Errorf("nexthop IP bytes (%d) in MP_REACH don't agree in length with function invocation (v6:%v) IP type", nhl, v6), nil, nil
+		if isFlowspecSAFI(safi) { //flowspec has no next hop. skip it if it is there.
+			if int(nhl) > len(buf) {
+				return nil, attrErr(protoparse.ErrMalformed, "next hop length in MP_REACH is malformed"), nil, nil
 			}
-			attrs.NextHop = addr //This next hop is prefered if it exists
-		} else {
-			return nil, fmt.Errorf("next hop length in MP_REACH is malformed"), nil, nil
+		} else { //set next hop
+			nh, err := readMPNextHop(buf, nhl, safi)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerAttr), nil, nil
+			}
+			attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_NEXT_HOP)
+			attrs.NextHop = nh.ipWrapper() //This next hop is prefered if it exists
+			extra.MPNextHop = nh
 		}
 		buf = buf[nhl:]
 		totskip += int(nhl)
 		if len(buf) < 1 {
-			return nil, fmt.Errorf("not enough space in MP_REACH for SNPA number info"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough space in MP_REACH for SNPA number info"), nil, nil
 		}
 		snpanum := uint8(buf[0]) //number of SNPAs
 		buf = buf[1:]
@@ -571,30 +616,98 @@ readattr:
 			innerskip, snpal := 0, uint8(0)
 			for i := 0; i < int(snpanum); i++ {
 				if len(buf) < 1 {
-					return nil, fmt.Errorf("not enough space in MP_REACH for SNPA length info"), nil, nil
+					return nil, attrErr(protoparse.ErrTruncated, "not enough space in MP_REACH for SNPA length info"), nil, nil
 				}
 				snpal = uint8(buf[0])
 				buf = buf[1:]
 				innerskip += 1
 				if int(snpal) > len(buf) {
-					return nil, fmt.Errorf("not enough space in MP_REACH for SNPA info"), nil, nil
+					return nil, attrErr(protoparse.ErrTruncated, "not enough space in MP_REACH for SNPA info"), nil, nil
 				}
 				buf = buf[snpal:]
 				innerskip += int(snpal)
 			}
 			totskip += innerskip
 		}
-		mpadv = readPrefix(buf, v6)
+		if totskip > int(attrlen) {
+			return nil, attrErr(protoparse.ErrMalformed, "MP_REACH header is longer than the attribute"), nil, nil
+		}
+		nlri := buf[:int(attrlen)-totskip]
+		if isFlowspecSAFI(safi) {
+			rules, err := readFlowspecNLRI(nlri, afi == AFI_IP6, safi == SAFI_FLOWSPEC_VPN)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.FlowspecAdvertised = append(extra.FlowspecAdvertised, rules...)
+		} else if afi == AFI_L2VPN && safi == SAFI_EVPN {
+			routes, err := readEVPNNLRI(nlri)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.EVPNAdvertised = append(extra.EVPNAdvertised, routes...)
+		} else if afi == AFI_BGPLS {
+			nlris, err := readLSNLRI(nlri, safi == SAFI_BGPLSVPN)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.LSAdvertised = append(extra.LSAdvertised, nlris...)
+		} else if isLabeledSAFI(safi) {
+			routes, err := readLabeledNLRI(nlri, afi == AFI_IP6, safi != SAFI_MPLS_LABEL, false)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.LabeledAdvertised = append(extra.LabeledAdvertised, routes...)
+		} else if safi == SAFI_UNICAST || safi == SAFI_MULTICAST {
+			var err error
+			mpadv, err = readPrefix(nlri, afi == AFI_IP6) //the AFI describes the NLRI, not the peering session
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+		}
+		// the NLRI of the other SAFIs are not decoded
 		//fmt.Printf(" [MP_REACH_NLRI] ")
 	case pbbgp.BGPUpdate_Attributes_MP_UNREACH_NLRI:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_MP_UNREACH_NLRI)
-		if len(buf) < 3 {
-			return nil, fmt.Errorf("not enough bytes for MP unreach"), nil, nil
+		if len(buf) < 3 || attrlen < 3 {
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for MP unreach"), nil, nil
 		}
-		//XXX skip over AFI and SAFI
+		afi := binary.BigEndian.Uint16(buf[:2])
+		safi := uint8(buf[2])
 		buf = buf[3:]
 		totskip += 3
-		mpwdr = readPrefix(buf, v6)
+		nlri := buf[:int(attrlen)-totskip]
+		if isFlowspecSAFI(safi) {
+			rules, err := readFlowspecNLRI(nlri, afi == AFI_IP6, safi == SAFI_FLOWSPEC_VPN)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.FlowspecWithdrawn = append(extra.FlowspecWithdrawn, rules...)
+		} else if afi == AFI_L2VPN && safi == SAFI_EVPN {
+			routes, err := readEVPNNLRI(nlri)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.EVPNWithdrawn = append(extra.EVPNWithdrawn, routes...)
+		} else if afi == AFI_BGPLS {
+			nlris, err := readLSNLRI(nlri, safi == SAFI_BGPLSVPN)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.LSWithdrawn = append(extra.LSWithdrawn, nlris...)
+		} else if isLabeledSAFI(safi) {
+			routes, err := readLabeledNLRI(nlri, afi == AFI_IP6, safi != SAFI_MPLS_LABEL, true)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+			extra.LabeledWithdrawn = append(extra.LabeledWithdrawn, routes...)
+		} else if safi == SAFI_UNICAST || safi == SAFI_MULTICAST {
+			var err error
+			mpwdr, err = readPrefix(nlri, afi == AFI_IP6)
+			if err != nil {
+				return nil, wrapErr(err, protoparse.LayerNLRI), nil, nil
+			}
+		}
+		// the NLRI of the other SAFIs are not decoded
 		//fmt.Printf(" [MP_UNREACH_NLRI] ")
 	case pbbgp.BGPUpdate_Attributes_EXTENDED_COMMUNITY:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_EXTENDED_COMMUNITY)
@@ -608,6 +721,14 @@ readattr:
 		copy(combuf, buf[:attrlen])
 		com.ExtendedCommunity = combuf
 		attrs.Communities.Communities = append(attrs.Communities.Communities, com)
+		// Extended communities are 8 octet values
+		for i := 0; i+8 <= len(combuf); i += 8 {
+			if act := readFlowspecAction(combuf[i : i+8]); act != nil {
+				extra.FlowspecActions = append(extra.FlowspecActions, act)
+			} else if ec := readEVPNCommunity(combuf[i : i+8]); ec != nil {
+				extra.EVPNCommunities = append(extra.EVPNCommunities, ec)
+			}
+		}
 	case pbbgp.BGPUpdate_Attributes_AS4_PATH:
 		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_AS4_PATH)
 		//fmt.Printf(" [AS4-path] ")
@@ -615,7 +736,7 @@ readattr:
 	readseg4:
 		seg := new(pbbgp.BGPUpdate_ASPathSegment)
 		if len(buf) < 2 {
-			return nil, errors.New("not enough bytes for path segment type and path length"), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for path segment type and path length"), nil, nil
 		}
 		ptype := uint8(buf[0])
 		setp := false
@@ -625,13 +746,13 @@ readattr:
 		case 2:
 			setp = false
 		default:
-			return nil, fmt.Errorf("unknown path segment type %d", ptype), nil, nil
+			return nil, attrErr(protoparse.ErrUnsupported, "unknown path segment type %d", ptype), nil, nil
 		}
 		plen := int(buf[1])
 		buf = buf[2:]
 		totskip += 2
 		if len(buf) < int(plen)*4 {
-			return nil, fmt.Errorf("not enough bytes for an AS4 path segment of length %d", plen), nil, nil
+			return nil, attrErr(protoparse.ErrTruncated, "not enough bytes for an AS4 path segment of length %d", plen), nil, nil
 		}
 		for pind := 0; pind < plen; pind++ {
 			AS := binary.BigEndian.Uint32(buf[:4])
@@ -655,22 +776,45 @@ readattr:
 		//fmt.Printf(" [IPV6 extended community] ")
 		buf = buf[20:]
 		totskip += 20
-	case pbbgp.BGPUpdate_Attributes_ORIGINATOR_ID, pbbgp.BGPUpdate_Attributes_CLUSTER_LIST, pbbgp.BGPUpdate_Attributes_PMSI_TUNNEL, pbbgp.BGPUpdate_Attributes_TUNNEL_ENCAPSULATION_ATTRIBUTE, pbbgp.BGPUpdate_Attributes_TRAFFIC_ENGINEERING, pbbgp.BGPUpdate_Attributes_AIGP, pbbgp.BGPUpdate_Attributes_PE_DISTINGUISHER_LABELS, pbbgp.BGPUpdate_Attributes_BGP_LS_ATTRIBUTE, pbbgp.BGPUpdate_Attributes_LARGE_COMMUNITY, pbbgp.BGPUpdate_Attributes_BGPSEC_PATH, pbbgp.BGPUpdate_Attributes_ATTR_SET:
+	case pbbgp.BGPUpdate_Attributes_PMSI_TUNNEL:
+		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_PMSI_TUNNEL)
+		pt, err := readPMSITunnel(buf[:attrlen])
+		if err != nil {
+			return nil, wrapErr(err, protoparse.LayerAttr), nil, nil
+		}
+		extra.PMSITunnel = pt
+	case pbbgp.BGPUpdate_Attributes_LARGE_COMMUNITY:
+		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_LARGE_COMMUNITY)
+		lcs, err := readLargeCommunities(buf[:attrlen])
+		if err != nil {
+			return nil, wrapErr(err, protoparse.LayerAttr), nil, nil
+		}
+		extra.LargeCommunities = append(extra.LargeCommunities, lcs...)
+	case pbbgp.BGPUpdate_Attributes_BGP_LS_ATTRIBUTE:
+		attrs.Types = append(attrs.Types, pbbgp.BGPUpdate_Attributes_BGP_LS_ATTRIBUTE)
+		la, err := readLSAttribute(buf[:attrlen])
+		if err != nil {
+			return nil, wrapErr(err, protoparse.LayerAttr), nil, nil
+		}
+		extra.LSAttribute = la
+	case pbbgp.BGPUpdate_Attributes_ORIGINATOR_ID, pbbgp.BGPUpdate_Attributes_CLUSTER_LIST, pbbgp.BGPUpdate_Attributes_TUNNEL_ENCAPSULATION_ATTRIBUTE, pbbgp.BGPUpdate_Attributes_TRAFFIC_ENGINEERING, pbbgp.BGPUpdate_Attributes_AIGP, pbbgp.BGPUpdate_Attributes_PE_DISTINGUISHER_LABELS, pbbgp.BGPUpdate_Attributes_BGPSEC_PATH, pbbgp.BGPUpdate_Attributes_ATTR_SET:
 		attrs.Types = append(attrs.Types, typebyte)
 	default:
 		//fmt.Printf("\nunknown type!\n")
-		return attrs, fmt.Errorf(" [unknown type %d] ", typebyte), nil, nil
+		return attrs, attrErr(protoparse.ErrUnsupported, "unknown attribute type %d", typebyte), nil, nil
 	}
 	buf = buf[int(attrlen)-totskip:]
 	goto readattr
-
-	//NOTREACHED
-	return attrs, nil, mpadv, mpwdr
 }
 
 func (b *bgpUpdateBuf) Parse() (protoparse.PbVal, error) {
+	// b.buf is advanced as it is decoded, so it always starts at this offset of the update
+	start := b.buf
+	off := func() int {
+		return len(start) - len(b.buf)
+	}
 	if len(b.buf) < 2 {
-		return nil, errors.New("not enough bytes to parse withdrawn routes length")
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, off(), protoparse.ErrTruncated, "not enough bytes to parse withdrawn routes length")
 	}
 	uplen := len(b.buf)
 	wlen := int(binary.BigEndian.Uint16(b.buf[:2]))
@@ -679,18 +823,24 @@ func (b *bgpUpdateBuf) Parse() (protoparse.PbVal, error) {
 		//fmt.Println("no withdrawn routes present")
 		b.buf = b.buf[2:] // advance or die (fail or success)
 	} else {
+		b.buf = b.buf[2:] // advance or die
 		if len(b.buf) < wlen {
-			return nil, errors.New("not enough bytes for withdrawn routes")
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off(), protoparse.ErrTruncated, "not enough bytes for withdrawn routes")
 		}
-		b.buf = b.buf[2:] // advance or die
 
-		wpslice := readPrefix(b.buf[:wlen], b.isv6)
+		wpslice, err := readPrefix(b.buf[:wlen], b.isv6)
+		if err != nil {
+			return nil, protoparse.AddOffset(err, off())
+		}
 		b.buf = b.buf[wlen:]
 
 		b.dest.WithdrawnRoutes = new(pbbgp.BGPUpdate_WithdrawnRoutes)
 		b.dest.WithdrawnRoutes.Prefixes = wpslice
 	}
 	//read attr len
+	if len(b.buf) < 2 {
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, off(), protoparse.ErrTruncated, "not enough bytes to parse attributes length")
+	}
 	attrlen := binary.BigEndian.Uint16(b.buf[:2])
 	b.buf = b.buf[2:]
 	if attrlen == 0 {
@@ -698,12 +848,12 @@ func (b *bgpUpdateBuf) Parse() (protoparse.PbVal, error) {
 		return nil, nil
 	} else {
 		if len(b.buf) < int(attrlen) {
-			return nil, errors.New("not enough bytes for attributes")
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off(), protoparse.ErrTruncated, "not enough bytes for attributes")
 		}
 		//attrtype := binary.BigEndian.Uint16(b.buf[:2])
-		attrs, errattr, mpadv, mpwdr := readAttrs(b.buf[:attrlen], b.isAS4, b.isv6)
+		attrs, errattr, mpadv, mpwdr := readAttrs(b.buf[:attrlen], b.isAS4, b.isv6, b.extra)
 		if errattr != nil { //XXX log the error?
-			return nil, errattr
+			return nil, protoparse.AddOffset(errattr, off())
 		}
 		//fmt.Printf("attributes: %s\n", attrs)
 		b.buf = b.buf[attrlen:]
@@ -725,7 +875,10 @@ func (b *bgpUpdateBuf) Parse() (protoparse.PbVal, error) {
 			return nil, nil //return. it might only have withdraws
 		}
 		//fmt.Println("nrlilen:", nlrilen)
-		nlrislice := readPrefix(b.buf[:nlrilen], b.isv6)
+		nlrislice, err := readPrefix(b.buf[:nlrilen], b.isv6)
+		if err != nil {
+			return nil, protoparse.AddOffset(err, off())
+		}
 		b.buf = b.buf[nlrilen:]
 		if b.dest.AdvertisedRoutes == nil { // make a new one
 			b.dest.AdvertisedRoutes = new(pbbgp.BGPUpdate_AdvertisedRoutes)
@@ -741,3 +894,13 @@ func (b *bgpUpdateBuf) Parse() (protoparse.PbVal, error) {
 func (b *bgpUpdateBuf) GetUpdate() *pbbgp.BGPUpdate {
 	return b.dest
 }
+
+// GetExtraAttrs returns what was decoded from the update that doesn't
+// fit in the BGPUpdate protocol buffer.
+func (b *bgpUpdateBuf) GetExtraAttrs() *ExtraAttrs {
+	return b.extra
+}
+
+func isFlowspecSAFI(safi uint8) bool {
+	return safi == SAFI_FLOWSPEC || safi == SAFI_FLOWSPEC_VPN
+}
@@ -0,0 +1,181 @@
+package bgp
+
+import (
+	"errors"
+	"testing"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse"
+)
+
+// attr encodes a path attribute, with an extended length if it needs one.
+func attr(flags, code uint8, val []byte) []byte {
+	if len(val) > 255 {
+		return append([]byte{flags | 0x10, code, byte(len(val) >> 8), byte(len(val))}, val...)
+	}
+	return append([]byte{flags, code, byte(len(val))}, val...)
+}
+
+// mpReach encodes an MP_REACH attribute without SNPAs.
+func mpReach(afi uint16, safi uint8, nh, nlri []byte) []byte {
+	val := append([]byte{byte(afi >> 8), byte(afi), safi, byte(len(nh))}, nh...)
+	val = append(val, 0)
+	return attr(0x80, 14, append(val, nlri...))
+}
+
+func mpUnreach(afi uint16, safi uint8, nlri []byte) []byte {
+	return attr(0x80, 15, append([]byte{byte(afi >> 8), byte(afi), safi}, nlri...))
+}
+
+// updateBody encodes the body of an UPDATE, the part after the BGP header.
+func updateBody(withdrawn, attrs, nlri []byte) []byte {
+	ret := append([]byte{byte(len(withdrawn) >> 8), byte(len(withdrawn))}, withdrawn...)
+	ret = append(ret, byte(len(attrs)>>8), byte(len(attrs)))
+	ret = append(ret, attrs...)
+	return append(ret, nlri...)
+}
+
+// parseAttrs decodes attributes like an update of an AS4 IPv4 session.
+func parseAttrs(buf []byte) (*pbbgp.BGPUpdate_Attributes, *ExtraAttrs, error) {
+	extra := new(ExtraAttrs)
+	attrs, err, _, _ := readAttrs(buf, true, false, extra)
+	return attrs, extra, err
+}
+
+func concat(bufs ...[]byte) []byte {
+	ret := []byte{}
+	for _, b := range bufs {
+		ret = append(ret, b...)
+	}
+	return ret
+}
+
+var (
+	origin = attr(0x40, 1, []byte{0})
+	nh4    = []byte{192, 0, 2, 1}
+	nh6    = []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+)
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		update   []byte
+		kind     error
+		layer    protoparse.Layer
+		attrType uint8
+		offset   int
+	}{
+		{
+			name:   "truncated withdrawn prefix",
+			update: updateBody([]byte{8, 10, 24, 10, 0}, nil, nil),
+			kind:   protoparse.ErrTruncated,
+			layer:  protoparse.LayerNLRI,
+			offset: 2 + 2,
+		},
+		{
+			name:   "truncated attributes",
+			update: concat([]byte{0, 0, 0, 10}, origin),
+			kind:   protoparse.ErrTruncated,
+			layer:  protoparse.LayerBGP,
+			offset: 4,
+		},
+		{
+			name:     "truncated AS path segment",
+			update:   updateBody(nil, concat(origin, attr(0x40, 2, []byte{2, 2, 0, 0, 0, 1})), nil),
+			kind:     protoparse.ErrTruncated,
+			layer:    protoparse.LayerAttr,
+			attrType: 2,
+			offset:   4 + 4 + 3 + 2,
+		},
+		{
+			name:     "bad MED length",
+			update:   updateBody(nil, concat(origin, attr(0x80, 4, []byte{0, 0, 1})), nil),
+			kind:     protoparse.ErrMalformed,
+			layer:    protoparse.LayerAttr,
+			attrType: 4,
+			offset:   4 + 4 + 3,
+		},
+		{
+			name:     "unknown attribute",
+			update:   updateBody(nil, concat(origin, attr(0xc0, 250, []byte{1})), nil),
+			kind:     protoparse.ErrUnsupported,
+			layer:    protoparse.LayerAttr,
+			attrType: 250,
+			offset:   4 + 4 + 3,
+		},
+		{
+			name:     "truncated MP_REACH prefix",
+			update:   updateBody(nil, concat(origin, mpReach(AFI_IP6, SAFI_UNICAST, nh6, []byte{64, 0x20, 0x01, 0x0d})), nil),
+			kind:     protoparse.ErrTruncated,
+			layer:    protoparse.LayerNLRI,
+			attrType: 14,
+			offset:   4 + 4 + 3 + 4 + 16 + 1,
+		},
+		{
+			name:     "MP_UNREACH prefix too long",
+			update:   updateBody(nil, concat(origin, mpUnreach(AFI_IP, SAFI_UNICAST, []byte{8, 10, 33, 10, 0, 0, 0, 0})), nil),
+			kind:     protoparse.ErrMalformed,
+			layer:    protoparse.LayerNLRI,
+			attrType: 15,
+			offset:   4 + 4 + 3 + 3 + 2,
+		},
+		{
+			name:     "bad MP_REACH next hop",
+			update:   updateBody(nil, mpReach(AFI_IP, SAFI_UNICAST, []byte{192, 0, 2, 1, 0}, []byte{8, 10}), nil),
+			kind:     protoparse.ErrMalformed,
+			layer:    protoparse.LayerAttr,
+			attrType: 14,
+			offset:   4 + 3 + 4,
+		},
+		{
+			name:     "EVPN route longer than the NLRI",
+			update:   updateBody(nil, concat(origin, mpReach(AFI_L2VPN, SAFI_EVPN, nh4, []byte{3, 30, 0})), nil),
+			kind:     protoparse.ErrTruncated,
+			layer:    protoparse.LayerNLRI,
+			attrType: 14,
+			offset:   4 + 4 + 3 + 4 + 4 + 1,
+		},
+		{
+			name:   "truncated NLRI",
+			update: updateBody(nil, origin, []byte{16, 10, 1, 24, 10}),
+			kind:   protoparse.ErrTruncated,
+			layer:  protoparse.LayerNLRI,
+			offset: 4 + 4 + 3,
+		},
+	}
+	for _, c := range cases {
+		// the offsets don't depend on where the update is in memory
+		buf := append(make([]byte, 0, 4096), c.update...)
+		_, err := NewBgpUpdateBuf(buf, false, true).Parse()
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+			continue
+		}
+		if !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not of kind %q", c.name, err, c.kind)
+		}
+		var perr *protoparse.ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error %q is not a ParseError", c.name, err)
+			continue
+		}
+		if perr.Layer != c.layer || perr.AttrType != c.attrType || perr.Offset != c.offset {
+			t.Errorf("%s: got layer %s type %d offset %d, expected layer %s type %d offset %d", c.name,
+				perr.Layer, perr.AttrType, perr.Offset, c.layer, c.attrType, c.offset)
+		}
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	_, err := NewBgpHeaderBuf(make([]byte, 10), false, true).Parse()
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerBGP || perr.Offset != 0 || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("expected a truncated BGP header error, got %v", err)
+	}
+
+	open := NewMessage(MSG_OPEN, []byte{4, 0xfd, 0xe8, 0, 90, 192, 0, 2, 1, 6, 2, 4, 65, 4, 0, 0})[BGP_HEADER_LEN:]
+	_, err = ParseOpen(open)
+	if !errors.As(err, &perr) || perr.Offset != 10+2+2 || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("expected a truncated capability at offset 14, got %v", err)
+	}
+}
@@ -0,0 +1,778 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+// BGP-LS NLRI and attribute (RFC7752) with the segment routing
+// extensions (RFC9085)
+const (
+	AFI_BGPLS     = 16388
+	SAFI_BGPLS    = 71
+	SAFI_BGPLSVPN = 72
+)
+
+type LSNLRIType uint16
+
+const (
+	LS_NODE_NLRI = LSNLRIType(iota + 1)
+	LS_LINK_NLRI
+	LS_IPV4_PREFIX_NLRI
+	LS_IPV6_PREFIX_NLRI
+)
+
+var lsNLRINames = map[LSNLRIType]string{
+	LS_NODE_NLRI:        "node",
+	LS_LINK_NLRI:        "link",
+	LS_IPV4_PREFIX_NLRI: "ipv4-prefix",
+	LS_IPV6_PREFIX_NLRI: "ipv6-prefix",
+}
+
+func (t LSNLRIType) String() string {
+	if name, ok := lsNLRINames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint16(t))
+}
+
+func (t LSNLRIType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type LSProtocolID uint8
+
+const (
+	LS_PROTO_ISIS_L1 = LSProtocolID(iota + 1)
+	LS_PROTO_ISIS_L2
+	LS_PROTO_OSPFV2
+	LS_PROTO_DIRECT
+	LS_PROTO_STATIC
+	LS_PROTO_OSPFV3
+	LS_PROTO_BGP
+)
+
+var lsProtocolNames = map[LSProtocolID]string{
+	LS_PROTO_ISIS_L1: "isis-l1",
+	LS_PROTO_ISIS_L2: "isis-l2",
+	LS_PROTO_OSPFV2:  "ospfv2",
+	LS_PROTO_DIRECT:  "direct",
+	LS_PROTO_STATIC:  "static",
+	LS_PROTO_OSPFV3:  "ospfv3",
+	LS_PROTO_BGP:     "bgp",
+}
+
+func (p LSProtocolID) String() string {
+	if name, ok := lsProtocolNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(p))
+}
+
+func (p LSProtocolID) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// NLRI descriptor TLV types
+const (
+	LS_TLV_LOCAL_NODE      = 256
+	LS_TLV_REMOTE_NODE     = 257
+	LS_TLV_LINK_IDS        = 258
+	LS_TLV_IPV4_IFACE      = 259
+	LS_TLV_IPV4_NEIGHBOR   = 260
+	LS_TLV_IPV6_IFACE      = 261
+	LS_TLV_IPV6_NEIGHBOR   = 262
+	LS_TLV_MT_ID           = 263
+	LS_TLV_OSPF_ROUTE_TYPE = 264
+	LS_TLV_IP_REACH        = 265
+	LS_TLV_AS              = 512
+	LS_TLV_BGPLS_ID        = 513
+	LS_TLV_OSPF_AREA_ID    = 514
+	LS_TLV_IGP_ROUTER_ID   = 515
+)
+
+// Attribute TLV types
+const (
+	LS_ATTR_NODE_FLAGS       = 1024
+	LS_ATTR_NODE_NAME        = 1026
+	LS_ATTR_ISIS_AREA_ID     = 1027
+	LS_ATTR_LOCAL_IPV4_RID   = 1028
+	LS_ATTR_LOCAL_IPV6_RID   = 1029
+	LS_ATTR_REMOTE_IPV4_RID  = 1030
+	LS_ATTR_REMOTE_IPV6_RID  = 1031
+	LS_ATTR_SR_CAPABILITIES  = 1034
+	LS_ATTR_SR_ALGORITHM     = 1035
+	LS_ATTR_SR_LOCAL_BLOCK   = 1036
+	LS_ATTR_ADMIN_GROUP      = 1088
+	LS_ATTR_MAX_BW           = 1089
+	LS_ATTR_MAX_RESV_BW      = 1090
+	LS_ATTR_UNRESV_BW        = 1091
+	LS_ATTR_TE_METRIC        = 1092
+	LS_ATTR_LINK_PROTECTION  = 1093
+	LS_ATTR_MPLS_PROTO_MASK  = 1094
+	LS_ATTR_IGP_METRIC       = 1095
+	LS_ATTR_SRLG             = 1096
+	LS_ATTR_LINK_NAME        = 1098
+	LS_ATTR_ADJ_SID          = 1099
+	LS_ATTR_LAN_ADJ_SID      = 1100
+	LS_ATTR_IGP_FLAGS        = 1152
+	LS_ATTR_ROUTE_TAG        = 1153
+	LS_ATTR_EXT_ROUTE_TAG    = 1154
+	LS_ATTR_PREFIX_METRIC    = 1155
+	LS_ATTR_OSPF_FWD_ADDR    = 1156
+	LS_ATTR_PREFIX_SID       = 1158
+	LS_SUBTLV_SID_LABEL      = 1161
+	LS_ATTR_PREFIX_ATTR_FLAG = 1170
+)
+
+// LSTLV is a TLV that was not understood. It is kept raw.
+type LSTLV struct {
+	Type  uint16   `json:"type"`
+	Value HexBytes `json:"value"`
+}
+
+// LSNodeDescriptor holds the sub-TLVs of a local or remote node descriptor.
+type LSNodeDescriptor struct {
+	AS          *uint32  `json:"as,omitempty"`
+	BGPLSID     *uint32  `json:"bgp_ls_id,omitempty"`
+	OSPFAreaID  *uint32  `json:"ospf_area_id,omitempty"`
+	IGPRouterID HexBytes `json:"igp_router_id,omitempty"`
+	Unknown     []*LSTLV `json:"unknown_tlvs,omitempty"`
+}
+
+// LSLinkDescriptor holds the link descriptor TLVs of a link NLRI.
+type LSLinkDescriptor struct {
+	LocalID          *uint32  `json:"local_id,omitempty"`
+	RemoteID         *uint32  `json:"remote_id,omitempty"`
+	IPv4Interface    net.IP   `json:"ipv4_interface,omitempty"`
+	IPv4Neighbor     net.IP   `json:"ipv4_neighbor,omitempty"`
+	IPv6Interface    net.IP   `json:"ipv6_interface,omitempty"`
+	IPv6Neighbor     net.IP   `json:"ipv6_neighbor,omitempty"`
+	MultiTopologyIDs []uint16 `json:"multi_topology_ids,omitempty"`
+	Unknown          []*LSTLV `json:"unknown_tlvs,omitempty"`
+}
+
+// LSPrefixDescriptor holds the prefix descriptor TLVs of a prefix NLRI.
+type LSPrefixDescriptor struct {
+	MultiTopologyIDs []uint16       `json:"multi_topology_ids,omitempty"`
+	OSPFRouteType    uint8          `json:"ospf_route_type,omitempty"`
+	Prefix           *PrefixWrapper `json:"prefix,omitempty"`
+	Unknown          []*LSTLV       `json:"unknown_tlvs,omitempty"`
+}
+
+// LSNLRI is a decoded BGP-LS NLRI. Link and Prefix are only set
+// for the respective NLRI types. RD is only set for SAFI 72.
+type LSNLRI struct {
+	Type       LSNLRIType          `json:"type"`
+	RD         *RouteDistinguisher `json:"rd,omitempty"`
+	ProtocolID LSProtocolID        `json:"protocol_id"`
+	Identifier uint64              `json:"identifier"`
+	LocalNode  *LSNodeDescriptor   `json:"local_node,omitempty"`
+	RemoteNode *LSNodeDescriptor   `json:"remote_node,omitempty"`
+	Link       *LSLinkDescriptor   `json:"link,omitempty"`
+	Prefix     *LSPrefixDescriptor `json:"prefix,omitempty"`
+	Unknown    []*LSTLV            `json:"unknown_tlvs,omitempty"`
+	// unknown NLRI types are kept raw
+	Raw HexBytes `json:"raw,omitempty"`
+}
+
+// LSSRRange is a range of an SRGB or SRLB. Either Label or Index is set
+// depending on the length of the SID/Label sub-TLV.
+type LSSRRange struct {
+	Size  uint32  `json:"size"`
+	Label *uint32 `json:"label,omitempty"`
+	Index *uint32 `json:"index,omitempty"`
+}
+
+// LSSRCapabilities is the SR capabilities or SR local block TLV.
+type LSSRCapabilities struct {
+	Flags  uint8        `json:"flags"`
+	Ranges []*LSSRRange `json:"ranges"`
+}
+
+// LSSID is an adjacency, LAN adjacency or prefix SID. SID is a label if it
+// was encoded in 3 bytes and an index if it was encoded in 4.
+type LSSID struct {
+	Flags      uint8    `json:"flags"`
+	Weight     uint8    `json:"weight,omitempty"`
+	Algorithm  uint8    `json:"algorithm,omitempty"`
+	NeighborID HexBytes `json:"neighbor_id,omitempty"`
+	Label      *uint32  `json:"label,omitempty"`
+	Index      *uint32  `json:"index,omitempty"`
+}
+
+// LSAttribute is the decoded BGP_LS_ATTRIBUTE. Which fields are set depends
+// on the type of the NLRI it was advertised with.
+type LSAttribute struct {
+	NodeFlags              *uint8            `json:"node_flags,omitempty"`
+	NodeName               string            `json:"node_name,omitempty"`
+	ISISAreaIDs            []HexBytes        `json:"isis_area_ids,omitempty"`
+	LocalRouterIDs         []net.IP          `json:"local_router_ids,omitempty"`
+	RemoteRouterIDs        []net.IP          `json:"remote_router_ids,omitempty"`
+	SRCapabilities         *LSSRCapabilities `json:"sr_capabilities,omitempty"`
+	SRAlgorithms           []uint32          `json:"sr_algorithms,omitempty"`
+	SRLocalBlock           *LSSRCapabilities `json:"sr_local_block,omitempty"`
+	AdminGroup             *uint32           `json:"admin_group,omitempty"`
+	MaxLinkBandwidth       *float32          `json:"max_link_bandwidth,omitempty"`
+	MaxReservableBandwidth *float32          `json:"max_reservable_bandwidth,omitempty"`
+	UnreservedBandwidth    []float32         `json:"unreserved_bandwidth,omitempty"`
+	TEDefaultMetric        *uint32           `json:"te_default_metric,omitempty"`
+	LinkProtection         *uint8            `json:"link_protection,omitempty"`
+	MPLSProtocolMask       *uint8            `json:"mpls_protocol_mask,omitempty"`
+	IGPMetric              *uint32           `json:"igp_metric,omitempty"`
+	SRLGs                  []uint32          `json:"srlgs,omitempty"`
+	LinkName               string            `json:"link_name,omitempty"`
+	AdjacencySIDs          []*LSSID          `json:"adjacency_sids,omitempty"`
+	IGPFlags               *uint8            `json:"igp_flags,omitempty"`
+	RouteTags              []uint32          `json:"route_tags,omitempty"`
+	ExtendedRouteTags      []uint64          `json:"extended_route_tags,omitempty"`
+	PrefixMetric           *uint32           `json:"prefix_metric,omitempty"`
+	OSPFForwardingAddress  net.IP            `json:"ospf_forwarding_address,omitempty"`
+	PrefixSIDs             []*LSSID          `json:"prefix_sids,omitempty"`
+	PrefixAttrFlags        *uint8            `json:"prefix_attr_flags,omitempty"`
+	Unknown                []*LSTLV          `json:"unknown_tlvs,omitempty"`
+}
+
+// HexBytes is a byte slice that is marshaled as a hex string.
+type HexBytes []byte
+
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%x", []byte(h))), nil
+}
+
+// lsTLVs splits buf in 2 byte type, 2 byte length TLVs.
+func lsTLVs(buf []byte) ([]*LSTLV, error) {
+	tlvs := []*LSTLV{}
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, fmt.Errorf("%w for BGP-LS TLV type and length", protoparse.ErrTruncated)
+		}
+		t, l := binary.BigEndian.Uint16(buf[:2]), int(binary.BigEndian.Uint16(buf[2:4]))
+		buf = buf[4:]
+		if l > len(buf) {
+			return nil, fmt.Errorf("%w for BGP-LS TLV %d of length %d, %d remain", protoparse.ErrTruncated, t, l, len(buf))
+		}
+		val := make([]byte, l)
+		copy(val, buf[:l])
+		tlvs = append(tlvs, &LSTLV{t, val})
+		buf = buf[l:]
+	}
+	return tlvs, nil
+}
+
+func lsLenErr(t uint16, l int) error {
+	return fmt.Errorf("BGP-LS TLV %d has an invalid length:%d", t, l)
+}
+
+func u32p(v uint32) *uint32 {
+	return &v
+}
+
+func u8p(v uint8) *uint8 {
+	return &v
+}
+
+func f32p(v float32) *float32 {
+	return &v
+}
+
+// readLSNLRI reads all the BGP-LS NLRI in buf. Each one is a 2 byte type, 2 byte length, value.
+func readLSNLRI(buf []byte, vpn bool) ([]*LSNLRI, error) {
+	nlris := []*LSNLRI{}
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, fmt.Errorf("%w for BGP-LS NLRI type and length", protoparse.ErrTruncated)
+		}
+		ntype, nlen := LSNLRIType(binary.BigEndian.Uint16(buf[:2])), int(binary.BigEndian.Uint16(buf[2:4]))
+		buf = buf[4:]
+		if nlen > len(buf) {
+			return nil, fmt.Errorf("%w for BGP-LS NLRI of length %d, %d remain", protoparse.ErrTruncated, nlen, len(buf))
+		}
+		nlri, err := readLSNLRIValue(ntype, buf[:nlen], vpn)
+		if err != nil {
+			return nil, err
+		}
+		nlris = append(nlris, nlri)
+		buf = buf[nlen:]
+	}
+	return nlris, nil
+}
+
+func readLSNLRIValue(ntype LSNLRIType, buf []byte, vpn bool) (*LSNLRI, error) {
+	nlri := &LSNLRI{Type: ntype}
+	if vpn {
+		if len(buf) < RD_LEN {
+			return nil, fmt.Errorf("%w for BGP-LS VPN route distinguisher", protoparse.ErrTruncated)
+		}
+		rd := newRouteDistinguisher(buf)
+		nlri.RD = &rd
+		buf = buf[RD_LEN:]
+	}
+	switch ntype {
+	case LS_NODE_NLRI, LS_LINK_NLRI, LS_IPV4_PREFIX_NLRI, LS_IPV6_PREFIX_NLRI:
+	default:
+		nlri.Raw = append(HexBytes{}, buf...)
+		return nlri, nil
+	}
+	if len(buf) < 9 {
+		return nil, fmt.Errorf("%w for BGP-LS %s NLRI protocol and identifier", protoparse.ErrTruncated, ntype)
+	}
+	nlri.ProtocolID = LSProtocolID(buf[0])
+	nlri.Identifier = binary.BigEndian.Uint64(buf[1:9])
+	tlvs, err := lsTLVs(buf[9:])
+	if err != nil {
+		return nil, err
+	}
+	for _, tlv := range tlvs {
+		switch {
+		case tlv.Type == LS_TLV_LOCAL_NODE:
+			if nlri.LocalNode, err = readLSNodeDescriptor(tlv.Value); err != nil {
+				return nil, err
+			}
+		case tlv.Type == LS_TLV_REMOTE_NODE && ntype == LS_LINK_NLRI:
+			if nlri.RemoteNode, err = readLSNodeDescriptor(tlv.Value); err != nil {
+				return nil, err
+			}
+		case ntype == LS_LINK_NLRI && tlv.Type >= LS_TLV_LINK_IDS && tlv.Type <= LS_TLV_MT_ID:
+			if nlri.Link == nil {
+				nlri.Link = new(LSLinkDescriptor)
+			}
+			if err = readLSLinkDescriptor(nlri.Link, tlv); err != nil {
+				return nil, err
+			}
+		case (ntype == LS_IPV4_PREFIX_NLRI || ntype == LS_IPV6_PREFIX_NLRI) && tlv.Type >= LS_TLV_MT_ID && tlv.Type <= LS_TLV_IP_REACH:
+			if nlri.Prefix == nil {
+				nlri.Prefix = new(LSPrefixDescriptor)
+			}
+			if err = readLSPrefixDescriptor(nlri.Prefix, tlv, ntype == LS_IPV6_PREFIX_NLRI); err != nil {
+				return nil, err
+			}
+		default:
+			nlri.Unknown = append(nlri.Unknown, tlv)
+		}
+	}
+	return nlri, nil
+}
+
+func readLSNodeDescriptor(buf []byte) (*LSNodeDescriptor, error) {
+	tlvs, err := lsTLVs(buf)
+	if err != nil {
+		return nil, err
+	}
+	nd := new(LSNodeDescriptor)
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case LS_TLV_AS, LS_TLV_BGPLS_ID, LS_TLV_OSPF_AREA_ID:
+			if len(tlv.Value) != 4 {
+				return nil, lsLenErr(tlv.Type, len(tlv.Value))
+			}
+			v := u32p(binary.BigEndian.Uint32(tlv.Value))
+			switch tlv.Type {
+			case LS_TLV_AS:
+				nd.AS = v
+			case LS_TLV_BGPLS_ID:
+				nd.BGPLSID = v
+			default:
+				nd.OSPFAreaID = v
+			}
+		case LS_TLV_IGP_ROUTER_ID:
+			nd.IGPRouterID = tlv.Value
+		default:
+			nd.Unknown = append(nd.Unknown, tlv)
+		}
+	}
+	return nd, nil
+}
+
+func readLSLinkDescriptor(ld *LSLinkDescriptor, tlv *LSTLV) error {
+	val := tlv.Value
+	switch tlv.Type {
+	case LS_TLV_LINK_IDS:
+		if len(val) != 8 {
+			return lsLenErr(tlv.Type, len(val))
+		}
+		ld.LocalID = u32p(binary.BigEndian.Uint32(val[:4]))
+		ld.RemoteID = u32p(binary.BigEndian.Uint32(val[4:8]))
+	case LS_TLV_IPV4_IFACE, LS_TLV_IPV4_NEIGHBOR:
+		if len(val) != 4 {
+			return lsLenErr(tlv.Type, len(val))
+		}
+		if tlv.Type == LS_TLV_IPV4_IFACE {
+			ld.IPv4Interface = net.IP(val)
+		} else {
+			ld.IPv4Neighbor = net.IP(val)
+		}
+	case LS_TLV_IPV6_IFACE, LS_TLV_IPV6_NEIGHBOR:
+		if len(val) != 16 {
+			return lsLenErr(tlv.Type, len(val))
+		}
+		if tlv.Type == LS_TLV_IPV6_IFACE {
+			ld.IPv6Interface = net.IP(val)
+		} else {
+			ld.IPv6Neighbor = net.IP(val)
+		}
+	case LS_TLV_MT_ID:
+		mtids, err := readMTIDs(tlv)
+		if err != nil {
+			return err
+		}
+		ld.MultiTopologyIDs = mtids
+	}
+	return nil
+}
+
+func readLSPrefixDescriptor(pd *LSPrefixDescriptor, tlv *LSTLV, v6 bool) error {
+	val := tlv.Value
+	switch tlv.Type {
+	case LS_TLV_MT_ID:
+		mtids, err := readMTIDs(tlv)
+		if err != nil {
+			return err
+		}
+		pd.MultiTopologyIDs = mtids
+	case LS_TLV_OSPF_ROUTE_TYPE:
+		if len(val) != 1 {
+			return lsLenErr(tlv.Type, len(val))
+		}
+		pd.OSPFRouteType = val[0]
+	case LS_TLV_IP_REACH:
+		if len(val) < 1 {
+			return lsLenErr(tlv.Type, len(val))
+		}
+		iplen := 4
+		if v6 {
+			iplen = 16
+		}
+		bitlen := int(val[0])
+		if bitlen > iplen*8 || (bitlen+7)/8 != len(val)-1 {
+			return fmt.Errorf("BGP-LS IP reachability has an invalid prefix length:%d", bitlen)
+		}
+		IPbuf := make([]byte, iplen)
+		copy(IPbuf, val[1:])
+		pd.Prefix = &PrefixWrapper{net.IP(IPbuf), uint32(bitlen)}
+	}
+	return nil
+}
+
+func readMTIDs(tlv *LSTLV) ([]uint16, error) {
+	if len(tlv.Value)%2 != 0 {
+		return nil, lsLenErr(tlv.Type, len(tlv.Value))
+	}
+	mtids := []uint16{}
+	for i := 0; i < len(tlv.Value); i += 2 {
+		mtids = append(mtids, binary.BigEndian.Uint16(tlv.Value[i:i+2])&0x0fff)
+	}
+	return mtids, nil
+}
+
+// readLSAttribute decodes the TLVs in a BGP_LS_ATTRIBUTE. TLVs that are
+// not understood are kept in Unknown.
+func readLSAttribute(buf []byte) (*LSAttribute, error) {
+	tlvs, err := lsTLVs(buf)
+	if err != nil {
+		return nil, err
+	}
+	la := new(LSAttribute)
+	for _, tlv := range tlvs {
+		val := tlv.Value
+		switch tlv.Type {
+		case LS_ATTR_NODE_FLAGS, LS_ATTR_LINK_PROTECTION, LS_ATTR_MPLS_PROTO_MASK, LS_ATTR_IGP_FLAGS, LS_ATTR_PREFIX_ATTR_FLAG:
+			if len(val) < 1 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			switch tlv.Type {
+			case LS_ATTR_NODE_FLAGS:
+				la.NodeFlags = u8p(val[0])
+			case LS_ATTR_LINK_PROTECTION:
+				la.LinkProtection = u8p(val[0])
+			case LS_ATTR_MPLS_PROTO_MASK:
+				la.MPLSProtocolMask = u8p(val[0])
+			case LS_ATTR_IGP_FLAGS:
+				la.IGPFlags = u8p(val[0])
+			default:
+				la.PrefixAttrFlags = u8p(val[0])
+			}
+		case LS_ATTR_NODE_NAME:
+			la.NodeName = string(val)
+		case LS_ATTR_LINK_NAME:
+			la.LinkName = string(val)
+		case LS_ATTR_ISIS_AREA_ID:
+			la.ISISAreaIDs = append(la.ISISAreaIDs, val)
+		case LS_ATTR_LOCAL_IPV4_RID, LS_ATTR_LOCAL_IPV6_RID, LS_ATTR_REMOTE_IPV4_RID, LS_ATTR_REMOTE_IPV6_RID, LS_ATTR_OSPF_FWD_ADDR:
+			if len(val) != 4 && len(val) != 16 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			switch tlv.Type {
+			case LS_ATTR_LOCAL_IPV4_RID, LS_ATTR_LOCAL_IPV6_RID:
+				la.LocalRouterIDs = append(la.LocalRouterIDs, net.IP(val))
+			case LS_ATTR_REMOTE_IPV4_RID, LS_ATTR_REMOTE_IPV6_RID:
+				la.RemoteRouterIDs = append(la.RemoteRouterIDs, net.IP(val))
+			default:
+				la.OSPFForwardingAddress = net.IP(val)
+			}
+		case LS_ATTR_SR_CAPABILITIES, LS_ATTR_SR_LOCAL_BLOCK:
+			srcap, err := readLSSRCapabilities(tlv)
+			if err != nil {
+				return nil, err
+			}
+			if tlv.Type == LS_ATTR_SR_CAPABILITIES {
+				la.SRCapabilities = srcap
+			} else {
+				la.SRLocalBlock = srcap
+			}
+		case LS_ATTR_SR_ALGORITHM:
+			for _, alg := range val {
+				la.SRAlgorithms = append(la.SRAlgorithms, uint32(alg))
+			}
+		case LS_ATTR_ADMIN_GROUP, LS_ATTR_PREFIX_METRIC:
+			if len(val) != 4 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			if tlv.Type == LS_ATTR_ADMIN_GROUP {
+				la.AdminGroup = u32p(binary.BigEndian.Uint32(val))
+			} else {
+				la.PrefixMetric = u32p(binary.BigEndian.Uint32(val))
+			}
+		case LS_ATTR_MAX_BW, LS_ATTR_MAX_RESV_BW:
+			if len(val) != 4 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			bw := f32p(math.Float32frombits(binary.BigEndian.Uint32(val)))
+			if tlv.Type == LS_ATTR_MAX_BW {
+				la.MaxLinkBandwidth = bw
+			} else {
+				la.MaxReservableBandwidth = bw
+			}
+		case LS_ATTR_UNRESV_BW:
+			if len(val) != 32 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			for i := 0; i < 32; i += 4 {
+				la.UnreservedBandwidth = append(la.UnreservedBandwidth, math.Float32frombits(binary.BigEndian.Uint32(val[i:i+4])))
+			}
+		case LS_ATTR_TE_METRIC, LS_ATTR_IGP_METRIC:
+			// the IGP metric is 1 to 3 bytes and TE metric is 3 or 4 bytes depending on implementation
+			if len(val) < 1 || len(val) > 4 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			metric := uint32(0)
+			for _, b := range val {
+				metric = metric<<8 | uint32(b)
+			}
+			if tlv.Type == LS_ATTR_IGP_METRIC {
+				if len(val) == 1 { // IS-IS narrow metrics are 6 bits
+					metric &= 0x3f
+				}
+				la.IGPMetric = u32p(metric)
+			} else {
+				la.TEDefaultMetric = u32p(metric)
+			}
+		case LS_ATTR_SRLG, LS_ATTR_ROUTE_TAG:
+			if len(val)%4 != 0 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			for i := 0; i < len(val); i += 4 {
+				v := binary.BigEndian.Uint32(val[i : i+4])
+				if tlv.Type == LS_ATTR_SRLG {
+					la.SRLGs = append(la.SRLGs, v)
+				} else {
+					la.RouteTags = append(la.RouteTags, v)
+				}
+			}
+		case LS_ATTR_EXT_ROUTE_TAG:
+			if len(val)%8 != 0 {
+				return nil, lsLenErr(tlv.Type, len(val))
+			}
+			for i := 0; i < len(val); i += 8 {
+				la.ExtendedRouteTags = append(la.ExtendedRouteTags, binary.BigEndian.Uint64(val[i:i+8]))
+			}
+		case LS_ATTR_ADJ_SID, LS_ATTR_LAN_ADJ_SID, LS_ATTR_PREFIX_SID:
+			sid, err := readLSSID(tlv)
+			if err != nil {
+				return nil, err
+			}
+			if tlv.Type == LS_ATTR_PREFIX_SID {
+				la.PrefixSIDs = append(la.PrefixSIDs, sid)
+			} else {
+				la.AdjacencySIDs = append(la.AdjacencySIDs, sid)
+			}
+		default:
+			la.Unknown = append(la.Unknown, tlv)
+		}
+	}
+	return la, nil
+}
+
+// setSID sets the label or the index of a SID depending on its length.
+func setSID(label, index **uint32, val []byte) error {
+	switch len(val) {
+	case 3:
+		*label = u32p((uint32(val[0])<<16 | uint32(val[1])<<8 | uint32(val[2])) & 0xfffff)
+	case 4:
+		*index = u32p(binary.BigEndian.Uint32(val))
+	default:
+		return fmt.Errorf("SID/Label should be 3 or 4 bytes and it is:%d", len(val))
+	}
+	return nil
+}
+
+func readLSSRCapabilities(tlv *LSTLV) (*LSSRCapabilities, error) {
+	val := tlv.Value
+	if len(val) < 2 {
+		return nil, lsLenErr(tlv.Type, len(val))
+	}
+	srcap := &LSSRCapabilities{Flags: val[0]}
+	val = val[2:]
+	for len(val) > 0 {
+		// range size(3) followed by a SID/Label sub-TLV
+		if len(val) < 7 {
+			return nil, lsLenErr(tlv.Type, len(tlv.Value))
+		}
+		r := &LSSRRange{Size: uint32(val[0])<<16 | uint32(val[1])<<8 | uint32(val[2])}
+		st, sl := binary.BigEndian.Uint16(val[3:5]), int(binary.BigEndian.Uint16(val[5:7]))
+		if st != LS_SUBTLV_SID_LABEL || 7+sl > len(val) {
+			return nil, fmt.Errorf("BGP-LS TLV %d range is missing its SID/Label sub-TLV", tlv.Type)
+		}
+		if err := setSID(&r.Label, &r.Index, val[7:7+sl]); err != nil {
+			return nil, err
+		}
+		srcap.Ranges = append(srcap.Ranges, r)
+		val = val[7+sl:]
+	}
+	return srcap, nil
+}
+
+func readLSSID(tlv *LSTLV) (*LSSID, error) {
+	val := tlv.Value
+	if len(val) < 4 {
+		return nil, lsLenErr(tlv.Type, len(val))
+	}
+	sid := &LSSID{Flags: val[0]}
+	switch tlv.Type {
+	case LS_ATTR_PREFIX_SID:
+		sid.Algorithm = val[1]
+	default:
+		sid.Weight = val[1]
+	}
+	val = val[4:]
+	if tlv.Type == LS_ATTR_LAN_ADJ_SID {
+		// the neighbor is a 4 byte OSPF router id or a 6 byte IS-IS system id
+		// followed by a 3 or 4 byte SID.
+		nlen := 6
+		if len(val) == 7 || len(val) == 8 {
+			nlen = 4
+		}
+		if len(val) < nlen {
+			return nil, lsLenErr(tlv.Type, len(tlv.Value))
+		}
+		sid.NeighborID = append(HexBytes{}, val[:nlen]...)
+		val = val[nlen:]
+	}
+	if err := setSID(&sid.Label, &sid.Index, val); err != nil {
+		return nil, err
+	}
+	return sid, nil
+}
+
+func (n *LSNodeDescriptor) String() string {
+	ret := ""
+	if n.AS != nil {
+		ret += fmt.Sprintf(" as:%d", *n.AS)
+	}
+	if n.BGPLSID != nil {
+		ret += fmt.Sprintf(" bgp-ls-id:%d", *n.BGPLSID)
+	}
+	if n.OSPFAreaID != nil {
+		ret += fmt.Sprintf(" area:%d", *n.OSPFAreaID)
+	}
+	if n.IGPRouterID != nil {
+		ret += fmt.Sprintf(" router-id:%x", []byte(n.IGPRouterID))
+	}
+	return ret
+}
+
+func (l *LSNLRI) String() string {
+	ret := fmt.Sprintf("[type: %s]", l.Type)
+	if l.RD != nil {
+		ret += fmt.Sprintf("[rd: %s]", l.RD)
+	}
+	if l.Raw != nil {
+		return ret + fmt.Sprintf("[raw: %x]", []byte(l.Raw))
+	}
+	ret += fmt.Sprintf("[protocol: %s][id: %d]", l.ProtocolID, l.Identifier)
+	if l.LocalNode != nil {
+		ret += fmt.Sprintf("[local:%s]", l.LocalNode)
+	}
+	if l.RemoteNode != nil {
+		ret += fmt.Sprintf("[remote:%s]", l.RemoteNode)
+	}
+	if l.Link != nil {
+		if l.Link.IPv4Interface != nil {
+			ret += fmt.Sprintf("[iface: %s]", l.Link.IPv4Interface)
+		}
+		if l.Link.IPv4Neighbor != nil {
+			ret += fmt.Sprintf("[neighbor: %s]", l.Link.IPv4Neighbor)
+		}
+		if l.Link.IPv6Interface != nil {
+			ret += fmt.Sprintf("[iface: %s]", l.Link.IPv6Interface)
+		}
+		if l.Link.IPv6Neighbor != nil {
+			ret += fmt.Sprintf("[neighbor: %s]", l.Link.IPv6Neighbor)
+		}
+		if l.Link.LocalID != nil {
+			ret += fmt.Sprintf("[link-id: %d/%d]", *l.Link.LocalID, *l.Link.RemoteID)
+		}
+	}
+	if l.Prefix != nil && l.Prefix.Prefix != nil {
+		ret += fmt.Sprintf("[prefix: %s/%d]", l.Prefix.Prefix.Prefix, l.Prefix.Prefix.Mask)
+	}
+	if len(l.Unknown) > 0 {
+		ret += fmt.Sprintf("[unknown tlvs: %d]", len(l.Unknown))
+	}
+	return ret
+}
+
+func (la *LSAttribute) String() string {
+	ret := ""
+	if la.NodeName != "" {
+		ret += fmt.Sprintf(" node-name:%s", la.NodeName)
+	}
+	if len(la.LocalRouterIDs) > 0 {
+		ret += fmt.Sprintf(" local-router-ids:%v", la.LocalRouterIDs)
+	}
+	if len(la.RemoteRouterIDs) > 0 {
+		ret += fmt.Sprintf(" remote-router-ids:%v", la.RemoteRouterIDs)
+	}
+	if la.IGPMetric != nil {
+		ret += fmt.Sprintf(" igp-metric:%d", *la.IGPMetric)
+	}
+	if la.TEDefaultMetric != nil {
+		ret += fmt.Sprintf(" te-metric:%d", *la.TEDefaultMetric)
+	}
+	if la.MaxLinkBandwidth != nil {
+		ret += fmt.Sprintf(" max-bw:%g", *la.MaxLinkBandwidth)
+	}
+	if la.MaxReservableBandwidth != nil {
+		ret += fmt.Sprintf(" max-resv-bw:%g", *la.MaxReservableBandwidth)
+	}
+	if la.PrefixMetric != nil {
+		ret += fmt.Sprintf(" prefix-metric:%d", *la.PrefixMetric)
+	}
+	if la.SRCapabilities != nil {
+		ret += fmt.Sprintf(" sr-ranges:%d", len(la.SRCapabilities.Ranges))
+	}
+	if len(la.AdjacencySIDs) > 0 {
+		ret += fmt.Sprintf(" adj-sids:%d", len(la.AdjacencySIDs))
+	}
+	if len(la.PrefixSIDs) > 0 {
+		ret += fmt.Sprintf(" prefix-sids:%d", len(la.PrefixSIDs))
+	}
+	if len(la.Unknown) > 0 {
+		ret += fmt.Sprintf(" unknown-tlvs:%d", len(la.Unknown))
+	}
+	return ret
+}
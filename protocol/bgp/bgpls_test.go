@@ -0,0 +1,237 @@
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+func lsTLV(t uint16, val ...[]byte) []byte {
+	v := concat(val...)
+	return append([]byte{byte(t >> 8), byte(t), byte(len(v) >> 8), byte(len(v))}, v...)
+}
+
+// lsNLRI encodes an NLRI with an identifier of 0.
+func lsNLRI(ntype LSNLRIType, proto LSProtocolID, tlvs ...[]byte) []byte {
+	return lsTLV(uint16(ntype), []byte{byte(proto), 0, 0, 0, 0, 0, 0, 0, 0}, concat(tlvs...))
+}
+
+func be32(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+var (
+	lsAS      = lsTLV(LS_TLV_AS, be32(65000))
+	lsLocal   = lsTLV(LS_TLV_LOCAL_NODE, lsAS, lsTLV(LS_TLV_IGP_ROUTER_ID, []byte{192, 0, 2, 1}))
+	lsRemote  = lsTLV(LS_TLV_REMOTE_NODE, lsAS, lsTLV(LS_TLV_IGP_ROUTER_ID, []byte{192, 0, 2, 2}))
+	lsUnknown = lsTLV(1171, []byte{1, 2, 3})
+)
+
+func TestLSNLRI(t *testing.T) {
+	cases := []struct {
+		name string
+		nlri []byte
+		vpn  bool
+		want string
+	}{
+		{"node", lsNLRI(LS_NODE_NLRI, LS_PROTO_ISIS_L2, lsTLV(LS_TLV_LOCAL_NODE, lsAS,
+			lsTLV(LS_TLV_BGPLS_ID, be32(0)), lsTLV(LS_TLV_IGP_ROUTER_ID, []byte{0, 0, 0, 0, 0, 1}))),
+			false, "[type: node][protocol: isis-l2][id: 0][local: as:65000 bgp-ls-id:0 router-id:000000000001]"},
+		{"IPv4 link", lsNLRI(LS_LINK_NLRI, LS_PROTO_OSPFV2, lsLocal, lsRemote,
+			lsTLV(LS_TLV_LINK_IDS, be32(1), be32(2)),
+			lsTLV(LS_TLV_IPV4_IFACE, []byte{10, 0, 0, 1}), lsTLV(LS_TLV_IPV4_NEIGHBOR, []byte{10, 0, 0, 2})),
+			false, "[type: link][protocol: ospfv2][id: 0][local: as:65000 router-id:c0000201][remote: as:65000 router-id:c0000202][iface: 10.0.0.1][neighbor: 10.0.0.2][link-id: 1/2]"},
+		{"IPv6 link", lsNLRI(LS_LINK_NLRI, LS_PROTO_ISIS_L1, lsLocal, lsRemote,
+			lsTLV(LS_TLV_IPV6_IFACE, nh6), lsTLV(LS_TLV_IPV6_NEIGHBOR, net.ParseIP("2001:db8::2")), lsTLV(LS_TLV_MT_ID, []byte{0, 2})),
+			false, "[type: link][protocol: isis-l1][id: 0][local: as:65000 router-id:c0000201][remote: as:65000 router-id:c0000202][iface: 2001:db8::1][neighbor: 2001:db8::2]"},
+		{"IPv4 prefix", lsNLRI(LS_IPV4_PREFIX_NLRI, LS_PROTO_OSPFV2, lsLocal,
+			lsTLV(LS_TLV_OSPF_ROUTE_TYPE, []byte{1}), lsTLV(LS_TLV_IP_REACH, []byte{24, 10, 1, 2})),
+			false, "[type: ipv4-prefix][protocol: ospfv2][id: 0][local: as:65000 router-id:c0000201][prefix: 10.1.2.0/24]"},
+		{"IPv6 prefix", lsNLRI(LS_IPV6_PREFIX_NLRI, LS_PROTO_ISIS_L2, lsLocal,
+			lsTLV(LS_TLV_IP_REACH, []byte{32, 0x20, 0x01, 0x0d, 0xb8})),
+			false, "[type: ipv6-prefix][protocol: isis-l2][id: 0][local: as:65000 router-id:c0000201][prefix: 2001:db8::/32]"},
+		{"VPN node", concat(lsTLV(uint16(LS_NODE_NLRI), []byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1}, []byte{byte(LS_PROTO_BGP), 0, 0, 0, 0, 0, 0, 0, 7}, lsLocal)),
+			true, "[type: node][rd: 65000:1][protocol: bgp][id: 7][local: as:65000 router-id:c0000201]"},
+		{"unknown NLRI type", lsTLV(6, []byte{0xde, 0xad}),
+			false, "[type: unknown-6][raw: dead]"},
+		{"unknown TLV", lsNLRI(LS_NODE_NLRI, LS_PROTO_STATIC, lsLocal, lsUnknown),
+			false, "[type: node][protocol: static][id: 0][local: as:65000 router-id:c0000201][unknown tlvs: 1]"},
+	}
+	for _, c := range cases {
+		nlris, err := readLSNLRI(c.nlri, c.vpn)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if len(nlris) != 1 || nlris[0].String() != c.want {
+			t.Errorf("%s: got %v want %s", c.name, nlris, c.want)
+		}
+	}
+
+	// unknown TLVs are kept as they are, at the NLRI and the node descriptor level
+	nlris, err := readLSNLRI(lsNLRI(LS_NODE_NLRI, LS_PROTO_DIRECT,
+		lsTLV(LS_TLV_LOCAL_NODE, lsAS, lsTLV(516, []byte{192, 0, 2, 9})), lsUnknown), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := nlris[0]
+	if len(n.Unknown) != 1 || n.Unknown[0].Type != 1171 || fmt.Sprintf("%x", []byte(n.Unknown[0].Value)) != "010203" {
+		t.Errorf("bad unknown NLRI TLVs %v", n.Unknown)
+	}
+	if len(n.LocalNode.Unknown) != 1 || n.LocalNode.Unknown[0].Type != 516 || net.IP(n.LocalNode.Unknown[0].Value).String() != "192.0.2.9" {
+		t.Errorf("bad unknown node descriptor TLVs %v", n.LocalNode.Unknown)
+	}
+}
+
+func TestLSNLRIErrors(t *testing.T) {
+	// kind is nil when any error will do
+	cases := []struct {
+		name string
+		nlri []byte
+		vpn  bool
+		kind error
+	}{
+		{"missing length", []byte{0, 1, 0}, false, protoparse.ErrTruncated},
+		{"length past the end", []byte{0, 1, 0, 20, 2, 0}, false, protoparse.ErrTruncated},
+		{"truncated identifier", lsTLV(uint16(LS_NODE_NLRI), []byte{2, 0, 0, 0}), false, protoparse.ErrTruncated},
+		{"truncated route distinguisher", lsTLV(uint16(LS_NODE_NLRI), []byte{0, 0, 0xfd}), true, protoparse.ErrTruncated},
+		{"truncated TLV", lsNLRI(LS_NODE_NLRI, LS_PROTO_OSPFV2, lsLocal[:len(lsLocal)-2]), false, protoparse.ErrTruncated},
+		{"truncated node descriptor TLV", lsNLRI(LS_NODE_NLRI, LS_PROTO_OSPFV2, lsTLV(LS_TLV_LOCAL_NODE, lsAS[:6])), false, protoparse.ErrTruncated},
+		{"AS length", lsNLRI(LS_NODE_NLRI, LS_PROTO_OSPFV2, lsTLV(LS_TLV_LOCAL_NODE, lsTLV(LS_TLV_AS, []byte{0, 1}))), false, nil},
+		{"link IDs length", lsNLRI(LS_LINK_NLRI, LS_PROTO_OSPFV2, lsLocal, lsTLV(LS_TLV_LINK_IDS, be32(1))), false, nil},
+		{"IPv6 interface length", lsNLRI(LS_LINK_NLRI, LS_PROTO_OSPFV2, lsLocal, lsTLV(LS_TLV_IPV6_IFACE, nh4)), false, nil},
+		{"multi topology length", lsNLRI(LS_LINK_NLRI, LS_PROTO_OSPFV2, lsLocal, lsTLV(LS_TLV_MT_ID, []byte{0})), false, nil},
+		{"prefix length", lsNLRI(LS_IPV4_PREFIX_NLRI, LS_PROTO_OSPFV2, lsLocal, lsTLV(LS_TLV_IP_REACH, []byte{33, 10, 0, 0, 0, 0})), false, nil},
+		{"prefix bytes", lsNLRI(LS_IPV4_PREFIX_NLRI, LS_PROTO_OSPFV2, lsLocal, lsTLV(LS_TLV_IP_REACH, []byte{24, 10, 0})), false, nil},
+	}
+	for _, c := range cases {
+		_, err := readLSNLRI(c.nlri, c.vpn)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+		} else if c.kind != nil && !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not %q", c.name, err, c.kind)
+		}
+	}
+}
+
+func TestLSAttribute(t *testing.T) {
+	sidLabel := func(v ...byte) []byte { return lsTLV(LS_SUBTLV_SID_LABEL, v) }
+	bw := be32(math.Float32bits(125000000))
+	attr := concat(
+		// node
+		lsTLV(LS_ATTR_NODE_FLAGS, []byte{0x20}),
+		lsTLV(LS_ATTR_NODE_NAME, []byte("r1")),
+		lsTLV(LS_ATTR_LOCAL_IPV4_RID, []byte{192, 0, 2, 1}),
+		lsTLV(LS_ATTR_SR_CAPABILITIES, []byte{0x80, 0}, []byte{0, 0x1f, 0x40}, sidLabel(0, 0x3e, 0x80),
+			[]byte{0, 0, 100}, sidLabel(0, 0, 0, 0)),
+		lsTLV(LS_ATTR_SR_ALGORITHM, []byte{0, 1}),
+		lsTLV(LS_ATTR_SR_LOCAL_BLOCK, []byte{0, 0}, []byte{0, 0x03, 0xe8}, sidLabel(0, 0x3a, 0x98)),
+		// link
+		lsTLV(LS_ATTR_REMOTE_IPV6_RID, nh6),
+		lsTLV(LS_ATTR_MAX_BW, bw),
+		lsTLV(LS_ATTR_UNRESV_BW, bw, bw, bw, bw, bw, bw, bw, bw),
+		lsTLV(LS_ATTR_TE_METRIC, []byte{0, 0, 10}),
+		lsTLV(LS_ATTR_IGP_METRIC, []byte{0xca}),
+		lsTLV(LS_ATTR_SRLG, be32(1), be32(2)),
+		lsTLV(LS_ATTR_ADJ_SID, []byte{0x30, 0, 0, 0}, []byte{0x00, 0x5d, 0xc1}),
+		lsTLV(LS_ATTR_LAN_ADJ_SID, []byte{0x30, 0, 0, 0}, []byte{0, 0, 0, 0, 0, 2}, []byte{0x00, 0x5d, 0xc2}),
+		lsTLV(LS_ATTR_LAN_ADJ_SID, []byte{0x20, 0, 0, 0}, []byte{192, 0, 2, 3}, be32(5)),
+		// prefix
+		lsTLV(LS_ATTR_PREFIX_METRIC, be32(20)),
+		lsTLV(LS_ATTR_PREFIX_SID, []byte{0x40, 0, 0, 0}, be32(101)),
+		lsTLV(LS_ATTR_ROUTE_TAG, be32(7)),
+		lsUnknown,
+		lsTLV(1172, nil),
+	)
+	la, err := readLSAttribute(attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " node-name:r1 local-router-ids:[192.0.2.1] remote-router-ids:[2001:db8::1] igp-metric:10 te-metric:10 max-bw:1.25e+08 prefix-metric:20 sr-ranges:2 adj-sids:3 prefix-sids:1 unknown-tlvs:2"; la.String() != want {
+		t.Errorf("got %q want %q", la, want)
+	}
+	if *la.NodeFlags != 0x20 || fmt.Sprint(la.SRAlgorithms) != "[0 1]" || fmt.Sprint(la.SRLGs) != "[1 2]" ||
+		fmt.Sprint(la.RouteTags) != "[7]" || len(la.UnreservedBandwidth) != 8 || la.UnreservedBandwidth[7] != 125000000 {
+		t.Errorf("bad attribute %+v", la)
+	}
+
+	// SIDs are labels in 3 bytes and indexes in 4
+	srgb := la.SRCapabilities.Ranges
+	if srgb[0].Size != 8000 || *srgb[0].Label != 16000 || srgb[0].Index != nil || srgb[1].Size != 100 || *srgb[1].Index != 0 {
+		t.Errorf("bad SRGB %+v %+v", srgb[0], srgb[1])
+	}
+	if srlb := la.SRLocalBlock.Ranges; len(srlb) != 1 || srlb[0].Size != 1000 || *srlb[0].Label != 15000 {
+		t.Errorf("bad SRLB %v", la.SRLocalBlock)
+	}
+	adj := la.AdjacencySIDs
+	if adj[0].Flags != 0x30 || *adj[0].Label != 24001 || adj[0].NeighborID != nil {
+		t.Errorf("bad adjacency SID %+v", adj[0])
+	}
+	if fmt.Sprintf("%x", []byte(adj[1].NeighborID)) != "000000000002" || *adj[1].Label != 24002 {
+		t.Errorf("bad IS-IS LAN adjacency SID %+v", adj[1])
+	}
+	if fmt.Sprintf("%x", []byte(adj[2].NeighborID)) != "c0000203" || *adj[2].Index != 5 {
+		t.Errorf("bad OSPF LAN adjacency SID %+v", adj[2])
+	}
+	if sid := la.PrefixSIDs[0]; sid.Flags != 0x40 || *sid.Index != 101 || sid.Label != nil {
+		t.Errorf("bad prefix SID %+v", sid)
+	}
+
+	// unknown TLVs are kept as they are
+	if la.Unknown[0].Type != 1171 || fmt.Sprintf("%x", []byte(la.Unknown[0].Value)) != "010203" ||
+		la.Unknown[1].Type != 1172 || len(la.Unknown[1].Value) != 0 {
+		t.Errorf("bad unknown TLVs %v %v", la.Unknown[0], la.Unknown[1])
+	}
+}
+
+func TestLSAttributeErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		attr []byte
+		kind error
+	}{
+		{"truncated TLV", lsTLV(LS_ATTR_NODE_NAME, []byte("r1"))[:5], protoparse.ErrTruncated},
+		{"router ID length", lsTLV(LS_ATTR_LOCAL_IPV4_RID, []byte{192, 0, 2}), nil},
+		{"bandwidth length", lsTLV(LS_ATTR_UNRESV_BW, be32(0)), nil},
+		{"metric length", lsTLV(LS_ATTR_IGP_METRIC, be32(0), []byte{0}), nil},
+		{"SRLG length", lsTLV(LS_ATTR_SRLG, []byte{0, 0, 1}), nil},
+		{"SR range without a SID", lsTLV(LS_ATTR_SR_CAPABILITIES, []byte{0, 0}, []byte{0, 0, 8}, lsTLV(1162, []byte{0, 0, 0})), nil},
+		{"SID length", lsTLV(LS_ATTR_PREFIX_SID, []byte{0, 0, 0, 0}, []byte{0, 1}), nil},
+		{"short adjacency SID", lsTLV(LS_ATTR_ADJ_SID, []byte{0, 0}), nil},
+	}
+	for _, c := range cases {
+		_, err := readLSAttribute(c.attr)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+		} else if c.kind != nil && !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not %q", c.name, err, c.kind)
+		}
+	}
+}
+
+func TestLSUpdate(t *testing.T) {
+	node := lsNLRI(LS_NODE_NLRI, LS_PROTO_OSPFV2, lsLocal)
+	_, extra, err := parseAttrs(concat(origin,
+		mpReach(AFI_BGPLS, SAFI_BGPLS, nh4, node),
+		mpUnreach(AFI_BGPLS, SAFI_BGPLS, node),
+		attr(0x80, 29, concat(lsTLV(LS_ATTR_NODE_NAME, []byte("r1")), lsUnknown))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra.LSAdvertised) != 1 || len(extra.LSWithdrawn) != 1 || extra.LSAdvertised[0].LocalNode == nil {
+		t.Errorf("bad NLRI %v %v", extra.LSAdvertised, extra.LSWithdrawn)
+	}
+	if extra.LSAttribute == nil || extra.LSAttribute.NodeName != "r1" || len(extra.LSAttribute.Unknown) != 1 {
+		t.Errorf("bad attribute %v", extra.LSAttribute)
+	}
+
+	_, _, err = parseAttrs(concat(origin, attr(0x80, 29, lsTLV(LS_ATTR_NODE_NAME, []byte("r1"))[:5])))
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerAttr || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("bad error for a truncated attribute %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+)
+
+// Community is a standard community of RFC 1997, the AS in the high
+// 16 bits and the value in the low ones.
+type Community uint32
+
+// well known communities from the IANA registry
+const (
+	COMMUNITY_GRACEFUL_SHUTDOWN   = Community(0xffff0000)
+	COMMUNITY_ACCEPT_OWN          = Community(0xffff0001)
+	COMMUNITY_LLGR_STALE          = Community(0xffff0006)
+	COMMUNITY_NO_LLGR             = Community(0xffff0007)
+	COMMUNITY_BLACKHOLE           = Community(0xffff029a)
+	COMMUNITY_NO_EXPORT           = Community(0xffffff01)
+	COMMUNITY_NO_ADVERTISE        = Community(0xffffff02)
+	COMMUNITY_NO_EXPORT_SUBCONFED = Community(0xffffff03)
+	COMMUNITY_NOPEER              = Community(0xffffff04)
+)
+
+// WellKnownCommunities maps the names of well known communities to them.
+var WellKnownCommunities = map[string]Community{
+	"GRACEFUL_SHUTDOWN":   COMMUNITY_GRACEFUL_SHUTDOWN,
+	"ACCEPT_OWN":          COMMUNITY_ACCEPT_OWN,
+	"LLGR_STALE":          COMMUNITY_LLGR_STALE,
+	"NO_LLGR":             COMMUNITY_NO_LLGR,
+	"BLACKHOLE":           COMMUNITY_BLACKHOLE,
+	"NO_EXPORT":           COMMUNITY_NO_EXPORT,
+	"NO_ADVERTISE":        COMMUNITY_NO_ADVERTISE,
+	"NO_EXPORT_SUBCONFED": COMMUNITY_NO_EXPORT_SUBCONFED,
+	"NOPEER":              COMMUNITY_NOPEER,
+}
+
+func (c Community) AS() uint16 {
+	return uint16(c >> 16)
+}
+
+func (c Community) Value() uint16 {
+	return uint16(c)
+}
+
+func (c Community) String() string {
+	return fmt.Sprintf("%d:%d", c.AS(), c.Value())
+}
+
+// LargeCommunity is a large community of RFC 8092.
+type LargeCommunity struct {
+	GlobalAdmin uint32 `json:"global_admin"`
+	LocalData1  uint32 `json:"local_data_1"`
+	LocalData2  uint32 `json:"local_data_2"`
+}
+
+func (c LargeCommunity) String() string {
+	return fmt.Sprintf("%d:%d:%d", c.GlobalAdmin, c.LocalData1, c.LocalData2)
+}
+
+func readLargeCommunities(buf []byte) ([]LargeCommunity, error) {
+	if len(buf)%12 != 0 {
+		return nil, fmt.Errorf("large communities attribute length %d is not a multiple of 12", len(buf))
+	}
+	ret := make([]LargeCommunity, 0, len(buf)/12)
+	for ; len(buf) > 0; buf = buf[12:] {
+		ret = append(ret, LargeCommunity{
+			GlobalAdmin: binary.BigEndian.Uint32(buf[:4]),
+			LocalData1:  binary.BigEndian.Uint32(buf[4:8]),
+			LocalData2:  binary.BigEndian.Uint32(buf[8:12]),
+		})
+	}
+	return ret, nil
+}
+
+// types and subtypes of the extended communities of RFC 4360 and 5668
+const (
+	EXTCOM_TYPE_TWO_OCTET_AS  = 0x00
+	EXTCOM_TYPE_IPV4          = 0x01
+	EXTCOM_TYPE_FOUR_OCTET_AS = 0x02
+
+	EXTCOM_SUBTYPE_ROUTE_TARGET = 0x02
+	EXTCOM_SUBTYPE_ROUTE_ORIGIN = 0x03
+)
+
+// ExtendedCommunity is an 8 byte extended community of RFC 4360.
+type ExtendedCommunity [8]byte
+
+// Type returns the type of the community without the IANA authority and
+// transitive bits.
+func (c ExtendedCommunity) Type() uint8 {
+	return c[0] & 0x3f
+}
+
+func (c ExtendedCommunity) Subtype() uint8 {
+	return c[1]
+}
+
+func (c ExtendedCommunity) Transitive() bool {
+	return c[0]&0x40 == 0
+}
+
+// Name returns rt for route targets and soo for route origins, and the
+// empty string for other communities.
+func (c ExtendedCommunity) Name() string {
+	if c.Type() > EXTCOM_TYPE_FOUR_OCTET_AS {
+		return ""
+	}
+	switch c.Subtype() {
+	case EXTCOM_SUBTYPE_ROUTE_TARGET:
+		return "rt"
+	case EXTCOM_SUBTYPE_ROUTE_ORIGIN:
+		return "soo"
+	}
+	return ""
+}
+
+// Admin returns the global administrator of a two or four octet AS or
+// IPv4 specific community as text, an AS number or an IPv4 address, and
+// its local administrator. ok is false for other types.
+func (c ExtendedCommunity) Admin() (global string, local uint32, ok bool) {
+	switch c.Type() {
+	case EXTCOM_TYPE_TWO_OCTET_AS:
+		return fmt.Sprint(binary.BigEndian.Uint16(c[2:4])), binary.BigEndian.Uint32(c[4:8]), true
+	case EXTCOM_TYPE_IPV4:
+		return net.IP(c[2:6]).String(), uint32(binary.BigEndian.Uint16(c[6:8])), true
+	case EXTCOM_TYPE_FOUR_OCTET_AS:
+		return fmt.Sprint(binary.BigEndian.Uint32(c[2:6])), uint32(binary.BigEndian.Uint16(c[6:8])), true
+	}
+	return "", 0, false
+}
+
+// String returns route targets and origins like rt:65000:100 or
+// soo:192.0.2.1:7, and other communities in hex.
+func (c ExtendedCommunity) String() string {
+	if name := c.Name(); name != "" {
+		global, local, _ := c.Admin()
+		return fmt.Sprintf("%s:%s:%d", name, global, local)
+	}
+	return hex.EncodeToString(c[:])
+}
+
+// GetCommunities returns the standard communities of the attributes.
+func GetCommunities(attrs *pbbgp.BGPUpdate_Attributes) []Community {
+	var ret []Community
+	for _, com := range attrs.GetCommunities().GetCommunities() {
+		for b := com.Community; len(b) >= 4; b = b[4:] {
+			ret = append(ret, Community(binary.BigEndian.Uint32(b[:4])))
+		}
+	}
+	return ret
+}
+
+// GetExtendedCommunities returns the extended communities of the
+// attributes.
+func GetExtendedCommunities(attrs *pbbgp.BGPUpdate_Attributes) []ExtendedCommunity {
+	var ret []ExtendedCommunity
+	for _, com := range attrs.GetCommunities().GetCommunities() {
+		for b := com.ExtendedCommunity; len(b) >= 8; b = b[8:] {
+			var ec ExtendedCommunity
+			copy(ec[:], b[:8])
+			ret = append(ret, ec)
+		}
+	}
+	return ret
+}
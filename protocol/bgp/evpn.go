@@ -0,0 +1,429 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+// EVPN NLRI (RFC7432) and the IP prefix route (RFC9136)
+const (
+	AFI_L2VPN = 25
+	SAFI_EVPN = 70
+)
+
+type EVPNRouteType uint8
+
+const (
+	EVPN_ETHERNET_AD = EVPNRouteType(iota + 1)
+	EVPN_MAC_IP_ADVERTISEMENT
+	EVPN_INCLUSIVE_MULTICAST
+	EVPN_ETHERNET_SEGMENT
+	EVPN_IP_PREFIX
+)
+
+var evpnRouteNames = map[EVPNRouteType]string{
+	EVPN_ETHERNET_AD:          "ethernet-ad",
+	EVPN_MAC_IP_ADVERTISEMENT: "mac-ip-advertisement",
+	EVPN_INCLUSIVE_MULTICAST:  "inclusive-multicast",
+	EVPN_ETHERNET_SEGMENT:     "ethernet-segment",
+	EVPN_IP_PREFIX:            "ip-prefix",
+}
+
+func (t EVPNRouteType) String() string {
+	if name, ok := evpnRouteNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+func (t EVPNRouteType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+const (
+	ESI_LEN = 10
+)
+
+// EthernetSegmentID is the 10 byte ESI. The first byte is the ESI type.
+type EthernetSegmentID [ESI_LEN]byte
+
+func (esi EthernetSegmentID) String() string {
+	parts := make([]string, ESI_LEN)
+	for i, b := range esi {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (esi EthernetSegmentID) MarshalText() ([]byte, error) {
+	return []byte(esi.String()), nil
+}
+
+// MACAddress is a net.HardwareAddr that is marshaled in its string form.
+type MACAddress net.HardwareAddr
+
+func (m MACAddress) String() string {
+	return net.HardwareAddr(m).String()
+}
+
+func (m MACAddress) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// EVPNLabel is the raw 3 byte label field. With MPLS encapsulation the label
+// is in the high 20 bits, while VXLAN uses all 24 bits as the VNI.
+type EVPNLabel uint32
+
+func (l EVPNLabel) MPLSLabel() uint32 {
+	return uint32(l) >> 4
+}
+
+func (l EVPNLabel) VNI() uint32 {
+	return uint32(l)
+}
+
+func (l EVPNLabel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		MPLSLabel uint32 `json:"mpls_label"`
+		VNI       uint32 `json:"vni"`
+	}{l.MPLSLabel(), l.VNI()})
+}
+
+func readLabel(buf []byte) EVPNLabel {
+	return EVPNLabel(uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2]))
+}
+
+// EVPNRoute is a decoded EVPN NLRI. Which fields are set depends on the type.
+type EVPNRoute struct {
+	Type              EVPNRouteType      `json:"type"`
+	RD                RouteDistinguisher `json:"rd"`
+	ESI               *EthernetSegmentID `json:"esi,omitempty"`
+	EthernetTag       uint32             `json:"ethernet_tag"`
+	MAC               MACAddress         `json:"mac,omitempty"`
+	IP                net.IP             `json:"ip,omitempty"`
+	Prefix            *PrefixWrapper     `json:"prefix,omitempty"`
+	Gateway           net.IP             `json:"gateway,omitempty"`
+	OriginatingRouter net.IP             `json:"originating_router,omitempty"`
+	Labels            []EVPNLabel        `json:"labels,omitempty"`
+}
+
+func (r *EVPNRoute) String() string {
+	ret := fmt.Sprintf("[type: %s][rd: %s]", r.Type, r.RD)
+	if r.ESI != nil {
+		ret += fmt.Sprintf("[esi: %s]", r.ESI)
+	}
+	if r.Type != EVPN_ETHERNET_SEGMENT {
+		ret += fmt.Sprintf("[etag: %d]", r.EthernetTag)
+	}
+	if r.MAC != nil {
+		ret += fmt.Sprintf("[mac: %s]", r.MAC)
+	}
+	if r.IP != nil {
+		ret += fmt.Sprintf("[ip: %s]", r.IP)
+	}
+	if r.Prefix != nil {
+		ret += fmt.Sprintf("[prefix: %s/%d]", r.Prefix.Prefix, r.Prefix.Mask)
+	}
+	if r.Gateway != nil {
+		ret += fmt.Sprintf("[gateway: %s]", r.Gateway)
+	}
+	if r.OriginatingRouter != nil {
+		ret += fmt.Sprintf("[originator: %s]", r.OriginatingRouter)
+	}
+	for _, l := range r.Labels {
+		ret += fmt.Sprintf("[label: %d]", l.MPLSLabel())
+	}
+	return ret
+}
+
+// readEVPNNLRI reads all the EVPN routes in buf. Each one is a type, length, value.
+func readEVPNNLRI(buf []byte) ([]*EVPNRoute, error) {
+	routes := []*EVPNRoute{}
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, fmt.Errorf("%w for EVPN route type and length", protoparse.ErrTruncated)
+		}
+		rtype, rlen := EVPNRouteType(buf[0]), int(buf[1])
+		buf = buf[2:]
+		if rlen > len(buf) {
+			return nil, fmt.Errorf("%w for EVPN route of length %d, %d remain", protoparse.ErrTruncated, rlen, len(buf))
+		}
+		route, err := readEVPNRoute(rtype, buf[:rlen])
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+		buf = buf[rlen:]
+	}
+	return routes, nil
+}
+
+func readEVPNRoute(rtype EVPNRouteType, buf []byte) (*EVPNRoute, error) {
+	route := &EVPNRoute{Type: rtype}
+	if len(buf) < RD_LEN {
+		return nil, fmt.Errorf("%w for %s route distinguisher", protoparse.ErrTruncated, rtype)
+	}
+	route.RD = newRouteDistinguisher(buf)
+	buf = buf[RD_LEN:]
+	var err error
+	switch rtype {
+	case EVPN_ETHERNET_AD:
+		// ESI(10) + ethernet tag(4) + label(3)
+		if len(buf) != ESI_LEN+7 {
+			return nil, fmt.Errorf("%s route should be %d bytes and it is:%d", rtype, RD_LEN+ESI_LEN+7, RD_LEN+len(buf))
+		}
+		buf = readESI(route, buf)
+		route.EthernetTag = binary.BigEndian.Uint32(buf[:4])
+		route.Labels = []EVPNLabel{readLabel(buf[4:7])}
+	case EVPN_MAC_IP_ADVERTISEMENT:
+		// ESI(10) + ethernet tag(4) + MAC len(1) + MAC(6) + IP len(1) + IP + label(3) [+ label(3)]
+		if len(buf) < ESI_LEN+12 {
+			return nil, fmt.Errorf("%w for %s route", protoparse.ErrTruncated, rtype)
+		}
+		buf = readESI(route, buf)
+		route.EthernetTag = binary.BigEndian.Uint32(buf[:4])
+		if buf[4] != 48 {
+			return nil, fmt.Errorf("%s MAC address length should be 48 bits and it is:%d", rtype, buf[4])
+		}
+		mac := make([]byte, 6)
+		copy(mac, buf[5:11])
+		route.MAC = MACAddress(mac)
+		if route.IP, buf, err = readEVPNIP(buf[11:]); err != nil {
+			return nil, err
+		}
+		switch len(buf) {
+		case 3:
+			route.Labels = []EVPNLabel{readLabel(buf[:3])}
+		case 6:
+			route.Labels = []EVPNLabel{readLabel(buf[:3]), readLabel(buf[3:6])}
+		default:
+			return nil, fmt.Errorf("%s route has %d bytes left for labels", rtype, len(buf))
+		}
+	case EVPN_INCLUSIVE_MULTICAST:
+		// ethernet tag(4) + IP len(1) + originating router IP
+		if len(buf) < 5 {
+			return nil, fmt.Errorf("%w for %s route", protoparse.ErrTruncated, rtype)
+		}
+		route.EthernetTag = binary.BigEndian.Uint32(buf[:4])
+		if route.OriginatingRouter, _, err = readEVPNIP(buf[4:]); err != nil {
+			return nil, err
+		}
+	case EVPN_ETHERNET_SEGMENT:
+		// ESI(10) + IP len(1) + originating router IP
+		if len(buf) < ESI_LEN+1 {
+			return nil, fmt.Errorf("%w for %s route", protoparse.ErrTruncated, rtype)
+		}
+		buf = readESI(route, buf)
+		if route.OriginatingRouter, _, err = readEVPNIP(buf); err != nil {
+			return nil, err
+		}
+	case EVPN_IP_PREFIX:
+		// ESI(10) + ethernet tag(4) + prefix len(1) + prefix + gateway + label(3)
+		// the address family is only known from the total length
+		var iplen int
+		switch len(buf) {
+		case ESI_LEN + 5 + 4 + 4 + 3:
+			iplen = 4
+		case ESI_LEN + 5 + 16 + 16 + 3:
+			iplen = 16
+		default:
+			return nil, fmt.Errorf("%s route has an invalid length:%d", rtype, RD_LEN+len(buf))
+		}
+		buf = readESI(route, buf)
+		route.EthernetTag = binary.BigEndian.Uint32(buf[:4])
+		mask := uint32(buf[4])
+		if mask > uint32(iplen*8) {
+			return nil, fmt.Errorf("%s route has an invalid prefix length:%d", rtype, mask)
+		}
+		buf = buf[5:]
+		prefix := make([]byte, iplen)
+		copy(prefix, buf[:iplen])
+		route.Prefix = &PrefixWrapper{net.IP(prefix), mask}
+		gw := make([]byte, iplen)
+		copy(gw, buf[iplen:2*iplen])
+		route.Gateway = net.IP(gw)
+		route.Labels = []EVPNLabel{readLabel(buf[2*iplen : 2*iplen+3])}
+	default:
+		return nil, fmt.Errorf("%w: EVPN route type %d", protoparse.ErrUnsupported, rtype)
+	}
+	return route, nil
+}
+
+func readESI(route *EVPNRoute, buf []byte) []byte {
+	var esi EthernetSegmentID
+	copy(esi[:], buf[:ESI_LEN])
+	route.ESI = &esi
+	return buf[ESI_LEN:]
+}
+
+// readEVPNIP reads an IP that is prefixed by its length in bits, which can
+// be 0, 32 or 128.
+func readEVPNIP(buf []byte) (net.IP, []byte, error) {
+	if len(buf) < 1 {
+		return nil, nil, fmt.Errorf("%w for EVPN IP length", protoparse.ErrTruncated)
+	}
+	bitlen := int(buf[0])
+	buf = buf[1:]
+	if bitlen != 0 && bitlen != 32 && bitlen != 128 {
+		return nil, nil, fmt.Errorf("invalid EVPN IP address length:%d", bitlen)
+	}
+	if len(buf) < bitlen/8 {
+		return nil, nil, fmt.Errorf("%w for EVPN IP address of length %d", protoparse.ErrTruncated, bitlen)
+	}
+	if bitlen == 0 {
+		return nil, buf, nil
+	}
+	IPbuf := make([]byte, bitlen/8)
+	copy(IPbuf, buf[:bitlen/8])
+	return net.IP(IPbuf), buf[bitlen/8:], nil
+}
+
+// EVPN related extended community types and subtypes
+const (
+	EXTCOM_TYPE_EVPN   = 0x06
+	EXTCOM_TYPE_OPAQUE = 0x03
+
+	EVPN_EXTCOM_MAC_MOBILITY    = 0x00
+	EVPN_EXTCOM_ESI_LABEL       = 0x01
+	EVPN_EXTCOM_ES_IMPORT_RT    = 0x02
+	EVPN_EXTCOM_ROUTER_MAC      = 0x03
+	OPAQUE_EXTCOM_DEFAULT_GW    = 0x0d
+	EVPN_EXTCOM_MAC_STICKY_FLAG = 0x01
+	EVPN_EXTCOM_SINGLE_ACTIVE   = 0x01
+)
+
+// EVPNCommunity is a decoded EVPN extended community.
+type EVPNCommunity struct {
+	Type           string     `json:"type"`
+	Sticky         bool       `json:"sticky,omitempty"`
+	SequenceNumber uint32     `json:"sequence_number,omitempty"`
+	SingleActive   bool       `json:"single_active,omitempty"`
+	Label          *EVPNLabel `json:"label,omitempty"`
+	MAC            MACAddress `json:"mac,omitempty"`
+}
+
+// readEVPNCommunity decodes an 8 byte extended community into an EVPN
+// community. It returns nil if the community is not one.
+func readEVPNCommunity(com []byte) *EVPNCommunity {
+	if len(com) != 8 {
+		return nil
+	}
+	ec := new(EVPNCommunity)
+	switch {
+	case com[0] == EXTCOM_TYPE_EVPN && com[1] == EVPN_EXTCOM_MAC_MOBILITY:
+		ec.Type = "mac-mobility"
+		ec.Sticky = com[2]&EVPN_EXTCOM_MAC_STICKY_FLAG != 0
+		ec.SequenceNumber = binary.BigEndian.Uint32(com[4:8])
+	case com[0] == EXTCOM_TYPE_EVPN && com[1] == EVPN_EXTCOM_ESI_LABEL:
+		ec.Type = "esi-label"
+		ec.SingleActive = com[2]&EVPN_EXTCOM_SINGLE_ACTIVE != 0
+		label := readLabel(com[5:8])
+		ec.Label = &label
+	case com[0] == EXTCOM_TYPE_EVPN && com[1] == EVPN_EXTCOM_ES_IMPORT_RT:
+		ec.Type = "es-import-route-target"
+		ec.MAC = MACAddress(append([]byte{}, com[2:8]...))
+	case com[0] == EXTCOM_TYPE_EVPN && com[1] == EVPN_EXTCOM_ROUTER_MAC:
+		ec.Type = "router-mac"
+		ec.MAC = MACAddress(append([]byte{}, com[2:8]...))
+	case com[0] == EXTCOM_TYPE_OPAQUE && com[1] == OPAQUE_EXTCOM_DEFAULT_GW:
+		ec.Type = "default-gateway"
+	default:
+		return nil
+	}
+	return ec
+}
+
+func (ec *EVPNCommunity) String() string {
+	switch ec.Type {
+	case "mac-mobility":
+		return fmt.Sprintf("%s seq:%d sticky:%v", ec.Type, ec.SequenceNumber, ec.Sticky)
+	case "esi-label":
+		return fmt.Sprintf("%s label:%d single-active:%v", ec.Type, ec.Label.MPLSLabel(), ec.SingleActive)
+	case "es-import-route-target", "router-mac":
+		return fmt.Sprintf("%s %s", ec.Type, ec.MAC)
+	}
+	return ec.Type
+}
+
+// PMSI tunnel types (RFC6514 and RFC7432)
+type PMSITunnelType uint8
+
+const (
+	PMSI_NO_TUNNEL = PMSITunnelType(iota)
+	PMSI_RSVP_TE_P2MP
+	PMSI_MLDP_P2MP
+	PMSI_PIM_SSM
+	PMSI_PIM_SM
+	PMSI_BIDIR_PIM
+	PMSI_INGRESS_REPLICATION
+	PMSI_MLDP_MP2MP
+)
+
+var pmsiTunnelNames = map[PMSITunnelType]string{
+	PMSI_NO_TUNNEL:           "no-tunnel-info",
+	PMSI_RSVP_TE_P2MP:        "rsvp-te-p2mp",
+	PMSI_MLDP_P2MP:           "mldp-p2mp",
+	PMSI_PIM_SSM:             "pim-ssm",
+	PMSI_PIM_SM:              "pim-sm",
+	PMSI_BIDIR_PIM:           "bidir-pim",
+	PMSI_INGRESS_REPLICATION: "ingress-replication",
+	PMSI_MLDP_MP2MP:          "mldp-mp2mp",
+}
+
+func (t PMSITunnelType) String() string {
+	if name, ok := pmsiTunnelNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+func (t PMSITunnelType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// PMSITunnel is the decoded PMSI_TUNNEL attribute. For ingress replication
+// the tunnel identifier is the endpoint IP, otherwise it is kept raw.
+type PMSITunnel struct {
+	LeafInfoRequired bool           `json:"leaf_info_required,omitempty"`
+	TunnelType       PMSITunnelType `json:"tunnel_type"`
+	Label            EVPNLabel      `json:"label"`
+	Endpoint         net.IP         `json:"endpoint,omitempty"`
+	TunnelID         []byte         `json:"tunnel_id,omitempty"`
+}
+
+func readPMSITunnel(buf []byte) (*PMSITunnel, error) {
+	if len(buf) < 5 {
+		return nil, fmt.Errorf("%w for PMSI tunnel attribute of length %d", protoparse.ErrTruncated, len(buf))
+	}
+	pt := &PMSITunnel{
+		LeafInfoRequired: buf[0]&0x01 != 0,
+		TunnelType:       PMSITunnelType(buf[1]),
+		Label:            readLabel(buf[2:5]),
+	}
+	id := make([]byte, len(buf)-5)
+	copy(id, buf[5:])
+	if pt.TunnelType == PMSI_INGRESS_REPLICATION && (len(id) == 4 || len(id) == 16) {
+		pt.Endpoint = net.IP(id)
+	} else if len(id) > 0 {
+		pt.TunnelID = id
+	}
+	return pt, nil
+}
+
+func (pt *PMSITunnel) String() string {
+	ret := fmt.Sprintf("type:%s label:%d", pt.TunnelType, pt.Label.MPLSLabel())
+	if pt.Endpoint != nil {
+		ret += fmt.Sprintf(" endpoint:%s", pt.Endpoint)
+	} else if pt.TunnelID != nil {
+		ret += fmt.Sprintf(" id:%x", pt.TunnelID)
+	}
+	if pt.LeafInfoRequired {
+		ret += " leaf-info-required"
+	}
+	return ret
+}
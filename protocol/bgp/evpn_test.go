@@ -0,0 +1,195 @@
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+func evpnNLRI(rtype EVPNRouteType, val ...[]byte) []byte {
+	v := concat(val...)
+	return append([]byte{byte(rtype), byte(len(v))}, v...)
+}
+
+var (
+	evpnRD    = []byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1} // 65000:1
+	evpnESI   = []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99}
+	zeroESI   = make([]byte, ESI_LEN)
+	evpnMAC   = []byte{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01}
+	label100  = []byte{0x00, 0x06, 0x41}
+	label200  = []byte{0x00, 0x0c, 0x81}
+	zeroEtag  = []byte{0, 0, 0, 0}
+	evpnPrfx6 = []byte{0x20, 0x01, 0x0d, 0xb8, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+)
+
+func TestEVPNNLRI(t *testing.T) {
+	cases := []struct {
+		name  string
+		nlri  []byte
+		route string
+	}{
+		{"ethernet auto-discovery", evpnNLRI(EVPN_ETHERNET_AD, evpnRD, evpnESI, []byte{0, 0, 0, 100}, label100),
+			"[type: ethernet-ad][rd: 65000:1][esi: 00:11:22:33:44:55:66:77:88:99][etag: 100][label: 100]"},
+		{"MAC/IP with two labels", evpnNLRI(EVPN_MAC_IP_ADVERTISEMENT, evpnRD, zeroESI, zeroEtag,
+			[]byte{48}, evpnMAC, []byte{32, 192, 0, 2, 10}, label100, label200),
+			"[type: mac-ip-advertisement][rd: 65000:1][esi: 00:00:00:00:00:00:00:00:00:00][etag: 0][mac: 00:00:5e:00:53:01][ip: 192.0.2.10][label: 100][label: 200]"},
+		{"MAC only", evpnNLRI(EVPN_MAC_IP_ADVERTISEMENT, evpnRD, zeroESI, []byte{0, 0, 0, 10},
+			[]byte{48}, evpnMAC, []byte{0}, label100),
+			"[type: mac-ip-advertisement][rd: 65000:1][esi: 00:00:00:00:00:00:00:00:00:00][etag: 10][mac: 00:00:5e:00:53:01][label: 100]"},
+		{"inclusive multicast", evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD, zeroEtag, []byte{32, 192, 0, 2, 1}),
+			"[type: inclusive-multicast][rd: 65000:1][etag: 0][originator: 192.0.2.1]"},
+		{"inclusive multicast from IPv6", evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD, zeroEtag, []byte{128}, nh6),
+			"[type: inclusive-multicast][rd: 65000:1][etag: 0][originator: 2001:db8::1]"},
+		{"ethernet segment", evpnNLRI(EVPN_ETHERNET_SEGMENT, evpnRD, evpnESI, []byte{32, 192, 0, 2, 1}),
+			"[type: ethernet-segment][rd: 65000:1][esi: 00:11:22:33:44:55:66:77:88:99][originator: 192.0.2.1]"},
+		{"IPv4 prefix", evpnNLRI(EVPN_IP_PREFIX, evpnRD, zeroESI, zeroEtag, []byte{24, 10, 0, 0, 0}, nh4, label100),
+			"[type: ip-prefix][rd: 65000:1][esi: 00:00:00:00:00:00:00:00:00:00][etag: 0][prefix: 10.0.0.0/24][gateway: 192.0.2.1][label: 100]"},
+		{"IPv6 prefix", evpnNLRI(EVPN_IP_PREFIX, evpnRD, zeroESI, zeroEtag, []byte{48}, evpnPrfx6, make([]byte, 16), label100),
+			"[type: ip-prefix][rd: 65000:1][esi: 00:00:00:00:00:00:00:00:00:00][etag: 0][prefix: 2001:db8:1::/48][gateway: ::][label: 100]"},
+	}
+	for _, c := range cases {
+		routes, err := readEVPNNLRI(c.nlri)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if len(routes) != 1 || routes[0].String() != c.route {
+			t.Errorf("%s: got %v want %s", c.name, routes, c.route)
+		}
+	}
+
+	// several routes and a VXLAN label
+	vni := []byte{0x00, 0x27, 0x1a}
+	routes, err := readEVPNNLRI(concat(cases[0].nlri, evpnNLRI(EVPN_ETHERNET_AD, evpnRD, evpnESI, zeroEtag, vni)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[1].Labels[0].VNI() != 10010 {
+		t.Errorf("bad routes %v", routes)
+	}
+}
+
+func TestEVPNNLRIErrors(t *testing.T) {
+	mac := func(macbits byte, rest ...[]byte) []byte {
+		return evpnNLRI(EVPN_MAC_IP_ADVERTISEMENT, evpnRD, zeroESI, zeroEtag, []byte{macbits}, evpnMAC, concat(rest...))
+	}
+	// kind is nil when any error will do
+	cases := []struct {
+		name string
+		nlri []byte
+		kind error
+	}{
+		{"missing length", []byte{byte(EVPN_ETHERNET_AD)}, protoparse.ErrTruncated},
+		{"length past the end", []byte{byte(EVPN_ETHERNET_AD), 25, 0, 0}, protoparse.ErrTruncated},
+		{"truncated route distinguisher", evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD[:6]), protoparse.ErrTruncated},
+		{"ethernet auto-discovery too long", evpnNLRI(EVPN_ETHERNET_AD, evpnRD, evpnESI, zeroEtag, label100, []byte{0}), nil},
+		{"ethernet auto-discovery too short", evpnNLRI(EVPN_ETHERNET_AD, evpnRD, evpnESI, zeroEtag), nil},
+		{"truncated MAC/IP", evpnNLRI(EVPN_MAC_IP_ADVERTISEMENT, evpnRD, zeroESI, zeroEtag, []byte{48}), protoparse.ErrTruncated},
+		{"MAC length", mac(40, []byte{0}, label100), nil},
+		{"IP length", mac(48, []byte{24, 10, 0, 0}, label100), nil},
+		{"truncated IP", mac(48, []byte{128, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0}), protoparse.ErrTruncated},
+		{"label length", mac(48, []byte{0}, label100, []byte{0}), nil},
+		{"truncated inclusive multicast", evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD, zeroEtag), protoparse.ErrTruncated},
+		{"truncated originator", evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD, zeroEtag, []byte{32, 192, 0}), protoparse.ErrTruncated},
+		{"truncated ethernet segment", evpnNLRI(EVPN_ETHERNET_SEGMENT, evpnRD, evpnESI[:8]), protoparse.ErrTruncated},
+		{"IP prefix length", evpnNLRI(EVPN_IP_PREFIX, evpnRD, zeroESI, zeroEtag, []byte{24, 10, 0, 0, 0}, nh4), nil},
+		{"IP prefix mask", evpnNLRI(EVPN_IP_PREFIX, evpnRD, zeroESI, zeroEtag, []byte{33, 10, 0, 0, 0}, nh4, label100), nil},
+		{"unknown route type", evpnNLRI(EVPNRouteType(9), evpnRD), protoparse.ErrUnsupported},
+	}
+	for _, c := range cases {
+		_, err := readEVPNNLRI(c.nlri)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+		} else if c.kind != nil && !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not %q", c.name, err, c.kind)
+		}
+	}
+}
+
+func TestEVPNCommunities(t *testing.T) {
+	coms := [][]byte{
+		{0x06, 0x00, 0x01, 0, 0, 0, 0, 5},
+		{0x06, 0x01, 0x01, 0, 0, 0x00, 0x06, 0x41},
+		{0x06, 0x02, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		{0x06, 0x03, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x01},
+		{0x03, 0x0d, 0, 0, 0, 0, 0, 0},
+		{0x00, 0x02, 0xfd, 0xe8, 0, 0, 0, 1}, // a route target is not an EVPN community
+	}
+	want := []string{
+		"mac-mobility seq:5 sticky:true",
+		"esi-label label:100 single-active:true",
+		"es-import-route-target 00:11:22:33:44:55",
+		"router-mac 00:00:5e:00:53:01",
+		"default-gateway",
+	}
+	_, extra, err := parseAttrs(concat(origin, attr(0xc0, 16, concat(coms...))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, ec := range extra.EVPNCommunities {
+		got = append(got, ec.String())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestPMSITunnel(t *testing.T) {
+	cases := []struct {
+		name   string
+		attr   []byte
+		tunnel string
+	}{
+		{"ingress replication", []byte{0, 6, 0x00, 0x06, 0x41, 192, 0, 2, 1},
+			"type:ingress-replication label:100 endpoint:192.0.2.1"},
+		{"ingress replication over IPv6", concat([]byte{0, 6, 0x00, 0x06, 0x41}, nh6),
+			"type:ingress-replication label:100 endpoint:2001:db8::1"},
+		{"PIM-SSM", []byte{1, 3, 0, 0, 0, 192, 0, 2, 1, 232, 1, 1, 1},
+			"type:pim-ssm label:0 id:c0000201e8010101 leaf-info-required"},
+		{"no tunnel", []byte{0, 0, 0, 0, 0}, "type:no-tunnel-info label:0"},
+	}
+	for _, c := range cases {
+		pt, err := readPMSITunnel(c.attr)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if pt.String() != c.tunnel {
+			t.Errorf("%s: got %s want %s", c.name, pt, c.tunnel)
+		}
+	}
+
+	_, _, err := parseAttrs(concat(origin, attr(0xc0, 22, []byte{0, 6, 0, 0})))
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerAttr || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("bad error for a truncated PMSI tunnel %v", err)
+	}
+}
+
+func TestEVPNUpdate(t *testing.T) {
+	imet := evpnNLRI(EVPN_INCLUSIVE_MULTICAST, evpnRD, zeroEtag, []byte{32, 192, 0, 2, 1})
+	macip := evpnNLRI(EVPN_MAC_IP_ADVERTISEMENT, evpnRD, zeroESI, zeroEtag, []byte{48}, evpnMAC, []byte{0}, label100)
+	_, extra, err := parseAttrs(concat(origin,
+		mpReach(AFI_L2VPN, SAFI_EVPN, nh4, imet),
+		mpUnreach(AFI_L2VPN, SAFI_EVPN, macip),
+		attr(0xc0, 22, []byte{0, 6, 0x00, 0x06, 0x41, 192, 0, 2, 1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra.EVPNAdvertised) != 1 || extra.EVPNAdvertised[0].Type != EVPN_INCLUSIVE_MULTICAST {
+		t.Errorf("bad advertised routes %v", extra.EVPNAdvertised)
+	}
+	if len(extra.EVPNWithdrawn) != 1 || extra.EVPNWithdrawn[0].Type != EVPN_MAC_IP_ADVERTISEMENT {
+		t.Errorf("bad withdrawn routes %v", extra.EVPNWithdrawn)
+	}
+	if extra.PMSITunnel == nil || extra.PMSITunnel.TunnelType != PMSI_INGRESS_REPLICATION {
+		t.Errorf("bad PMSI tunnel %v", extra.PMSITunnel)
+	}
+
+	_, _, err = parseAttrs(concat(origin, mpReach(AFI_L2VPN, SAFI_EVPN, nh4, imet[:len(imet)-2])))
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerNLRI || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("bad error for a truncated route %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package bgp
+
+import (
+	"fmt"
+)
+
+// ExtraAttrs holds what is decoded from an update but does not fit
+// in the BGPUpdate protocol buffer, like NLRI of non unicast
+// address families and the typed extended communities that go with them.
+type ExtraAttrs struct {
+	// this is exposed through the attributes when marshaled
+	MPNextHop          *MPNextHop        `json:"-"`
+	LabeledAdvertised  []*LabeledRoute   `json:"labeled_advertised_routes,omitempty"`
+	LabeledWithdrawn   []*LabeledRoute   `json:"labeled_withdrawn_routes,omitempty"`
+	FlowspecAdvertised []*FlowspecRule   `json:"flowspec_advertised_routes,omitempty"`
+	FlowspecWithdrawn  []*FlowspecRule   `json:"flowspec_withdrawn_routes,omitempty"`
+	FlowspecActions    []*FlowspecAction `json:"flowspec_actions,omitempty"`
+	EVPNAdvertised     []*EVPNRoute      `json:"evpn_advertised_routes,omitempty"`
+	EVPNWithdrawn      []*EVPNRoute      `json:"evpn_withdrawn_routes,omitempty"`
+	EVPNCommunities    []*EVPNCommunity  `json:"evpn_communities,omitempty"`
+	PMSITunnel         *PMSITunnel       `json:"pmsi_tunnel,omitempty"`
+	LSAdvertised       []*LSNLRI         `json:"bgp_ls_advertised,omitempty"`
+	LSWithdrawn        []*LSNLRI         `json:"bgp_ls_withdrawn,omitempty"`
+	LSAttribute        *LSAttribute      `json:"bgp_ls_attribute,omitempty"`
+	LargeCommunities   []LargeCommunity  `json:"large_communities,omitempty"`
+}
+
+func (e *ExtraAttrs) isEmpty() bool {
+	return len(e.LabeledAdvertised) == 0 && len(e.LabeledWithdrawn) == 0 && len(e.FlowspecAdvertised) == 0 && len(e.FlowspecWithdrawn) == 0 && len(e.FlowspecActions) == 0 &&
+		len(e.EVPNAdvertised) == 0 && len(e.EVPNWithdrawn) == 0 && len(e.EVPNCommunities) == 0 && e.PMSITunnel == nil &&
+		len(e.LSAdvertised) == 0 && len(e.LSWithdrawn) == 0 && e.LSAttribute == nil && len(e.LargeCommunities) == 0
+}
+
+func (e *ExtraAttrs) String() string {
+	ret := ""
+	if len(e.LabeledWithdrawn) != 0 {
+		ret += fmt.Sprintf(" Withdrawn Labeled Routes (%d):\n", len(e.LabeledWithdrawn))
+		for _, r := range e.LabeledWithdrawn {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.LabeledAdvertised) != 0 {
+		ret += fmt.Sprintf(" Advertised Labeled Routes (%d):\n", len(e.LabeledAdvertised))
+		for _, r := range e.LabeledAdvertised {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.FlowspecWithdrawn) != 0 {
+		ret += fmt.Sprintf(" Withdrawn Flowspec Rules (%d):\n", len(e.FlowspecWithdrawn))
+		for _, r := range e.FlowspecWithdrawn {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.FlowspecAdvertised) != 0 {
+		ret += fmt.Sprintf(" Advertised Flowspec Rules (%d):\n", len(e.FlowspecAdvertised))
+		for _, r := range e.FlowspecAdvertised {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.FlowspecActions) != 0 {
+		ret += "Flowspec-Actions:"
+		for _, a := range e.FlowspecActions {
+			ret += fmt.Sprintf(" [%s]", a)
+		}
+		ret += "\n"
+	}
+	if len(e.EVPNWithdrawn) != 0 {
+		ret += fmt.Sprintf(" Withdrawn EVPN Routes (%d):\n", len(e.EVPNWithdrawn))
+		for _, r := range e.EVPNWithdrawn {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.EVPNAdvertised) != 0 {
+		ret += fmt.Sprintf(" Advertised EVPN Routes (%d):\n", len(e.EVPNAdvertised))
+		for _, r := range e.EVPNAdvertised {
+			ret += fmt.Sprintf("%s\n", r)
+		}
+	}
+	if len(e.EVPNCommunities) != 0 {
+		ret += "EVPN-Communities:"
+		for _, c := range e.EVPNCommunities {
+			ret += fmt.Sprintf(" [%s]", c)
+		}
+		ret += "\n"
+	}
+	if e.PMSITunnel != nil {
+		ret += fmt.Sprintf("PMSI-Tunnel: %s\n", e.PMSITunnel)
+	}
+	if len(e.LSWithdrawn) != 0 {
+		ret += fmt.Sprintf(" Withdrawn BGP-LS NLRI (%d):\n", len(e.LSWithdrawn))
+		for _, n := range e.LSWithdrawn {
+			ret += fmt.Sprintf("%s\n", n)
+		}
+	}
+	if len(e.LSAdvertised) != 0 {
+		ret += fmt.Sprintf(" Advertised BGP-LS NLRI (%d):\n", len(e.LSAdvertised))
+		for _, n := range e.LSAdvertised {
+			ret += fmt.Sprintf("%s\n", n)
+		}
+	}
+	if e.LSAttribute != nil {
+		ret += fmt.Sprintf("BGP-LS-Attribute:%s\n", e.LSAttribute)
+	}
+	if len(e.LargeCommunities) != 0 {
+		ret += "Large-Communities:"
+		for _, c := range e.LargeCommunities {
+			ret += fmt.Sprintf(" %s", c)
+		}
+		ret += "\n"
+	}
+	return ret
+}
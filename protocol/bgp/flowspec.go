@@ -0,0 +1,451 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+// flowspec NLRI (RFC8955) and its IPv6 extensions (RFC8956)
+const (
+	SAFI_FLOWSPEC     = 133
+	SAFI_FLOWSPEC_VPN = 134
+)
+
+type FlowspecComponentType uint8
+
+const (
+	FS_DST_PREFIX = FlowspecComponentType(iota + 1)
+	FS_SRC_PREFIX
+	FS_IP_PROTO
+	FS_PORT
+	FS_DST_PORT
+	FS_SRC_PORT
+	FS_ICMP_TYPE
+	FS_ICMP_CODE
+	FS_TCP_FLAGS
+	FS_PKT_LEN
+	FS_DSCP
+	FS_FRAGMENT
+	FS_FLOW_LABEL
+)
+
+var fsComponentNames = map[FlowspecComponentType]string{
+	FS_DST_PREFIX: "destination",
+	FS_SRC_PREFIX: "source",
+	FS_IP_PROTO:   "protocol",
+	FS_PORT:       "port",
+	FS_DST_PORT:   "destination-port",
+	FS_SRC_PORT:   "source-port",
+	FS_ICMP_TYPE:  "icmp-type",
+	FS_ICMP_CODE:  "icmp-code",
+	FS_TCP_FLAGS:  "tcp-flags",
+	FS_PKT_LEN:    "packet-length",
+	FS_DSCP:       "dscp",
+	FS_FRAGMENT:   "fragment",
+	FS_FLOW_LABEL: "flow-label",
+}
+
+func (t FlowspecComponentType) String() string {
+	if name, ok := fsComponentNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+func (t FlowspecComponentType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// isBitmask returns true for the components that use the bitmask
+// operator instead of the numeric one.
+func (t FlowspecComponentType) isBitmask() bool {
+	return t == FS_TCP_FLAGS || t == FS_FRAGMENT
+}
+
+// operator byte bits
+const (
+	fsOpEnd   = 0x80
+	fsOpAnd   = 0x40
+	fsOpLen   = 0x30
+	fsOpLt    = 0x04
+	fsOpGt    = 0x02
+	fsOpEq    = 0x01
+	fsOpNot   = 0x02
+	fsOpMatch = 0x01
+)
+
+// FlowspecOperand is one operator/value pair of a numeric or bitmask
+// component. Lt, Gt and Eq are only used by numeric components
+// and Not and Match only by bitmask ones.
+type FlowspecOperand struct {
+	And   bool   `json:"and,omitempty"`
+	Lt    bool   `json:"lt,omitempty"`
+	Gt    bool   `json:"gt,omitempty"`
+	Eq    bool   `json:"eq,omitempty"`
+	Not   bool   `json:"not,omitempty"`
+	Match bool   `json:"match,omitempty"`
+	Value uint32 `json:"value"`
+}
+
+// FlowspecComponent is either a prefix component or a list of operands.
+type FlowspecComponent struct {
+	Type     FlowspecComponentType `json:"type"`
+	Prefix   *PrefixWrapper        `json:"prefix,omitempty"`
+	Offset   uint8                 `json:"offset,omitempty"`
+	Operands []*FlowspecOperand    `json:"operands,omitempty"`
+}
+
+// FlowspecRule is a single flowspec NLRI. RD is only set for SAFI 134.
+type FlowspecRule struct {
+	RD         *RouteDistinguisher  `json:"rd,omitempty"`
+	Components []*FlowspecComponent `json:"components"`
+}
+
+var tcpFlagNames = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+
+var fragmentNames = []string{"dont-fragment", "is-fragment", "first-fragment", "last-fragment"}
+
+func bitmaskToString(names []string, val uint32) string {
+	parts := []string{}
+	for i, name := range names {
+		if val&(1<<uint(i)) != 0 {
+			parts = append(parts, name)
+			val &^= 1 << uint(i)
+		}
+	}
+	if val != 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("0x%x", val))
+	}
+	return strings.Join(parts, "|")
+}
+
+func (o *FlowspecOperand) numericString() string {
+	op := ""
+	switch {
+	case o.Lt && o.Gt && o.Eq:
+		return "true"
+	case o.Lt && o.Gt:
+		op = "!="
+	case o.Lt && o.Eq:
+		op = "<="
+	case o.Gt && o.Eq:
+		op = ">="
+	case o.Lt:
+		op = "<"
+	case o.Gt:
+		op = ">"
+	case o.Eq:
+		op = "=="
+	default:
+		return "false"
+	}
+	return fmt.Sprintf("%s%d", op, o.Value)
+}
+
+func (o *FlowspecOperand) bitmaskString(t FlowspecComponentType) string {
+	op := ""
+	if o.Not {
+		op += "!"
+	}
+	if o.Match {
+		op += "="
+	}
+	val := fmt.Sprintf("0x%x", o.Value)
+	switch t {
+	case FS_TCP_FLAGS:
+		val = bitmaskToString(tcpFlagNames, o.Value)
+	case FS_FRAGMENT:
+		val = bitmaskToString(fragmentNames, o.Value)
+	}
+	return op + val
+}
+
+func (c *FlowspecComponent) String() string {
+	if c.Prefix != nil {
+		if c.Offset != 0 {
+			return fmt.Sprintf("[%s: %s/%d offset %d]", c.Type, c.Prefix.Prefix, c.Prefix.Mask, c.Offset)
+		}
+		return fmt.Sprintf("[%s: %s/%d]", c.Type, c.Prefix.Prefix, c.Prefix.Mask)
+	}
+	ret := fmt.Sprintf("[%s:", c.Type)
+	for i, o := range c.Operands {
+		if i > 0 && o.And {
+			ret += "&"
+		} else {
+			ret += " "
+		}
+		if c.Type.isBitmask() {
+			ret += o.bitmaskString(c.Type)
+		} else {
+			ret += o.numericString()
+		}
+	}
+	return ret + "]"
+}
+
+func (r *FlowspecRule) String() string {
+	ret := ""
+	if r.RD != nil {
+		ret += fmt.Sprintf("[rd: %s]", r.RD)
+	}
+	for _, c := range r.Components {
+		ret += c.String()
+	}
+	return ret
+}
+
+// readFlowspecNLRI reads all the flowspec NLRI in buf. Each one is prefixed by
+// a 1 or 2 byte length.
+func readFlowspecNLRI(buf []byte, v6, vpn bool) ([]*FlowspecRule, error) {
+	rules := []*FlowspecRule{}
+	for len(buf) > 0 {
+		nlen := int(buf[0])
+		buf = buf[1:]
+		if nlen >= 0xf0 { //length is 2 bytes (0xfnnn)
+			if len(buf) < 1 {
+				return nil, fmt.Errorf("%w for flowspec NLRI extended length", protoparse.ErrTruncated)
+			}
+			nlen = (nlen&0x0f)<<8 | int(buf[0])
+			buf = buf[1:]
+		}
+		if nlen > len(buf) {
+			return nil, fmt.Errorf("%w for flowspec NLRI of length %d, %d remain", protoparse.ErrTruncated, nlen, len(buf))
+		}
+		rule, err := readFlowspecRule(buf[:nlen], v6, vpn)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+		buf = buf[nlen:]
+	}
+	return rules, nil
+}
+
+func readFlowspecRule(buf []byte, v6, vpn bool) (*FlowspecRule, error) {
+	rule := new(FlowspecRule)
+	if vpn {
+		if len(buf) < RD_LEN {
+			return nil, fmt.Errorf("%w for flowspec VPN route distinguisher", protoparse.ErrTruncated)
+		}
+		rd := newRouteDistinguisher(buf)
+		rule.RD = &rd
+		buf = buf[RD_LEN:]
+	}
+	for len(buf) > 0 {
+		comp := &FlowspecComponent{Type: FlowspecComponentType(buf[0])}
+		buf = buf[1:]
+		var err error
+		switch comp.Type {
+		case FS_DST_PREFIX, FS_SRC_PREFIX:
+			buf, err = readFlowspecPrefix(comp, buf, v6)
+		case FS_IP_PROTO, FS_PORT, FS_DST_PORT, FS_SRC_PORT, FS_ICMP_TYPE, FS_ICMP_CODE,
+			FS_TCP_FLAGS, FS_PKT_LEN, FS_DSCP, FS_FRAGMENT, FS_FLOW_LABEL:
+			buf, err = readFlowspecOperands(comp, buf)
+		default:
+			return nil, fmt.Errorf("%w: flowspec component %d", protoparse.ErrUnsupported, comp.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rule.Components = append(rule.Components, comp)
+	}
+	return rule, nil
+}
+
+// readFlowspecPrefix reads a prefix component. IPv6 components have an
+// extra offset byte and only carry the bits from offset to the prefix length.
+func readFlowspecPrefix(comp *FlowspecComponent, buf []byte, v6 bool) ([]byte, error) {
+	if len(buf) < 1 {
+		return nil, fmt.Errorf("%w for flowspec prefix length", protoparse.ErrTruncated)
+	}
+	bitlen := int(buf[0])
+	buf = buf[1:]
+	offset := 0
+	IPbuf := make([]byte, 4)
+	if v6 {
+		if len(buf) < 1 {
+			return nil, fmt.Errorf("%w for flowspec prefix offset", protoparse.ErrTruncated)
+		}
+		offset = int(buf[0])
+		buf = buf[1:]
+		IPbuf = make([]byte, 16)
+	}
+	if bitlen > len(IPbuf)*8 || offset > bitlen {
+		return nil, fmt.Errorf("invalid flowspec prefix length %d with offset %d", bitlen, offset)
+	}
+	bytelen := (bitlen - offset + 7) / 8
+	if bytelen > len(buf) {
+		return nil, fmt.Errorf("%w for flowspec prefix of length %d", protoparse.ErrTruncated, bitlen)
+	}
+	//copy the pattern bits in place starting at offset
+	for i := 0; i < bitlen-offset; i++ {
+		if buf[i/8]&(0x80>>uint(i%8)) != 0 {
+			pos := offset + i
+			IPbuf[pos/8] |= 0x80 >> uint(pos%8)
+		}
+	}
+	comp.Prefix = &PrefixWrapper{net.IP(IPbuf), uint32(bitlen)}
+	comp.Offset = uint8(offset)
+	return buf[bytelen:], nil
+}
+
+// readFlowspecOperands reads the operator/value list until the end of list bit.
+func readFlowspecOperands(comp *FlowspecComponent, buf []byte) ([]byte, error) {
+	for {
+		if len(buf) < 1 {
+			return nil, fmt.Errorf("%w for %s operator", protoparse.ErrTruncated, comp.Type)
+		}
+		op := buf[0]
+		buf = buf[1:]
+		vlen := 1 << ((op & fsOpLen) >> 4)
+		if vlen > len(buf) {
+			return nil, fmt.Errorf("%w for %s value of length %d", protoparse.ErrTruncated, comp.Type, vlen)
+		}
+		o := &FlowspecOperand{And: op&fsOpAnd != 0}
+		if comp.Type.isBitmask() {
+			o.Not = op&fsOpNot != 0
+			o.Match = op&fsOpMatch != 0
+		} else {
+			o.Lt = op&fsOpLt != 0
+			o.Gt = op&fsOpGt != 0
+			o.Eq = op&fsOpEq != 0
+		}
+		switch vlen {
+		case 1:
+			o.Value = uint32(buf[0])
+		case 2:
+			o.Value = uint32(binary.BigEndian.Uint16(buf[:2]))
+		case 4:
+			o.Value = binary.BigEndian.Uint32(buf[:4])
+		default:
+			return nil, fmt.Errorf("unsupported %s value length %d", comp.Type, vlen)
+		}
+		buf = buf[vlen:]
+		comp.Operands = append(comp.Operands, o)
+		if op&fsOpEnd != 0 {
+			return buf, nil
+		}
+	}
+}
+
+// flowspec traffic filtering actions carried in extended communities
+type FlowspecActionType uint16
+
+const (
+	FS_ACTION_TRAFFIC_RATE_BYTES   = FlowspecActionType(0x8006)
+	FS_ACTION_TRAFFIC_ACTION       = FlowspecActionType(0x8007)
+	FS_ACTION_REDIRECT_AS2         = FlowspecActionType(0x8008)
+	FS_ACTION_TRAFFIC_MARKING      = FlowspecActionType(0x8009)
+	FS_ACTION_TRAFFIC_RATE_PACKETS = FlowspecActionType(0x800c)
+	FS_ACTION_REDIRECT_IPV4        = FlowspecActionType(0x8108)
+	FS_ACTION_REDIRECT_AS4         = FlowspecActionType(0x8208)
+)
+
+var fsActionNames = map[FlowspecActionType]string{
+	FS_ACTION_TRAFFIC_RATE_BYTES:   "traffic-rate-bytes",
+	FS_ACTION_TRAFFIC_ACTION:       "traffic-action",
+	FS_ACTION_REDIRECT_AS2:         "redirect",
+	FS_ACTION_TRAFFIC_MARKING:      "traffic-marking",
+	FS_ACTION_TRAFFIC_RATE_PACKETS: "traffic-rate-packets",
+	FS_ACTION_REDIRECT_IPV4:        "redirect",
+	FS_ACTION_REDIRECT_AS4:         "redirect",
+}
+
+func (t FlowspecActionType) String() string {
+	if name, ok := fsActionNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-0x%04x", uint16(t))
+}
+
+// FlowspecAction is a decoded flowspec extended community. Rate is in
+// bytes or packets per second and a rate of 0 means discard.
+type FlowspecAction struct {
+	Type     FlowspecActionType
+	Rate     float32
+	Sample   bool
+	Terminal bool
+	Target   string
+	DSCP     uint8
+}
+
+// readFlowspecAction decodes an 8 byte extended community into a flowspec action.
+// It returns nil if the community is not one.
+func readFlowspecAction(com []byte) *FlowspecAction {
+	if len(com) != 8 {
+		return nil
+	}
+	act := &FlowspecAction{Type: FlowspecActionType(binary.BigEndian.Uint16(com[:2]))}
+	switch act.Type {
+	case FS_ACTION_TRAFFIC_RATE_BYTES, FS_ACTION_TRAFFIC_RATE_PACKETS:
+		act.Rate = math.Float32frombits(binary.BigEndian.Uint32(com[4:8]))
+	case FS_ACTION_TRAFFIC_ACTION:
+		act.Sample = com[7]&0x02 != 0
+		act.Terminal = com[7]&0x01 != 0
+	case FS_ACTION_REDIRECT_AS2:
+		act.Target = fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(com[2:4]), binary.BigEndian.Uint32(com[4:8]))
+	case FS_ACTION_REDIRECT_IPV4:
+		act.Target = fmt.Sprintf("%s:%d", net.IP(com[2:6]), binary.BigEndian.Uint16(com[6:8]))
+	case FS_ACTION_REDIRECT_AS4:
+		act.Target = fmt.Sprintf("%d:%d", binary.BigEndian.Uint32(com[2:6]), binary.BigEndian.Uint16(com[6:8]))
+	case FS_ACTION_TRAFFIC_MARKING:
+		act.DSCP = com[7] & 0x3f
+	default:
+		return nil
+	}
+	return act
+}
+
+func (a *FlowspecAction) String() string {
+	switch a.Type {
+	case FS_ACTION_TRAFFIC_RATE_BYTES, FS_ACTION_TRAFFIC_RATE_PACKETS:
+		if a.Rate == 0 {
+			return "discard"
+		}
+		unit := "bytes"
+		if a.Type == FS_ACTION_TRAFFIC_RATE_PACKETS {
+			unit = "packets"
+		}
+		return fmt.Sprintf("rate-limit %g %s/s", a.Rate, unit)
+	case FS_ACTION_TRAFFIC_ACTION:
+		return fmt.Sprintf("%s sample:%v terminal:%v", a.Type, a.Sample, a.Terminal)
+	case FS_ACTION_REDIRECT_AS2, FS_ACTION_REDIRECT_IPV4, FS_ACTION_REDIRECT_AS4:
+		return fmt.Sprintf("redirect %s", a.Target)
+	case FS_ACTION_TRAFFIC_MARKING:
+		return fmt.Sprintf("mark dscp %d", a.DSCP)
+	}
+	return a.Type.String()
+}
+
+type flowspecActionWrapper struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Rate        *float32 `json:"rate,omitempty"`
+	Sample      bool     `json:"sample,omitempty"`
+	Terminal    bool     `json:"terminal,omitempty"`
+	Target      string   `json:"target,omitempty"`
+	DSCP        *uint8   `json:"dscp,omitempty"`
+}
+
+func (a *FlowspecAction) MarshalJSON() ([]byte, error) {
+	w := &flowspecActionWrapper{
+		Type:        a.Type.String(),
+		Description: a.String(),
+		Sample:      a.Sample,
+		Terminal:    a.Terminal,
+		Target:      a.Target,
+	}
+	switch a.Type {
+	case FS_ACTION_TRAFFIC_RATE_BYTES, FS_ACTION_TRAFFIC_RATE_PACKETS:
+		w.Rate = &a.Rate
+	case FS_ACTION_TRAFFIC_MARKING:
+		w.DSCP = &a.DSCP
+	}
+	return json.Marshal(w)
+}
@@ -0,0 +1,157 @@
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+func flowspecNLRI(rule []byte) []byte {
+	if len(rule) >= 0xf0 {
+		return append([]byte{0xf0 | byte(len(rule)>>8), byte(len(rule))}, rule...)
+	}
+	return append([]byte{byte(len(rule))}, rule...)
+}
+
+func TestFlowspecNLRI(t *testing.T) {
+	// the examples of RFC8955 section 4.3
+	tcp25 := []byte{
+		0x01, 0x18, 0xc0, 0x00, 0x02, // destination 192.0.2.0/24
+		0x03, 0x81, 0x06, // protocol ==6
+		0x04, 0x81, 0x19, // port ==25
+	}
+	ports := []byte{
+		0x01, 0x18, 0xc0, 0x00, 0x02, // destination 192.0.2.0/24
+		0x02, 0x18, 0xcb, 0x00, 0x71, // source 203.0.113.0/24
+		0x04, 0x01, 0x89, 0x01, 0x8b, // port ==137 ==139
+		0x13, 0x1f, 0x90, 0xd5, 0x1f, 0x98, // >=8080 and <=8088
+	}
+	fragment := []byte{
+		0x01, 0x20, 0xc0, 0x00, 0x02, 0x01, // destination 192.0.2.1/32
+		0x0c, 0x80, 0x04, // fragment first-fragment
+	}
+	// RFC8956 prefixes with an offset and a flow label
+	v6 := []byte{
+		0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8, // destination 2001:db8::/32
+		0x02, 0x40, 0x30, 0x00, 0x01, // source bits 48 to 64
+		0x0d, 0xa1, 0x00, 0x01, 0x23, 0x45, // flow label ==74565
+	}
+	// enough port operands to need the 2 byte length
+	long := []byte{byte(FS_PORT)}
+	for i := 0; i < 124; i++ {
+		long = append(long, 0x01, byte(i))
+	}
+	long[len(long)-2] |= fsOpEnd
+
+	cases := []struct {
+		name  string
+		nlri  []byte
+		v6    bool
+		vpn   bool
+		rules []string
+	}{
+		{"TCP port 25", flowspecNLRI(tcp25), false, false,
+			[]string{"[destination: 192.0.2.0/24][protocol: ==6][port: ==25]"}},
+		{"port list and range", flowspecNLRI(ports), false, false,
+			[]string{"[destination: 192.0.2.0/24][source: 203.0.113.0/24][port: ==137 ==139 >=8080&<=8088]"}},
+		{"fragments", flowspecNLRI(fragment), false, false,
+			[]string{"[destination: 192.0.2.1/32][fragment: first-fragment]"}},
+		{"two rules", concat(flowspecNLRI(tcp25), flowspecNLRI(fragment)), false, false,
+			[]string{"[destination: 192.0.2.0/24][protocol: ==6][port: ==25]", "[destination: 192.0.2.1/32][fragment: first-fragment]"}},
+		{"short rule in 2 byte length", concat([]byte{0xf0, byte(len(tcp25))}, tcp25), false, false,
+			[]string{"[destination: 192.0.2.0/24][protocol: ==6][port: ==25]"}},
+		{"IPv6 with offset", flowspecNLRI(v6), true, false,
+			[]string{"[destination: 2001:db8::/32][source: 0:0:0:1::/64 offset 48][flow-label: ==74565]"}},
+		{"VPN", flowspecNLRI(concat([]byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1}, tcp25)), false, true,
+			[]string{"[rd: 65000:1][destination: 192.0.2.0/24][protocol: ==6][port: ==25]"}},
+		{"end of list starts the next component", flowspecNLRI([]byte{0x04, 0x81, 0x19, 0x05, 0x91, 0x01, 0xbb}), false, false,
+			[]string{"[port: ==25][destination-port: ==443]"}},
+		{"TCP flags", flowspecNLRI([]byte{0x09, 0x01, 0x02, 0xc3, 0x04}), false, false,
+			[]string{"[tcp-flags: =syn&!=rst]"}},
+		{"numeric operators", flowspecNLRI([]byte{0x0a, 0x06, 0x40, 0x47, 0x00, 0x85, 0x05}), false, false,
+			[]string{"[packet-length: !=64&true <=5]"}},
+	}
+	for _, c := range cases {
+		rules, err := readFlowspecNLRI(c.nlri, c.v6, c.vpn)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		got := []string{}
+		for _, r := range rules {
+			got = append(got, r.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.rules) {
+			t.Errorf("%s: got %v want %v", c.name, got, c.rules)
+		}
+	}
+
+	rules, err := readFlowspecNLRI(flowspecNLRI(long), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(long) < 0xf0 || len(rules) != 1 || len(rules[0].Components) != 1 || len(rules[0].Components[0].Operands) != 124 {
+		t.Errorf("bad rule with a 2 byte length %v", rules)
+	}
+}
+
+func TestFlowspecNLRIErrors(t *testing.T) {
+	// kind is nil when any error will do
+	cases := []struct {
+		name string
+		nlri []byte
+		v6   bool
+		vpn  bool
+		kind error
+	}{
+		{"missing 2nd length byte", []byte{0xf0}, false, false, protoparse.ErrTruncated},
+		{"length past the end", []byte{0x0b, 0x01, 0x18, 0xc0}, false, false, protoparse.ErrTruncated},
+		{"truncated prefix", []byte{0x04, 0x01, 0x18, 0xc0, 0x00}, false, false, protoparse.ErrTruncated},
+		{"missing IPv6 offset", []byte{0x02, 0x01, 0x40}, true, false, protoparse.ErrTruncated},
+		{"truncated value", []byte{0x03, 0x04, 0x91, 0x01}, false, false, protoparse.ErrTruncated},
+		{"truncated route distinguisher", []byte{0x04, 0, 0, 0xfd, 0xe8}, false, true, protoparse.ErrTruncated},
+		// the end of the rule ends the operand list, not the next rule
+		{"missing end of list", concat(flowspecNLRI([]byte{0x04, 0x01, 0x19}), flowspecNLRI([]byte{0x04, 0x81, 0x19})), false, false, protoparse.ErrTruncated},
+		{"unknown component", []byte{0x03, 0x0e, 0x81, 0x00}, false, false, protoparse.ErrUnsupported},
+		{"IPv4 prefix too long", []byte{0x06, 0x01, 0x21, 0xc0, 0x00, 0x02, 0x01}, false, false, nil},
+		{"offset past the prefix length", []byte{0x04, 0x01, 0x20, 0x30, 0x00}, true, false, nil},
+	}
+	for _, c := range cases {
+		_, err := readFlowspecNLRI(c.nlri, c.v6, c.vpn)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+		} else if c.kind != nil && !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not %q", c.name, err, c.kind)
+		}
+	}
+}
+
+func TestFlowspecUpdate(t *testing.T) {
+	tcp25 := []byte{0x01, 0x18, 0xc0, 0x00, 0x02, 0x03, 0x81, 0x06, 0x04, 0x81, 0x19}
+	v6 := []byte{0x01, 0x20, 0x00, 0x20, 0x01, 0x0d, 0xb8}
+	discard := attr(0xc0, 16, []byte{0x80, 0x06, 0, 0, 0, 0, 0, 0})
+	_, extra, err := parseAttrs(concat(origin, discard,
+		mpReach(AFI_IP, SAFI_FLOWSPEC, nil, flowspecNLRI(tcp25)),
+		mpUnreach(AFI_IP6, SAFI_FLOWSPEC, flowspecNLRI(v6))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra.FlowspecAdvertised) != 1 || extra.FlowspecAdvertised[0].String() != "[destination: 192.0.2.0/24][protocol: ==6][port: ==25]" {
+		t.Errorf("bad advertised rules %v", extra.FlowspecAdvertised)
+	}
+	if len(extra.FlowspecWithdrawn) != 1 || extra.FlowspecWithdrawn[0].String() != "[destination: 2001:db8::/32]" {
+		t.Errorf("bad withdrawn rules %v", extra.FlowspecWithdrawn)
+	}
+	if len(extra.FlowspecActions) != 1 || extra.FlowspecActions[0].String() != "discard" {
+		t.Errorf("bad actions %v", extra.FlowspecActions)
+	}
+
+	// errors in a rule are at the NLRI layer
+	_, _, err = parseAttrs(concat(origin, mpReach(AFI_IP, SAFI_FLOWSPEC, nil, []byte{0x03, 0x04, 0x91, 0x01})))
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerNLRI || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Errorf("bad error for a truncated rule %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package bgp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+const (
+	SAFI_MPLS_LABEL = 4
+	MPLS_LABEL_LEN  = 3
+	// the label of withdrawn labeled NLRI in RFC3107
+	MPLS_LABEL_WITHDRAWN = 0x800000
+)
+
+// LabeledRoute is a labeled unicast NLRI (RFC8277) or a VPN-IPv4 or
+// VPN-IPv6 NLRI (RFC4364, RFC4659), which also has a route distinguisher.
+// Labels are the 20 bit MPLS labels of the stack, and are not set for
+// withdrawn routes.
+type LabeledRoute struct {
+	Labels []uint32            `json:"labels,omitempty"`
+	RD     *RouteDistinguisher `json:"rd,omitempty"`
+	Prefix *PrefixWrapper      `json:"prefix"`
+}
+
+func (r *LabeledRoute) String() string {
+	ret := ""
+	if r.RD != nil {
+		ret += fmt.Sprintf("[rd: %s]", r.RD)
+	}
+	ret += fmt.Sprintf("[prefix: %s/%d]", r.Prefix.Prefix, r.Prefix.Mask)
+	for _, l := range r.Labels {
+		ret += fmt.Sprintf("[label: %d]", l)
+	}
+	return ret
+}
+
+func isLabeledSAFI(safi uint8) bool {
+	return safi == SAFI_MPLS_LABEL || safi == SAFI_MPLS_VPN || safi == SAFI_MPLS_VPN_MULTICAST
+}
+
+// readLabeledNLRI reads labeled NLRI. Each one is a length in bits of what
+// follows, a stack of labels that ends at the one with the bottom of stack
+// bit set, the RD for VPN routes and the prefix. Withdrawn routes carry a
+// single label field that is ignored (RFC8277 2.4).
+func readLabeledNLRI(buf []byte, v6, vpn, withdrawn bool) ([]*LabeledRoute, error) {
+	routes := []*LabeledRoute{}
+	iplen := 4
+	if v6 {
+		iplen = 16
+	}
+	off := 0
+	for len(buf) > 0 {
+		bitlen := int(buf[0])
+		bytelen := (bitlen + 7) / 8
+		if bytelen > len(buf)-1 {
+			return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrTruncated, "not enough bytes for a labeled prefix of length %d", bitlen)
+		}
+		nlri := buf[1 : 1+bytelen]
+		route := new(LabeledRoute)
+		for {
+			if bitlen < MPLS_LABEL_LEN*8 {
+				return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrMalformed, "labeled prefix length %d is too short for its labels", buf[0])
+			}
+			label := uint32(nlri[0])<<16 | uint32(nlri[1])<<8 | uint32(nlri[2])
+			nlri, bitlen = nlri[MPLS_LABEL_LEN:], bitlen-MPLS_LABEL_LEN*8
+			if withdrawn {
+				break
+			}
+			route.Labels = append(route.Labels, label>>4)
+			if label&1 == 1 || label == MPLS_LABEL_WITHDRAWN {
+				break
+			}
+		}
+		if vpn {
+			if bitlen < RD_LEN*8 {
+				return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrMalformed, "labeled prefix length %d is too short for a route distinguisher", buf[0])
+			}
+			rd := newRouteDistinguisher(nlri)
+			route.RD = &rd
+			nlri, bitlen = nlri[RD_LEN:], bitlen-RD_LEN*8
+		}
+		if bitlen > iplen*8 {
+			return nil, protoparse.NewParseError(protoparse.LayerNLRI, off, protoparse.ErrMalformed, "prefix length %d of labeled prefix is too long [v6:%v]", bitlen, v6)
+		}
+		prefix := make([]byte, iplen)
+		copy(prefix, nlri)
+		// clear trailing bits in the last byte like readPrefix
+		if bitlen%8 != 0 {
+			mask := 0xff00 >> (bitlen % 8)
+			prefix[bitlen/8] &= byte(mask)
+		}
+		route.Prefix = &PrefixWrapper{net.IP(prefix), uint32(bitlen)}
+		routes = append(routes, route)
+		buf = buf[1+bytelen:]
+		off += 1 + bytelen
+	}
+	return routes, nil
+}
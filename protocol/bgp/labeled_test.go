@@ -0,0 +1,103 @@
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+func TestLabeledNLRI(t *testing.T) {
+	rd := []byte{0, 0, 0xfd, 0xe8, 0, 0, 0, 1}           // 65000:1
+	rd1 := []byte{0, 1, 192, 0, 2, 1, 0, 7}              // 192.0.2.1:7
+	label100 := []byte{0x00, 0x06, 0x41}                 // label 100, bottom of stack
+	labels := []byte{0x00, 0x06, 0x40, 0x00, 0x0c, 0x81} // labels 100 and 200
+	withdrawn := []byte{0x80, 0, 0}
+
+	// a VPN-IPv4 update, which used to fail on the length of its NLRI
+	_, extra, err := parseAttrs(concat(origin, mpReach(AFI_IP, SAFI_MPLS_VPN, concat(make([]byte, RD_LEN), nh4),
+		concat([]byte{24 + 64 + 24}, label100, rd, []byte{10, 1, 2}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra.LabeledAdvertised) != 1 || extra.LabeledAdvertised[0].String() != "[rd: 65000:1][prefix: 10.1.2.0/24][label: 100]" {
+		t.Errorf("bad VPN-IPv4 routes %v", extra.LabeledAdvertised)
+	}
+
+	cases := []struct {
+		name      string
+		afi       uint16
+		safi      uint8
+		withdrawn bool
+		nlri      []byte
+		routes    string
+	}{
+		{"VPN-IPv6 withdrawn", AFI_IP6, SAFI_MPLS_VPN, true,
+			concat([]byte{24 + 64 + 48}, withdrawn, rd1, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 1}),
+			"[[rd: 192.0.2.1:7][prefix: 2001:db8:1::/48]]"},
+		{"labeled unicast with a label stack", AFI_IP, SAFI_MPLS_LABEL, false,
+			concat([]byte{48 + 22}, labels, []byte{10, 0, 7}, []byte{24 + 32}, label100, []byte{192, 0, 2, 0}),
+			"[[prefix: 10.0.4.0/22][label: 100][label: 200] [prefix: 192.0.2.0/32][label: 100]]"},
+		{"labeled unicast withdrawn", AFI_IP, SAFI_MPLS_LABEL, true,
+			concat([]byte{24 + 16}, withdrawn, []byte{10, 1}),
+			"[[prefix: 10.1.0.0/16]]"},
+		{"VPN-IPv4 default", AFI_IP, SAFI_MPLS_VPN_MULTICAST, false,
+			concat([]byte{24 + 64}, label100, rd),
+			"[[rd: 65000:1][prefix: 0.0.0.0/0][label: 100]]"},
+	}
+	for _, c := range cases {
+		a := mpUnreach(c.afi, c.safi, c.nlri)
+		if !c.withdrawn {
+			a = mpReach(c.afi, c.safi, nh4, c.nlri)
+			if c.safi != SAFI_MPLS_LABEL {
+				a = mpReach(c.afi, c.safi, concat(make([]byte, RD_LEN), nh4), c.nlri)
+			}
+		}
+		_, extra, err := parseAttrs(a)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		routes := extra.LabeledAdvertised
+		if c.withdrawn {
+			routes = extra.LabeledWithdrawn
+		}
+		if s := fmt.Sprint(routes); s != c.routes {
+			t.Errorf("%s: expected %s, got %s", c.name, c.routes, s)
+		}
+	}
+
+	// the NLRI of other SAFIs are skipped
+	if _, extra, err := parseAttrs(mpReach(AFI_IP, 132, nh4, concat([]byte{96}, rd, []byte{0, 0, 0, 1}))); err != nil || !extra.isEmpty() {
+		t.Errorf("route target constraint NLRI decoded: %v %v", extra, err)
+	}
+
+	errCases := []struct {
+		name string
+		safi uint8
+		nlri []byte
+		kind error
+	}{
+		{"no room for the RD", SAFI_MPLS_VPN, concat([]byte{24 + 32}, label100, []byte{10, 1, 2, 3}), protoparse.ErrMalformed},
+		{"label stack without bottom", SAFI_MPLS_LABEL, concat([]byte{48}, []byte{0, 0, 0x10, 0, 0, 0x20}), protoparse.ErrMalformed},
+		{"prefix too long", SAFI_MPLS_LABEL, concat([]byte{24 + 40}, label100, []byte{10, 0, 0, 0, 0}), protoparse.ErrMalformed},
+		{"truncated", SAFI_MPLS_VPN, concat([]byte{24 + 64 + 24}, label100, rd), protoparse.ErrTruncated},
+	}
+	for _, c := range errCases {
+		// the error is at the second NLRI, after a good one
+		nh, first := nh4, concat([]byte{24 + 24}, label100, []byte{10, 1, 2})
+		if c.safi != SAFI_MPLS_LABEL {
+			nh, first = concat(make([]byte, RD_LEN), nh4), concat([]byte{24 + 64 + 24}, label100, rd, []byte{10, 1, 2})
+		}
+		_, _, err := parseAttrs(mpReach(AFI_IP, c.safi, nh, concat(first, c.nlri)))
+		var perr *protoparse.ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, c.kind) || perr.Layer != protoparse.LayerNLRI || perr.AttrType != 14 {
+			t.Errorf("%s: expected an NLRI error of kind %q, got %v", c.name, c.kind, err)
+			continue
+		}
+		if want := 3 + 4 + len(nh) + 1 + len(first); perr.Offset != want {
+			t.Errorf("%s: expected offset %d, got %d", c.name, want, perr.Offset)
+		}
+	}
+}
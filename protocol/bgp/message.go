@@ -0,0 +1,309 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+const (
+	BGP_HEADER_LEN  = 19
+	BGP_MAX_MSG_LEN = 4096
+)
+
+// BGP message types (RFC4271, RFC2918)
+const (
+	MSG_OPEN          = 1
+	MSG_UPDATE        = 2
+	MSG_NOTIFICATION  = 3
+	MSG_KEEPALIVE     = 4
+	MSG_ROUTE_REFRESH = 5
+)
+
+// Capability codes (RFC5492) of the capabilities decoded in OPEN messages.
+const (
+	CAP_MULTIPROTOCOL          = 1
+	CAP_ROUTE_REFRESH          = 2
+	CAP_EXTENDED_NEXTHOP       = 5
+	CAP_EXTENDED_MESSAGE       = 6
+	CAP_GRACEFUL_RESTART       = 64
+	CAP_AS4                    = 65
+	CAP_ADD_PATH               = 69
+	CAP_ENHANCED_ROUTE_REFRESH = 70
+)
+
+// AS_TRANS is the 2 byte AS a 4 byte AS speaker puts in the OPEN (RFC6793).
+const AS_TRANS = 23456
+
+// ReadMessageHeader checks the marker and length of the BGP message at the
+// start of buf and returns its type and total length, header included.
+func ReadMessageHeader(buf []byte) (uint8, int, error) {
+	if len(buf) < BGP_HEADER_LEN {
+		return 0, 0, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrTruncated, "not enough bytes to decode BGP header")
+	}
+	for _, b := range buf[:16] {
+		if b != 0xff {
+			return 0, 0, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrMalformed, "BGP header marker is not all ones")
+		}
+	}
+	mlen := int(binary.BigEndian.Uint16(buf[16:18]))
+	if mlen < BGP_HEADER_LEN {
+		return 0, 0, protoparse.NewParseError(protoparse.LayerBGP, 16, protoparse.ErrMalformed, "BGP message length %d is shorter than the header", mlen)
+	}
+	if mlen > len(buf) {
+		return 0, 0, protoparse.NewParseError(protoparse.LayerBGP, 16, protoparse.ErrTruncated, "not enough bytes for BGP message of length %d", mlen)
+	}
+	return buf[18], mlen, nil
+}
+
+// AFISAFI is an address family as negotiated in the multiprotocol capability.
+type AFISAFI struct {
+	AFI  uint16 `json:"afi"`
+	SAFI uint8  `json:"safi"`
+}
+
+func (a AFISAFI) String() string {
+	return fmt.Sprintf("%d/%d", a.AFI, a.SAFI)
+}
+
+// Capability is a capability advertised in the optional parameters of an OPEN.
+type Capability struct {
+	Code  uint8    `json:"code"`
+	Value HexBytes `json:"value,omitempty"`
+}
+
+// Open is a decoded BGP OPEN message. AS is the 4 byte AS from the AS4
+// capability if the speaker sent it, and the AS of the message otherwise.
+type Open struct {
+	Version      uint8         `json:"version"`
+	AS           uint32        `json:"as"`
+	HoldTime     uint16        `json:"hold_time"`
+	BGPID        net.IP        `json:"bgp_id"`
+	Capabilities []*Capability `json:"capabilities,omitempty"`
+}
+
+// ParseOpen decodes the body of an OPEN message, the part after the BGP header.
+func ParseOpen(buf []byte) (*Open, error) {
+	if len(buf) < 10 {
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrTruncated, "not enough bytes for OPEN message")
+	}
+	o := &Open{
+		Version:  buf[0],
+		AS:       uint32(binary.BigEndian.Uint16(buf[1:3])),
+		HoldTime: binary.BigEndian.Uint16(buf[3:5]),
+		BGPID:    copyIP(buf[5:9]),
+	}
+	plen := int(buf[9])
+	buf = buf[10:]
+	off := 10
+	if plen > len(buf) {
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, off, protoparse.ErrTruncated, "not enough bytes for OPEN optional parameters of length %d", plen)
+	}
+	buf = buf[:plen]
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off, protoparse.ErrTruncated, "not enough bytes for OPEN parameter type and length")
+		}
+		ptype, pl := buf[0], int(buf[1])
+		buf = buf[2:]
+		off += 2
+		if pl > len(buf) {
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off, protoparse.ErrTruncated, "not enough bytes for OPEN parameter of length %d", pl)
+		}
+		if ptype == 2 { //capabilities. other parameter types are deprecated
+			caps, err := readCapabilities(buf[:pl])
+			if err != nil {
+				return nil, protoparse.AddOffset(err, off)
+			}
+			o.Capabilities = append(o.Capabilities, caps...)
+		}
+		buf = buf[pl:]
+		off += pl
+	}
+	if as4, ok := o.AS4(); ok {
+		o.AS = as4
+	}
+	return o, nil
+}
+
+func readCapabilities(buf []byte) ([]*Capability, error) {
+	caps := []*Capability{}
+	off := 0
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off, protoparse.ErrTruncated, "not enough bytes for capability code and length")
+		}
+		code, cl := buf[0], int(buf[1])
+		buf = buf[2:]
+		off += 2
+		if cl > len(buf) {
+			return nil, protoparse.NewParseError(protoparse.LayerBGP, off, protoparse.ErrTruncated, "not enough bytes for capability %d of length %d", code, cl)
+		}
+		val := make([]byte, cl)
+		copy(val, buf[:cl])
+		caps = append(caps, &Capability{Code: code, Value: val})
+		buf = buf[cl:]
+		off += cl
+	}
+	return caps, nil
+}
+
+// GetCapability returns the first capability with code, or nil.
+func (o *Open) GetCapability(code uint8) *Capability {
+	for _, c := range o.Capabilities {
+		if c.Code == code {
+			return c
+		}
+	}
+	return nil
+}
+
+// AS4 returns the AS of the AS4 capability and whether it is present.
+func (o *Open) AS4() (uint32, bool) {
+	c := o.GetCapability(CAP_AS4)
+	if c == nil || len(c.Value) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(c.Value), true
+}
+
+// Families returns the address families of the multiprotocol capabilities.
+func (o *Open) Families() []AFISAFI {
+	fams := []AFISAFI{}
+	for _, c := range o.Capabilities {
+		if c.Code == CAP_MULTIPROTOCOL && len(c.Value) == 4 {
+			fams = append(fams, AFISAFI{binary.BigEndian.Uint16(c.Value[:2]), c.Value[3]})
+		}
+	}
+	return fams
+}
+
+func (o *Open) String() string {
+	ret := fmt.Sprintf("Version:%d AS:%d HoldTime:%d BGPID:%s", o.Version, o.AS, o.HoldTime, o.BGPID)
+	if fams := o.Families(); len(fams) != 0 {
+		ret += fmt.Sprintf(" Families:%v", fams)
+	}
+	if len(o.Capabilities) != 0 {
+		ret += " Capabilities:"
+		for _, c := range o.Capabilities {
+			ret += fmt.Sprintf(" %d", c.Code)
+		}
+	}
+	return ret
+}
+
+// Notification is a decoded BGP NOTIFICATION message.
+type Notification struct {
+	Code    uint8    `json:"code"`
+	Subcode uint8    `json:"subcode"`
+	Data    HexBytes `json:"data,omitempty"`
+}
+
+var notificationNames = map[uint8]string{
+	1: "Message Header Error",
+	2: "OPEN Message Error",
+	3: "UPDATE Message Error",
+	4: "Hold Timer Expired",
+	5: "Finite State Machine Error",
+	6: "Cease",
+	7: "ROUTE-REFRESH Message Error",
+}
+
+// ParseNotification decodes the body of a NOTIFICATION message.
+func ParseNotification(buf []byte) (*Notification, error) {
+	if len(buf) < 2 {
+		return nil, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrTruncated, "not enough bytes for NOTIFICATION message")
+	}
+	n := &Notification{Code: buf[0], Subcode: buf[1]}
+	if len(buf) > 2 {
+		n.Data = make([]byte, len(buf)-2)
+		copy(n.Data, buf[2:])
+	}
+	return n, nil
+}
+
+func (n *Notification) String() string {
+	name, ok := notificationNames[n.Code]
+	if !ok {
+		name = fmt.Sprintf("Unknown Error %d", n.Code)
+	}
+	return fmt.Sprintf("%s (subcode %d)", name, n.Subcode)
+}
+
+// NewMessage encodes a BGP message of mtype with body.
+func NewMessage(mtype uint8, body []byte) []byte {
+	msg := make([]byte, BGP_HEADER_LEN, BGP_HEADER_LEN+len(body))
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xff
+	}
+	binary.BigEndian.PutUint16(msg[16:18], uint16(BGP_HEADER_LEN+len(body)))
+	msg[18] = mtype
+	return append(msg, body...)
+}
+
+// NewAS4Capability returns the capability a 4 byte AS speaker advertises.
+func NewAS4Capability(as uint32) *Capability {
+	val := make([]byte, 4)
+	binary.BigEndian.PutUint32(val, as)
+	return &Capability{Code: CAP_AS4, Value: val}
+}
+
+// NewMultiprotocolCapability returns the capability for an address family.
+func NewMultiprotocolCapability(fam AFISAFI) *Capability {
+	return &Capability{Code: CAP_MULTIPROTOCOL, Value: []byte{byte(fam.AFI >> 8), byte(fam.AFI), 0, fam.SAFI}}
+}
+
+// Encode returns the OPEN as a BGP message. The AS field carries AS_TRANS
+// if the AS doesn't fit in 2 bytes, so the AS4 capability must be present.
+func (o *Open) Encode() []byte {
+	caps := []byte{}
+	for _, c := range o.Capabilities {
+		caps = append(caps, c.Code, byte(len(c.Value)))
+		caps = append(caps, c.Value...)
+	}
+	body := make([]byte, 10, 12+len(caps))
+	body[0] = o.Version
+	as := o.AS
+	if as > 0xffff {
+		as = AS_TRANS
+	}
+	binary.BigEndian.PutUint16(body[1:3], uint16(as))
+	binary.BigEndian.PutUint16(body[3:5], o.HoldTime)
+	copy(body[5:9], o.BGPID.To4())
+	if len(caps) > 0 {
+		body[9] = byte(len(caps) + 2)
+		body = append(body, 2, byte(len(caps)))
+		body = append(body, caps...)
+	}
+	return NewMessage(MSG_OPEN, body)
+}
+
+// Encode returns the NOTIFICATION as a BGP message.
+func (n *Notification) Encode() []byte {
+	return NewMessage(MSG_NOTIFICATION, append([]byte{n.Code, n.Subcode}, n.Data...))
+}
+
+// SplitBGP is a bufio.SplitFunc that splits a stream of BGP messages, like
+// the payload of a BGP TCP session.
+func SplitBGP(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if len(data) < BGP_HEADER_LEN {
+		if atEOF {
+			return 0, nil, protoparse.NewParseError(protoparse.LayerBGP, 0, protoparse.ErrTruncated, "stream ended in the middle of a BGP header")
+		}
+		return 0, nil, nil
+	}
+	_, mlen, err := ReadMessageHeader(data)
+	if err != nil {
+		if errors.Is(err, protoparse.ErrTruncated) && !atEOF { //need to read more
+			return 0, nil, nil
+		}
+		return 0, nil, err
+	}
+	return mlen, data[:mlen], nil
+}
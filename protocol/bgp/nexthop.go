@@ -0,0 +1,87 @@
+package bgp
+
+import (
+	"fmt"
+	pbcom "github.com/CSUNetSec/netsec-protobufs/common"
+	"net"
+)
+
+const (
+	SAFI_MPLS_VPN           = 128
+	SAFI_MPLS_VPN_MULTICAST = 129
+)
+
+// MPNextHop is the next hop of an MP_REACH attribute. IPv6 next hops can
+// carry a link local address after the global one (RFC2545), IPv4 NLRI can
+// have IPv6 next hops (RFC8950) and VPN next hops are prefixed by a
+// route distinguisher (RFC4364, RFC4659).
+type MPNextHop struct {
+	Global    net.IP              `json:"global"`
+	LinkLocal net.IP              `json:"link_local,omitempty"`
+	RD        *RouteDistinguisher `json:"rd,omitempty"`
+}
+
+// readMPNextHop decodes the next hop of an MP_REACH based on its length, since
+// the AFI only describes the NLRI.
+func readMPNextHop(buf []byte, nhl, safi uint8) (*MPNextHop, error) {
+	if nhl == 0 || int(nhl) > len(buf) {
+		return nil, fmt.Errorf("next hop length (%d) in MP_REACH is malformed", nhl)
+	}
+	buf = buf[:nhl]
+	nh := new(MPNextHop)
+	if safi == SAFI_MPLS_VPN || safi == SAFI_MPLS_VPN_MULTICAST {
+		//RD + IPv4, RD + IPv6 or RD + IPv6 + RD + IPv6 link local
+		switch nhl {
+		case RD_LEN + 4, RD_LEN + 16:
+			rd := newRouteDistinguisher(buf)
+			nh.RD = &rd
+			nh.Global = copyIP(buf[RD_LEN:])
+		case 2 * (RD_LEN + 16):
+			rd := newRouteDistinguisher(buf)
+			nh.RD = &rd
+			nh.Global = copyIP(buf[RD_LEN : RD_LEN+16])
+			nh.LinkLocal = copyIP(buf[2*RD_LEN+16:])
+		default:
+			return nil, fmt.Errorf("VPN next hop length (%d) in MP_REACH is malformed", nhl)
+		}
+		return nh, nil
+	}
+	switch nhl {
+	case 4, 16:
+		nh.Global = copyIP(buf)
+	case 32:
+		nh.Global = copyIP(buf[:16])
+		nh.LinkLocal = copyIP(buf[16:])
+	default:
+		return nil, fmt.Errorf("next hop length (%d) in MP_REACH is not an IPv4 or IPv6 address length", nhl)
+	}
+	return nh, nil
+}
+
+func copyIP(buf []byte) net.IP {
+	IPbuf := make([]byte, len(buf))
+	copy(IPbuf, buf)
+	return net.IP(IPbuf)
+}
+
+// ipWrapper returns the global next hop in the form the BGPUpdate protobuf stores it.
+func (nh *MPNextHop) ipWrapper() *pbcom.IPAddressWrapper {
+	addr := new(pbcom.IPAddressWrapper)
+	if len(nh.Global) == 4 {
+		addr.IPv4 = nh.Global
+	} else {
+		addr.IPv6 = nh.Global
+	}
+	return addr
+}
+
+func (nh *MPNextHop) String() string {
+	ret := nh.Global.String()
+	if nh.LinkLocal != nil {
+		ret += fmt.Sprintf(" Link-Local:%s", nh.LinkLocal)
+	}
+	if nh.RD != nil {
+		ret += fmt.Sprintf(" RD:%s", nh.RD)
+	}
+	return ret
+}
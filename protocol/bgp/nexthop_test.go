@@ -0,0 +1,57 @@
+package bgp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMPNextHop(t *testing.T) {
+	rd0 := make([]byte, RD_LEN)
+	ll := []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	cases := []struct {
+		name              string
+		afi               uint16
+		safi              uint8
+		nh, nlri          []byte
+		global, linkLocal string
+		rd                string
+	}{
+		{"IPv4", AFI_IP, SAFI_UNICAST, nh4, []byte{8, 10}, "192.0.2.1", "", ""},
+		{"IPv6", AFI_IP6, SAFI_UNICAST, nh6, []byte{32, 0x20, 0x01, 0x0d, 0xb8}, "2001:db8::1", "", ""},
+		{"IPv6 and link local (RFC2545)", AFI_IP6, SAFI_UNICAST, concat(nh6, ll), []byte{32, 0x20, 0x01, 0x0d, 0xb8}, "2001:db8::1", "fe80::1", ""},
+		{"IPv6 for IPv4 NLRI (RFC8950)", AFI_IP, SAFI_UNICAST, nh6, []byte{8, 10}, "2001:db8::1", "", ""},
+		{"VPN-IPv4", AFI_IP, SAFI_MPLS_VPN, concat(rd0, nh4), nil, "192.0.2.1", "", "0:0"},
+		{"VPN-IPv6", AFI_IP6, SAFI_MPLS_VPN, concat(rd0, nh6), nil, "2001:db8::1", "", "0:0"},
+		{"VPN-IPv6 and link local", AFI_IP6, SAFI_MPLS_VPN, concat(rd0, nh6, rd0, ll), nil, "2001:db8::1", "fe80::1", "0:0"},
+	}
+	for _, c := range cases {
+		attrs, extra, err := parseAttrs(mpReach(c.afi, c.safi, c.nh, c.nlri))
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		nh := extra.MPNextHop
+		if nh == nil || nh.Global.String() != c.global {
+			t.Errorf("%s: expected next hop %s, got %v", c.name, c.global, nh)
+			continue
+		}
+		if (c.linkLocal == "" && nh.LinkLocal != nil) || (c.linkLocal != "" && nh.LinkLocal.String() != c.linkLocal) {
+			t.Errorf("%s: expected link local %q, got %v", c.name, c.linkLocal, nh.LinkLocal)
+		}
+		if (c.rd == "" && nh.RD != nil) || (c.rd != "" && (nh.RD == nil || nh.RD.String() != c.rd)) {
+			t.Errorf("%s: expected RD %q, got %v", c.name, c.rd, nh.RD)
+		}
+		// the protobuf only holds the global address
+		aw := NewAttrsWrapper(attrs)
+		aw.setMPNextHop(nh)
+		if !aw.NextHop.Equal(net.ParseIP(c.global)) {
+			t.Errorf("%s: attributes have next hop %s", c.name, aw.NextHop)
+		}
+	}
+
+	for _, nh := range [][]byte{nh4[:3], concat(nh6, nh4), concat(rd0, nh4[:2])} {
+		if _, _, err := parseAttrs(mpReach(AFI_IP, SAFI_MPLS_VPN, nh, nil)); err == nil {
+			t.Errorf("next hop of length %d parsed", len(nh))
+		}
+	}
+}
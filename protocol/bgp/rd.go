@@ -0,0 +1,42 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	RD_LEN = 8
+)
+
+// RouteDistinguisher is the 8 byte value prefixed to VPN NLRI (RFC4364).
+type RouteDistinguisher [RD_LEN]byte
+
+func newRouteDistinguisher(buf []byte) RouteDistinguisher {
+	var rd RouteDistinguisher
+	copy(rd[:], buf[:RD_LEN])
+	return rd
+}
+
+// Type returns the 2 byte type field of the RD.
+func (rd RouteDistinguisher) Type() uint16 {
+	return binary.BigEndian.Uint16(rd[:2])
+}
+
+// String formats the RD as admin:assigned according to its type.
+func (rd RouteDistinguisher) String() string {
+	switch rd.Type() {
+	case 0: // 2 byte AS and 4 byte number
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(rd[2:4]), binary.BigEndian.Uint32(rd[4:8]))
+	case 1: // IPv4 address and 2 byte number
+		return fmt.Sprintf("%s:%d", net.IP(rd[2:6]), binary.BigEndian.Uint16(rd[6:8]))
+	case 2: // 4 byte AS and 2 byte number
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint32(rd[2:6]), binary.BigEndian.Uint16(rd[6:8]))
+	}
+	return fmt.Sprintf("type%d:%x", rd.Type(), rd[2:])
+}
+
+func (rd RouteDistinguisher) MarshalText() ([]byte, error) {
+	return []byte(rd.String()), nil
+}
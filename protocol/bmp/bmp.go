@@ -0,0 +1,377 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	pp "github.com/CSUNetSec/protoparse"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+)
+
+const (
+	BMP_VERSION         = 3
+	BMP_HEADER_LEN      = 6
+	PER_PEER_HEADER_LEN = 42
+)
+
+// MsgType is the type of a BMP message (RFC7854 section 4.1).
+type MsgType uint8
+
+const (
+	ROUTE_MONITORING = MsgType(iota)
+	STATISTICS_REPORT
+	PEER_DOWN
+	PEER_UP
+	INITIATION
+	TERMINATION
+	ROUTE_MIRRORING
+)
+
+var msgTypeNames = map[MsgType]string{
+	ROUTE_MONITORING:  "route-monitoring",
+	STATISTICS_REPORT: "statistics-report",
+	PEER_DOWN:         "peer-down",
+	PEER_UP:           "peer-up",
+	INITIATION:        "initiation",
+	TERMINATION:       "termination",
+	ROUTE_MIRRORING:   "route-mirroring",
+}
+
+func (t MsgType) String() string {
+	if name, ok := msgTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+func (t MsgType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// PeerType is the type of a per-peer header (RFC7854 section 4.2, RFC9069).
+type PeerType uint8
+
+const (
+	PEER_GLOBAL = PeerType(iota)
+	PEER_RD
+	PEER_LOCAL
+	PEER_LOC_RIB
+)
+
+var peerTypeNames = map[PeerType]string{
+	PEER_GLOBAL:  "global",
+	PEER_RD:      "rd-instance",
+	PEER_LOCAL:   "local-instance",
+	PEER_LOC_RIB: "loc-rib",
+}
+
+func (t PeerType) String() string {
+	if name, ok := peerTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+func (t PeerType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// per-peer header flags
+const (
+	PEER_FLAG_V = 0x80 // IPv6 peer address
+	PEER_FLAG_L = 0x40 // post-policy Adj-RIB-In
+	PEER_FLAG_A = 0x20 // legacy 2 byte AS_PATH
+	PEER_FLAG_O = 0x10 // Adj-RIB-Out (RFC8671)
+	PEER_FLAG_F = 0x80 // filtered Loc-RIB (RFC9069)
+)
+
+// Header is the common header of all BMP messages.
+type Header struct {
+	Version uint8   `json:"version"`
+	Length  uint32  `json:"length"`
+	Type    MsgType `json:"type"`
+}
+
+// PeerHeader is the per-peer header of the messages that are about a peer.
+// The flags are decoded in the booleans, and for loc-rib peers PostPolicy
+// is set and Filtered holds the F flag.
+type PeerHeader struct {
+	Type          PeerType               `json:"peer_type"`
+	Flags         uint8                  `json:"flags"`
+	Distinguisher bgp.RouteDistinguisher `json:"peer_distinguisher"`
+	Address       net.IP                 `json:"peer_address"`
+	AS            uint32                 `json:"peer_as"`
+	BGPID         net.IP                 `json:"peer_bgp_id"`
+	Timestamp     time.Time              `json:"timestamp"`
+	IPv6          bool                   `json:"ipv6,omitempty"`
+	PostPolicy    bool                   `json:"post_policy,omitempty"`
+	LegacyASPath  bool                   `json:"legacy_as_path,omitempty"`
+	AdjRIBOut     bool                   `json:"adj_rib_out,omitempty"`
+	Filtered      bool                   `json:"filtered,omitempty"`
+}
+
+func (p *PeerHeader) String() string {
+	ret := fmt.Sprintf("Peer Type:%s Address:%s AS:%d BGPID:%s Time:%s", p.Type, p.Address, p.AS, p.BGPID, p.Timestamp)
+	if p.Type == PEER_RD {
+		ret += fmt.Sprintf(" Distinguisher:%s", p.Distinguisher)
+	}
+	if p.PostPolicy {
+		ret += " post-policy"
+	}
+	if p.AdjRIBOut {
+		ret += " adj-rib-out"
+	}
+	if p.Filtered {
+		ret += " filtered"
+	}
+	return ret
+}
+
+// readAddress reads a 16 byte address field that holds an IPv4 address
+// in its last 4 bytes unless v6 is set.
+func readAddress(buf []byte, v6 bool) net.IP {
+	if v6 {
+		IPbuf := make([]byte, 16)
+		copy(IPbuf, buf[:16])
+		return net.IP(IPbuf)
+	}
+	IPbuf := make([]byte, 4)
+	copy(IPbuf, buf[12:16])
+	return net.IP(IPbuf)
+}
+
+func readPeerHeader(buf []byte) (*PeerHeader, error) {
+	if len(buf) < PER_PEER_HEADER_LEN {
+		return nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrTruncated, "not enough bytes for BMP per-peer header")
+	}
+	p := &PeerHeader{
+		Type:  PeerType(buf[0]),
+		Flags: buf[1],
+	}
+	copy(p.Distinguisher[:], buf[2:10])
+	if p.Type == PEER_LOC_RIB {
+		p.PostPolicy = true
+		p.Filtered = p.Flags&PEER_FLAG_F != 0
+	} else {
+		p.IPv6 = p.Flags&PEER_FLAG_V != 0
+		p.PostPolicy = p.Flags&PEER_FLAG_L != 0
+		p.LegacyASPath = p.Flags&PEER_FLAG_A != 0
+		p.AdjRIBOut = p.Flags&PEER_FLAG_O != 0
+	}
+	p.Address = readAddress(buf[10:26], p.IPv6)
+	p.AS = binary.BigEndian.Uint32(buf[26:30])
+	p.BGPID = net.IP(append([]byte{}, buf[30:34]...))
+	sec := binary.BigEndian.Uint32(buf[34:38])
+	usec := binary.BigEndian.Uint32(buf[38:42])
+	p.Timestamp = time.Unix(int64(sec), int64(usec)*1000).UTC()
+	return p, nil
+}
+
+// PeerHeaderer is implemented by the bodies of the messages that have
+// a per-peer header.
+type PeerHeaderer interface {
+	pp.PbVal
+	GetPeerHeader() *PeerHeader
+}
+
+type bmpHdrBuf struct {
+	dest *Header
+	buf  []byte
+}
+
+// NewBmpHdrBuf returns a PbVal for the BMP message in buf. Parsing it
+// returns the PbVal of the message body according to its type.
+func NewBmpHdrBuf(buf []byte) *bmpHdrBuf {
+	return &bmpHdrBuf{
+		dest: new(Header),
+		buf:  buf,
+	}
+}
+
+func (b *bmpHdrBuf) Parse() (pp.PbVal, error) {
+	if len(b.buf) < BMP_HEADER_LEN {
+		return nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrTruncated, "not enough bytes to decode BMP header")
+	}
+	b.dest.Version = b.buf[0]
+	b.dest.Length = binary.BigEndian.Uint32(b.buf[1:5])
+	b.dest.Type = MsgType(b.buf[5])
+	if b.dest.Version != BMP_VERSION {
+		return nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrUnsupported, "unsupported BMP version %d", b.dest.Version)
+	}
+	if b.dest.Length < BMP_HEADER_LEN {
+		return nil, pp.NewParseError(pp.LayerBMP, 1, pp.ErrMalformed, "BMP message length %d is shorter than the header", b.dest.Length)
+	}
+	if int(b.dest.Length) > len(b.buf) {
+		return nil, pp.NewParseError(pp.LayerBMP, 1, pp.ErrTruncated, "not enough bytes for BMP message. len of buf:%d len parsed:%d", len(b.buf), b.dest.Length)
+	}
+	body := b.buf[BMP_HEADER_LEN:b.dest.Length]
+	switch b.dest.Type {
+	case ROUTE_MONITORING:
+		return &routeMonitoringBuf{buf: body}, nil
+	case STATISTICS_REPORT:
+		return &statsReportBuf{buf: body, dest: new(StatsReport)}, nil
+	case PEER_DOWN:
+		return &peerDownBuf{buf: body, dest: new(PeerDown)}, nil
+	case PEER_UP:
+		return &peerUpBuf{buf: body, dest: new(PeerUp)}, nil
+	case INITIATION, TERMINATION:
+		return &infoBuf{buf: body, dest: &Info{Type: b.dest.Type}}, nil
+	case ROUTE_MIRRORING:
+		return &routeMirroringBuf{buf: body, dest: new(RouteMirroring)}, nil
+	}
+	return nil, pp.NewParseError(pp.LayerBMP, 5, pp.ErrUnsupported, "unsupported BMP message type %d", b.dest.Type)
+}
+
+func (b *bmpHdrBuf) GetHeader() *Header {
+	return b.dest
+}
+
+func (b *bmpHdrBuf) String() string {
+	return fmt.Sprintf("BMP Version:%d Type:%s Length:%d", b.dest.Version, b.dest.Type, b.dest.Length)
+}
+
+func (b *bmpHdrBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.dest)
+}
+
+// SplitBmp is a bufio.SplitFunc that splits a stream of BMP messages.
+func SplitBmp(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	dataLen := len(data)
+	if atEOF && dataLen == 0 {
+		return 0, nil, nil
+	}
+	if dataLen < BMP_HEADER_LEN {
+		if atEOF {
+			return 0, nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrTruncated, "stream ended in the middle of a BMP header")
+		}
+		return 0, nil, nil
+	}
+	totlen := int(binary.BigEndian.Uint32(data[1:5]))
+	if data[0] != BMP_VERSION || totlen < BMP_HEADER_LEN {
+		// a length can't be trusted after this so the stream is lost
+		return 0, nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrMalformed, "bad BMP header (version %d length %d) in stream", data[0], totlen)
+	}
+	if dataLen < totlen {
+		if atEOF {
+			return 0, nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrTruncated, "stream ended in the middle of a BMP message")
+		}
+		return 0, nil, nil
+	}
+	return totlen, data[0:totlen], nil
+}
+
+// routeMonitoringBuf is the body of a route monitoring message. Parsing it
+// returns the header of the BGP update it carries.
+type routeMonitoringBuf struct {
+	peer *PeerHeader
+	buf  []byte
+}
+
+func (r *routeMonitoringBuf) Parse() (pp.PbVal, error) {
+	peer, err := readPeerHeader(r.buf)
+	if err != nil {
+		return nil, err
+	}
+	r.peer = peer
+	msg := r.buf[PER_PEER_HEADER_LEN:]
+	mtype, _, err := bgp.ReadMessageHeader(msg)
+	if err != nil {
+		return nil, pp.AddOffset(err, PER_PEER_HEADER_LEN)
+	}
+	if mtype != bgp.MSG_UPDATE {
+		return nil, pp.NewParseError(pp.LayerBMP, PER_PEER_HEADER_LEN+18, pp.ErrMalformed, "route monitoring message carries BGP message of type %d", mtype)
+	}
+	return bgp.NewBgpHeaderBuf(msg, peer.IPv6, !peer.LegacyASPath), nil
+}
+
+func (r *routeMonitoringBuf) GetPeerHeader() *PeerHeader {
+	return r.peer
+}
+
+func (r *routeMonitoringBuf) String() string {
+	if r.peer == nil {
+		return ""
+	}
+	return r.peer.String()
+}
+
+func (r *routeMonitoringBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.peer)
+}
+
+// BmpBufferStack holds the PbVals a BMP message was parsed in. Bgphbuf and
+// Bgpupbuf are only set for route monitoring messages.
+type BmpBufferStack struct {
+	Bmphbuf  pp.PbVal `json:"bmp_header,omitempty"`
+	Bodybuf  pp.PbVal `json:"bmp_body,omitempty"`
+	Bgphbuf  pp.PbVal `json:"bgp_header,omitempty"`
+	Bgpupbuf pp.PbVal `json:"bgp_update,omitempty"`
+}
+
+// ParseHeaders parses a whole BMP message as split by SplitBmp.
+func ParseHeaders(data []byte) (*BmpBufferStack, error) {
+	bmph := NewBmpHdrBuf(data)
+	body, err := bmph.Parse()
+	if err != nil {
+		return nil, err
+	}
+	bgph, err := body.Parse()
+	if err != nil {
+		return nil, pp.AddOffset(err, BMP_HEADER_LEN)
+	}
+	if bgph == nil {
+		return &BmpBufferStack{Bmphbuf: bmph, Bodybuf: body}, nil
+	}
+	// only route monitoring carries a BGP message, after the per-peer header
+	off := BMP_HEADER_LEN + PER_PEER_HEADER_LEN
+	bgpup, err := bgph.Parse()
+	if err != nil {
+		return nil, pp.AddOffset(err, off)
+	}
+	if _, err = bgpup.Parse(); err != nil {
+		return nil, pp.AddOffset(err, off+bgp.BGP_HEADER_LEN)
+	}
+	return &BmpBufferStack{Bmphbuf: bmph, Bodybuf: body, Bgphbuf: bgph, Bgpupbuf: bgpup}, nil
+}
+
+// GetHeader returns the common header of the message.
+func (bbs *BmpBufferStack) GetHeader() *Header {
+	return bbs.Bmphbuf.(*bmpHdrBuf).dest
+}
+
+// GetRawMessage returns the bytes of the message.
+func (bbs *BmpBufferStack) GetRawMessage() []byte {
+	return bbs.Bmphbuf.(*bmpHdrBuf).buf
+}
+
+// GetPeerHeader returns the per-peer header, or nil for initiation and
+// termination messages.
+func (bbs *BmpBufferStack) GetPeerHeader() *PeerHeader {
+	if ph, ok := bbs.Bodybuf.(PeerHeaderer); ok {
+		return ph.GetPeerHeader()
+	}
+	return nil
+}
+
+// GetUpdate returns the BGP update of a route monitoring message, or nil.
+func (bbs *BmpBufferStack) GetUpdate() *pbbgp.BGPUpdate {
+	if bbs.Bgpupbuf == nil {
+		return nil
+	}
+	return bbs.Bgpupbuf.(pp.BGPUpdater).GetUpdate()
+}
+
+func (bbs *BmpBufferStack) String() string {
+	ret := bbs.Bmphbuf.String() + "\n"
+	if s := bbs.Bodybuf.String(); s != "" {
+		ret += s + "\n"
+	}
+	if bbs.Bgpupbuf != nil {
+		ret += bbs.Bgpupbuf.String()
+	}
+	return ret
+}
@@ -0,0 +1,220 @@
+package bmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+
+	pp "github.com/CSUNetSec/protoparse"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+)
+
+func bgpMessage(mtype uint8, body []byte) []byte {
+	msg := bytes.Repeat([]byte{0xff}, 16)
+	msg = append(msg, 0, 0, mtype)
+	binary.BigEndian.PutUint16(msg[16:18], uint16(bgp.BGP_HEADER_LEN+len(body)))
+	return append(msg, body...)
+}
+
+func bmpMessage(mtype MsgType, body []byte) []byte {
+	msg := []byte{BMP_VERSION, 0, 0, 0, 0, byte(mtype)}
+	binary.BigEndian.PutUint32(msg[1:5], uint32(BMP_HEADER_LEN+len(body)))
+	return append(msg, body...)
+}
+
+func peerHeader(addr net.IP, as uint32, flags uint8) []byte {
+	hdr := make([]byte, PER_PEER_HEADER_LEN)
+	if v4 := addr.To4(); v4 != nil {
+		copy(hdr[22:26], v4)
+	} else {
+		copy(hdr[10:26], addr)
+		flags |= PEER_FLAG_V
+	}
+	hdr[1] = flags
+	binary.BigEndian.PutUint32(hdr[26:30], as)
+	copy(hdr[30:34], bgpID(addr))
+	binary.BigEndian.PutUint32(hdr[34:38], 1500000000)
+	binary.BigEndian.PutUint32(hdr[38:42], 250000)
+	return hdr
+}
+
+// bgpID returns addr as a BGP identifier, or a fixed one for IPv6 addresses.
+func bgpID(addr net.IP) net.IP {
+	if v4 := addr.To4(); v4 != nil {
+		return v4
+	}
+	return net.IPv4(192, 0, 2, 1).To4()
+}
+
+func openBody(as uint32, id net.IP) []byte {
+	caps := []byte{1, 4, 0, 1, 0, 1, 65, 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(caps[8:12], as)
+	body := []byte{4, 0x5b, 0xa0, 0, 90}
+	body = append(body, bgpID(id)...)
+	body = append(body, byte(len(caps)+2), 2, byte(len(caps)))
+	return append(body, caps...)
+}
+
+// updateBody advertises 10.0.0.0/8 with an AS4 path of ases.
+func updateBody(ases ...uint32) []byte {
+	path := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}
+	attrs = append(attrs, path...)
+	attrs = append(attrs, 0x40, 3, 4, 192, 0, 2, 1)
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	return append(body, 8, 10)
+}
+
+func routeMonitoring(peer net.IP, as uint32, flags uint8, path ...uint32) []byte {
+	body := peerHeader(peer, as, flags)
+	return bmpMessage(ROUTE_MONITORING, append(body, bgpMessage(bgp.MSG_UPDATE, updateBody(path...))...))
+}
+
+func peerUp(peer net.IP, as uint32, local net.IP, localAS uint32) []byte {
+	body := peerHeader(peer, as, 0)
+	addr := make([]byte, 16)
+	if v4 := local.To4(); v4 != nil && peer.To4() != nil {
+		copy(addr[12:], v4)
+	} else {
+		copy(addr, local.To16())
+	}
+	body = append(body, addr...)
+	body = append(body, 0, 179, 0xc0, 0x01)
+	body = append(body, bgpMessage(bgp.MSG_OPEN, openBody(localAS, local))...)
+	body = append(body, bgpMessage(bgp.MSG_OPEN, openBody(as, peer))...)
+	return bmpMessage(PEER_UP, body)
+}
+
+func peerDown(peer net.IP, as uint32) []byte {
+	body := peerHeader(peer, as, 0)
+	body = append(body, PEER_DOWN_REMOTE_NOTIFICATION)
+	body = append(body, bgpMessage(bgp.MSG_NOTIFICATION, []byte{6, 2})...)
+	return bmpMessage(PEER_DOWN, body)
+}
+
+func initiation(name string) []byte {
+	tlv := []byte{0, INFO_SYSNAME, 0, byte(len(name))}
+	return bmpMessage(INITIATION, append(tlv, name...))
+}
+
+func termination(reason uint16) []byte {
+	return bmpMessage(TERMINATION, []byte{0, INFO_REASON, 0, 2, byte(reason >> 8), byte(reason)})
+}
+
+func statsReport(peer net.IP, as uint32) []byte {
+	body := peerHeader(peer, as, 0)
+	body = append(body, 0, 0, 0, 2)
+	body = append(body, 0, 7, 0, 8, 0, 0, 0, 0, 0, 0, 0x01, 0x00)
+	body = append(body, 0, 9, 0, 11, 0, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0x20)
+	return bmpMessage(STATISTICS_REPORT, body)
+}
+
+func TestRouteMonitoring(t *testing.T) {
+	peer := net.ParseIP("10.0.0.1")
+	bbs, err := ParseHeaders(routeMonitoring(peer, 4200000000, PEER_FLAG_L, 4200000000, 3356))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph := bbs.GetPeerHeader()
+	if !ph.Address.Equal(peer) || ph.AS != 4200000000 || !ph.PostPolicy || ph.IPv6 || ph.AdjRIBOut {
+		t.Errorf("bad per-peer header %s", ph)
+	}
+	if ph.Timestamp.Unix() != 1500000000 || ph.Timestamp.Nanosecond() != 250000000 {
+		t.Errorf("bad timestamp %s", ph.Timestamp)
+	}
+	up := bbs.GetUpdate()
+	if up == nil || up.AdvertisedRoutes == nil || len(up.AdvertisedRoutes.Prefixes) != 1 {
+		t.Fatalf("expected one advertised prefix, got %v", up)
+	}
+	seq := up.Attrs.ASPath[0].ASSeq
+	if len(seq) != 2 || seq[0] != 4200000000 || seq[1] != 3356 {
+		t.Errorf("bad AS path %v", seq)
+	}
+}
+
+func TestPeerUpDown(t *testing.T) {
+	peer, local := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	bbs, err := ParseHeaders(peerUp(peer, 65001, local, 4200000001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu := bbs.Bodybuf.(*peerUpBuf).GetPeerUp()
+	if !pu.LocalAddress.Equal(local) || pu.LocalPort != 179 || pu.RemotePort != 0xc001 {
+		t.Errorf("bad peer up addresses %s %d %d", pu.LocalAddress, pu.LocalPort, pu.RemotePort)
+	}
+	if pu.SentOpen.AS != 4200000001 || pu.ReceivedOpen.AS != 65001 || pu.ReceivedOpen.HoldTime != 90 {
+		t.Errorf("bad OPENs %s / %s", pu.SentOpen, pu.ReceivedOpen)
+	}
+	if fams := pu.ReceivedOpen.Families(); len(fams) != 1 || fams[0] != (bgp.AFISAFI{AFI: 1, SAFI: 1}) {
+		t.Errorf("bad families %v", fams)
+	}
+
+	bbs, err = ParseHeaders(peerDown(peer, 65001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd := bbs.Bodybuf.(*peerDownBuf).GetPeerDown()
+	if pd.Reason != PEER_DOWN_REMOTE_NOTIFICATION || pd.Notification == nil || pd.Notification.Code != 6 || pd.Notification.Subcode != 2 {
+		t.Errorf("bad peer down %s", bbs.Bodybuf)
+	}
+}
+
+func TestInfoAndStats(t *testing.T) {
+	bbs, err := ParseHeaders(initiation("router1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := bbs.Bodybuf.(*infoBuf).GetInfo().Strings(INFO_SYSNAME); len(names) != 1 || names[0] != "router1" {
+		t.Errorf("bad sysName %v", names)
+	}
+	bbs, err = ParseHeaders(termination(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := bbs.Bodybuf.(*infoBuf).GetInfo().Reason(); !ok || r != 2 {
+		t.Errorf("bad termination reason %d", r)
+	}
+	bbs, err = ParseHeaders(statsReport(net.ParseIP("10.0.0.1"), 65001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := bbs.Bodybuf.(*statsReportBuf).GetStatsReport().Stats
+	if len(stats) != 2 || stats[0].Value != 256 || stats[1].AFI != 2 || stats[1].SAFI != 1 || stats[1].Value != 32 {
+		t.Errorf("bad stats %s", bbs.Bodybuf)
+	}
+}
+
+func TestSplitBmp(t *testing.T) {
+	peer := net.ParseIP("10.0.0.1")
+	stream := append(initiation("router1"), routeMonitoring(peer, 65001, 0, 65001)...)
+	stream = append(stream, termination(0)...)
+	scanner := bufio.NewScanner(bytes.NewReader(stream))
+	scanner.Split(SplitBmp)
+	types := []MsgType{}
+	for scanner.Scan() {
+		bbs, err := ParseHeaders(scanner.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, bbs.GetHeader().Type)
+	}
+	if scanner.Err() != nil || len(types) != 3 || types[1] != ROUTE_MONITORING {
+		t.Errorf("bad split %v err:%v", types, scanner.Err())
+	}
+
+	scanner = bufio.NewScanner(bytes.NewReader(stream[:len(stream)-2]))
+	scanner.Split(SplitBmp)
+	for scanner.Scan() {
+	}
+	if !errors.Is(scanner.Err(), pp.ErrTruncated) {
+		t.Errorf("expected a truncated error at the end of the stream, got %v", scanner.Err())
+	}
+}
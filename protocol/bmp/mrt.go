@@ -0,0 +1,107 @@
+package bmp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// MRTConverter turns BMP messages into BGP4MP MRT records. Route monitoring
+// messages become MESSAGE_AS4 records (MESSAGE for peers with the legacy 2
+// byte AS_PATH flag) and peer up/down messages STATE_CHANGE_AS4 records.
+// It remembers the local address and AS of each peer from its peer up,
+// since route monitoring messages don't carry them, so it must see all
+// the messages of a router in order. Timestamps are the per-peer header
+// ones truncated to seconds, or the time the message was received if the
+// router didn't set one.
+type MRTConverter struct {
+	// StateChanges enables the records of peer up and down messages.
+	// mrt.ParseHeaders reports those records as unsupported, so readers
+	// that only expect updates may want them off.
+	StateChanges bool
+
+	mu     sync.Mutex
+	locals map[string]*mrt.BGP4MPPeering
+}
+
+// NewMRTConverter creates a converter that also emits state changes.
+func NewMRTConverter() *MRTConverter {
+	return &MRTConverter{
+		StateChanges: true,
+		locals:       make(map[string]*mrt.BGP4MPPeering),
+	}
+}
+
+func (c *MRTConverter) peering(router string, peer *PeerHeader) *mrt.BGP4MPPeering {
+	key := router + "|" + peerKey(peer)
+	p, ok := c.locals[key]
+	if !ok {
+		p = &mrt.BGP4MPPeering{}
+		c.locals[key] = p
+	}
+	p.PeerAS = peer.AS
+	p.PeerIP = peer.Address
+	return p
+}
+
+// Convert returns the MRT record for a BMP message, or nil for messages
+// that don't have one.
+func (c *MRTConverter) Convert(m *Message) ([]byte, error) {
+	peer := m.GetPeerHeader()
+	if peer == nil {
+		return nil, nil
+	}
+	ts := peer.Timestamp
+	if ts.Unix() == 0 {
+		ts = m.Received
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.peering(m.Router, peer)
+	switch body := m.Bodybuf.(type) {
+	case *routeMonitoringBuf:
+		msg, err := body.bgpMessage()
+		if err != nil {
+			return nil, err
+		}
+		return mrt.NewBGP4MPMessage(ts, p, !peer.LegacyASPath, msg), nil
+	case *peerUpBuf:
+		pu := body.GetPeerUp()
+		p.LocalIP = pu.LocalAddress
+		if pu.SentOpen != nil {
+			p.LocalAS = pu.SentOpen.AS
+		}
+		if !c.StateChanges {
+			return nil, nil
+		}
+		return mrt.NewBGP4MPStateChange(ts, p, mrt.STATE_OPENCONFIRM, mrt.STATE_ESTABLISHED), nil
+	case *peerDownBuf:
+		if !c.StateChanges {
+			return nil, nil
+		}
+		return mrt.NewBGP4MPStateChange(ts, p, mrt.STATE_ESTABLISHED, mrt.STATE_IDLE), nil
+	}
+	return nil, nil
+}
+
+// ConvertBMP converts a BMP message that is not tied to a station session.
+// All such messages are considered to come from the same router.
+func (c *MRTConverter) ConvertBMP(bbs *BmpBufferStack) ([]byte, error) {
+	return c.Convert(&Message{BmpBufferStack: bbs, Received: time.Now()})
+}
+
+// bgpMessage returns the BGP message a route monitoring message carries.
+func (r *routeMonitoringBuf) bgpMessage() ([]byte, error) {
+	if r.peer == nil {
+		return nil, fmt.Errorf("route monitoring message is not parsed")
+	}
+	msg := r.buf[PER_PEER_HEADER_LEN:]
+	_, mlen, err := bgp.ReadMessageHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg[:mlen], nil
+}
@@ -0,0 +1,58 @@
+package bmp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	pp "github.com/CSUNetSec/protoparse"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+func convert(t *testing.T, c *MRTConverter, data []byte) []byte {
+	bbs, err := ParseHeaders(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := c.Convert(&Message{Router: "r1", BmpBufferStack: bbs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestMRTConverter(t *testing.T) {
+	peer, local := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	c := NewMRTConverter()
+
+	rec := convert(t, c, peerUp(peer, 4200000000, local, 65000))
+	_, err := mrt.ParseHeaders(rec, false)
+	if !errors.Is(err, pp.ErrUnsupported) {
+		t.Errorf("expected the state change record to be unsupported by ParseHeaders, got %v", err)
+	}
+
+	rec = convert(t, c, routeMonitoring(peer, 4200000000, 0, 4200000000, 3356))
+	capture, err := mrt.MrtToBGPCapturev2(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture.Timestamp != 1500000000 || capture.Peer_AS != 4200000000 || capture.Local_AS != 65000 {
+		t.Errorf("bad capture header %v", capture)
+	}
+	if !net.IP(util.GetIP(capture.Peer_IP)).Equal(peer) || !net.IP(util.GetIP(capture.Local_IP)).Equal(local) {
+		t.Errorf("bad capture addresses %v %v", capture.Peer_IP, capture.Local_IP)
+	}
+	seq := capture.Update.Attrs.ASPath[0].ASSeq
+	if len(seq) != 2 || seq[0] != 4200000000 || seq[1] != 3356 {
+		t.Errorf("bad AS path %v", seq)
+	}
+
+	if rec = convert(t, c, initiation("router1")); rec != nil {
+		t.Errorf("expected no record for an initiation message")
+	}
+	c.StateChanges = false
+	if rec = convert(t, c, peerDown(peer, 4200000000)); rec != nil {
+		t.Errorf("expected no record for a peer down with state changes off")
+	}
+}
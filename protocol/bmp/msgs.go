@@ -0,0 +1,502 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	pp "github.com/CSUNetSec/protoparse"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+)
+
+// TLV is a type, length, value of the information fields of BMP messages.
+type TLV struct {
+	Type  uint16       `json:"type"`
+	Value bgp.HexBytes `json:"value"`
+}
+
+// readTLVs splits buf in 2 byte type, 2 byte length TLVs.
+func readTLVs(buf []byte) ([]*TLV, error) {
+	tlvs := []*TLV{}
+	off := 0
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, pp.NewParseError(pp.LayerBMP, off, pp.ErrTruncated, "not enough bytes for BMP TLV type and length")
+		}
+		t := binary.BigEndian.Uint16(buf[:2])
+		l := int(binary.BigEndian.Uint16(buf[2:4]))
+		buf = buf[4:]
+		off += 4
+		if l > len(buf) {
+			return nil, pp.NewParseError(pp.LayerBMP, off, pp.ErrTruncated, "not enough bytes for BMP TLV of type %d and length %d", t, l)
+		}
+		val := make([]byte, l)
+		copy(val, buf[:l])
+		tlvs = append(tlvs, &TLV{Type: t, Value: val})
+		buf = buf[l:]
+		off += l
+	}
+	return tlvs, nil
+}
+
+// Stat is a statistic of a statistics report. AFI and SAFI are set for the
+// per address family gauges.
+type Stat struct {
+	Type  uint16 `json:"type"`
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+	AFI   uint16 `json:"afi,omitempty"`
+	SAFI  uint8  `json:"safi,omitempty"`
+}
+
+var statNames = map[uint16]string{
+	0:  "rejected-prefixes",
+	1:  "duplicate-advertisements",
+	2:  "duplicate-withdraws",
+	3:  "cluster-list-loops",
+	4:  "as-path-loops",
+	5:  "originator-id-loops",
+	6:  "as-confed-loops",
+	7:  "adj-rib-in-routes",
+	8:  "loc-rib-routes",
+	9:  "adj-rib-in-routes-per-afi-safi",
+	10: "loc-rib-routes-per-afi-safi",
+	11: "treat-as-withdraw-updates",
+	12: "treat-as-withdraw-prefixes",
+	13: "duplicate-updates",
+	14: "adj-rib-out-pre-policy-routes",
+	15: "adj-rib-out-post-policy-routes",
+	16: "adj-rib-out-pre-policy-routes-per-afi-safi",
+	17: "adj-rib-out-post-policy-routes-per-afi-safi",
+}
+
+func (s *Stat) String() string {
+	if s.AFI != 0 {
+		return fmt.Sprintf("%s(%d/%d):%d", s.Name, s.AFI, s.SAFI, s.Value)
+	}
+	return fmt.Sprintf("%s:%d", s.Name, s.Value)
+}
+
+// StatsReport is the body of a statistics report message.
+type StatsReport struct {
+	Peer  *PeerHeader `json:"peer"`
+	Stats []*Stat     `json:"stats"`
+}
+
+type statsReportBuf struct {
+	dest *StatsReport
+	buf  []byte
+}
+
+func (s *statsReportBuf) Parse() (pp.PbVal, error) {
+	return nil, s.parse()
+}
+
+func (s *statsReportBuf) parse() error {
+	// s.buf is advanced as it is decoded, so it always starts at this offset of the body
+	start := s.buf
+	off := func() int {
+		return len(start) - len(s.buf)
+	}
+	peer, err := readPeerHeader(s.buf)
+	if err != nil {
+		return err
+	}
+	s.dest.Peer = peer
+	s.buf = s.buf[PER_PEER_HEADER_LEN:]
+	if len(s.buf) < 4 {
+		return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for statistics count")
+	}
+	count := int(binary.BigEndian.Uint32(s.buf[:4]))
+	s.buf = s.buf[4:]
+	for i := 0; i < count; i++ {
+		if len(s.buf) < 4 {
+			return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for statistic type and length")
+		}
+		st := &Stat{Type: binary.BigEndian.Uint16(s.buf[:2])}
+		l := int(binary.BigEndian.Uint16(s.buf[2:4]))
+		s.buf = s.buf[4:]
+		if l > len(s.buf) {
+			return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for statistic %d of length %d", st.Type, l)
+		}
+		val := s.buf[:l]
+		//counters are 4 bytes, gauges 8 and per AFI/SAFI gauges 11
+		switch l {
+		case 4:
+			st.Value = uint64(binary.BigEndian.Uint32(val))
+		case 8:
+			st.Value = binary.BigEndian.Uint64(val)
+		case 11:
+			st.AFI = binary.BigEndian.Uint16(val[:2])
+			st.SAFI = val[2]
+			st.Value = binary.BigEndian.Uint64(val[3:])
+		default:
+			return pp.NewParseError(pp.LayerBMP, off(), pp.ErrMalformed, "statistic %d has bad length %d", st.Type, l)
+		}
+		if name, ok := statNames[st.Type]; ok {
+			st.Name = name
+		} else {
+			st.Name = fmt.Sprintf("unknown-%d", st.Type)
+		}
+		s.dest.Stats = append(s.dest.Stats, st)
+		s.buf = s.buf[l:]
+	}
+	return nil
+}
+
+func (s *statsReportBuf) GetPeerHeader() *PeerHeader {
+	return s.dest.Peer
+}
+
+func (s *statsReportBuf) GetStatsReport() *StatsReport {
+	return s.dest
+}
+
+func (s *statsReportBuf) String() string {
+	if s.dest.Peer == nil {
+		return ""
+	}
+	ret := s.dest.Peer.String() + "\nStats:"
+	for _, st := range s.dest.Stats {
+		ret += " " + st.String()
+	}
+	return ret
+}
+
+func (s *statsReportBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.dest)
+}
+
+// Peer down reasons
+const (
+	PEER_DOWN_LOCAL_NOTIFICATION    = 1
+	PEER_DOWN_LOCAL_NO_NOTIFICATION = 2
+	PEER_DOWN_REMOTE_NOTIFICATION   = 3
+	PEER_DOWN_REMOTE_NO_DATA        = 4
+	PEER_DOWN_DECONFIGURED          = 5
+	PEER_DOWN_LOC_RIB_DISABLED      = 6
+)
+
+// PeerDown is the body of a peer down message. Depending on the reason
+// it carries the NOTIFICATION that closed the session, or the FSM event
+// of the local system.
+type PeerDown struct {
+	Peer         *PeerHeader       `json:"peer"`
+	Reason       uint8             `json:"reason"`
+	Notification *bgp.Notification `json:"notification,omitempty"`
+	FSMEvent     uint16            `json:"fsm_event,omitempty"`
+	Data         []*TLV            `json:"data,omitempty"`
+}
+
+type peerDownBuf struct {
+	dest *PeerDown
+	buf  []byte
+}
+
+func (p *peerDownBuf) Parse() (pp.PbVal, error) {
+	return nil, p.parse()
+}
+
+func (p *peerDownBuf) parse() error {
+	// p.buf is advanced as it is decoded, so it always starts at this offset of the body
+	start := p.buf
+	off := func() int {
+		return len(start) - len(p.buf)
+	}
+	peer, err := readPeerHeader(p.buf)
+	if err != nil {
+		return err
+	}
+	p.dest.Peer = peer
+	p.buf = p.buf[PER_PEER_HEADER_LEN:]
+	if len(p.buf) < 1 {
+		return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for peer down reason")
+	}
+	p.dest.Reason = p.buf[0]
+	p.buf = p.buf[1:]
+	switch p.dest.Reason {
+	case PEER_DOWN_LOCAL_NOTIFICATION, PEER_DOWN_REMOTE_NOTIFICATION:
+		mtype, mlen, err := bgp.ReadMessageHeader(p.buf)
+		if err != nil {
+			return pp.AddOffset(err, off())
+		}
+		if mtype != bgp.MSG_NOTIFICATION {
+			return pp.NewParseError(pp.LayerBMP, off(), pp.ErrMalformed, "peer down carries BGP message of type %d instead of a NOTIFICATION", mtype)
+		}
+		n, err := bgp.ParseNotification(p.buf[bgp.BGP_HEADER_LEN:mlen])
+		if err != nil {
+			return pp.AddOffset(err, off()+bgp.BGP_HEADER_LEN)
+		}
+		p.dest.Notification = n
+	case PEER_DOWN_LOCAL_NO_NOTIFICATION:
+		if len(p.buf) < 2 {
+			return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for peer down FSM event")
+		}
+		p.dest.FSMEvent = binary.BigEndian.Uint16(p.buf[:2])
+	case PEER_DOWN_LOC_RIB_DISABLED:
+		tlvs, err := readTLVs(p.buf)
+		if err != nil {
+			return pp.AddOffset(err, off())
+		}
+		p.dest.Data = tlvs
+	}
+	return nil
+}
+
+func (p *peerDownBuf) GetPeerHeader() *PeerHeader {
+	return p.dest.Peer
+}
+
+func (p *peerDownBuf) GetPeerDown() *PeerDown {
+	return p.dest
+}
+
+func (p *peerDownBuf) String() string {
+	if p.dest.Peer == nil {
+		return ""
+	}
+	ret := fmt.Sprintf("%s\nPeer Down Reason:%d", p.dest.Peer, p.dest.Reason)
+	if p.dest.Notification != nil {
+		ret += fmt.Sprintf(" Notification:%s", p.dest.Notification)
+	}
+	if p.dest.Reason == PEER_DOWN_LOCAL_NO_NOTIFICATION {
+		ret += fmt.Sprintf(" FSM Event:%d", p.dest.FSMEvent)
+	}
+	return ret
+}
+
+func (p *peerDownBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.dest)
+}
+
+// PeerUp is the body of a peer up message with the OPEN messages that
+// were exchanged when the session was established.
+type PeerUp struct {
+	Peer         *PeerHeader `json:"peer"`
+	LocalAddress net.IP      `json:"local_address"`
+	LocalPort    uint16      `json:"local_port"`
+	RemotePort   uint16      `json:"remote_port"`
+	SentOpen     *bgp.Open   `json:"sent_open"`
+	ReceivedOpen *bgp.Open   `json:"received_open"`
+	Info         []*TLV      `json:"info,omitempty"`
+}
+
+type peerUpBuf struct {
+	dest *PeerUp
+	buf  []byte
+}
+
+func (p *peerUpBuf) Parse() (pp.PbVal, error) {
+	return nil, p.parse()
+}
+
+func (p *peerUpBuf) parse() error {
+	// p.buf is advanced as it is decoded, so it always starts at this offset of the body
+	start := p.buf
+	off := func() int {
+		return len(start) - len(p.buf)
+	}
+	peer, err := readPeerHeader(p.buf)
+	if err != nil {
+		return err
+	}
+	p.dest.Peer = peer
+	p.buf = p.buf[PER_PEER_HEADER_LEN:]
+	if len(p.buf) < 20 {
+		return pp.NewParseError(pp.LayerBMP, off(), pp.ErrTruncated, "not enough bytes for peer up local address and ports")
+	}
+	p.dest.LocalAddress = readAddress(p.buf[:16], peer.IPv6)
+	p.dest.LocalPort = binary.BigEndian.Uint16(p.buf[16:18])
+	p.dest.RemotePort = binary.BigEndian.Uint16(p.buf[18:20])
+	p.buf = p.buf[20:]
+	if p.dest.SentOpen, err = p.readOpen(); err != nil {
+		return pp.AddOffset(err, off())
+	}
+	if p.dest.ReceivedOpen, err = p.readOpen(); err != nil {
+		return pp.AddOffset(err, off())
+	}
+	if p.dest.Info, err = readTLVs(p.buf); err != nil {
+		return pp.AddOffset(err, off())
+	}
+	return nil
+}
+
+// readOpen reads the OPEN at the start of p.buf, and advances p.buf past it
+// if there is no error.
+func (p *peerUpBuf) readOpen() (*bgp.Open, error) {
+	mtype, mlen, err := bgp.ReadMessageHeader(p.buf)
+	if err != nil {
+		return nil, err
+	}
+	if mtype != bgp.MSG_OPEN {
+		return nil, pp.NewParseError(pp.LayerBMP, 0, pp.ErrMalformed, "peer up carries BGP message of type %d instead of an OPEN", mtype)
+	}
+	o, err := bgp.ParseOpen(p.buf[bgp.BGP_HEADER_LEN:mlen])
+	if err != nil {
+		return nil, pp.AddOffset(err, bgp.BGP_HEADER_LEN)
+	}
+	p.buf = p.buf[mlen:]
+	return o, nil
+}
+
+func (p *peerUpBuf) GetPeerHeader() *PeerHeader {
+	return p.dest.Peer
+}
+
+func (p *peerUpBuf) GetPeerUp() *PeerUp {
+	return p.dest
+}
+
+func (p *peerUpBuf) String() string {
+	if p.dest.Peer == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s\nPeer Up Local:%s Ports:%d/%d\nSent OPEN:%s\nReceived OPEN:%s", p.dest.Peer,
+		p.dest.LocalAddress, p.dest.LocalPort, p.dest.RemotePort, p.dest.SentOpen, p.dest.ReceivedOpen)
+}
+
+func (p *peerUpBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.dest)
+}
+
+// Information TLV types of initiation and termination messages
+const (
+	INFO_STRING   = 0
+	INFO_SYSDESCR = 1 // initiation only
+	INFO_SYSNAME  = 2 // initiation only
+	INFO_REASON   = 1 // termination only
+)
+
+// Info is the body of an initiation or termination message.
+type Info struct {
+	Type MsgType `json:"type"`
+	TLVs []*TLV  `json:"tlvs"`
+}
+
+// Strings returns the values of the TLVs of type t as strings.
+func (i *Info) Strings(t uint16) []string {
+	ret := []string{}
+	for _, tlv := range i.TLVs {
+		if tlv.Type == t {
+			ret = append(ret, string(tlv.Value))
+		}
+	}
+	return ret
+}
+
+// Reason returns the reason code of a termination message and whether it had one.
+func (i *Info) Reason() (uint16, bool) {
+	if i.Type != TERMINATION {
+		return 0, false
+	}
+	for _, tlv := range i.TLVs {
+		if tlv.Type == INFO_REASON && len(tlv.Value) == 2 {
+			return binary.BigEndian.Uint16(tlv.Value), true
+		}
+	}
+	return 0, false
+}
+
+type infoBuf struct {
+	dest *Info
+	buf  []byte
+}
+
+func (i *infoBuf) Parse() (pp.PbVal, error) {
+	tlvs, err := readTLVs(i.buf)
+	if err != nil {
+		return nil, err
+	}
+	i.dest.TLVs = tlvs
+	return nil, nil
+}
+
+func (i *infoBuf) GetInfo() *Info {
+	return i.dest
+}
+
+func (i *infoBuf) String() string {
+	ret := fmt.Sprintf("%s:", i.dest.Type)
+	for _, tlv := range i.dest.TLVs {
+		if i.dest.Type == TERMINATION && tlv.Type == INFO_REASON {
+			r, _ := i.dest.Reason()
+			ret += fmt.Sprintf(" [reason %d]", r)
+		} else {
+			ret += fmt.Sprintf(" [%d:%s]", tlv.Type, string(tlv.Value))
+		}
+	}
+	return ret
+}
+
+func (i *infoBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.dest)
+}
+
+// Route mirroring TLV types and information codes
+const (
+	MIRROR_BGP_MESSAGE   = 0
+	MIRROR_INFORMATION   = 1
+	MIRROR_ERRORED_PDU   = 0
+	MIRROR_MESSAGES_LOST = 1
+)
+
+// RouteMirroring is the body of a route mirroring message. Messages are
+// the verbatim BGP messages, headers included.
+type RouteMirroring struct {
+	Peer     *PeerHeader    `json:"peer"`
+	Messages []bgp.HexBytes `json:"messages,omitempty"`
+	Info     []uint16       `json:"info,omitempty"`
+}
+
+type routeMirroringBuf struct {
+	dest *RouteMirroring
+	buf  []byte
+}
+
+func (r *routeMirroringBuf) Parse() (pp.PbVal, error) {
+	return nil, r.parse()
+}
+
+func (r *routeMirroringBuf) parse() error {
+	peer, err := readPeerHeader(r.buf)
+	if err != nil {
+		return err
+	}
+	r.dest.Peer = peer
+	tlvs, err := readTLVs(r.buf[PER_PEER_HEADER_LEN:])
+	if err != nil {
+		return pp.AddOffset(err, PER_PEER_HEADER_LEN)
+	}
+	for _, tlv := range tlvs {
+		switch tlv.Type {
+		case MIRROR_BGP_MESSAGE:
+			r.dest.Messages = append(r.dest.Messages, tlv.Value)
+		case MIRROR_INFORMATION:
+			if len(tlv.Value) != 2 {
+				return pp.NewParseError(pp.LayerBMP, PER_PEER_HEADER_LEN, pp.ErrMalformed, "route mirroring information has bad length %d", len(tlv.Value))
+			}
+			r.dest.Info = append(r.dest.Info, binary.BigEndian.Uint16(tlv.Value))
+		}
+	}
+	return nil
+}
+
+func (r *routeMirroringBuf) GetPeerHeader() *PeerHeader {
+	return r.dest.Peer
+}
+
+func (r *routeMirroringBuf) GetRouteMirroring() *RouteMirroring {
+	return r.dest
+}
+
+func (r *routeMirroringBuf) String() string {
+	if r.dest.Peer == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s\nMirrored Messages:%d Info:%v", r.dest.Peer, len(r.dest.Messages), r.dest.Info)
+}
+
+func (r *routeMirroringBuf) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.dest)
+}
@@ -0,0 +1,315 @@
+package bmp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message is a BMP message received by a Station.
+type Message struct {
+	Router   string    // remote address of the router's session
+	Received time.Time // when the station read it
+	*BmpBufferStack
+}
+
+// PeerState is what a station knows about a peer of a monitored router.
+type PeerState struct {
+	Peer     *PeerHeader `json:"peer"`
+	Up       bool        `json:"up"`
+	PeerUp   *PeerUp     `json:"peer_up,omitempty"`
+	PeerDown *PeerDown   `json:"peer_down,omitempty"`
+	Changed  time.Time   `json:"changed"`
+	Updates  uint64      `json:"updates"`
+}
+
+// RouterState is what a station knows about a connected router. The peers
+// are keyed by their distinguisher and address.
+type RouterState struct {
+	Addr      string                `json:"addr"`
+	SysName   string                `json:"sys_name,omitempty"`
+	SysDescr  string                `json:"sys_descr,omitempty"`
+	Connected time.Time             `json:"connected"`
+	Peers     map[string]*PeerState `json:"peers"`
+}
+
+func peerKey(p *PeerHeader) string {
+	return fmt.Sprintf("%s|%s", p.Distinguisher, p.Address)
+}
+
+// Station is a BMP collector. It accepts router connections on a listener,
+// decodes their messages and delivers them either to a handler function or
+// a channel. Delivery happens on the goroutine reading the router's session
+// so a slow consumer stops reading from the router instead of buffering.
+type Station struct {
+	// ErrorHandler, if set, is called with the errors that end a session
+	// and with messages that could not be decoded. Those messages are skipped.
+	ErrorHandler func(router string, err error)
+
+	handler func(*Message)
+	msgs    chan *Message
+
+	mu      sync.Mutex
+	ln      net.Listener
+	conns   map[net.Conn]struct{}
+	routers map[string]*RouterState
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewStation creates a station that calls handler for every message.
+func NewStation(handler func(*Message)) *Station {
+	return &Station{
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+		routers: make(map[string]*RouterState),
+		done:    make(chan struct{}),
+	}
+}
+
+// NewChanStation creates a station that sends every message on a channel
+// of size buffered, available from Messages.
+func NewChanStation(size int) *Station {
+	s := NewStation(nil)
+	s.msgs = make(chan *Message, size)
+	return s
+}
+
+// Messages returns the channel of a station created with NewChanStation.
+// It is closed when the station is closed and all sessions have ended.
+func (s *Station) Messages() <-chan *Message {
+	return s.msgs
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Station) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts router connections on ln until the station is closed.
+// It returns nil after Close and the accept error otherwise.
+func (s *Station) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	default:
+	}
+	s.ln = ln
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		s.mu.Lock()
+		select {
+		case <-s.done: //closed between the accept and now
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.session(conn)
+	}
+}
+
+// Addr returns the address the station listens on, or nil if it is not serving.
+func (s *Station) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Close stops the listener, closes all router sessions and waits for them to end.
+func (s *Station) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	close(s.done)
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if s.msgs != nil {
+		close(s.msgs)
+	}
+	return err
+}
+
+// Routers returns a copy of the state of the connected routers.
+func (s *Station) Routers() []*RouterState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]*RouterState, 0, len(s.routers))
+	for _, r := range s.routers {
+		rc := *r
+		rc.Peers = make(map[string]*PeerState, len(r.Peers))
+		for k, p := range r.Peers {
+			pc := *p
+			rc.Peers[k] = &pc
+		}
+		ret = append(ret, &rc)
+	}
+	return ret
+}
+
+func (s *Station) session(conn net.Conn) {
+	router := conn.RemoteAddr().String()
+	s.mu.Lock()
+	s.routers[router] = &RouterState{
+		Addr:      router,
+		Connected: time.Now(),
+		Peers:     make(map[string]*PeerState),
+	}
+	s.mu.Unlock()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		delete(s.routers, router)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(SplitBmp)
+	scanbuffer := make([]byte, 1<<20)
+	scanner.Buffer(scanbuffer, cap(scanbuffer))
+	for scanner.Scan() {
+		//the scanner reuses its buffer and the message outlives the scan
+		data := append([]byte{}, scanner.Bytes()...)
+		bbs, err := ParseHeaders(data)
+		if err != nil {
+			s.reportError(router, err)
+			continue
+		}
+		s.track(router, bbs)
+		if !s.deliver(&Message{Router: router, Received: time.Now(), BmpBufferStack: bbs}) {
+			return
+		}
+		if bbs.GetHeader().Type == TERMINATION {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		select {
+		case <-s.done: //closed by us
+		default:
+			s.reportError(router, err)
+		}
+	}
+}
+
+// deliver returns false if the station was closed while waiting on the consumer.
+func (s *Station) deliver(m *Message) bool {
+	if s.msgs == nil {
+		if s.handler != nil {
+			s.handler(m)
+		}
+		return true
+	}
+	select {
+	case s.msgs <- m:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *Station) reportError(router string, err error) {
+	if s.ErrorHandler != nil {
+		s.ErrorHandler(router, err)
+	}
+}
+
+// track updates the router state from a message.
+func (s *Station) track(router string, bbs *BmpBufferStack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, ok := s.routers[router]
+	if !ok {
+		return
+	}
+	if info, ok := bbs.Bodybuf.(*infoBuf); ok && info.dest.Type == INITIATION {
+		if names := info.dest.Strings(INFO_SYSNAME); len(names) > 0 {
+			rs.SysName = names[0]
+		}
+		if descrs := info.dest.Strings(INFO_SYSDESCR); len(descrs) > 0 {
+			rs.SysDescr = descrs[0]
+		}
+		return
+	}
+	peer := bbs.GetPeerHeader()
+	if peer == nil {
+		return
+	}
+	key := peerKey(peer)
+	ps, ok := rs.Peers[key]
+	if !ok {
+		ps = &PeerState{}
+		rs.Peers[key] = ps
+	}
+	ps.Peer = peer
+	switch body := bbs.Bodybuf.(type) {
+	case *peerUpBuf:
+		ps.Up, ps.PeerUp, ps.PeerDown, ps.Changed = true, body.dest, nil, peer.Timestamp
+	case *peerDownBuf:
+		ps.Up, ps.PeerDown, ps.Changed = false, body.dest, peer.Timestamp
+	case *routeMonitoringBuf:
+		ps.Updates++
+	}
+}
+
+// Replay dials a station at addr and writes the BMP messages read from
+// capture to it, as a router would. It is meant for testing collectors
+// with canned captures.
+func Replay(addr string, capture io.Reader) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	scanner := bufio.NewScanner(capture)
+	scanner.Split(SplitBmp)
+	scanbuffer := make([]byte, 1<<20)
+	scanner.Buffer(scanbuffer, cap(scanbuffer))
+	for scanner.Scan() {
+		if _, err := conn.Write(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,144 @@
+package bmp
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startStation(t *testing.T, s *Station) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	return ln.Addr().String()
+}
+
+func TestStationChannel(t *testing.T) {
+	peer, local := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	capture := [][]byte{
+		initiation("router1"),
+		peerUp(peer, 65001, local, 65000),
+		routeMonitoring(peer, 65001, 0, 65001, 3356),
+		routeMonitoring(peer, 65001, 0, 65001, 174),
+		statsReport(peer, 65001),
+	}
+	// a station with a channel of 1 makes the session wait on the test
+	s := NewChanStation(1)
+	defer s.Close()
+	addr := startStation(t, s)
+	// unlike Replay, this keeps the session up so the router state is kept
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go conn.Write(bytes.Join(capture, nil))
+
+	for i := range capture {
+		select {
+		case m := <-s.Messages():
+			if m.GetHeader().Type != MsgType(capture[i][5]) {
+				t.Errorf("message %d: got type %s", i, m.GetHeader().Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+
+	routers := s.Routers()
+	if len(routers) != 1 {
+		t.Fatalf("expected 1 router, got %d", len(routers))
+	}
+	r := routers[0]
+	if r.SysName != "router1" || len(r.Peers) != 1 {
+		t.Fatalf("bad router state %+v", r)
+	}
+	for _, ps := range r.Peers {
+		if !ps.Up || ps.Updates != 2 || ps.PeerUp.ReceivedOpen.AS != 65001 {
+			t.Errorf("bad peer state %+v", ps)
+		}
+	}
+}
+
+func TestStationHandler(t *testing.T) {
+	peer, local := net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.2")
+	var (
+		mu       sync.Mutex
+		received []*Message
+		errs     []error
+	)
+	done := make(chan struct{})
+	s := NewStation(func(m *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, m)
+		if m.GetHeader().Type == TERMINATION {
+			close(done)
+		}
+	})
+	s.ErrorHandler = func(router string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+	defer s.Close()
+	addr := startStation(t, s)
+
+	broken := peerDown(peer, 65001)
+	broken = broken[:len(broken)-3]
+	broken[4] -= 3 //a peer down with a cut NOTIFICATION but a valid BMP length
+	capture := [][]byte{
+		initiation("router2"),
+		peerUp(peer, 65001, local, 65000),
+		broken,
+		peerDown(peer, 65001),
+		termination(0),
+	}
+	if err := Replay(addr, bytes.NewReader(bytes.Join(capture, nil))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for termination")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 4 || len(errs) != 1 {
+		t.Fatalf("expected 4 messages and 1 error, got %d and %v", len(received), errs)
+	}
+	pd := received[2].GetPeerHeader()
+	if pd == nil || !pd.IPv6 || !pd.Address.Equal(peer) {
+		t.Errorf("bad peer down header %v", pd)
+	}
+}
+
+func TestStationClose(t *testing.T) {
+	s := NewChanStation(0)
+	addr := startStation(t, s)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// nobody reads the channel so the session blocks on delivering this
+	conn.Write(initiation("router3"))
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on a session")
+	}
+	if _, ok := <-s.Messages(); ok {
+		t.Error("expected the message channel to be closed")
+	}
+}
@@ -0,0 +1,112 @@
+package mrt
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// BGP4MP subtypes of state changes (RFC6396)
+const (
+	STATE_CHANGE     = 0
+	STATE_CHANGE_AS4 = 5
+)
+
+// BGP FSM states as they appear in state change records
+const (
+	STATE_IDLE        = 1
+	STATE_CONNECT     = 2
+	STATE_ACTIVE      = 3
+	STATE_OPENSENT    = 4
+	STATE_OPENCONFIRM = 5
+	STATE_ESTABLISHED = 6
+)
+
+// BGP4MPPeering holds the fields of a BGP4MP header that describe the
+// session a record is about.
+type BGP4MPPeering struct {
+	PeerAS         uint32
+	LocalAS        uint32
+	InterfaceIndex uint16
+	PeerIP         net.IP
+	LocalIP        net.IP
+}
+
+// addresses returns the peer and local IPs as they are encoded and whether
+// the peering is over IPv4. A local IP of the other family is replaced by
+// the unspecified address of the peer's family.
+func (p *BGP4MPPeering) addresses() ([]byte, []byte, bool) {
+	if peer := p.PeerIP.To4(); peer != nil {
+		local := p.LocalIP.To4()
+		if local == nil {
+			local = net.IPv4zero.To4()
+		}
+		return peer, local, true
+	}
+	peer := p.PeerIP.To16()
+	if peer == nil {
+		peer = net.IPv6zero
+	}
+	local := p.LocalIP.To16()
+	if local == nil || p.LocalIP.To4() != nil {
+		local = net.IPv6zero
+	}
+	return peer, local, false
+}
+
+// header encodes the BGP4MP header with 4 or 2 byte ASes. 2 byte headers
+// carry AS_TRANS for ASes that don't fit.
+func (p *BGP4MPPeering) header(AS4 bool) []byte {
+	var hdr []byte
+	if AS4 {
+		hdr = make([]byte, 8)
+		binary.BigEndian.PutUint32(hdr[:4], p.PeerAS)
+		binary.BigEndian.PutUint32(hdr[4:8], p.LocalAS)
+	} else {
+		hdr = make([]byte, 4)
+		binary.BigEndian.PutUint16(hdr[:2], as2(p.PeerAS))
+		binary.BigEndian.PutUint16(hdr[2:4], as2(p.LocalAS))
+	}
+	peer, local, v4 := p.addresses()
+	af := []byte{byte(p.InterfaceIndex >> 8), byte(p.InterfaceIndex), 0, 2}
+	if v4 {
+		af[3] = 1
+	}
+	hdr = append(hdr, af...)
+	hdr = append(hdr, peer...)
+	return append(hdr, local...)
+}
+
+func as2(as uint32) uint16 {
+	if as > 0xffff {
+		return 23456 //AS_TRANS
+	}
+	return uint16(as)
+}
+
+// NewMrtRecord encodes an MRT record with a body of type and subtype.
+func NewMrtRecord(ts time.Time, mtype, subtype uint16, body []byte) []byte {
+	rec := make([]byte, MRT_HEADER_LEN, MRT_HEADER_LEN+len(body))
+	binary.BigEndian.PutUint32(rec[:4], uint32(ts.Unix()))
+	binary.BigEndian.PutUint16(rec[4:6], mtype)
+	binary.BigEndian.PutUint16(rec[6:8], subtype)
+	binary.BigEndian.PutUint32(rec[8:12], uint32(len(body)))
+	return append(rec, body...)
+}
+
+// NewBGP4MPMessage encodes a BGP4MP MESSAGE_AS4 record, or a MESSAGE record if
+// AS4 is false, carrying msg, a whole BGP message including its header.
+// AS4 must agree with the encoding of the AS_PATH in msg.
+func NewBGP4MPMessage(ts time.Time, peering *BGP4MPPeering, AS4 bool, msg []byte) []byte {
+	body := append(peering.header(AS4), msg...)
+	if AS4 {
+		return NewMrtRecord(ts, BGP4MP, MESSAGE_AS4, body)
+	}
+	return NewMrtRecord(ts, BGP4MP, MESSAGE, body)
+}
+
+// NewBGP4MPStateChange encodes a BGP4MP STATE_CHANGE_AS4 record.
+func NewBGP4MPStateChange(ts time.Time, peering *BGP4MPPeering, oldState, newState uint16) []byte {
+	body := append(peering.header(true), byte(oldState>>8), byte(oldState), byte(newState>>8), byte(newState))
+	return NewMrtRecord(ts, BGP4MP, STATE_CHANGE_AS4, body)
+}
@@ -5,6 +5,7 @@ import (
 	common "github.com/CSUNetSec/netsec-protobufs/common"
 	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
 	"github.com/CSUNetSec/protoparse"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
 	util "github.com/CSUNetSec/protoparse/util"
 	"net"
 	"time"
@@ -31,30 +32,36 @@ func ParseHeaders(data []byte, ind bool) (*MrtBufferStack, error) {
 	mrth := NewMrtHdrBuf(data)
 	bgp4h, err := mrth.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("Failed parsing MRT header: %s\n", err)
+		return nil, err
 	}
+	// the offset in data of the buffer of each layer, to locate its errors
+	off := MRT_HEADER_LEN
 
 	if ind {
 		_, err = bgp4h.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("Failed parsing RIB header: %s\n", err)
+			return nil, protoparse.AddOffset(err, off)
 		}
 
 		return &MrtBufferStack{MrthBuf: mrth, Ribbuf: bgp4h}, nil
 	} else {
 		bgph, err := bgp4h.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("Failed parsing BG4MP header: %s\n", err)
+			return nil, protoparse.AddOffset(err, off)
+		}
+		if b4, ok := bgp4h.(*bgp4mpHdrBuf); ok {
+			off += b4.hdrlen
 		}
 
 		bgpup, err := bgph.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("Failed parsing BGP header: %s\n", err)
+			return nil, protoparse.AddOffset(err, off)
 		}
+		off += bgp.BGP_HEADER_LEN
 
 		_, err = bgpup.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("Failed parsing BGP update: %s\n", err)
+			return nil, protoparse.AddOffset(err, off)
 		}
 
 		return &MrtBufferStack{MrthBuf: mrth, Bgp4mpbuf: bgp4h, Bgphbuf: bgph, Bgpupbuf: bgpup}, nil
@@ -65,12 +72,12 @@ func ParseRibHeaders(data []byte, ind protoparse.PbVal) (*MrtBufferStack, error)
 	mrth := NewRIBMrtHdrBuf(data, ind)
 	ribH, err := mrth.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("Failed parsing MRT header: %s\n", err)
+		return nil, err
 	}
 
 	_, err = ribH.Parse()
 	if err != nil {
-		return nil, fmt.Errorf("Failed parsing RIB header: %s\n", err)
+		return nil, protoparse.AddOffset(err, MRT_HEADER_LEN)
 	}
 
 	return &MrtBufferStack{MrthBuf: mrth, Ribbuf: ribH}, nil
@@ -111,6 +118,49 @@ func GetASPath(mbs *MrtBufferStack) ([]uint32, error) {
 
 }
 
+// GetAttributes returns the path attributes of an update, or of each
+// entry of a RIB
+func GetAttributes(mbs *MrtBufferStack) ([]*pbbgp.BGPUpdate_Attributes, error) {
+	if mbs.IsRibStack() {
+		rib := mbs.Ribbuf.(protoparse.RIBHeaderer).GetHeader()
+		if rib == nil {
+			return nil, fmt.Errorf("Error parsing attributes in rib header")
+		}
+		var attrs []*pbbgp.BGPUpdate_Attributes
+		for _, ent := range rib.RouteEntry {
+			if ent.Attrs != nil {
+				attrs = append(attrs, ent.Attrs)
+			}
+		}
+		return attrs, nil
+	}
+	if mbs.Bgpupbuf == nil {
+		return nil, fmt.Errorf("Error parsing attributes in BGP update")
+	}
+	update := mbs.Bgpupbuf.(protoparse.BGPUpdater).GetUpdate()
+	if update == nil || update.Attrs == nil {
+		return nil, fmt.Errorf("Error parsing attributes in BGP update")
+	}
+	return []*pbbgp.BGPUpdate_Attributes{update.Attrs}, nil
+}
+
+// GetExtraAttrs returns what was decoded from the attributes of an update,
+// or of each entry of a RIB, that doesn't fit in their protocol buffers.
+func GetExtraAttrs(mbs *MrtBufferStack) ([]*bgp.ExtraAttrs, error) {
+	if mbs.IsRibStack() {
+		rib, ok := mbs.Ribbuf.(interface{ GetExtraAttrs() []*bgp.ExtraAttrs })
+		if !ok {
+			return nil, fmt.Errorf("Error getting extra attributes of rib entries")
+		}
+		return rib.GetExtraAttrs(), nil
+	}
+	up, ok := mbs.Bgpupbuf.(interface{ GetExtraAttrs() *bgp.ExtraAttrs })
+	if !ok {
+		return nil, fmt.Errorf("Error getting extra attributes of BGP update")
+	}
+	return []*bgp.ExtraAttrs{up.GetExtraAttrs()}, nil
+}
+
 func getASPathFromAttrs(attrs *pbbgp.BGPUpdate_Attributes) []uint32 {
 	var ASlist []uint32
 	for _, segment := range attrs.ASPath {
@@ -130,6 +180,36 @@ func GetCollector(mbs *MrtBufferStack) net.IP {
 	return net.IP(util.GetIP(b4mph.Local_IP))
 }
 
+// Peer is a BGP peer of a collector.
+type Peer struct {
+	IP net.IP
+	AS uint32
+}
+
+// GetPeers returns the peer of an update from the BGP4MP header, or the
+// peer of each entry of a RIB from the peer index table.
+func GetPeers(mbs *MrtBufferStack) ([]Peer, error) {
+	if mbs.IsRibStack() {
+		rib, ok := mbs.Ribbuf.(interface{ GetPeers() []*pbbgp.PeerEntry })
+		if !ok {
+			return nil, fmt.Errorf("Error getting peers of rib entries")
+		}
+		var peers []Peer
+		for _, pe := range rib.GetPeers() {
+			if pe != nil {
+				peers = append(peers, Peer{net.IP(util.GetIP(pe.Peer_IP)), pe.Peer_AS})
+			}
+		}
+		return peers, nil
+	}
+	b4mph, ok := mbs.Bgp4mpbuf.(protoparse.BGP4MPHeaderer)
+	if !ok || b4mph.GetHeader() == nil {
+		return nil, fmt.Errorf("Error getting peer from BGP4MP header")
+	}
+	h := b4mph.GetHeader()
+	return []Peer{{net.IP(util.GetIP(h.Peer_IP)), h.Peer_AS}}, nil
+}
+
 type Route struct {
 	IP   net.IP
 	Mask uint8
@@ -147,7 +227,7 @@ func GetAdvertisedPrefixes(mbs *MrtBufferStack) ([]Route, error) {
 	if mbs.IsRibStack() {
 		rib := mbs.Ribbuf.(protoparse.RIBHeaderer).GetHeader()
 		if rib == nil {
-			return nil, fmt.Errorf("Error parsing withdrawn routes")
+			return nil, fmt.Errorf("Error parsing advertised routes")
 		}
 
 		pref := rib.GetRouteEntry()[0].GetPrefix()
@@ -157,7 +237,7 @@ func GetAdvertisedPrefixes(mbs *MrtBufferStack) ([]Route, error) {
 		update := mbs.Bgpupbuf.(protoparse.BGPUpdater).GetUpdate()
 
 		if update == nil || update.AdvertisedRoutes == nil {
-			return nil, fmt.Errorf("Error parsing advertised routes\n")
+			return nil, fmt.Errorf("Error parsing advertised routes")
 		}
 
 		return getRoutes(update.AdvertisedRoutes.Prefixes), nil
@@ -179,7 +259,7 @@ func GetWithdrawnPrefixes(mbs *MrtBufferStack) ([]Route, error) {
 		update := mbs.Bgpupbuf.(protoparse.BGPUpdater).GetUpdate()
 
 		if update == nil || update.WithdrawnRoutes == nil {
-			return nil, fmt.Errorf("Error parsing withdrawn routes\n")
+			return nil, fmt.Errorf("Error parsing withdrawn routes")
 		}
 
 		return getRoutes(update.WithdrawnRoutes.Prefixes), nil
@@ -3,7 +3,6 @@ package mrt
 import (
 	"encoding/binary"
 	"encoding/json"
-	"errors"
 	"fmt"
 	monpb2 "github.com/CSUNetSec/netsec-protobufs/bgpmon/v2"
 	pbcom "github.com/CSUNetSec/netsec-protobufs/common"
@@ -28,29 +27,21 @@ const (
 	TABLE_DUMP        = 12
 	TABLE_DUMP_V2     = 13
 	PEER_INDEX_TABLE  = 1
+	// the TABLE_DUMP_V2 subtypes of the RIB entries the rib package parses
+	RIB_IPV4_UNICAST   = 2
+	RIB_IPV4_MULTICAST = 3
+	RIB_IPV6_UNICAST   = 4
+	RIB_IPV6_MULTICAST = 5
 )
 
 func MrtToBGPCapturev2(data []byte) (*monpb2.BGPCapture, error) {
-	mrth := NewMrtHdrBuf(data)
-	bgp4h, errmrt := mrth.Parse()
-	if errmrt != nil {
-		return nil, fmt.Errorf("Failed parsing MRT header:%s\n", errmrt)
-	}
-	bgph, errbgph := bgp4h.Parse()
-	if errbgph != nil {
-		return nil, fmt.Errorf("Failed parsing BGP4MP header:%s\n", errbgph)
-	}
-	bgpup, errbgpup := bgph.Parse()
-	if errbgpup != nil {
-		return nil, fmt.Errorf("Failed parsing BGP Header:%s\n", errbgpup)
-	}
-	_, errup := bgpup.Parse()
-	if errup != nil {
-		return nil, fmt.Errorf("Failed parsing BGP Update:%s\n", errup)
+	mbs, err := ParseHeaders(data, false)
+	if err != nil {
+		return nil, err
 	}
 	capture := new(monpb2.BGPCapture)
-	bgphpb := bgp4h.(pp.BGP4MPHeaderer).GetHeader()
-	mrtpb := mrth.GetHeader()
+	bgphpb := mbs.Bgp4mpbuf.(pp.BGP4MPHeaderer).GetHeader()
+	mrtpb := mbs.MrthBuf.(pp.MRTHeaderer).GetHeader()
 	capture.Timestamp = mrtpb.Timestamp
 	capture.Peer_AS = bgphpb.Peer_AS
 	capture.Local_AS = bgphpb.Local_AS
@@ -58,7 +49,7 @@ func MrtToBGPCapturev2(data []byte) (*monpb2.BGPCapture, error) {
 	capture.AddressFamily = bgphpb.AddressFamily
 	capture.Peer_IP = bgphpb.Peer_IP
 	capture.Local_IP = bgphpb.Local_IP
-	capture.Update = bgpup.(pp.BGPUpdater).GetUpdate()
+	capture.Update = mbs.Bgpupbuf.(pp.BGPUpdater).GetUpdate()
 	return capture, nil
 }
 
@@ -74,6 +65,8 @@ type bgp4mpHdrBuf struct {
 	buf   []byte
 	isv6  bool
 	isAS4 bool
+	// the length of the header once it is parsed, where the BGP message starts
+	hdrlen int
 }
 
 func NewMrtHdrBuf(buf []byte) *mrtHhdrBuf {
@@ -113,7 +106,7 @@ func (m *bgp4mpHdrBuf) String() string {
 
 func IsRib(a []byte) (bool, error) {
 	if len(a) < MRT_HEADER_LEN {
-		return false, errors.New("Not enough bytes in data slice to decode MRT header")
+		return false, pp.NewParseError(pp.LayerMRT, 0, pp.ErrTruncated, "not enough bytes in data slice to decode MRT header")
 	}
 	u16type := binary.BigEndian.Uint16(a[4:6])
 	if u16type == uint16(TABLE_DUMP) || u16type == uint16(TABLE_DUMP_V2) {
@@ -124,7 +117,7 @@ func IsRib(a []byte) (bool, error) {
 
 func (mhb *mrtHhdrBuf) Parse() (protoparse.PbVal, error) {
 	if len(mhb.buf) < MRT_HEADER_LEN {
-		return nil, errors.New("Not enough bytes in data slice to decode MRT header")
+		return nil, pp.NewParseError(pp.LayerMRT, 0, pp.ErrTruncated, "not enough bytes in data slice to decode MRT header")
 	}
 	mhb.dest.Timestamp = binary.BigEndian.Uint32(mhb.buf[:4])
 	u16type := binary.BigEndian.Uint16(mhb.buf[4:6])
@@ -133,7 +126,7 @@ func (mhb *mrtHhdrBuf) Parse() (protoparse.PbVal, error) {
 	mhb.dest.Subtype = uint32(u16subtype)
 	mhb.dest.Len = binary.BigEndian.Uint32(mhb.buf[8:12])
 	if len(mhb.buf[MRT_HEADER_LEN:]) < int(mhb.dest.Len) {
-		return nil, fmt.Errorf("Not enough bytes in data slice for underlying message.len of buf:%d len parsed:%d", len(mhb.buf[MRT_HEADER_LEN:]), mhb.dest.Len)
+		return nil, pp.NewParseError(pp.LayerMRT, MRT_HEADER_LEN, pp.ErrTruncated, "not enough bytes in data slice for underlying message. len of buf:%d len parsed:%d", len(mhb.buf[MRT_HEADER_LEN:]), mhb.dest.Len)
 	}
 	switch u16type {
 	case uint16(BGP4MP), uint16(BGP4MP_ET):
@@ -143,11 +136,11 @@ func (mhb *mrtHhdrBuf) Parse() (protoparse.PbVal, error) {
 		if u16subtype == MESSAGE || u16subtype == MESSAGE_LOCAL {
 			return NewBgp4mpHdrBuf(mhb.buf[MRT_HEADER_LEN:], false), nil
 		}
-		return nil, errors.New("unsupported MRT subtype")
+		return nil, pp.NewParseError(pp.LayerMRT, 6, pp.ErrUnsupported, "unsupported MRT subtype %d", u16subtype)
 	//XXX: when we start to parse deeper we should remove the MRT header
 	case uint16(TABLE_DUMP):
 		mhb.isrib = true
-		return nil, fmt.Errorf("TABLE_DUMP not implemented")
+		return nil, pp.NewParseError(pp.LayerMRT, 4, pp.ErrUnsupported, "TABLE_DUMP not implemented")
 	case uint16(TABLE_DUMP_V2):
 		mhb.isrib = true
 		isInd := u16subtype == PEER_INDEX_TABLE
@@ -157,21 +150,25 @@ func (mhb *mrtHhdrBuf) Parse() (protoparse.PbVal, error) {
 			return rib.NewRibEntryBuf(mhb.buf[MRT_HEADER_LEN:], int(u16subtype), mhb.index), nil
 		}
 	}
-	return nil, errors.New("unsupported MRT type")
+	return nil, pp.NewParseError(pp.LayerMRT, 4, pp.ErrUnsupported, "unsupported MRT type %d", u16type)
 }
 
 func (b4hdrb *bgp4mpHdrBuf) Parse() (protoparse.PbVal, error) {
 	if len(b4hdrb.buf) < 20 { //PeerAS + Local AS + interface ind + AF + 2*IPv4 addres
-		return nil, errors.New("Not enough bytes in data slice to decode BGP4MP hdr")
+		return nil, pp.NewParseError(pp.LayerBGP4MP, 0, pp.ErrTruncated, "not enough bytes in data slice to decode BGP4MP hdr")
 	}
+	// the offset of b4hdrb.buf in the header as it is advanced
+	off := 0
 	if b4hdrb.isAS4 {
 		b4hdrb.dest.Peer_AS = binary.BigEndian.Uint32(b4hdrb.buf[:4])
 		b4hdrb.dest.Local_AS = binary.BigEndian.Uint32(b4hdrb.buf[4:8])
 		b4hdrb.buf = b4hdrb.buf[8:]
+		off = 8
 	} else {
 		b4hdrb.dest.Peer_AS = uint32(binary.BigEndian.Uint16(b4hdrb.buf[:2]))
 		b4hdrb.dest.Local_AS = uint32(binary.BigEndian.Uint16(b4hdrb.buf[2:4]))
 		b4hdrb.buf = b4hdrb.buf[4:]
+		off = 4
 	}
 	b4hdrb.dest.InterfaceIndex = uint32(binary.BigEndian.Uint16(b4hdrb.buf[:2]))
 	u16af := binary.BigEndian.Uint16(b4hdrb.buf[2:4])
@@ -179,20 +176,28 @@ func (b4hdrb *bgp4mpHdrBuf) Parse() (protoparse.PbVal, error) {
 	pIP, lIP := new(pbcom.IPAddressWrapper), new(pbcom.IPAddressWrapper)
 	switch u16af {
 	case bgp.AFI_IP:
+		if len(b4hdrb.buf) < 12 {
+			return nil, pp.NewParseError(pp.LayerBGP4MP, off, pp.ErrTruncated, "not enough bytes in data slice for BGP4MP IPv4 addresses")
+		}
 		pIP.IPv4 = b4hdrb.buf[4:8]
 		lIP.IPv4 = b4hdrb.buf[8:12]
 		b4hdrb.dest.Peer_IP = pIP
 		b4hdrb.dest.Local_IP = lIP
 		b4hdrb.buf = b4hdrb.buf[12:]
+		b4hdrb.hdrlen = off + 12
 	case bgp.AFI_IP6:
+		if len(b4hdrb.buf) < 36 {
+			return nil, pp.NewParseError(pp.LayerBGP4MP, off, pp.ErrTruncated, "not enough bytes in data slice for BGP4MP IPv6 addresses")
+		}
 		b4hdrb.isv6 = true
 		pIP.IPv6 = b4hdrb.buf[4:20]
 		lIP.IPv6 = b4hdrb.buf[20:36]
 		b4hdrb.dest.Peer_IP = pIP
 		b4hdrb.dest.Local_IP = lIP
 		b4hdrb.buf = b4hdrb.buf[36:]
+		b4hdrb.hdrlen = off + 36
 	default:
-		return nil, errors.New("unsupported BGP4MP address family")
+		return nil, pp.NewParseError(pp.LayerBGP4MP, off+2, pp.ErrUnsupported, "unsupported BGP4MP address family %d", u16af)
 	}
 	return bgp.NewBgpHeaderBuf(b4hdrb.buf, b4hdrb.isv6, b4hdrb.isAS4), nil
 }
@@ -0,0 +1,108 @@
+package mrt
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse"
+)
+
+// bgp4mpRecord wraps the body of a BGP update in a BGP4MP_MESSAGE_AS4
+// record between two IPv4 peers.
+func bgp4mpRecord(update []byte) []byte {
+	bgpmsg := make([]byte, 19)
+	for i := 0; i < 16; i++ {
+		bgpmsg[i] = 0xff
+	}
+	binary.BigEndian.PutUint16(bgpmsg[16:18], uint16(19+len(update)))
+	bgpmsg[18] = 2
+	bgpmsg = append(bgpmsg, update...)
+
+	b4mp := []byte{0, 0, 0xfd, 0xe8, 0, 0, 0xfd, 0xe9, 0, 0, 0, 1, 10, 0, 0, 1, 10, 0, 0, 2}
+	b4mp = append(b4mp, bgpmsg...)
+
+	rec := make([]byte, MRT_HEADER_LEN)
+	binary.BigEndian.PutUint16(rec[4:6], uint16(BGP4MP))
+	binary.BigEndian.PutUint16(rec[6:8], MESSAGE_AS4)
+	binary.BigEndian.PutUint32(rec[8:12], uint32(len(b4mp)))
+	return append(rec, b4mp...)
+}
+
+type parseErrCase struct {
+	name     string
+	update   []byte
+	kind     error
+	layer    protoparse.Layer
+	attrType uint8
+	offset   int
+}
+
+// offsets are from the start of the record. the update starts at 12+20+19
+var parseErrCases = []parseErrCase{
+	{
+		name: "truncated AS path segment",
+		//no withdrawn, 11 bytes of attributes: ORIGIN IGP, AS_PATH claiming 2 ASes with one present
+		update:   []byte{0, 0, 0, 11, 0x40, 1, 1, 0, 0x40, 2, 4, 2, 2, 0, 0},
+		kind:     protoparse.ErrTruncated,
+		layer:    protoparse.LayerAttr,
+		attrType: 2,
+		offset:   51 + 4 + 4 + 3 + 2,
+	},
+	{
+		name:     "unknown path segment type",
+		update:   []byte{0, 0, 0, 10, 0x40, 1, 1, 0, 0x40, 2, 3, 9, 0, 0},
+		kind:     protoparse.ErrUnsupported,
+		layer:    protoparse.LayerAttr,
+		attrType: 2,
+		offset:   51 + 4 + 4 + 3,
+	},
+	{
+		name:   "withdrawn prefix too long",
+		update: []byte{0, 2, 33, 10, 0, 0},
+		kind:   protoparse.ErrMalformed,
+		layer:  protoparse.LayerNLRI,
+		offset: 51 + 2,
+	},
+	{
+		name:   "truncated NLRI",
+		update: []byte{0, 0, 0, 4, 0x40, 1, 1, 0, 24, 10, 0},
+		kind:   protoparse.ErrTruncated,
+		layer:  protoparse.LayerNLRI,
+		offset: 51 + 4 + 4,
+	},
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range parseErrCases {
+		_, err := ParseHeaders(bgp4mpRecord(c.update), false)
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+			continue
+		}
+		if !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %q is not of kind %q", c.name, err, c.kind)
+		}
+		var perr *protoparse.ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error %q is not a ParseError", c.name, err)
+			continue
+		}
+		if perr.Layer != c.layer || perr.AttrType != c.attrType || perr.Offset != c.offset {
+			t.Errorf("%s: got layer %s type %d offset %d, expected layer %s type %d offset %d", c.name,
+				perr.Layer, perr.AttrType, perr.Offset, c.layer, c.attrType, c.offset)
+		}
+	}
+}
+
+func TestParseTruncatedHeader(t *testing.T) {
+	rec := bgp4mpRecord([]byte{0, 0, 0, 0})
+	_, err := ParseHeaders(rec[:20], false)
+	var perr *protoparse.ParseError
+	if !errors.As(err, &perr) || perr.Layer != protoparse.LayerMRT || !errors.Is(err, protoparse.ErrTruncated) {
+		t.Fatalf("expected a truncated MRT error, got %v", err)
+	}
+	if perr.Offset != MRT_HEADER_LEN {
+		t.Errorf("expected offset %d, got %d", MRT_HEADER_LEN, perr.Offset)
+	}
+}
@@ -0,0 +1,256 @@
+// Package pcap reads BGP sessions out of pcap and pcapng packet captures.
+// TCP streams to or from port 179 are reassembled, split in BGP messages
+// and returned as BGP4MP MRT records, so they can be parsed like the
+// records of an MRT file.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// link types of the captures that can be decoded
+const (
+	LINKTYPE_NULL      = 0
+	LINKTYPE_ETHERNET  = 1
+	LINKTYPE_RAW       = 101
+	LINKTYPE_LINUX_SLL = 113
+	LINKTYPE_LOOP      = 108
+	LINKTYPE_IPV4      = 228
+	LINKTYPE_IPV6      = 229
+	LINKTYPE_SLL2      = 276
+)
+
+const (
+	PCAP_MAGIC       = 0xa1b2c3d4
+	PCAP_MAGIC_NANO  = 0xa1b23c4d
+	PCAPNG_SHB       = 0x0a0d0d0a
+	PCAPNG_BYTEORDER = 0x1a2b3c4d
+	// packets larger than this are considered a corrupt capture
+	MAX_PACKET_LEN = 1 << 18
+)
+
+var errCorrupt = errors.New("corrupt capture file")
+
+// packet is a captured frame with the link type of its interface.
+type packet struct {
+	ts       time.Time
+	linkType uint32
+	data     []byte
+}
+
+// packetSource reads the packets of a capture file format.
+type packetSource interface {
+	next() (*packet, error)
+}
+
+// newPacketSource detects the format of the capture from its first bytes.
+func newPacketSource(r io.Reader) (packetSource, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture magic number: %w", err)
+	}
+	if binary.BigEndian.Uint32(magic) == PCAPNG_SHB {
+		return &pcapngSource{r: br, interfaces: []pcapngInterface{}}, nil
+	}
+	return newPcapSource(br)
+}
+
+// pcapSource reads the classic libpcap format.
+type pcapSource struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+	hdr      [16]byte
+}
+
+func newPcapSource(r io.Reader) (*pcapSource, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+	p := &pcapSource{r: r}
+	switch {
+	case binary.BigEndian.Uint32(hdr[:4]) == PCAP_MAGIC:
+		p.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr[:4]) == PCAP_MAGIC:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:4]) == PCAP_MAGIC_NANO:
+		p.order, p.nano = binary.BigEndian, true
+	case binary.LittleEndian.Uint32(hdr[:4]) == PCAP_MAGIC_NANO:
+		p.order, p.nano = binary.LittleEndian, true
+	default:
+		return nil, fmt.Errorf("not a pcap or pcapng file (magic %x)", hdr[:4])
+	}
+	p.linkType = p.order.Uint32(hdr[20:24]) & 0x0fffffff //the upper bits hold FCS info
+	return p, nil
+}
+
+func (p *pcapSource) next() (*packet, error) {
+	if _, err := io.ReadFull(p.r, p.hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errCorrupt
+		}
+		return nil, err
+	}
+	sec := int64(p.order.Uint32(p.hdr[:4]))
+	frac := int64(p.order.Uint32(p.hdr[4:8]))
+	caplen := p.order.Uint32(p.hdr[8:12])
+	if caplen > MAX_PACKET_LEN {
+		return nil, errCorrupt
+	}
+	data := make([]byte, caplen)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, errCorrupt
+	}
+	if !p.nano {
+		frac *= 1000
+	}
+	return &packet{ts: time.Unix(sec, frac).UTC(), linkType: p.linkType, data: data}, nil
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	// timestamp units per second
+	resolution uint64
+}
+
+// pcapngSource reads the pcapng format. Each section can have a different
+// byte order and interfaces with different link types and resolutions.
+type pcapngSource struct {
+	r          io.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+// block reads the next block and returns its type and body.
+func (p *pcapngSource) block() (uint32, []byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errCorrupt
+		}
+		return 0, nil, err
+	}
+	btype := binary.BigEndian.Uint32(hdr[:4])
+	if btype == PCAPNG_SHB { //a new section, with a possibly different byte order
+		var bom [4]byte
+		if _, err := io.ReadFull(p.r, bom[:]); err != nil {
+			return 0, nil, errCorrupt
+		}
+		switch {
+		case binary.BigEndian.Uint32(bom[:]) == PCAPNG_BYTEORDER:
+			p.order = binary.BigEndian
+		case binary.LittleEndian.Uint32(bom[:]) == PCAPNG_BYTEORDER:
+			p.order = binary.LittleEndian
+		default:
+			return 0, nil, errCorrupt
+		}
+		p.interfaces = p.interfaces[:0]
+		blen := p.order.Uint32(hdr[4:8])
+		if blen < 16 || blen > MAX_PACKET_LEN || blen%4 != 0 {
+			return 0, nil, errCorrupt
+		}
+		body := make([]byte, blen-12)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return 0, nil, errCorrupt
+		}
+		return btype, body[:len(body)-4], nil
+	}
+	if p.order == nil {
+		return 0, nil, errCorrupt
+	}
+	btype = p.order.Uint32(hdr[:4])
+	blen := p.order.Uint32(hdr[4:8])
+	if blen < 12 || blen > MAX_PACKET_LEN || blen%4 != 0 {
+		return 0, nil, errCorrupt
+	}
+	body := make([]byte, blen-8)
+	if _, err := io.ReadFull(p.r, body); err != nil {
+		return 0, nil, errCorrupt
+	}
+	return btype, body[:len(body)-4], nil //without the trailing length
+}
+
+func (p *pcapngSource) next() (*packet, error) {
+	for {
+		btype, body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		switch btype {
+		case 1: //interface description
+			if len(body) < 8 {
+				return nil, errCorrupt
+			}
+			iface := pcapngInterface{linkType: uint32(p.order.Uint16(body[:2])), resolution: 1000000}
+			p.readIfOptions(&iface, body[8:])
+			p.interfaces = append(p.interfaces, iface)
+		case 6, 2: //enhanced packet and the obsolete packet block
+			if len(body) < 20 {
+				return nil, errCorrupt
+			}
+			ifid := p.order.Uint32(body[:4])
+			if btype == 2 {
+				ifid = uint32(p.order.Uint16(body[:2]))
+			}
+			if int(ifid) >= len(p.interfaces) {
+				return nil, errCorrupt
+			}
+			iface := p.interfaces[ifid]
+			ts := uint64(p.order.Uint32(body[4:8]))<<32 | uint64(p.order.Uint32(body[8:12]))
+			caplen := p.order.Uint32(body[12:16])
+			if int(caplen) > len(body)-20 {
+				return nil, errCorrupt
+			}
+			return &packet{ts: iface.time(ts), linkType: iface.linkType, data: body[20 : 20+caplen]}, nil
+		case 3: //simple packet, on the first interface and without a timestamp
+			if len(body) < 4 || len(p.interfaces) == 0 {
+				return nil, errCorrupt
+			}
+			caplen := p.order.Uint32(body[:4])
+			if int(caplen) > len(body)-4 {
+				caplen = uint32(len(body) - 4)
+			}
+			return &packet{linkType: p.interfaces[0].linkType, data: body[4 : 4+caplen]}, nil
+		}
+		//other blocks (statistics, name resolution, ...) are skipped
+	}
+}
+
+// readIfOptions reads the timestamp resolution option of an interface.
+func (p *pcapngSource) readIfOptions(iface *pcapngInterface, opts []byte) {
+	for len(opts) >= 4 {
+		code := p.order.Uint16(opts[:2])
+		olen := int(p.order.Uint16(opts[2:4]))
+		opts = opts[4:]
+		if code == 0 || olen > len(opts) {
+			return
+		}
+		if code == 9 && olen >= 1 { //if_tsresol
+			v := opts[0]
+			res := uint64(1)
+			for i := uint8(0); i < v&0x7f; i++ {
+				if v&0x80 != 0 {
+					res *= 2
+				} else {
+					res *= 10
+				}
+			}
+			iface.resolution = res
+		}
+		opts = opts[(olen+3)&^3:]
+	}
+}
+
+func (iface pcapngInterface) time(ts uint64) time.Time {
+	sec := ts / iface.resolution
+	frac := ts % iface.resolution
+	return time.Unix(int64(sec), int64(frac*1000000000/iface.resolution)).UTC()
+}
@@ -0,0 +1,265 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+var (
+	routerA = net.ParseIP("192.0.2.1").To4()
+	routerB = net.ParseIP("192.0.2.2").To4()
+	start   = time.Unix(1500000000, 250000000).UTC()
+)
+
+// updateBody advertises 10.0.0.0/8 with an AS4 path of ases. The next hop
+// must be of the family of the session.
+func updateBody(nexthop net.IP, ases ...uint32) []byte {
+	path := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}
+	attrs = append(attrs, path...)
+	if nh := nexthop.To4(); nh != nil {
+		nexthop = nh
+	}
+	attrs = append(attrs, 0x40, 3, byte(len(nexthop)))
+	attrs = append(attrs, nexthop...)
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	return append(body, 8, 10)
+}
+
+func openMsg(as uint32, id string) []byte {
+	o := &bgp.Open{Version: 4, AS: as, HoldTime: 90, BGPID: net.ParseIP(id), Capabilities: []*bgp.Capability{bgp.NewAS4Capability(as)}}
+	return o.Encode()
+}
+
+// tcpPacket builds an IPv4 or IPv6 TCP packet.
+func tcpPacket(src, dst net.IP, sport, dport uint16, seq uint32, flags uint8, payload []byte) []byte {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[:2], sport)
+	binary.BigEndian.PutUint16(tcp[2:4], dport)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, payload...)
+	if src.To4() != nil {
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+		ip[9] = 6
+		copy(ip[12:16], src.To4())
+		copy(ip[16:20], dst.To4())
+		return append(ip, tcp...)
+	}
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(tcp)))
+	ip[6] = 6
+	copy(ip[8:24], src)
+	copy(ip[24:40], dst)
+	return append(ip, tcp...)
+}
+
+func ethernet(ip []byte) []byte {
+	frame := make([]byte, 14, 14+len(ip))
+	if ip[0]>>4 == 4 {
+		frame[12] = 0x08
+	} else {
+		frame[12], frame[13] = 0x86, 0xdd
+	}
+	return append(frame, ip...)
+}
+
+// session returns the packets of a BGP session from a (port 40000) to
+// b (port 179), with an update from a split in two segments that arrive
+// out of order and a retransmission.
+func session(a, b net.IP) [][]byte {
+	update := bgp.NewMessage(bgp.MSG_UPDATE, updateBody(a, 4200000000, 3356))
+	openA, openB := openMsg(4200000000, "10.0.0.1"), openMsg(65000, "10.0.0.2")
+	isnA, isnB := uint32(0xfffffff0), uint32(1000) //a's sequence numbers wrap
+	nextA := isnA + 1 + uint32(len(openA))
+	return [][]byte{
+		tcpPacket(a, b, 40000, 179, isnA, tcpSYN, nil),
+		tcpPacket(b, a, 179, 40000, isnB, tcpSYN|0x10, nil),
+		tcpPacket(a, b, 40000, 179, isnA+1, 0x10, openA),
+		tcpPacket(b, a, 179, 40000, isnB+1, 0x10, openB),
+		tcpPacket(a, b, 40000, 179, nextA+10, 0x10, update[10:]),
+		tcpPacket(a, b, 40000, 179, nextA, 0x10, update[:10]),
+		tcpPacket(a, b, 40000, 179, nextA, 0x10, update[:10]),
+		tcpPacket(a, b, 40000, 179, nextA+uint32(len(update)), tcpFIN|0x10, nil),
+	}
+}
+
+func pcapFile(linkType uint32, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[:4], PCAP_MAGIC)
+	binary.LittleEndian.PutUint16(hdr[4:6], 2)
+	binary.LittleEndian.PutUint16(hdr[6:8], 4)
+	binary.LittleEndian.PutUint32(hdr[16:20], 65535)
+	binary.LittleEndian.PutUint32(hdr[20:24], linkType)
+	buf.Write(hdr)
+	for i, f := range frames {
+		ts := start.Add(time.Duration(i) * time.Second)
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[:4], uint32(ts.Unix()))
+		binary.LittleEndian.PutUint32(rec[4:8], uint32(ts.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(f)))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(len(f)))
+		buf.Write(rec)
+		buf.Write(f)
+	}
+	return buf.Bytes()
+}
+
+func pcapngBlock(btype uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	blk := make([]byte, 8, 12+len(body))
+	binary.BigEndian.PutUint32(blk[:4], btype)
+	binary.BigEndian.PutUint32(blk[4:8], uint32(12+len(body)))
+	blk = append(blk, body...)
+	return append(blk, blk[4:8]...)
+}
+
+// pcapngFile writes a big endian pcapng with nanosecond timestamps.
+func pcapngFile(linkType uint16, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(pcapngBlock(PCAPNG_SHB, []byte{0x1a, 0x2b, 0x3c, 0x4d, 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+	idb := []byte{byte(linkType >> 8), byte(linkType), 0, 0, 0, 0, 0, 0}
+	idb = append(idb, 0, 9, 0, 1, 9, 0, 0, 0, 0, 0, 0, 0) //if_tsresol 10^-9
+	buf.Write(pcapngBlock(1, idb))
+	for i, f := range frames {
+		ts := uint64(start.Add(time.Duration(i) * time.Second).UnixNano())
+		epb := make([]byte, 20, 20+len(f))
+		binary.BigEndian.PutUint32(epb[4:8], uint32(ts>>32))
+		binary.BigEndian.PutUint32(epb[8:12], uint32(ts))
+		binary.BigEndian.PutUint32(epb[12:16], uint32(len(f)))
+		binary.BigEndian.PutUint32(epb[16:20], uint32(len(f)))
+		buf.Write(pcapngBlock(6, append(epb, f...)))
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, capture []byte) [][]byte {
+	r, err := NewReader(bytes.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := [][]byte{}
+	for r.Scan() {
+		recs = append(recs, append([]byte{}, r.Bytes()...))
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func checkUpdate(t *testing.T, rec []byte, peer, local net.IP, ts time.Time) {
+	if _, err := mrt.ParseHeaders(rec, false); err != nil {
+		t.Fatalf("record does not parse: %s", err)
+	}
+	c, err := mrt.MrtToBGPCapturev2(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Timestamp != uint32(ts.Unix()) {
+		t.Errorf("expected timestamp %d, got %d", ts.Unix(), c.Timestamp)
+	}
+	if c.Peer_AS != 4200000000 || c.Local_AS != 65000 {
+		t.Errorf("bad ASes %d %d", c.Peer_AS, c.Local_AS)
+	}
+	if !net.IP(util.GetIP(c.Peer_IP)).Equal(peer) || !net.IP(util.GetIP(c.Local_IP)).Equal(local) {
+		t.Errorf("bad addresses %v %v", c.Peer_IP, c.Local_IP)
+	}
+	seq := c.Update.Attrs.ASPath[0].ASSeq
+	if len(seq) != 2 || seq[0] != 4200000000 || seq[1] != 3356 {
+		t.Errorf("bad AS path %v", seq)
+	}
+}
+
+func TestPcap(t *testing.T) {
+	frames := [][]byte{}
+	for _, p := range session(routerA, routerB) {
+		frames = append(frames, ethernet(p))
+	}
+	recs := readAll(t, pcapFile(LINKTYPE_ETHERNET, frames))
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	//completed by the 6th packet
+	checkUpdate(t, recs[0], routerA, routerB, start.Add(5*time.Second))
+}
+
+func TestPcapng(t *testing.T) {
+	a, b := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	recs := readAll(t, pcapngFile(LINKTYPE_RAW, session(a, b)))
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	checkUpdate(t, recs[0], a, b, start.Add(5*time.Second))
+}
+
+func TestAllMessages(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(pcapFile(LINKTYPE_RAW, session(routerA, routerB))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AllMessages = true
+	types := []uint8{}
+	for r.Scan() {
+		types = append(types, r.Bytes()[mrt.MRT_HEADER_LEN+20+18]) //after the MESSAGE_AS4 header for IPv4
+	}
+	if !bytes.Equal(types, []uint8{bgp.MSG_OPEN, bgp.MSG_OPEN, bgp.MSG_UPDATE}) {
+		t.Errorf("expected two OPENs and an UPDATE, got message types %v", types)
+	}
+}
+
+func TestMidStream(t *testing.T) {
+	// a capture that starts in the middle of an update, without the OPENs
+	update := bgp.NewMessage(bgp.MSG_UPDATE, updateBody(routerA, 4200000000, 3356))
+	stream := append(update[25:], update...)
+	frames := [][]byte{
+		tcpPacket(routerA, routerB, 40000, 179, 5000, 0x10, stream[:30]),
+		tcpPacket(routerA, routerB, 40000, 179, 5030, 0x10, stream[30:]),
+	}
+	recs := readAll(t, pcapFile(LINKTYPE_RAW, frames))
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(recs))
+	}
+	c, err := mrt.MrtToBGPCapturev2(recs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Peer_AS != 0 || len(c.Update.Attrs.ASPath[0].ASSeq) != 2 {
+		t.Errorf("bad capture %v", c)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture file at all"))); err == nil {
+		t.Error("expected an error for a file that is not a capture")
+	}
+	capture := pcapFile(LINKTYPE_RAW, session(routerA, routerB))
+	r, err := NewReader(bytes.NewReader(capture[:len(capture)-5]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r.Scan() {
+	}
+	if r.Err() != errCorrupt {
+		t.Errorf("expected a corrupt capture error, got %v", r.Err())
+	}
+}
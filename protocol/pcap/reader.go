@@ -0,0 +1,123 @@
+package pcap
+
+import (
+	"io"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+// Reader extracts the BGP messages of the sessions in a capture and returns
+// them as BGP4MP MRT records. Its Scan, Bytes and Err methods work like
+// the ones of a bufio.Scanner splitting an MRT file with mrt.SplitMrt.
+//
+// The peer of a record is the sender of the message and the local end its
+// receiver. Their ASes are learned from the OPEN messages of the session,
+// and are 0 if the capture doesn't have them. Sessions are assumed to use
+// 4 byte AS_PATHs unless an OPEN without the AS4 capability was seen. The
+// timestamp of a record is the capture time of the packet that completed
+// the message.
+type Reader struct {
+	// AllMessages also returns records for messages other than UPDATEs.
+	// mrt.ParseHeaders only decodes UPDATEs, so they are off by default.
+	AllMessages bool
+
+	src     packetSource
+	streams map[flowKey]*stream
+	records [][]byte
+	rec     []byte
+	err     error
+}
+
+// NewReader creates a reader for a pcap or pcapng capture.
+func NewReader(r io.Reader) (*Reader, error) {
+	src, err := newPacketSource(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{src: src, streams: make(map[flowKey]*stream)}, nil
+}
+
+// Scan advances to the next record, which is then available through Bytes.
+// It returns false at the end of the capture or on an error.
+func (r *Reader) Scan() bool {
+	for len(r.records) == 0 {
+		if r.err != nil {
+			r.rec = nil
+			return false
+		}
+		pkt, err := r.src.next()
+		if err != nil {
+			if err != io.EOF {
+				r.err = err
+			}
+			r.rec = nil
+			return false
+		}
+		r.handle(pkt)
+	}
+	r.rec, r.records = r.records[0], r.records[1:]
+	return true
+}
+
+// Bytes returns the record of the last Scan.
+func (r *Reader) Bytes() []byte {
+	return r.rec
+}
+
+// Err returns the error that stopped Scan, or nil at the end of the capture.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+func (r *Reader) handle(pkt *packet) {
+	ip := decodeLink(pkt.linkType, pkt.data)
+	if ip == nil {
+		return
+	}
+	seg := decodeIP(ip)
+	if seg == nil || (seg.sport != BGP_PORT && seg.dport != BGP_PORT) {
+		return
+	}
+	key := seg.key()
+	s, ok := r.streams[key]
+	if !ok || seg.flags&tcpSYN != 0 {
+		s = newStream(seg)
+		r.streams[key] = s
+	}
+	s.add(seg)
+	for msg := s.message(); msg != nil; msg = s.message() {
+		r.message(pkt, s, r.streams[key.reverse()], msg)
+	}
+	if seg.flags&(tcpFIN|tcpRST) != 0 {
+		delete(r.streams, key)
+	}
+}
+
+// message queues the record of a message sent on s. rev is the stream in
+// the other direction, if it was captured.
+func (r *Reader) message(pkt *packet, s, rev *stream, msg []byte) {
+	mtype := msg[18]
+	if mtype == bgp.MSG_OPEN {
+		if o, err := bgp.ParseOpen(msg[bgp.BGP_HEADER_LEN:]); err == nil {
+			s.open = o
+		}
+	}
+	if mtype != bgp.MSG_UPDATE && !r.AllMessages {
+		return
+	}
+	peering := &mrt.BGP4MPPeering{PeerIP: s.src, LocalIP: s.dst}
+	AS4 := true
+	if s.open != nil {
+		peering.PeerAS = s.open.AS
+		_, as4 := s.open.AS4()
+		AS4 = as4
+	}
+	if rev != nil && rev.open != nil {
+		peering.LocalAS = rev.open.AS
+		if _, as4 := rev.open.AS4(); !as4 {
+			AS4 = false
+		}
+	}
+	r.records = append(r.records, mrt.NewBGP4MPMessage(pkt.ts, peering, AS4, msg))
+}
@@ -0,0 +1,285 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/CSUNetSec/protoparse"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+)
+
+const (
+	BGP_PORT = 179
+	// out of order segments kept per stream before giving up on a gap
+	MAX_PENDING_SEGMENTS = 1024
+)
+
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+)
+
+// segment is the part of a TCP packet needed for reassembly.
+type segment struct {
+	src, dst     net.IP
+	sport, dport uint16
+	seq          uint32
+	flags        uint8
+	payload      []byte
+}
+
+// decodeLink strips the link layer of a frame and returns the IP packet in
+// it, or nil if it doesn't carry IP.
+func decodeLink(linkType uint32, data []byte) []byte {
+	var etype uint16
+	switch linkType {
+	case LINKTYPE_RAW, LINKTYPE_IPV4, LINKTYPE_IPV6:
+		return data
+	case LINKTYPE_NULL, LINKTYPE_LOOP:
+		//a 4 byte address family, in the byte order of the capturing host
+		if len(data) < 4 {
+			return nil
+		}
+		return data[4:]
+	case LINKTYPE_ETHERNET:
+		if len(data) < 14 {
+			return nil
+		}
+		etype, data = binary.BigEndian.Uint16(data[12:14]), data[14:]
+		for etype == 0x8100 || etype == 0x88a8 { //VLAN tags
+			if len(data) < 4 {
+				return nil
+			}
+			etype, data = binary.BigEndian.Uint16(data[2:4]), data[4:]
+		}
+	case LINKTYPE_LINUX_SLL:
+		if len(data) < 16 {
+			return nil
+		}
+		etype, data = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	case LINKTYPE_SLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		etype, data = binary.BigEndian.Uint16(data[:2]), data[20:]
+	default:
+		return nil
+	}
+	if etype != 0x0800 && etype != 0x86dd {
+		return nil
+	}
+	return data
+}
+
+// decodeIP returns the TCP segment of an IPv4 or IPv6 packet, or nil if
+// the packet isn't TCP or is a non first fragment.
+func decodeIP(data []byte) *segment {
+	if len(data) < 1 {
+		return nil
+	}
+	seg := &segment{}
+	var proto uint8
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil
+		}
+		ihl := int(data[0]&0x0f) * 4
+		tlen := int(binary.BigEndian.Uint16(data[2:4]))
+		if ihl < 20 || tlen < ihl || len(data) < ihl {
+			return nil
+		}
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff != 0 { //fragment offset
+			return nil
+		}
+		if tlen < len(data) { //ethernet padding
+			data = data[:tlen]
+		}
+		proto = data[9]
+		seg.src, seg.dst = copyIP(data[12:16]), copyIP(data[16:20])
+		data = data[ihl:]
+	case 6:
+		if len(data) < 40 {
+			return nil
+		}
+		plen := int(binary.BigEndian.Uint16(data[4:6]))
+		proto = data[6]
+		seg.src, seg.dst = copyIP(data[8:24]), copyIP(data[24:40])
+		data = data[40:]
+		if plen < len(data) {
+			data = data[:plen]
+		}
+		for proto == 0 || proto == 43 || proto == 60 || proto == 44 { //extension headers
+			if len(data) < 8 {
+				return nil
+			}
+			if proto == 44 {
+				if binary.BigEndian.Uint16(data[2:4])&0xfff8 != 0 {
+					return nil
+				}
+				proto, data = data[0], data[8:]
+				continue
+			}
+			hlen := (int(data[1]) + 1) * 8
+			if hlen > len(data) {
+				return nil
+			}
+			proto, data = data[0], data[hlen:]
+		}
+	default:
+		return nil
+	}
+	if proto != 6 || len(data) < 20 {
+		return nil
+	}
+	doff := int(data[12]>>4) * 4
+	if doff < 20 || doff > len(data) {
+		return nil
+	}
+	seg.sport = binary.BigEndian.Uint16(data[:2])
+	seg.dport = binary.BigEndian.Uint16(data[2:4])
+	seg.seq = binary.BigEndian.Uint32(data[4:8])
+	seg.flags = data[13]
+	seg.payload = data[doff:]
+	return seg
+}
+
+func copyIP(ip []byte) net.IP {
+	ret := make(net.IP, len(ip))
+	copy(ret, ip)
+	return ret
+}
+
+// flowKey identifies one direction of a TCP connection.
+type flowKey struct {
+	src, dst     string
+	sport, dport uint16
+}
+
+func (s *segment) key() flowKey {
+	return flowKey{string(s.src), string(s.dst), s.sport, s.dport}
+}
+
+func (k flowKey) reverse() flowKey {
+	return flowKey{k.dst, k.src, k.dport, k.sport}
+}
+
+// stream reassembles one direction of a TCP connection.
+type stream struct {
+	src, dst net.IP
+	synced   bool
+	next     uint32
+	pending  map[uint32][]byte
+	// the contiguous data not yet split in BGP messages
+	buf []byte
+	// set when data was lost and buf doesn't start at a BGP message
+	resync bool
+	// the OPEN the sender of this stream sent, if it was captured
+	open *bgp.Open
+}
+
+func newStream(seg *segment) *stream {
+	return &stream{src: seg.src, dst: seg.dst, pending: map[uint32][]byte{}}
+}
+
+// seqDiff compares sequence numbers with wraparound.
+func seqDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// add stores the payload of a segment and appends all the data that
+// became contiguous to buf.
+func (s *stream) add(seg *segment) {
+	if seg.flags&tcpSYN != 0 {
+		s.synced, s.next = true, seg.seq+1
+		return
+	}
+	if len(seg.payload) == 0 {
+		return
+	}
+	if !s.synced { //the capture started in the middle of the connection
+		s.synced, s.next = true, seg.seq
+		s.lost()
+	}
+	if p, ok := s.pending[seg.seq]; !ok || len(p) < len(seg.payload) {
+		s.pending[seg.seq] = seg.payload
+	}
+	if len(s.pending) > MAX_PENDING_SEGMENTS { //the segments we wait for were not captured
+		s.skipGap()
+		s.lost()
+	}
+	for found := true; found; {
+		found = false
+		for seq, p := range s.pending {
+			if seqDiff(seq, s.next) <= 0 {
+				delete(s.pending, seq)
+				s.append(seq, p)
+				found = true
+			}
+		}
+	}
+}
+
+// append adds the part of data starting at seq that is after s.next.
+func (s *stream) append(seq uint32, data []byte) {
+	if d := seqDiff(s.next, seq); d > 0 { //retransmission
+		if int(d) >= len(data) {
+			return
+		}
+		data = data[d:]
+	}
+	s.buf = append(s.buf, data...)
+	s.next += uint32(len(data))
+}
+
+// skipGap continues the stream from the earliest pending segment.
+func (s *stream) skipGap() {
+	first, set := uint32(0), false
+	for seq := range s.pending {
+		if !set || seqDiff(seq, first) < 0 {
+			first, set = seq, true
+		}
+	}
+	s.next = first
+}
+
+// lost drops the partial message in buf after data was lost.
+func (s *stream) lost() {
+	s.buf = s.buf[:0]
+	s.resync = true
+}
+
+// message returns the next complete BGP message in buf, or nil if there
+// is none yet. After lost data it skips to the next BGP marker.
+func (s *stream) message() []byte {
+	for {
+		if s.resync {
+			i := bytes.Index(s.buf, bgpMarker)
+			if i < 0 {
+				if len(s.buf) >= len(bgpMarker) { //keep what could be the start of a marker
+					s.buf = append(s.buf[:0], s.buf[len(s.buf)-len(bgpMarker)+1:]...)
+				}
+				return nil
+			}
+			s.buf = s.buf[i:]
+			s.resync = false
+		}
+		_, mlen, err := bgp.ReadMessageHeader(s.buf)
+		if err != nil {
+			if errors.Is(err, protoparse.ErrTruncated) {
+				return nil
+			}
+			s.buf = s.buf[1:]
+			s.resync = true
+			continue
+		}
+		msg := s.buf[:mlen]
+		s.buf = s.buf[mlen:]
+		return msg
+	}
+}
+
+var bgpMarker = bytes.Repeat([]byte{0xff}, 16)
@@ -23,6 +23,9 @@ type ribBuf struct {
 	isv6    bool
 	isIndex bool
 	index   pp.PbVal
+	extras  []*bgp.ExtraAttrs
+	// the buffer before it is advanced by parsing, to locate errors
+	start []byte
 }
 
 func NewRibIndexBuf(buf []byte) *ribBuf {
@@ -44,27 +47,34 @@ func NewRibEntryBuf(buf []byte, subType int, index pp.PbVal) *ribBuf {
 }
 
 func (r *ribBuf) Parse() (pp.PbVal, error) {
+	r.start = r.buf
 	if r.isIndex {
 		return r.parseIndexTable()
-	} else {
-		return r.parseRIB()
 	}
-	return nil, nil
+	return r.parseRIB()
+}
+
+// offset returns the offset of r.buf as it is advanced.
+func (r *ribBuf) offset() int {
+	return len(r.start) - len(r.buf)
 }
 
 // This function only parses AFI/SAFI-Specific RIB subtypes
 func (r *ribBuf) parseRIB() (pp.PbVal, error) {
 
 	if len(r.buf) < 5 {
-		return nil, fmt.Errorf("rib: Buffer too small to read bitlen")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read bitlen")
 	}
 	r.buf = r.buf[4:]
 	bitlen := uint8(r.buf[0])
+	if (r.isv6 && bitlen > 128) || (!r.isv6 && bitlen > 32) {
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrMalformed, "prefix length %d is too long", bitlen)
+	}
 	r.buf = r.buf[1:]
 
 	bytelen := int(bitlen+7) / 8
 	if int(bytelen) > len(r.buf) {
-		return nil, fmt.Errorf("Buffer too small to parse prefix. Buffer size:%d Prefix Size: %d\n", len(r.buf), bytelen)
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to parse prefix. Buffer size:%d Prefix Size: %d", len(r.buf), bytelen)
 	}
 
 	pbuf := make([]byte, bytelen)
@@ -103,7 +113,7 @@ func (r *ribBuf) parseRIB() (pp.PbVal, error) {
 	}
 
 	if len(r.buf) < 2 {
-		return nil, fmt.Errorf("rib: Buffer too small to read entry count")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read entry count")
 	}
 	entryCount := int(binary.BigEndian.Uint16(r.buf[:2]))
 	r.buf = r.buf[2:]
@@ -113,7 +123,7 @@ func (r *ribBuf) parseRIB() (pp.PbVal, error) {
 		re, err := r.parseRIBEntry(prefWrapper)
 		routes[i] = re
 		if err != nil {
-			return nil, fmt.Errorf("Error parsing RIB entries: %s", err)
+			return nil, err
 		}
 	}
 	r.dest.RouteEntry = routes
@@ -125,7 +135,7 @@ func (r *ribBuf) parseRIBEntry(pref *pbcom.PrefixWrapper) (*pbbgp.RIBEntry, erro
 	re.Prefix = pref
 
 	if len(r.buf) < 8 {
-		return nil, fmt.Errorf("rib: Buffer too small to parse RIB entry header")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to parse RIB entry header")
 	}
 	re.PeerIndex = uint32(binary.BigEndian.Uint16(r.buf[:2]))
 	r.buf = r.buf[2:]
@@ -137,15 +147,15 @@ func (r *ribBuf) parseRIBEntry(pref *pbcom.PrefixWrapper) (*pbbgp.RIBEntry, erro
 	r.buf = r.buf[2:]
 
 	if len(r.buf) < attrLen {
-		return nil, fmt.Errorf("rib: Buffer too small to parse BGP attributes")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to parse BGP attributes")
 	}
-	attrs, err, _, _ := bgp.ParseAttrs(r.buf[:attrLen], true, r.isv6)
-	r.buf = r.buf[attrLen:]
-	re.Attrs = attrs
-
+	attrs, extra, err := bgp.ParseAttrsExtra(r.buf[:attrLen], true, r.isv6)
 	if err != nil {
-		return nil, err
+		return nil, pp.AddOffset(err, r.offset())
 	}
+	r.buf = r.buf[attrLen:]
+	re.Attrs = attrs
+	r.extras = append(r.extras, extra)
 	return re, nil
 }
 
@@ -153,18 +163,18 @@ func (r *ribBuf) parseIndexTable() (pp.PbVal, error) {
 	// buf[0:4] is Collector BGP ID
 
 	if len(r.buf) < 6 {
-		return nil, fmt.Errorf("rib: Buffer too small to read view length")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read view length")
 	}
 	vLength := int(binary.BigEndian.Uint16(r.buf[4:6]))
 	r.buf = r.buf[6:]
 
 	if len(r.buf) < vLength {
-		return nil, fmt.Errorf("rib: Buffer too small to read view name")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read view name")
 	}
 	r.buf = r.buf[vLength:]
 
 	if len(r.buf) < 2 {
-		return nil, fmt.Errorf("rib: Buffer too small to read peer count")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read peer count")
 	}
 	peerCount := int(binary.BigEndian.Uint16(r.buf[:2]))
 	r.buf = r.buf[2:]
@@ -184,7 +194,7 @@ func (r *ribBuf) parseIndexTable() (pp.PbVal, error) {
 func (r *ribBuf) parsePeerEntry() (*pbbgp.PeerEntry, error) {
 
 	if len(r.buf) < 1 {
-		return nil, fmt.Errorf("rib: Buffer too small to read peer type")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read peer type")
 	}
 	peerType := uint8(r.buf[0])
 	r.buf = r.buf[1:]
@@ -193,7 +203,7 @@ func (r *ribBuf) parsePeerEntry() (*pbbgp.PeerEntry, error) {
 	IPv6 := (peerType&0x1 != 0)
 
 	if len(r.buf) < 4 {
-		return nil, fmt.Errorf("rib: Buffer too small to read BGP id")
+		return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read BGP id")
 	}
 	id := binary.BigEndian.Uint32(r.buf[:4])
 	r.buf = r.buf[4:]
@@ -202,7 +212,7 @@ func (r *ribBuf) parsePeerEntry() (*pbbgp.PeerEntry, error) {
 	if IPv6 {
 		IPbuf := make([]byte, 16)
 		if len(r.buf) < 16 {
-			return nil, fmt.Errorf("rib: Buffer too small to read peer IPv6")
+			return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read peer IPv6")
 		}
 		copy(IPbuf, r.buf[:16])
 		r.buf = r.buf[16:]
@@ -210,7 +220,7 @@ func (r *ribBuf) parsePeerEntry() (*pbbgp.PeerEntry, error) {
 	} else {
 		IPbuf := make([]byte, 4)
 		if len(r.buf) < 4 {
-			return nil, fmt.Errorf("rib: Buffer too small to read peer IPv4")
+			return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read peer IPv4")
 		}
 		copy(IPbuf, r.buf[:4])
 		r.buf = r.buf[4:]
@@ -220,13 +230,13 @@ func (r *ribBuf) parsePeerEntry() (*pbbgp.PeerEntry, error) {
 	var ASNum uint32
 	if AS4 {
 		if len(r.buf) < 4 {
-			return nil, fmt.Errorf("rib: Buffer too small to read AS number")
+			return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read AS number")
 		}
 		ASNum = binary.BigEndian.Uint32(r.buf[:4])
 		r.buf = r.buf[4:]
 	} else {
 		if len(r.buf) < 2 {
-			return nil, fmt.Errorf("rib: Buffer too small to read AS number")
+			return nil, pp.NewParseError(pp.LayerRIB, r.offset(), pp.ErrTruncated, "buffer too small to read AS number")
 		}
 		ASNum = uint32(binary.BigEndian.Uint16(r.buf[:2]))
 		r.buf = r.buf[2:]
@@ -244,6 +254,28 @@ func (r *ribBuf) GetHeader() *pbbgp.RIB {
 	return r.dest
 }
 
+// GetExtraAttrs returns what was decoded from the attributes of each
+// entry that doesn't fit in the RIB protocol buffer.
+func (r *ribBuf) GetExtraAttrs() []*bgp.ExtraAttrs {
+	return r.extras
+}
+
+// GetPeers returns the peer of each entry from the peer index table, or
+// nil for an entry whose peer is not in it.
+func (r *ribBuf) GetPeers() []*pbbgp.PeerEntry {
+	ret := make([]*pbbgp.PeerEntry, len(r.dest.RouteEntry))
+	ind, ok := r.index.(*ribBuf)
+	if !ok {
+		return ret
+	}
+	for i, re := range r.dest.RouteEntry {
+		if int(re.PeerIndex) < len(ind.dest.PeerEntry) {
+			ret[i] = ind.dest.PeerEntry[re.PeerIndex]
+		}
+	}
+	return ret
+}
+
 func (r *ribBuf) String() string {
 	str := ""
 	if r.isIndex {
@@ -0,0 +1,442 @@
+package rtr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pp "github.com/CSUNetSec/protoparse"
+)
+
+// Default timing parameters (RFC8210 section 6), used until the cache
+// sends its own in an End of Data PDU.
+const (
+	DEFAULT_REFRESH = 3600 * time.Second
+	DEFAULT_RETRY   = 600 * time.Second
+	DEFAULT_EXPIRE  = 7200 * time.Second
+	// how long to wait for the cache to answer a query
+	RESPONSE_TIMEOUT = 60 * time.Second
+)
+
+var (
+	ErrClosed = errors.New("RTR client is closed")
+)
+
+// Client keeps the data of an RTR cache in memory. It fetches all of it
+// with a reset query and then follows the changes with serial queries,
+// when the cache notifies it and every refresh interval. Changes are
+// applied all at once at the end of each response, so readers always see
+// the data of a serial. When the connection fails it reconnects after the
+// retry interval, and drops the data if it can't update it for longer
+// than the expire interval.
+type Client struct {
+	// Version is the highest protocol version the client uses. If the cache
+	// doesn't support it the client uses the version of the cache. It must
+	// be set before Start.
+	Version uint8
+	// ErrorHandler, if set, is called with the errors that end connections.
+	ErrorHandler func(err error)
+	// OnUpdate, if set, is called after the data changes to a new serial.
+	OnUpdate func(c *Client)
+	// Dial connects to the cache. It can be replaced to use a transport
+	// other than TCP.
+	Dial func() (net.Conn, error)
+
+	mu        sync.Mutex
+	set       *Set
+	hasData   bool
+	sessionID uint16
+	serial    uint32
+	lastSync  time.Time
+	refresh   time.Duration
+	retry     time.Duration
+	expire    time.Duration
+	version   uint8
+	conn      net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewClient creates a client for the cache at the TCP address addr.
+func NewClient(addr string) *Client {
+	return &Client{
+		Version: VERSION_2,
+		Dial: func() (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, RESPONSE_TIMEOUT)
+		},
+		set:     NewSet(),
+		refresh: DEFAULT_REFRESH,
+		retry:   DEFAULT_RETRY,
+		expire:  DEFAULT_EXPIRE,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start connects to the cache and returns after the client has all of its
+// data. The client then keeps following the cache until Close. If the
+// first synchronization fails the client is closed and the error returned.
+func (c *Client) Start() error {
+	c.version = c.Version
+	ready := make(chan error, 1)
+	c.wg.Add(1)
+	go c.run(ready)
+	err := <-ready
+	if err != nil {
+		c.Close()
+	}
+	return err
+}
+
+// Close disconnects from the cache and stops the client.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+	})
+	c.wg.Wait()
+	return nil
+}
+
+// Set returns the current data of the cache. The set must not be modified
+// and is replaced, not changed, by updates.
+func (c *Client) Set() *Set {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.set
+}
+
+// VRPs returns the current VRPs.
+func (c *Client) VRPs() []VRP {
+	return c.Set().VRPs()
+}
+
+// ASPAs returns the current ASPAs.
+func (c *Client) ASPAs() []ASPA {
+	return c.Set().ASPAs()
+}
+
+// RouterKeys returns the current router keys.
+func (c *Client) RouterKeys() []RouterKey {
+	return c.Set().RouterKeys()
+}
+
+// Serial returns the session ID and serial of the current data, and false
+// if the client has no data.
+func (c *Client) Serial() (uint16, uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID, c.serial, c.hasData
+}
+
+// NegotiatedVersion returns the protocol version used with the cache.
+func (c *Client) NegotiatedVersion() uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) reportError(err error) {
+	if err != nil && c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
+
+// run connects to the cache until the client is closed. ready receives the
+// result of the first synchronization.
+func (c *Client) run(ready chan<- error) {
+	defer c.wg.Done()
+	for {
+		err := c.session(&ready)
+		if c.isClosed() {
+			if ready != nil {
+				ready <- ErrClosed
+			}
+			return
+		}
+		var rep *ErrorReport
+		if errors.As(err, &rep) && rep.Code == ERR_UNSUPPORTED_VERSION && !c.sawResponse() {
+			c.mu.Lock()
+			if c.version > VERSION_0 {
+				c.version--
+				c.mu.Unlock()
+				continue //try again right away with a lower version
+			}
+			c.mu.Unlock()
+		}
+		if ready != nil {
+			ready <- err
+			return
+		}
+		c.reportError(err)
+		c.mu.Lock()
+		retry := c.retry
+		c.mu.Unlock()
+		select {
+		case <-c.done:
+			return
+		case <-time.After(retry):
+		}
+		c.expireData()
+	}
+}
+
+// sawResponse reports whether the cache ever answered a query, after which
+// the version is not negotiated anymore.
+func (c *Client) sawResponse() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hasData
+}
+
+// expireData drops the data if it was not updated for the expire interval.
+func (c *Client) expireData() {
+	c.mu.Lock()
+	expired := c.hasData && time.Since(c.lastSync) > c.expire
+	if expired {
+		c.set, c.hasData = NewSet(), false
+	}
+	c.mu.Unlock()
+	if expired {
+		c.reportError(fmt.Errorf("RTR data expired after %s without updates", c.expire))
+		if c.OnUpdate != nil {
+			c.OnUpdate(c)
+		}
+	}
+}
+
+type received struct {
+	version uint8
+	pdu     PDU
+	raw     []byte
+	err     error
+}
+
+// read sends the PDUs of conn to pdus until it fails or stop is closed.
+func read(conn net.Conn, pdus chan<- received, stop <-chan struct{}) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(SplitRTR)
+	scanbuffer := make([]byte, MAX_PDU_LEN)
+	scanner.Buffer(scanbuffer, cap(scanbuffer))
+	for {
+		var r received
+		if scanner.Scan() {
+			r.raw = append([]byte{}, scanner.Bytes()...)
+			r.version, r.pdu, r.err = ParsePDU(r.raw)
+		} else {
+			r.err = scanner.Err()
+			if r.err == nil {
+				r.err = fmt.Errorf("connection closed by cache")
+			}
+		}
+		select {
+		case pdus <- r:
+		case <-stop:
+			return
+		}
+		if r.pdu == nil {
+			return
+		}
+	}
+}
+
+// session runs one connection to the cache. ready is sent nil and set to
+// nil after the first complete response.
+func (c *Client) session(ready *chan<- error) error {
+	conn, err := c.Dial()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	version := c.version
+	c.mu.Unlock()
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	pdus := make(chan received)
+	go read(conn, pdus, stop)
+
+	send := func(p PDU) error {
+		conn.SetWriteDeadline(time.Now().Add(RESPONSE_TIMEOUT))
+		_, err := conn.Write(p.Encode(version))
+		return err
+	}
+	// fail sends an error report about a received PDU and returns it.
+	fail := func(code uint16, raw []byte, format string, args ...interface{}) error {
+		rep := &ErrorReport{Code: code, PDU: raw, Text: fmt.Sprintf(format, args...)}
+		send(rep)
+		return rep
+	}
+
+	var (
+		waiting   bool   //for the answer to a query
+		reset     bool   //the query is a reset query
+		staged    *Set   //the data being received
+		respID    uint16 //session ID of the response
+		timeoutC  <-chan time.Time
+		refreshC  <-chan time.Time
+		responded bool //the cache sent a PDU in this connection
+	)
+	query := func() error {
+		_, serial, ok := c.Serial()
+		c.mu.Lock()
+		sessionID := c.sessionID
+		c.mu.Unlock()
+		var err error
+		if ok && !reset {
+			err = send(SerialQuery{SessionID: sessionID, Serial: serial})
+		} else {
+			reset = true
+			err = send(ResetQuery{})
+		}
+		waiting, timeoutC, refreshC = true, time.After(RESPONSE_TIMEOUT), nil
+		return err
+	}
+	if err := query(); err != nil {
+		return err
+	}
+	for {
+		var r received
+		select {
+		case <-c.done:
+			return ErrClosed
+		case <-timeoutC:
+			return fmt.Errorf("cache did not answer in %s", RESPONSE_TIMEOUT)
+		case <-refreshC:
+			if err := query(); err != nil {
+				return err
+			}
+			continue
+		case r = <-pdus:
+		}
+		if r.err != nil {
+			if r.raw != nil { //parsed, not a connection error
+				switch {
+				case r.version > VERSION_2:
+					return fail(ERR_UNSUPPORTED_VERSION, r.raw, "%s", r.err)
+				case errors.Is(r.err, pp.ErrUnsupported):
+					return fail(ERR_UNSUPPORTED_PDU, r.raw, "%s", r.err)
+				}
+				return fail(ERR_CORRUPT_DATA, r.raw, "%s", r.err)
+			}
+			return r.err
+		}
+		if rep, ok := r.pdu.(*ErrorReport); ok {
+			return rep
+		}
+		if r.version != version {
+			if responded || r.version > version {
+				return fail(ERR_UNEXPECTED_VERSION, r.raw, "expected version %d", version)
+			}
+			//the cache answered with a lower version it supports
+			version = r.version
+			c.mu.Lock()
+			c.version = version
+			c.mu.Unlock()
+		}
+		responded = true
+		switch p := r.pdu.(type) {
+		case SerialNotify:
+			if !waiting {
+				if err := query(); err != nil {
+					return err
+				}
+			}
+		case CacheReset:
+			if !waiting || staged != nil {
+				return fail(ERR_CORRUPT_DATA, r.raw, "unexpected cache reset")
+			}
+			reset = true
+			if err := query(); err != nil {
+				return err
+			}
+		case CacheResponse:
+			if !waiting || staged != nil {
+				return fail(ERR_CORRUPT_DATA, r.raw, "unexpected cache response")
+			}
+			respID = p.SessionID
+			if reset {
+				staged = NewSet()
+				break
+			}
+			c.mu.Lock()
+			if p.SessionID != c.sessionID {
+				c.mu.Unlock()
+				return fail(ERR_CORRUPT_DATA, r.raw, "session ID changed from %d to %d", c.sessionID, p.SessionID)
+			}
+			staged = c.set.clone()
+			c.mu.Unlock()
+		case Prefix, RouterKeyPDU, ASPAPDU:
+			if staged == nil {
+				return fail(ERR_CORRUPT_DATA, r.raw, "%s PDU outside of a response", p.Type())
+			}
+			if rep := staged.Apply(p); rep != nil {
+				rep.PDU = r.raw
+				send(rep)
+				return rep
+			}
+		case EndOfData:
+			if staged == nil {
+				return fail(ERR_CORRUPT_DATA, r.raw, "end of data outside of a response")
+			}
+			if p.SessionID != respID {
+				return fail(ERR_CORRUPT_DATA, r.raw, "end of data for session %d in a response for session %d", p.SessionID, respID)
+			}
+			c.commit(staged, p)
+			staged, waiting, reset, timeoutC = nil, false, false, nil
+			c.mu.Lock()
+			refreshC = time.After(c.refresh)
+			c.mu.Unlock()
+			if *ready != nil {
+				*ready <- nil
+				*ready = nil
+			}
+			if c.OnUpdate != nil {
+				c.OnUpdate(c)
+			}
+		default:
+			return fail(ERR_UNSUPPORTED_PDU, r.raw, "%s PDU sent by cache", p.Type())
+		}
+	}
+}
+
+// commit makes a received set the current data.
+func (c *Client) commit(s *Set, eod EndOfData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set, c.hasData = s, true
+	c.sessionID, c.serial = eod.SessionID, eod.Serial
+	c.lastSync = time.Now()
+	if eod.Refresh > 0 {
+		c.refresh = time.Duration(eod.Refresh) * time.Second
+	}
+	if eod.Retry > 0 {
+		c.retry = time.Duration(eod.Retry) * time.Second
+	}
+	if eod.Expire > 0 {
+		c.expire = time.Duration(eod.Expire) * time.Second
+	}
+}
@@ -0,0 +1,441 @@
+// Package rtr implements the RPKI to Router protocol (RFC6810, RFC8210 and
+// the ASPA PDU of its version 2 draft), the protocol routers use to fetch
+// validated ROA payloads, router keys and ASPAs from an RPKI cache.
+package rtr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	pp "github.com/CSUNetSec/protoparse"
+)
+
+// protocol versions
+const (
+	VERSION_0 = 0
+	VERSION_1 = 1
+	VERSION_2 = 2
+)
+
+const (
+	RTR_HEADER_LEN = 8
+	// the largest PDU accepted, which bounds ASPA provider lists and
+	// encapsulated error PDUs
+	MAX_PDU_LEN = 1 << 16
+)
+
+// PDUType is the type of an RTR PDU (RFC8210 section 5).
+type PDUType uint8
+
+const (
+	SERIAL_NOTIFY  = PDUType(0)
+	SERIAL_QUERY   = PDUType(1)
+	RESET_QUERY    = PDUType(2)
+	CACHE_RESPONSE = PDUType(3)
+	IPV4_PREFIX    = PDUType(4)
+	IPV6_PREFIX    = PDUType(6)
+	END_OF_DATA    = PDUType(7)
+	CACHE_RESET    = PDUType(8)
+	ROUTER_KEY     = PDUType(9)
+	ERROR_REPORT   = PDUType(10)
+	ASPA_PDU       = PDUType(11)
+)
+
+var pduTypeNames = map[PDUType]string{
+	SERIAL_NOTIFY:  "serial-notify",
+	SERIAL_QUERY:   "serial-query",
+	RESET_QUERY:    "reset-query",
+	CACHE_RESPONSE: "cache-response",
+	IPV4_PREFIX:    "ipv4-prefix",
+	IPV6_PREFIX:    "ipv6-prefix",
+	END_OF_DATA:    "end-of-data",
+	CACHE_RESET:    "cache-reset",
+	ROUTER_KEY:     "router-key",
+	ERROR_REPORT:   "error-report",
+	ASPA_PDU:       "aspa",
+}
+
+func (t PDUType) String() string {
+	if name, ok := pduTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown-%d", uint8(t))
+}
+
+// Error codes of error report PDUs (RFC8210 section 12).
+const (
+	ERR_CORRUPT_DATA        = 0
+	ERR_INTERNAL            = 1
+	ERR_NO_DATA             = 2
+	ERR_INVALID_REQUEST     = 3
+	ERR_UNSUPPORTED_VERSION = 4
+	ERR_UNSUPPORTED_PDU     = 5
+	ERR_WITHDRAWAL_UNKNOWN  = 6
+	ERR_DUPLICATE_ANNOUNCE  = 7
+	ERR_UNEXPECTED_VERSION  = 8
+	ERR_ASPA_PROVIDER_LIST  = 9
+)
+
+var errorCodeNames = map[uint16]string{
+	ERR_CORRUPT_DATA:        "Corrupt Data",
+	ERR_INTERNAL:            "Internal Error",
+	ERR_NO_DATA:             "No Data Available",
+	ERR_INVALID_REQUEST:     "Invalid Request",
+	ERR_UNSUPPORTED_VERSION: "Unsupported Protocol Version",
+	ERR_UNSUPPORTED_PDU:     "Unsupported PDU Type",
+	ERR_WITHDRAWAL_UNKNOWN:  "Withdrawal of Unknown Record",
+	ERR_DUPLICATE_ANNOUNCE:  "Duplicate Announcement Received",
+	ERR_UNEXPECTED_VERSION:  "Unexpected Protocol Version",
+	ERR_ASPA_PROVIDER_LIST:  "ASPA Provider List Error",
+}
+
+// flag of prefix, router key and ASPA PDUs
+const FLAG_ANNOUNCE = 1
+
+// PDU is a decoded RTR PDU. Encode returns it as sent with a protocol version.
+type PDU interface {
+	Type() PDUType
+	Encode(version uint8) []byte
+}
+
+// SerialNotify tells the router the cache has new data.
+type SerialNotify struct {
+	SessionID uint16
+	Serial    uint32
+}
+
+// SerialQuery asks for the changes since a serial.
+type SerialQuery struct {
+	SessionID uint16
+	Serial    uint32
+}
+
+// ResetQuery asks for all the data of the cache.
+type ResetQuery struct{}
+
+// CacheResponse starts the data that answers a query.
+type CacheResponse struct {
+	SessionID uint16
+}
+
+// Prefix announces or withdraws a VRP. It is an IPv4 or IPv6 prefix PDU
+// depending on the family of the VRP.
+type Prefix struct {
+	Announce bool
+	VRP
+}
+
+// EndOfData ends the data that answers a query. The intervals are in
+// seconds and are 0 in version 0 PDUs, which don't carry them.
+type EndOfData struct {
+	SessionID uint16
+	Serial    uint32
+	Refresh   uint32
+	Retry     uint32
+	Expire    uint32
+}
+
+// CacheReset tells the router the cache can't answer a serial query.
+type CacheReset struct{}
+
+// RouterKeyPDU announces or withdraws a BGPsec router key.
+type RouterKeyPDU struct {
+	Announce bool
+	RouterKey
+}
+
+// ErrorReport reports an error with an optional erroneous PDU and text.
+type ErrorReport struct {
+	Code uint16
+	PDU  []byte
+	Text string
+}
+
+// ASPAPDU announces or withdraws the providers of a customer AS. A
+// withdrawal has no providers.
+type ASPAPDU struct {
+	Announce bool
+	ASPA
+}
+
+func (SerialNotify) Type() PDUType  { return SERIAL_NOTIFY }
+func (SerialQuery) Type() PDUType   { return SERIAL_QUERY }
+func (ResetQuery) Type() PDUType    { return RESET_QUERY }
+func (CacheResponse) Type() PDUType { return CACHE_RESPONSE }
+func (EndOfData) Type() PDUType     { return END_OF_DATA }
+func (CacheReset) Type() PDUType    { return CACHE_RESET }
+func (RouterKeyPDU) Type() PDUType  { return ROUTER_KEY }
+func (ErrorReport) Type() PDUType   { return ERROR_REPORT }
+func (ASPAPDU) Type() PDUType       { return ASPA_PDU }
+
+func (p Prefix) Type() PDUType {
+	if p.Prefix.To4() != nil {
+		return IPV4_PREFIX
+	}
+	return IPV6_PREFIX
+}
+
+func (e *ErrorReport) Error() string {
+	name, ok := errorCodeNames[e.Code]
+	if !ok {
+		name = fmt.Sprintf("Unknown Error %d", e.Code)
+	}
+	if e.Text != "" {
+		return fmt.Sprintf("RTR error report: %s: %s", name, e.Text)
+	}
+	return fmt.Sprintf("RTR error report: %s", name)
+}
+
+// encode returns a PDU with its header. field is the 16 bits after the
+// type, that hold the session ID, error code or flags depending on it.
+func encode(version uint8, t PDUType, field uint16, body []byte) []byte {
+	pdu := make([]byte, RTR_HEADER_LEN, RTR_HEADER_LEN+len(body))
+	pdu[0], pdu[1] = version, uint8(t)
+	binary.BigEndian.PutUint16(pdu[2:4], field)
+	binary.BigEndian.PutUint32(pdu[4:8], uint32(RTR_HEADER_LEN+len(body)))
+	return append(pdu, body...)
+}
+
+func u32(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func flags(announce bool) uint8 {
+	if announce {
+		return FLAG_ANNOUNCE
+	}
+	return 0
+}
+
+func (p SerialNotify) Encode(version uint8) []byte {
+	return encode(version, SERIAL_NOTIFY, p.SessionID, u32(p.Serial))
+}
+
+func (p SerialQuery) Encode(version uint8) []byte {
+	return encode(version, SERIAL_QUERY, p.SessionID, u32(p.Serial))
+}
+
+func (p ResetQuery) Encode(version uint8) []byte {
+	return encode(version, RESET_QUERY, 0, nil)
+}
+
+func (p CacheResponse) Encode(version uint8) []byte {
+	return encode(version, CACHE_RESPONSE, p.SessionID, nil)
+}
+
+func (p Prefix) Encode(version uint8) []byte {
+	body := []byte{flags(p.Announce), p.Length, p.MaxLength, 0}
+	if ip := p.Prefix.To4(); ip != nil {
+		body = append(body, ip...)
+	} else {
+		body = append(body, p.Prefix.To16()...)
+	}
+	return encode(version, p.Type(), 0, append(body, u32(p.AS)...))
+}
+
+func (p EndOfData) Encode(version uint8) []byte {
+	body := u32(p.Serial)
+	if version > VERSION_0 {
+		body = append(body, u32(p.Refresh)...)
+		body = append(body, u32(p.Retry)...)
+		body = append(body, u32(p.Expire)...)
+	}
+	return encode(version, END_OF_DATA, p.SessionID, body)
+}
+
+func (p CacheReset) Encode(version uint8) []byte {
+	return encode(version, CACHE_RESET, 0, nil)
+}
+
+func (p RouterKeyPDU) Encode(version uint8) []byte {
+	body := append(append([]byte{}, p.SKI[:]...), u32(p.AS)...)
+	return encode(version, ROUTER_KEY, uint16(flags(p.Announce))<<8, append(body, p.SPKI...))
+}
+
+func (p ErrorReport) Encode(version uint8) []byte {
+	body := append(u32(uint32(len(p.PDU))), p.PDU...)
+	body = append(body, u32(uint32(len(p.Text)))...)
+	return encode(version, ERROR_REPORT, p.Code, append(body, p.Text...))
+}
+
+func (p ASPAPDU) Encode(version uint8) []byte {
+	body := u32(p.Customer)
+	for _, as := range p.Providers {
+		body = append(body, u32(as)...)
+	}
+	return encode(version, ASPA_PDU, uint16(flags(p.Announce))<<8, body)
+}
+
+func rtrErr(off int, kind error, format string, args ...interface{}) error {
+	return pp.NewParseError(pp.LayerRTR, off, kind, format, args...)
+}
+
+// ReadPDUHeader checks the header of the PDU at the start of buf and
+// returns its version, type and length.
+func ReadPDUHeader(buf []byte) (uint8, PDUType, int, error) {
+	if len(buf) < RTR_HEADER_LEN {
+		return 0, 0, 0, rtrErr(0, pp.ErrTruncated, "not enough bytes for RTR header")
+	}
+	plen := binary.BigEndian.Uint32(buf[4:8])
+	if plen < RTR_HEADER_LEN || plen > MAX_PDU_LEN {
+		return 0, 0, 0, rtrErr(4, pp.ErrMalformed, "RTR PDU length %d is out of range", plen)
+	}
+	if int(plen) > len(buf) {
+		return 0, 0, 0, rtrErr(4, pp.ErrTruncated, "not enough bytes for RTR PDU of length %d", plen)
+	}
+	return buf[0], PDUType(buf[1]), int(plen), nil
+}
+
+// ParsePDU decodes the PDU at the start of buf and returns its version.
+func ParsePDU(buf []byte) (uint8, PDU, error) {
+	version, ptype, plen, err := ReadPDUHeader(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version > VERSION_2 {
+		return version, nil, rtrErr(0, pp.ErrUnsupported, "unsupported RTR version %d", version)
+	}
+	field := binary.BigEndian.Uint16(buf[2:4])
+	body := buf[RTR_HEADER_LEN:plen]
+	wantLen := func(n int) error {
+		if len(body) != n {
+			return rtrErr(4, pp.ErrMalformed, "%s PDU should be %d bytes long and it is %d", ptype, RTR_HEADER_LEN+n, plen)
+		}
+		return nil
+	}
+	switch ptype {
+	case SERIAL_NOTIFY, SERIAL_QUERY:
+		if err := wantLen(4); err != nil {
+			return version, nil, err
+		}
+		if ptype == SERIAL_NOTIFY {
+			return version, SerialNotify{field, binary.BigEndian.Uint32(body)}, nil
+		}
+		return version, SerialQuery{field, binary.BigEndian.Uint32(body)}, nil
+	case RESET_QUERY, CACHE_RESET:
+		if err := wantLen(0); err != nil {
+			return version, nil, err
+		}
+		if ptype == RESET_QUERY {
+			return version, ResetQuery{}, nil
+		}
+		return version, CacheReset{}, nil
+	case CACHE_RESPONSE:
+		if err := wantLen(0); err != nil {
+			return version, nil, err
+		}
+		return version, CacheResponse{field}, nil
+	case IPV4_PREFIX, IPV6_PREFIX:
+		alen := 4
+		if ptype == IPV6_PREFIX {
+			alen = 16
+		}
+		if err := wantLen(8 + alen); err != nil {
+			return version, nil, err
+		}
+		p := Prefix{Announce: body[0]&FLAG_ANNOUNCE != 0}
+		p.Length, p.MaxLength = body[1], body[2]
+		p.Prefix = copyIP(body[4 : 4+alen])
+		p.AS = binary.BigEndian.Uint32(body[4+alen:])
+		if int(p.Length) > alen*8 || p.MaxLength < p.Length || int(p.MaxLength) > alen*8 {
+			return version, nil, rtrErr(RTR_HEADER_LEN, pp.ErrMalformed, "bad prefix length %d or max length %d", p.Length, p.MaxLength)
+		}
+		p.Prefix = p.Prefix.Mask(net.CIDRMask(int(p.Length), alen*8))
+		return version, p, nil
+	case END_OF_DATA:
+		if version == VERSION_0 {
+			if err := wantLen(4); err != nil {
+				return version, nil, err
+			}
+			return version, EndOfData{SessionID: field, Serial: binary.BigEndian.Uint32(body)}, nil
+		}
+		if err := wantLen(16); err != nil {
+			return version, nil, err
+		}
+		return version, EndOfData{
+			SessionID: field,
+			Serial:    binary.BigEndian.Uint32(body[:4]),
+			Refresh:   binary.BigEndian.Uint32(body[4:8]),
+			Retry:     binary.BigEndian.Uint32(body[8:12]),
+			Expire:    binary.BigEndian.Uint32(body[12:16]),
+		}, nil
+	case ROUTER_KEY:
+		if version == VERSION_0 {
+			return version, nil, rtrErr(0, pp.ErrUnsupported, "router key PDU in RTR version 0")
+		}
+		if len(body) < 24 {
+			return version, nil, rtrErr(RTR_HEADER_LEN, pp.ErrTruncated, "not enough bytes for router key PDU")
+		}
+		p := RouterKeyPDU{Announce: buf[2]&FLAG_ANNOUNCE != 0}
+		copy(p.SKI[:], body[:20])
+		p.AS = binary.BigEndian.Uint32(body[20:24])
+		p.SPKI = append([]byte{}, body[24:]...)
+		return version, p, nil
+	case ERROR_REPORT:
+		if len(body) < 4 {
+			return version, nil, rtrErr(RTR_HEADER_LEN, pp.ErrTruncated, "not enough bytes for error report PDU length")
+		}
+		elen := int(binary.BigEndian.Uint32(body[:4]))
+		body = body[4:]
+		if elen > len(body)-4 {
+			return version, nil, rtrErr(RTR_HEADER_LEN+4, pp.ErrTruncated, "not enough bytes for encapsulated PDU of length %d", elen)
+		}
+		p := ErrorReport{Code: field, PDU: append([]byte{}, body[:elen]...)}
+		body = body[elen:]
+		tlen := int(binary.BigEndian.Uint32(body[:4]))
+		body = body[4:]
+		if tlen > len(body) {
+			return version, nil, rtrErr(RTR_HEADER_LEN+8+elen, pp.ErrTruncated, "not enough bytes for error text of length %d", tlen)
+		}
+		p.Text = string(body[:tlen])
+		return version, &p, nil
+	case ASPA_PDU:
+		if version < VERSION_2 {
+			return version, nil, rtrErr(0, pp.ErrUnsupported, "ASPA PDU in RTR version %d", version)
+		}
+		if len(body) < 4 || len(body)%4 != 0 {
+			return version, nil, rtrErr(RTR_HEADER_LEN, pp.ErrMalformed, "ASPA PDU length %d is not a customer AS and a list of providers", plen)
+		}
+		p := ASPAPDU{Announce: buf[2]&FLAG_ANNOUNCE != 0}
+		p.Customer = binary.BigEndian.Uint32(body[:4])
+		for body = body[4:]; len(body) > 0; body = body[4:] {
+			p.Providers = append(p.Providers, binary.BigEndian.Uint32(body[:4]))
+		}
+		if p.Announce && len(p.Providers) == 0 {
+			return version, nil, rtrErr(0, pp.ErrMalformed, "ASPA announcement without providers")
+		}
+		return version, p, nil
+	}
+	return version, nil, rtrErr(1, pp.ErrUnsupported, "unknown RTR PDU type %d", uint8(ptype))
+}
+
+// SplitRTR is a bufio.SplitFunc that splits a stream of RTR PDUs.
+func SplitRTR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if len(data) < RTR_HEADER_LEN {
+		if atEOF {
+			return 0, nil, rtrErr(0, pp.ErrTruncated, "stream ended in the middle of an RTR header")
+		}
+		return 0, nil, nil
+	}
+	plen := binary.BigEndian.Uint32(data[4:8])
+	if plen < RTR_HEADER_LEN || plen > MAX_PDU_LEN {
+		return 0, nil, rtrErr(4, pp.ErrMalformed, "RTR PDU length %d is out of range", plen)
+	}
+	if int(plen) > len(data) {
+		if atEOF {
+			return 0, nil, rtrErr(0, pp.ErrTruncated, "stream ended in the middle of an RTR PDU")
+		}
+		return 0, nil, nil
+	}
+	return int(plen), data[:plen], nil
+}
+
+func copyIP(buf []byte) net.IP {
+	ip := make(net.IP, len(buf))
+	copy(ip, buf)
+	return ip
+}
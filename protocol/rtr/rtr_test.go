@@ -0,0 +1,226 @@
+package rtr
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	ski := [20]byte{1, 2, 3}
+	pdus := []PDU{
+		SerialNotify{SessionID: 7, Serial: 42},
+		SerialQuery{SessionID: 7, Serial: 41},
+		ResetQuery{},
+		CacheResponse{SessionID: 7},
+		Prefix{Announce: true, VRP: VRP{Prefix: net.ParseIP("192.0.2.0").To4(), Length: 24, MaxLength: 24, AS: 64512}},
+		Prefix{VRP: VRP{Prefix: net.ParseIP("2001:db8::"), Length: 32, MaxLength: 48, AS: 64513}},
+		EndOfData{SessionID: 7, Serial: 42, Refresh: 10, Retry: 20, Expire: 30},
+		CacheReset{},
+		RouterKeyPDU{Announce: true, RouterKey: RouterKey{SKI: ski, AS: 64512, SPKI: []byte{0xde, 0xad}}},
+		&ErrorReport{Code: ERR_NO_DATA, PDU: ResetQuery{}.Encode(VERSION_2), Text: "no data"},
+		ASPAPDU{Announce: true, ASPA: ASPA{Customer: 64512, Providers: []uint32{3356, 174}}},
+	}
+	for _, p := range pdus {
+		buf := p.Encode(VERSION_2)
+		v, got, err := ParsePDU(buf)
+		if err != nil {
+			t.Errorf("%s: %s", p.Type(), err)
+			continue
+		}
+		if v != VERSION_2 || !reflect.DeepEqual(got, p) {
+			t.Errorf("%s: encoded %v and parsed %v", p.Type(), p, got)
+		}
+	}
+
+	// version 0 end of data has no timers, and ASPAs need version 2
+	if _, p, err := ParsePDU(EndOfData{SessionID: 1, Serial: 2, Refresh: 3}.Encode(VERSION_0)); err != nil || p != (EndOfData{SessionID: 1, Serial: 2}) {
+		t.Errorf("bad version 0 end of data %v %v", p, err)
+	}
+	if _, _, err := ParsePDU(ASPAPDU{Announce: true, ASPA: ASPA{Customer: 1, Providers: []uint32{2}}}.Encode(VERSION_1)); err == nil {
+		t.Errorf("ASPA PDU parsed in version 1")
+	}
+	bad := Prefix{Announce: true, VRP: VRP{Prefix: net.ParseIP("10.0.0.0").To4(), Length: 24, MaxLength: 8}}.Encode(VERSION_1)
+	if _, _, err := ParsePDU(bad); err == nil {
+		t.Errorf("prefix with max length shorter than length parsed")
+	}
+	if _, _, err := ParsePDU(bad[:10]); err == nil {
+		t.Errorf("truncated PDU parsed")
+	}
+}
+
+// cache is a stand-in for an RTR cache. It calls handle with the PDUs
+// routers send, and the version they were sent with.
+type cache struct {
+	ln      net.Listener
+	handle  func(conn net.Conn, version uint8, p PDU)
+	conns   chan net.Conn
+	reports chan *ErrorReport
+}
+
+func newCache(t *testing.T, handle func(conn net.Conn, version uint8, p PDU)) *cache {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &cache{ln: ln, handle: handle, conns: make(chan net.Conn, 10), reports: make(chan *ErrorReport, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.conns <- conn
+			go c.serve(conn)
+		}
+	}()
+	return c
+}
+
+func (c *cache) serve(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(SplitRTR)
+	for scanner.Scan() {
+		v, p, err := ParsePDU(scanner.Bytes())
+		if err != nil {
+			return
+		}
+		if rep, ok := p.(*ErrorReport); ok {
+			c.reports <- rep
+			continue
+		}
+		c.handle(conn, v, p)
+	}
+}
+
+func send(conn net.Conn, version uint8, pdus ...PDU) {
+	for _, p := range pdus {
+		conn.Write(p.Encode(version))
+	}
+}
+
+func vrp(prefix string, maxlen uint8, as uint32) VRP {
+	_, n, _ := net.ParseCIDR(prefix)
+	l, _ := n.Mask.Size()
+	return VRP{Prefix: n.IP, Length: uint8(l), MaxLength: maxlen, AS: as}
+}
+
+func vrpStrings(vrps []VRP) string {
+	s := []string{}
+	for _, v := range vrps {
+		s = append(s, v.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestClient(t *testing.T) {
+	const session = 7
+	cc := newCache(t, func(conn net.Conn, v uint8, p PDU) {
+		switch q := p.(type) {
+		case ResetQuery:
+			send(conn, v,
+				CacheResponse{session},
+				Prefix{true, vrp("10.0.0.0/8", 16, 64512)},
+				Prefix{true, vrp("192.0.2.0/24", 24, 64513)},
+				Prefix{true, vrp("2001:db8::/32", 48, 64512)},
+				RouterKeyPDU{true, RouterKey{SKI: [20]byte{9}, AS: 64512, SPKI: []byte{1}}},
+				ASPAPDU{true, ASPA{Customer: 64512, Providers: []uint32{3356}}},
+				EndOfData{session, 1, 3600, 600, 7200})
+		case SerialQuery:
+			if q.SessionID != session || q.Serial != 1 {
+				send(conn, v, CacheReset{})
+				return
+			}
+			send(conn, v,
+				CacheResponse{session},
+				Prefix{false, vrp("192.0.2.0/24", 24, 64513)},
+				Prefix{true, vrp("198.51.100.0/24", 24, 64514)},
+				ASPAPDU{true, ASPA{Customer: 64512, Providers: []uint32{3356, 174}}},
+				EndOfData{session, 2, 3600, 600, 7200})
+		}
+	})
+	defer cc.ln.Close()
+
+	c := NewClient(cc.ln.Addr().String())
+	updates := make(chan uint32, 10)
+	c.OnUpdate = func(c *Client) {
+		_, serial, _ := c.Serial()
+		updates <- serial
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-updates
+	if got := vrpStrings(c.VRPs()); got != "10.0.0.0/8-16 AS64512, 192.0.2.0/24-24 AS64513, 2001:db8::/32-48 AS64512" {
+		t.Errorf("bad VRPs after reset query: %s", got)
+	}
+	if len(c.RouterKeys()) != 1 || len(c.ASPAs()) != 1 {
+		t.Errorf("expected 1 router key and 1 ASPA, got %v %v", c.RouterKeys(), c.ASPAs())
+	}
+
+	// the cache notifies the client of serial 2, which asks for the changes
+	send(<-cc.conns, VERSION_2, SerialNotify{session, 2})
+	if serial := <-updates; serial != 2 {
+		t.Fatalf("expected serial 2, got %d", serial)
+	}
+	if got := vrpStrings(c.VRPs()); got != "10.0.0.0/8-16 AS64512, 198.51.100.0/24-24 AS64514, 2001:db8::/32-48 AS64512" {
+		t.Errorf("bad VRPs after serial query: %s", got)
+	}
+	if a := c.ASPAs(); len(a) != 1 || !reflect.DeepEqual(a[0].Providers, []uint32{174, 3356}) {
+		t.Errorf("bad ASPAs after serial query: %v", a)
+	}
+	if v := c.NegotiatedVersion(); v != VERSION_2 {
+		t.Errorf("expected version 2, got %d", v)
+	}
+}
+
+func TestClientVersionFallback(t *testing.T) {
+	cc := newCache(t, func(conn net.Conn, v uint8, p PDU) {
+		if v > VERSION_1 {
+			send(conn, VERSION_1, &ErrorReport{Code: ERR_UNSUPPORTED_VERSION, PDU: p.Encode(v)})
+			conn.Close()
+			return
+		}
+		send(conn, v, CacheResponse{1}, Prefix{true, vrp("10.0.0.0/8", 8, 64512)}, EndOfData{1, 1, 3600, 600, 7200})
+	})
+	defer cc.ln.Close()
+
+	c := NewClient(cc.ln.Addr().String())
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if v := c.NegotiatedVersion(); v != VERSION_1 {
+		t.Errorf("expected version 1, got %d", v)
+	}
+	if len(c.VRPs()) != 1 {
+		t.Errorf("expected 1 VRP, got %v", c.VRPs())
+	}
+}
+
+func TestClientDuplicateAnnounce(t *testing.T) {
+	cc := newCache(t, func(conn net.Conn, v uint8, p PDU) {
+		pfx := Prefix{true, vrp("10.0.0.0/8", 8, 64512)}
+		send(conn, v, CacheResponse{1}, pfx, pfx, EndOfData{1, 1, 3600, 600, 7200})
+	})
+	defer cc.ln.Close()
+
+	c := NewClient(cc.ln.Addr().String())
+	err := c.Start()
+	var rep *ErrorReport
+	if !errors.As(err, &rep) || rep.Code != ERR_DUPLICATE_ANNOUNCE {
+		t.Fatalf("expected a duplicate announcement error, got %v", err)
+	}
+	// the client reports the error to the cache too
+	if rep := <-cc.reports; rep.Code != ERR_DUPLICATE_ANNOUNCE {
+		t.Errorf("cache got error report %v", rep)
+	}
+	if len(c.VRPs()) != 0 {
+		t.Errorf("data of a failed response was kept: %v", c.VRPs())
+	}
+}
@@ -0,0 +1,212 @@
+package rtr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// VRP is a validated ROA payload: AS may originate Prefix/Length and its
+// more specifics up to MaxLength.
+type VRP struct {
+	Prefix    net.IP `json:"prefix"`
+	Length    uint8  `json:"length"`
+	MaxLength uint8  `json:"max_length"`
+	AS        uint32 `json:"asn"`
+}
+
+func (v VRP) String() string {
+	return fmt.Sprintf("%s/%d-%d AS%d", v.Prefix, v.Length, v.MaxLength, v.AS)
+}
+
+// IPNet returns the prefix of the VRP.
+func (v VRP) IPNet() *net.IPNet {
+	bits := 128
+	if v.Prefix.To4() != nil {
+		bits = 32
+	}
+	return &net.IPNet{IP: v.Prefix, Mask: net.CIDRMask(int(v.Length), bits)}
+}
+
+type vrpKey struct {
+	prefix    [16]byte
+	v4        bool
+	length    uint8
+	maxLength uint8
+	as        uint32
+}
+
+func (v VRP) key() vrpKey {
+	k := vrpKey{length: v.Length, maxLength: v.MaxLength, as: v.AS}
+	if ip := v.Prefix.To4(); ip != nil {
+		k.v4 = true
+		copy(k.prefix[:], ip)
+	} else {
+		copy(k.prefix[:], v.Prefix.To16())
+	}
+	return k
+}
+
+// RouterKey is a BGPsec router key.
+type RouterKey struct {
+	SKI  [20]byte `json:"ski"`
+	AS   uint32   `json:"asn"`
+	SPKI []byte   `json:"spki"`
+}
+
+func (k RouterKey) String() string {
+	return fmt.Sprintf("AS%d SKI %s", k.AS, hex.EncodeToString(k.SKI[:]))
+}
+
+type routerKeyKey struct {
+	ski  [20]byte
+	as   uint32
+	spki string
+}
+
+func (k RouterKey) key() routerKeyKey {
+	return routerKeyKey{k.SKI, k.AS, string(k.SPKI)}
+}
+
+// ASPA lists the providers of a customer AS.
+type ASPA struct {
+	Customer  uint32   `json:"customer_asid"`
+	Providers []uint32 `json:"providers"`
+}
+
+func (a ASPA) String() string {
+	return fmt.Sprintf("AS%d providers %v", a.Customer, a.Providers)
+}
+
+// Set is the data of an RTR cache at a serial. It is not safe for
+// concurrent use; a Client hands out copies.
+type Set struct {
+	vrps  map[vrpKey]VRP
+	keys  map[routerKeyKey]RouterKey
+	aspas map[uint32]ASPA
+}
+
+// NewSet creates an empty set.
+func NewSet() *Set {
+	return &Set{
+		vrps:  make(map[vrpKey]VRP),
+		keys:  make(map[routerKeyKey]RouterKey),
+		aspas: make(map[uint32]ASPA),
+	}
+}
+
+func (s *Set) clone() *Set {
+	c := NewSet()
+	for k, v := range s.vrps {
+		c.vrps[k] = v
+	}
+	for k, v := range s.keys {
+		c.keys[k] = v
+	}
+	for k, v := range s.aspas {
+		c.aspas[k] = v
+	}
+	return c
+}
+
+// Apply adds an announcement or removes a withdrawal of a prefix, router
+// key or ASPA PDU. Announcing a record already in the set or withdrawing
+// one that isn't returns the error report a router sends for it. An ASPA
+// announcement replaces the providers of the customer.
+func (s *Set) Apply(p PDU) *ErrorReport {
+	switch p := p.(type) {
+	case Prefix:
+		k := p.key()
+		_, ok := s.vrps[k]
+		switch {
+		case p.Announce && ok:
+			return &ErrorReport{Code: ERR_DUPLICATE_ANNOUNCE, Text: p.VRP.String()}
+		case !p.Announce && !ok:
+			return &ErrorReport{Code: ERR_WITHDRAWAL_UNKNOWN, Text: p.VRP.String()}
+		case p.Announce:
+			s.vrps[k] = p.VRP
+		default:
+			delete(s.vrps, k)
+		}
+	case RouterKeyPDU:
+		k := p.key()
+		_, ok := s.keys[k]
+		switch {
+		case p.Announce && ok:
+			return &ErrorReport{Code: ERR_DUPLICATE_ANNOUNCE, Text: p.RouterKey.String()}
+		case !p.Announce && !ok:
+			return &ErrorReport{Code: ERR_WITHDRAWAL_UNKNOWN, Text: p.RouterKey.String()}
+		case p.Announce:
+			s.keys[k] = p.RouterKey
+		default:
+			delete(s.keys, k)
+		}
+	case ASPAPDU:
+		_, ok := s.aspas[p.Customer]
+		switch {
+		case !p.Announce && !ok:
+			return &ErrorReport{Code: ERR_WITHDRAWAL_UNKNOWN, Text: p.ASPA.String()}
+		case p.Announce:
+			providers := append([]uint32{}, p.Providers...)
+			sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+			s.aspas[p.Customer] = ASPA{Customer: p.Customer, Providers: providers}
+		default:
+			delete(s.aspas, p.Customer)
+		}
+	}
+	return nil
+}
+
+// VRPs returns the VRPs of the set ordered by prefix.
+func (s *Set) VRPs() []VRP {
+	ret := make([]VRP, 0, len(s.vrps))
+	for _, v := range s.vrps {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if c := bytes.Compare(a.Prefix.To16(), b.Prefix.To16()); c != 0 {
+			return c < 0
+		}
+		if a.Length != b.Length {
+			return a.Length < b.Length
+		}
+		if a.MaxLength != b.MaxLength {
+			return a.MaxLength < b.MaxLength
+		}
+		return a.AS < b.AS
+	})
+	return ret
+}
+
+// RouterKeys returns the router keys of the set ordered by AS.
+func (s *Set) RouterKeys() []RouterKey {
+	ret := make([]RouterKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].AS != ret[j].AS {
+			return ret[i].AS < ret[j].AS
+		}
+		return bytes.Compare(ret[i].SKI[:], ret[j].SKI[:]) < 0
+	})
+	return ret
+}
+
+// ASPAs returns the ASPAs of the set ordered by customer AS.
+func (s *Set) ASPAs() []ASPA {
+	ret := make([]ASPA, 0, len(s.aspas))
+	for _, a := range s.aspas {
+		ret = append(ret, a)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Customer < ret[j].Customer })
+	return ret
+}
+
+// Len returns the number of VRPs, router keys and ASPAs in the set.
+func (s *Set) Len() int {
+	return len(s.vrps) + len(s.keys) + len(s.aspas)
+}
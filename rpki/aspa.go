@@ -0,0 +1,319 @@
+package rpki
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	"github.com/CSUNetSec/protoparse/protocol/rtr"
+)
+
+// ASPAState is the ASPA verification state of an AS path
+// (draft-ietf-sidrops-aspa-verification).
+type ASPAState uint8
+
+const (
+	ASPA_UNKNOWN = ASPAState(iota)
+	ASPA_VALID
+	ASPA_INVALID
+)
+
+var aspaStateNames = map[ASPAState]string{
+	ASPA_UNKNOWN: "unknown",
+	ASPA_VALID:   "valid",
+	ASPA_INVALID: "invalid",
+}
+
+func (s ASPAState) String() string {
+	if n, ok := aspaStateNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+func (s ASPAState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseASPAState returns the state named "valid", "invalid" or "unknown".
+func ParseASPAState(name string) (ASPAState, error) {
+	for s, n := range aspaStateNames {
+		if strings.EqualFold(name, n) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ASPA verification state %q", name)
+}
+
+// ASPADirection says how a path was received. Upstream paths come from
+// customers and lateral peers and must only go up from customers to
+// providers. Downstream paths come from providers and may go up and then
+// down once.
+type ASPADirection uint8
+
+const (
+	ASPA_UPSTREAM = ASPADirection(iota)
+	ASPA_DOWNSTREAM
+)
+
+func (d ASPADirection) String() string {
+	if d == ASPA_DOWNSTREAM {
+		return "downstream"
+	}
+	return "upstream"
+}
+
+func (d ASPADirection) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// ASPAResult is the ASPA verification of the path of an update.
+type ASPAResult struct {
+	State     ASPAState     `json:"state"`
+	Direction ASPADirection `json:"direction"`
+}
+
+// hop is the result of checking if an AS is a provider of another.
+type hop uint8
+
+const (
+	hopNoAttestation = hop(iota)
+	hopProvider
+	hopNotProvider
+)
+
+// ASPAValidator verifies AS paths with a set of ASPAs. It is safe for
+// concurrent use and its ASPAs can be replaced while it is used.
+type ASPAValidator struct {
+	// Upstream lists the peer ASes whose paths are verified as upstream.
+	// Paths of other peers are verified as downstream, since collectors
+	// get full tables from their peers like customers do. It must not be
+	// changed while the validator is used.
+	Upstream map[uint32]bool
+
+	mu        sync.RWMutex
+	providers map[uint32]map[uint32]bool
+}
+
+// NewASPAValidator creates a validator with the ASPAs aspas.
+func NewASPAValidator(aspas []rtr.ASPA) *ASPAValidator {
+	v := &ASPAValidator{Upstream: make(map[uint32]bool)}
+	v.Update(aspas)
+	return v
+}
+
+// Update replaces the ASPAs of the validator.
+func (v *ASPAValidator) Update(aspas []rtr.ASPA) {
+	providers := make(map[uint32]map[uint32]bool, len(aspas))
+	for _, a := range aspas {
+		set := providers[a.Customer]
+		if set == nil {
+			set = make(map[uint32]bool, len(a.Providers))
+			providers[a.Customer] = set
+		}
+		for _, p := range a.Providers {
+			set[p] = true
+		}
+	}
+	v.mu.Lock()
+	v.providers = providers
+	v.mu.Unlock()
+}
+
+// Len returns the number of customer ASes with an ASPA.
+func (v *ASPAValidator) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.providers)
+}
+
+func (v *ASPAValidator) hop(customer, provider uint32) hop {
+	set, ok := v.providers[customer]
+	if !ok {
+		return hopNoAttestation
+	}
+	if set[provider] {
+		return hopProvider
+	}
+	return hopNotProvider
+}
+
+// Verify verifies a path, with the neighbor AS first and the origin last
+// like in the AS_PATH attribute, that has no AS_SETs.
+func (v *ASPAValidator) Verify(path []uint32, dir ASPADirection) ASPAState {
+	// the draft numbers the path from the origin, AS(1), to the
+	// neighbor, AS(N), without prepends
+	as := []uint32{}
+	for i := len(path) - 1; i >= 0; i-- {
+		if len(as) == 0 || as[len(as)-1] != path[i] {
+			as = append(as, path[i])
+		}
+	}
+	n := len(as)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	// the longest and shortest up ramps from the origin: the first hop
+	// that isn't to a provider ends the shortest one, the first hop that
+	// is attested to not be to a provider the longest one.
+	maxUp, minUp := n, n
+	for i := 0; i < n-1; i++ {
+		h := v.hop(as[i], as[i+1])
+		if h != hopProvider && minUp == n {
+			minUp = i + 1
+		}
+		if h == hopNotProvider {
+			maxUp = i + 1
+			break
+		}
+	}
+	if dir == ASPA_UPSTREAM {
+		switch {
+		case maxUp < n:
+			return ASPA_INVALID
+		case minUp < n:
+			return ASPA_UNKNOWN
+		}
+		return ASPA_VALID
+	}
+
+	// and the down ramps from the neighbor
+	maxDown, minDown := n, n
+	for j := n - 1; j > 0; j-- {
+		h := v.hop(as[j], as[j-1])
+		if h != hopProvider && minDown == n {
+			minDown = n - j
+		}
+		if h == hopNotProvider {
+			maxDown = n - j
+			break
+		}
+	}
+	switch {
+	case maxUp+maxDown < n:
+		return ASPA_INVALID
+	case minUp+minDown < n:
+		return ASPA_UNKNOWN
+	}
+	return ASPA_VALID
+}
+
+// verifyAttrs verifies the AS_PATH of attrs. Paths with AS_SETs are
+// invalid.
+func (v *ASPAValidator) verifyAttrs(attrs *pbbgp.BGPUpdate_Attributes, dir ASPADirection) ASPAState {
+	if attrs == nil {
+		return ASPA_UNKNOWN
+	}
+	path := []uint32{}
+	for _, seg := range attrs.ASPath {
+		if len(seg.ASSet) > 0 {
+			return ASPA_INVALID
+		}
+		path = append(path, seg.ASSeq...)
+	}
+	return v.Verify(path, dir)
+}
+
+func (v *ASPAValidator) direction(peerAS uint32) ASPADirection {
+	if v.Upstream[peerAS] {
+		return ASPA_UPSTREAM
+	}
+	return ASPA_DOWNSTREAM
+}
+
+// ValidateStack verifies the path of an update, or the paths of the
+// entries of a RIB with the worst state of them. It returns nil if no
+// prefixes are advertised.
+func (v *ASPAValidator) ValidateStack(mbs *mrt.MrtBufferStack) (*ASPAResult, error) {
+	routes, err := stackRoutes(mbs)
+	if err != nil || len(routes) == 0 {
+		return nil, err
+	}
+	dir := ASPA_DOWNSTREAM
+	if !mbs.IsRibStack() {
+		if hdr := mbs.Bgp4mpbuf.(protoparse.BGP4MPHeaderer).GetHeader(); hdr != nil {
+			dir = v.direction(hdr.Peer_AS)
+		}
+		return &ASPAResult{State: v.verifyAttrs(routes[0].attrs, dir), Direction: dir}, nil
+	}
+	res := &ASPAResult{State: ASPA_VALID, Direction: dir}
+	for _, r := range routes {
+		s := v.verifyAttrs(r.attrs, dir)
+		if s == ASPA_INVALID || (s == ASPA_UNKNOWN && res.State == ASPA_VALID) {
+			res.State = s
+		}
+	}
+	return res, nil
+}
+
+// Annotate adds the verification of the path of a capture to it, if it
+// advertises prefixes.
+func (v *ASPAValidator) Annotate(c *AnnotatedCapture) {
+	if c.BGPCapture == nil || len(updateRoutes(c.Update)) == 0 {
+		return
+	}
+	dir := v.direction(c.Peer_AS)
+	c.ASPA = &ASPAResult{State: v.verifyAttrs(c.Update.Attrs, dir), Direction: dir}
+}
+
+// ReadASPAs reads ASPAs in the JSON export format of RPKI validators:
+//
+//	{"aspas":[{"customer_asid":64496,"providers":[64497,64498]},...]}
+//
+// The customer can also be named customer and the providers
+// provider_set, and ASNs can be strings with an "AS" prefix.
+func ReadASPAs(r io.Reader) ([]rtr.ASPA, error) {
+	exp := struct {
+		ASPAs []struct {
+			CustomerASID json.RawMessage   `json:"customer_asid"`
+			Customer     json.RawMessage   `json:"customer"`
+			Providers    []json.RawMessage `json:"providers"`
+			ProviderSet  []json.RawMessage `json:"provider_set"`
+		} `json:"aspas"`
+	}{}
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		return nil, fmt.Errorf("malformed ASPA export: %w", err)
+	}
+	ret := make([]rtr.ASPA, 0, len(exp.ASPAs))
+	for i, a := range exp.ASPAs {
+		raw := a.CustomerASID
+		if raw == nil {
+			raw = a.Customer
+		}
+		customer, err := parseASN(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ASPA %d: %w", i, err)
+		}
+		aspa := rtr.ASPA{Customer: customer}
+		for _, p := range append(a.Providers, a.ProviderSet...) {
+			as, err := parseASN(p)
+			if err != nil {
+				return nil, fmt.Errorf("ASPA %d: %w", i, err)
+			}
+			aspa.Providers = append(aspa.Providers, as)
+		}
+		ret = append(ret, aspa)
+	}
+	return ret, nil
+}
+
+// NewASPAValidatorFromFile creates a validator with the ASPAs of a JSON
+// export.
+func NewASPAValidatorFromFile(fname string) (*ASPAValidator, error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	aspas, err := ReadASPAs(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return NewASPAValidator(aspas), nil
+}
@@ -0,0 +1,101 @@
+package rpki
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+const aspaJSON = `{"aspas":[
+{"customer_asid":64500,"providers":[64510]},
+{"customer_asid":64510,"providers":[64520]},
+{"customer_asid":64520,"providers":[0]},
+{"customer":"AS64530","provider_set":["AS64520"]},
+{"customer_asid":64540,"providers":["64530"]},
+{"customer_asid":64550,"providers":[64560]}]}`
+
+func testASPAValidator(t *testing.T) *ASPAValidator {
+	aspas, err := ReadASPAs(strings.NewReader(aspaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aspas) != 6 || aspas[3].Customer != 64530 || aspas[3].Providers[0] != 64520 {
+		t.Fatalf("bad ASPAs %v", aspas)
+	}
+	return NewASPAValidator(aspas)
+}
+
+func parsePath(s string) []uint32 {
+	path := []uint32{}
+	for _, f := range strings.Fields(s) {
+		as, _ := strconv.ParseUint(f, 10, 32)
+		path = append(path, uint32(as))
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	v := testASPAValidator(t)
+	cases := []struct {
+		path  string
+		dir   ASPADirection
+		state ASPAState
+	}{
+		{"64510 64500", ASPA_UPSTREAM, ASPA_VALID},
+		{"64510 64510 64500 64500", ASPA_UPSTREAM, ASPA_VALID},
+		{"64520 64510 64500", ASPA_UPSTREAM, ASPA_VALID},
+		{"64530 64520 64510 64500", ASPA_UPSTREAM, ASPA_INVALID}, //64530 isn't a provider of 64520
+		{"64510 64598", ASPA_UPSTREAM, ASPA_UNKNOWN},
+		{"64599 64500", ASPA_UPSTREAM, ASPA_INVALID},
+		{"64540 64530 64520 64510 64500", ASPA_DOWNSTREAM, ASPA_VALID}, //up to 64520 and down
+		{"64550 64500 64510 64520", ASPA_DOWNSTREAM, ASPA_INVALID},     //64500 leaks its provider's route
+		{"64597 64598 64510 64520", ASPA_DOWNSTREAM, ASPA_UNKNOWN},
+		{"64530 64520", ASPA_DOWNSTREAM, ASPA_VALID},
+	}
+	for _, c := range cases {
+		if s := v.Verify(parsePath(c.path), c.dir); s != c.state {
+			t.Errorf("%s path %s: expected %s, got %s", c.dir, c.path, c.state, s)
+		}
+	}
+}
+
+func TestVerifyUpdates(t *testing.T) {
+	v := testASPAValidator(t)
+	v.Upstream[64520] = true
+	updates := []struct {
+		peer uint32
+		path string
+		want string
+	}{
+		{64520, "64520 64510 64500", `{"state":"valid","direction":"upstream"}`},
+		{64530, "64530 64520 64510 64500", `{"state":"valid","direction":"downstream"}`},
+		{64520, "64520 {64510,64500}", `{"state":"invalid","direction":"upstream"}`},
+	}
+	for i, e := range updates {
+		rec := updateRecord(e.peer, nil, pathAttrs(e.path), nlri("10.0.0.0/8"))
+		mbs, err := mrt.ParseHeaders(rec, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := v.ValidateStack(mbs)
+		if err != nil || res == nil {
+			t.Fatalf("update %d: no result %v", i, err)
+		}
+		if got, _ := json.Marshal(res); string(got) != e.want {
+			t.Errorf("update %d: expected %s, got %s", i, e.want, got)
+		}
+
+		c, err := mrt.MrtToBGPCapturev2(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ac := NewAnnotatedCapture(c)
+		v.Annotate(ac)
+		if got, _ := json.Marshal(ac.ASPA); string(got) != e.want {
+			t.Errorf("update %d: expected annotation %s, got %s", i, e.want, got)
+		}
+	}
+}
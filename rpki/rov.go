@@ -0,0 +1,269 @@
+package rpki
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	"github.com/CSUNetSec/protoparse/protocol/rtr"
+	util "github.com/CSUNetSec/protoparse/util"
+	radix "github.com/armon/go-radix"
+)
+
+// ROVState is the origin validation state of a route (RFC6811).
+type ROVState uint8
+
+const (
+	ROV_NOTFOUND = ROVState(iota)
+	ROV_VALID
+	ROV_INVALID
+)
+
+var rovStateNames = map[ROVState]string{
+	ROV_NOTFOUND: "not-found",
+	ROV_VALID:    "valid",
+	ROV_INVALID:  "invalid",
+}
+
+func (s ROVState) String() string {
+	if n, ok := rovStateNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+func (s ROVState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseROVState returns the state named "valid", "invalid" or "not-found".
+func ParseROVState(name string) (ROVState, error) {
+	for s, n := range rovStateNames {
+		if strings.EqualFold(name, n) || strings.EqualFold(name, strings.Replace(n, "-", "", 1)) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown origin validation state %q", name)
+}
+
+// RouteValidity is the origin validation state of an advertised prefix.
+type RouteValidity struct {
+	Prefix string   `json:"prefix"`
+	Origin uint32   `json:"origin_as,omitempty"`
+	State  ROVState `json:"state"`
+}
+
+// ROVResult is the origin validation of all the prefixes of an update.
+// State is the worst state of a prefix: invalid, then not found.
+type ROVResult struct {
+	State  ROVState        `json:"state"`
+	Routes []RouteValidity `json:"routes"`
+}
+
+// Has reports whether a prefix of the update is in state s.
+func (r *ROVResult) Has(s ROVState) bool {
+	for _, rv := range r.Routes {
+		if rv.State == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ROV validates route origins with a set of VRPs. It is safe for
+// concurrent use and its VRPs can be replaced while it is used.
+type ROV struct {
+	mu  sync.RWMutex
+	v4  *radix.Tree
+	v6  *radix.Tree
+	len int
+}
+
+// NewROV creates a validator with the VRPs vrps.
+func NewROV(vrps []rtr.VRP) *ROV {
+	v := &ROV{}
+	v.Update(vrps)
+	return v
+}
+
+// Update replaces the VRPs of the validator.
+func (v *ROV) Update(vrps []rtr.VRP) {
+	v4, v6 := radix.New(), radix.New()
+	for _, vrp := range vrps {
+		t := v6
+		if vrp.Prefix.To4() != nil {
+			t = v4
+		}
+		key := util.IPToRadixkey(vrp.Prefix, vrp.Length)
+		old, _ := t.Get(key)
+		covering, _ := old.([]rtr.VRP)
+		t.Insert(key, append(covering, vrp))
+	}
+	v.mu.Lock()
+	v.v4, v.v6, v.len = v4, v6, len(vrps)
+	v.mu.Unlock()
+}
+
+// FollowRTR returns a validator that is updated with the VRPs of an RTR
+// client each time they change. It must be called before the client is
+// started, and it calls the OnUpdate function the client already had.
+func FollowRTR(c *rtr.Client) *ROV {
+	v := NewROV(c.VRPs())
+	prev := c.OnUpdate
+	c.OnUpdate = func(c *rtr.Client) {
+		v.Update(c.VRPs())
+		if prev != nil {
+			prev(c)
+		}
+	}
+	return v
+}
+
+// Len returns the number of VRPs of the validator.
+func (v *ROV) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.len
+}
+
+// Validate returns the state of the prefix ip/mask originated by origin.
+// A route is valid if a VRP covering it has its origin and a max length
+// that is at least the length of the prefix, invalid if VRPs cover it but
+// none matches, and not found if no VRP covers it. Routes whose origin
+// is unknown (hasOrigin false) can't be valid.
+func (v *ROV) Validate(ip net.IP, mask uint8, origin uint32, hasOrigin bool) ROVState {
+	v.mu.RLock()
+	t := v.v6
+	if ip.To4() != nil {
+		t = v.v4
+	}
+	v.mu.RUnlock()
+	key := util.IPToRadixkey(ip, mask)
+	if key == "" && mask != 0 {
+		return ROV_NOTFOUND
+	}
+	state := ROV_NOTFOUND
+	t.WalkPath(key, func(_ string, val interface{}) bool {
+		for _, vrp := range val.([]rtr.VRP) {
+			state = ROV_INVALID
+			// AS0 VRPs (RFC6483) cover prefixes but never match them
+			if hasOrigin && vrp.AS != 0 && vrp.AS == origin && mask <= vrp.MaxLength {
+				state = ROV_VALID
+				return true
+			}
+		}
+		return false
+	})
+	return state
+}
+
+func (v *ROV) validateRoutes(routes []route) *ROVResult {
+	if len(routes) == 0 {
+		return nil
+	}
+	res := &ROVResult{State: ROV_VALID}
+	for _, r := range routes {
+		origin, ok := originAS(r.attrs)
+		rv := RouteValidity{Prefix: r.String(), Origin: origin, State: v.Validate(r.IP, r.Mask, origin, ok)}
+		res.Routes = append(res.Routes, rv)
+		if rv.State == ROV_INVALID || (rv.State == ROV_NOTFOUND && res.State == ROV_VALID) {
+			res.State = rv.State
+		}
+	}
+	return res
+}
+
+// ValidateStack validates the prefixes advertised in an update or a RIB
+// entry. It returns nil if none are.
+func (v *ROV) ValidateStack(mbs *mrt.MrtBufferStack) (*ROVResult, error) {
+	routes, err := stackRoutes(mbs)
+	if err != nil {
+		return nil, err
+	}
+	return v.validateRoutes(routes), nil
+}
+
+// Annotate adds the validation of the prefixes advertised in a capture to
+// it.
+func (v *ROV) Annotate(c *AnnotatedCapture) {
+	if c.BGPCapture != nil {
+		c.ROV = v.validateRoutes(updateRoutes(c.Update))
+	}
+}
+
+// vrpExport is the JSON export of VRPs of validators like rpki-client,
+// Routinator and OctoRPKI.
+type vrpExport struct {
+	ROAs []struct {
+		Prefix    string          `json:"prefix"`
+		MaxLength uint8           `json:"maxLength"`
+		ASN       json.RawMessage `json:"asn"`
+	} `json:"roas"`
+}
+
+// parseASN parses an AS number that is a JSON number or a string, with or
+// without an "AS" prefix.
+func parseASN(raw json.RawMessage) (uint32, error) {
+	s := strings.Trim(string(raw), `"`)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	as, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed ASN %s", raw)
+	}
+	return uint32(as), nil
+}
+
+// ReadVRPs reads VRPs in the JSON export format of RPKI validators:
+//
+//	{"roas":[{"prefix":"192.0.2.0/24","maxLength":24,"asn":"AS64496"},...]}
+//
+// The ASN can be a number, and a missing max length is the prefix length.
+func ReadVRPs(r io.Reader) ([]rtr.VRP, error) {
+	exp := vrpExport{}
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		return nil, fmt.Errorf("malformed VRP export: %w", err)
+	}
+	ret := make([]rtr.VRP, 0, len(exp.ROAs))
+	for i, roa := range exp.ROAs {
+		_, n, err := net.ParseCIDR(roa.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("ROA %d: %w", i, err)
+		}
+		as, err := parseASN(roa.ASN)
+		if err != nil {
+			return nil, fmt.Errorf("ROA %d: %w", i, err)
+		}
+		ones, bits := n.Mask.Size()
+		vrp := rtr.VRP{Prefix: n.IP, Length: uint8(ones), MaxLength: roa.MaxLength, AS: as}
+		if vrp.MaxLength == 0 {
+			vrp.MaxLength = vrp.Length
+		}
+		if vrp.MaxLength < vrp.Length || int(vrp.MaxLength) > bits {
+			return nil, fmt.Errorf("ROA %d: bad max length %d for %s", i, roa.MaxLength, roa.Prefix)
+		}
+		ret = append(ret, vrp)
+	}
+	return ret, nil
+}
+
+// NewROVFromFile creates a validator with the VRPs of a JSON export.
+func NewROVFromFile(fname string) (*ROV, error) {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	vrps, err := ReadVRPs(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return NewROV(vrps), nil
+}
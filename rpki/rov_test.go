@@ -0,0 +1,155 @@
+package rpki
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CSUNetSec/protoparse/protocol/bgp"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+const vrpJSON = `{"metadata":{"generated":1700000000},"roas":[
+{"prefix":"10.0.0.0/8","maxLength":16,"asn":"AS64512","ta":"test"},
+{"prefix":"10.1.0.0/16","maxLength":24,"asn":64513},
+{"prefix":"192.0.2.0/24","asn":"AS0"},
+{"prefix":"2001:db8::/32","maxLength":48,"asn":"64514"}]}`
+
+func testROV(t *testing.T) *ROV {
+	vrps, err := ReadVRPs(strings.NewReader(vrpJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vrps) != 4 || vrps[2].MaxLength != 24 || vrps[1].AS != 64513 {
+		t.Fatalf("bad VRPs %v", vrps)
+	}
+	return NewROV(vrps)
+}
+
+func TestValidate(t *testing.T) {
+	v := testROV(t)
+	cases := []struct {
+		prefix    string
+		origin    uint32
+		hasOrigin bool
+		state     ROVState
+	}{
+		{"10.0.0.0/8", 64512, true, ROV_VALID},
+		{"10.2.0.0/16", 64512, true, ROV_VALID},
+		{"10.2.3.0/24", 64512, true, ROV_INVALID}, //too specific
+		{"10.1.2.0/24", 64513, true, ROV_VALID},   //the second VRP covers it
+		{"10.1.2.0/24", 64512, true, ROV_INVALID},
+		{"10.0.0.0/8", 0, false, ROV_INVALID},
+		{"192.0.2.0/24", 0, true, ROV_INVALID}, //AS0
+		{"198.51.100.0/24", 64512, true, ROV_NOTFOUND},
+		{"2001:db8:1::/48", 64514, true, ROV_VALID},
+		{"2001:db8:1::/56", 64514, true, ROV_INVALID},
+		{"2001:db9::/32", 64514, true, ROV_NOTFOUND},
+		{"0a00::/8", 64512, true, ROV_NOTFOUND}, //not covered by 10/8
+	}
+	for _, c := range cases {
+		_, n, _ := net.ParseCIDR(c.prefix)
+		ones, _ := n.Mask.Size()
+		if s := v.Validate(n.IP, uint8(ones), c.origin, c.hasOrigin); s != c.state {
+			t.Errorf("%s from AS%d: expected %s, got %s", c.prefix, c.origin, c.state, s)
+		}
+	}
+
+	if _, err := ReadVRPs(strings.NewReader(`{"roas":[{"prefix":"10.0.0.0/8","maxLength":4,"asn":1}]}`)); err == nil {
+		t.Errorf("ROA with max length shorter than its prefix was read")
+	}
+	if s, err := ParseROVState("NotFound"); err != nil || s != ROV_NOTFOUND {
+		t.Errorf("bad parsed state %s %v", s, err)
+	}
+}
+
+// updateRecord encodes a BGP4MP record of an update that peerAS sent from
+// 192.0.2.1, with withdrawn and nlri holding IPv4 prefixes.
+func updateRecord(peerAS uint32, withdrawn, attrs, nlri []byte) []byte {
+	body := make([]byte, 2, 4+len(withdrawn)+len(attrs)+len(nlri))
+	binary.BigEndian.PutUint16(body, uint16(len(withdrawn)))
+	body = append(body, withdrawn...)
+	body = append(body, byte(len(attrs)>>8), byte(len(attrs)))
+	body = append(body, attrs...)
+	body = append(body, nlri...)
+	peering := &mrt.BGP4MPPeering{PeerAS: peerAS, PeerIP: net.ParseIP("192.0.2.1")}
+	return mrt.NewBGP4MPMessage(time.Unix(1500000000, 0), peering, true, bgp.NewMessage(bgp.MSG_UPDATE, body))
+}
+
+// pathAttrs returns an IGP origin, the next hop 192.0.2.1 and an AS4 path
+// written like "3356 {64512,64513}", an AS_SEQUENCE with an optional AS_SET.
+func pathAttrs(path string) []byte {
+	seq, set := path, ""
+	if i := strings.Index(path, "{"); i >= 0 {
+		seq, set = path[:i], strings.Trim(path[i:], "{}")
+	}
+	segs := asSegment(2, strings.Fields(seq))
+	if set != "" {
+		segs = append(segs, asSegment(1, strings.Split(set, ","))...)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(segs))}
+	attrs = append(attrs, segs...)
+	return append(attrs, 0x40, 3, 4, 192, 0, 2, 1)
+}
+
+func asSegment(stype uint8, ases []string) []byte {
+	seg := []byte{stype, byte(len(ases))}
+	for _, as := range ases {
+		n, _ := strconv.ParseUint(as, 10, 32)
+		seg = append(seg, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(seg[len(seg)-4:], uint32(n))
+	}
+	return seg
+}
+
+// nlri encodes IPv4 prefixes as updates carry them.
+func nlri(prefixes ...string) []byte {
+	buf := []byte{}
+	for _, p := range prefixes {
+		_, n, _ := net.ParseCIDR(p)
+		ones, _ := n.Mask.Size()
+		buf = append(buf, byte(ones))
+		buf = append(buf, n.IP.To4()[:(ones+7)/8]...)
+	}
+	return buf
+}
+
+func TestValidateUpdates(t *testing.T) {
+	v := testROV(t)
+	recs := [][]byte{
+		updateRecord(3356, nil, pathAttrs("3356 64512"), nlri("10.2.0.0/16")),
+		updateRecord(3356, nil, pathAttrs("3356 64512"), nlri("10.2.3.0/24")),
+		updateRecord(3356, nil, pathAttrs("3356 {64512,64513}"), nlri("10.2.0.0/16")),
+		updateRecord(3356, nlri("10.2.0.0/16"), nil, nil),
+	}
+	want := []string{"valid", "invalid", "invalid", ""}
+	for i, rec := range recs {
+		mbs, err := mrt.ParseHeaders(rec, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := v.ValidateStack(mbs)
+		got := ""
+		if res != nil {
+			got = res.State.String()
+		}
+		if err != nil || got != want[i] {
+			t.Errorf("update %d: expected %q, got %q %v", i, want[i], got, err)
+		}
+
+		c, err := mrt.MrtToBGPCapturev2(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ac := NewAnnotatedCapture(c)
+		v.Annotate(ac)
+		js, _ := json.Marshal(ac)
+		if want[i] != "" && !strings.Contains(string(js), `"rov":{"state":"`+want[i]+`"`) {
+			t.Errorf("update %d: bad annotated capture %s", i, js)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package rpki validates BGP updates with RPKI data: the origins of the
+// advertised prefixes against VRPs (RFC6811), from a JSON export or an
+// RTR cache, and their AS paths against ASPAs.
+package rpki
+
+import (
+	"fmt"
+	"net"
+
+	monpb "github.com/CSUNetSec/netsec-protobufs/bgpmon/v2"
+	pbbgp "github.com/CSUNetSec/netsec-protobufs/protocol/bgp"
+	"github.com/CSUNetSec/protoparse"
+	"github.com/CSUNetSec/protoparse/protocol/mrt"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+// route is an advertised prefix and the attributes it was advertised with.
+type route struct {
+	mrt.Route
+	attrs *pbbgp.BGPUpdate_Attributes
+}
+
+func updateRoutes(update *pbbgp.BGPUpdate) []route {
+	if update == nil || update.AdvertisedRoutes == nil {
+		return nil
+	}
+	ret := []route{}
+	for _, p := range update.AdvertisedRoutes.Prefixes {
+		ret = append(ret, route{mrt.Route{IP: net.IP(util.GetIP(p.GetPrefix())), Mask: uint8(p.Mask)}, update.Attrs})
+	}
+	return ret
+}
+
+// stackRoutes returns the routes advertised in an update or the entries
+// of a RIB.
+func stackRoutes(mbs *mrt.MrtBufferStack) ([]route, error) {
+	if mbs.IsRibStack() {
+		rib := mbs.Ribbuf.(protoparse.RIBHeaderer).GetHeader()
+		if rib == nil {
+			return nil, fmt.Errorf("Error parsing RIB entries")
+		}
+		ret := []route{}
+		for _, ent := range rib.RouteEntry {
+			p := ent.GetPrefix()
+			ret = append(ret, route{mrt.Route{IP: net.IP(util.GetIP(p.GetPrefix())), Mask: uint8(p.GetMask())}, ent.Attrs})
+		}
+		return ret, nil
+	}
+	if mbs.Bgpupbuf == nil {
+		return nil, fmt.Errorf("Error parsing advertised routes")
+	}
+	update := mbs.Bgpupbuf.(protoparse.BGPUpdater).GetUpdate()
+	if update == nil {
+		return nil, fmt.Errorf("Error parsing advertised routes")
+	}
+	return updateRoutes(update), nil
+}
+
+// originAS returns the AS that originated a route, and false if it is
+// unknown because the path is empty or ends in an AS_SET.
+func originAS(attrs *pbbgp.BGPUpdate_Attributes) (uint32, bool) {
+	if attrs == nil || len(attrs.ASPath) == 0 {
+		return 0, false
+	}
+	last := attrs.ASPath[len(attrs.ASPath)-1]
+	if len(last.ASSeq) == 0 {
+		return 0, false
+	}
+	return last.ASSeq[len(last.ASSeq)-1], true
+}
+
+// AnnotatedCapture is a BGP capture with the results of validating it. It
+// marshals to the JSON of the capture with the results added.
+type AnnotatedCapture struct {
+	*monpb.BGPCapture
+	ROV  *ROVResult  `json:"rov,omitempty"`
+	ASPA *ASPAResult `json:"aspa,omitempty"`
+}
+
+// NewAnnotatedCapture wraps a capture to annotate it.
+func NewAnnotatedCapture(c *monpb.BGPCapture) *AnnotatedCapture {
+	return &AnnotatedCapture{BGPCapture: c}
+}
@@ -0,0 +1,531 @@
+// Package speaker is a minimal BGP speaker that peers with routers to
+// capture the updates they send. It never advertises routes of its own
+// besides what a caller explicitly sends on a session.
+package speaker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	monpb2 "github.com/CSUNetSec/netsec-protobufs/bgpmon/v2"
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	mrt "github.com/CSUNetSec/protoparse/protocol/mrt"
+)
+
+const (
+	DEFAULT_HOLD_TIME = 90 * time.Second
+	// how long to wait for the OPEN and KEEPALIVE of a new session
+	OPEN_TIMEOUT = 60 * time.Second
+)
+
+var (
+	ErrClosed = errors.New("speaker is closed")
+)
+
+// Config is the configuration of a speaker.
+type Config struct {
+	LocalAS  uint32
+	RouterID net.IP
+	// HoldTime is the hold time proposed to peers. 0 uses DEFAULT_HOLD_TIME.
+	HoldTime time.Duration
+	// Families are the advertised multiprotocol capabilities. nil
+	// advertises IPv4 and IPv6 unicast.
+	Families []bgp.AFISAFI
+	// PeerAS, if not 0, is the only AS accepted in OPEN messages.
+	PeerAS uint32
+}
+
+func (c *Config) open() *bgp.Open {
+	hold := c.HoldTime
+	if hold == 0 {
+		hold = DEFAULT_HOLD_TIME
+	}
+	fams := c.Families
+	if fams == nil {
+		fams = []bgp.AFISAFI{{AFI: bgp.AFI_IP, SAFI: 1}, {AFI: bgp.AFI_IP6, SAFI: 1}}
+	}
+	o := &bgp.Open{
+		Version:  4,
+		AS:       c.LocalAS,
+		HoldTime: uint16(hold / time.Second),
+		BGPID:    c.RouterID,
+	}
+	for _, f := range fams {
+		o.Capabilities = append(o.Capabilities, bgp.NewMultiprotocolCapability(f))
+	}
+	o.Capabilities = append(o.Capabilities, bgp.NewAS4Capability(c.LocalAS))
+	return o
+}
+
+// Update is an UPDATE received by a speaker. Record is the BGP4MP MRT
+// record of the update and Capture its decoded form, or nil if it couldn't
+// be decoded.
+type Update struct {
+	Session *Session
+	Record  []byte
+	Capture *monpb2.BGPCapture
+}
+
+// Speaker accepts BGP sessions and delivers the updates received on them
+// to a handler, on the goroutine of the session.
+type Speaker struct {
+	// ErrorHandler, if set, is called with the errors that end sessions
+	// and the updates that could not be decoded.
+	ErrorHandler func(s *Session, err error)
+	// OnEstablished, if set, is called when a session is established.
+	OnEstablished func(s *Session)
+
+	conf    Config
+	handler func(*Update)
+
+	mu       sync.Mutex
+	ln       net.Listener
+	sessions map[*Session]struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a speaker that calls handler for every received update.
+func New(conf Config, handler func(*Update)) *Speaker {
+	return &Speaker{
+		conf:     conf,
+		handler:  handler,
+		sessions: make(map[*Session]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (sp *Speaker) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return sp.Serve(ln)
+}
+
+// Serve accepts sessions on ln until the speaker is closed. It returns nil
+// after Close and the accept error otherwise.
+func (sp *Speaker) Serve(ln net.Listener) error {
+	sp.mu.Lock()
+	if sp.isClosed() {
+		sp.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	sp.ln = ln
+	sp.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if sp.isClosed() {
+				return nil
+			}
+			return err
+		}
+		s, err := sp.newSession(conn)
+		if err != nil {
+			conn.Close()
+			return nil
+		}
+		go s.run(nil)
+	}
+}
+
+// Dial opens a session to a peer at addr and returns it once it is
+// established. Updates received on it are delivered like the ones of
+// accepted sessions.
+func (sp *Speaker) Dial(addr string) (*Session, error) {
+	conn, err := net.DialTimeout("tcp", addr, OPEN_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	s, err := sp.newSession(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	established := make(chan error, 1)
+	go s.run(established)
+	if err := <-established; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (sp *Speaker) isClosed() bool {
+	select {
+	case <-sp.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sp *Speaker) newSession(conn net.Conn) (*Session, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.isClosed() {
+		return nil, ErrClosed
+	}
+	s := &Session{
+		sp:     sp,
+		conn:   conn,
+		closed: make(chan struct{}),
+	}
+	sp.sessions[s] = struct{}{}
+	sp.wg.Add(1)
+	return s, nil
+}
+
+// Sessions returns the established sessions.
+func (sp *Speaker) Sessions() []*Session {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	ret := []*Session{}
+	for s := range sp.sessions {
+		if s.Established() {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Close stops accepting sessions, sends a Cease NOTIFICATION on all sessions
+// and waits for them to end.
+func (sp *Speaker) Close() error {
+	sp.mu.Lock()
+	if sp.isClosed() {
+		sp.mu.Unlock()
+		return nil
+	}
+	close(sp.done)
+	var err error
+	if sp.ln != nil {
+		err = sp.ln.Close()
+	}
+	sessions := make([]*Session, 0, len(sp.sessions))
+	for s := range sp.sessions {
+		sessions = append(sessions, s)
+	}
+	sp.mu.Unlock()
+	for _, s := range sessions {
+		s.Close()
+	}
+	sp.wg.Wait()
+	return err
+}
+
+// NotificationError is the error of a session that ended with a
+// NOTIFICATION, sent or received.
+type NotificationError struct {
+	*bgp.Notification
+	Sent bool
+}
+
+func (e *NotificationError) Error() string {
+	if e.Sent {
+		return fmt.Sprintf("sent NOTIFICATION: %s", e.Notification)
+	}
+	return fmt.Sprintf("received NOTIFICATION: %s", e.Notification)
+}
+
+// Session is a BGP session of a speaker.
+type Session struct {
+	sp       *Speaker
+	conn     net.Conn
+	peerOpen *bgp.Open
+	hold     time.Duration
+	as4      bool
+
+	wmu         sync.Mutex
+	mu          sync.Mutex
+	established bool
+	sent        *NotificationError
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// PeerOpen returns the OPEN the peer sent.
+func (s *Session) PeerOpen() *bgp.Open {
+	return s.peerOpen
+}
+
+// RemoteAddr returns the address of the peer.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// HoldTime returns the negotiated hold time.
+func (s *Session) HoldTime() time.Duration {
+	return s.hold
+}
+
+// AS4 returns whether both speakers support 4 byte ASes.
+func (s *Session) AS4() bool {
+	return s.as4
+}
+
+// Established returns whether the session is up.
+func (s *Session) Established() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.established
+}
+
+// Done returns a channel that is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *Session) write(msg []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(OPEN_TIMEOUT))
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// SendUpdate sends an UPDATE with body, the message without its header.
+func (s *Session) SendUpdate(body []byte) error {
+	if !s.Established() {
+		return fmt.Errorf("session is not established")
+	}
+	return s.write(bgp.NewMessage(bgp.MSG_UPDATE, body))
+}
+
+// Close sends a Cease NOTIFICATION (administrative shutdown) and closes the session.
+func (s *Session) Close() error {
+	s.notify(&bgp.Notification{Code: 6, Subcode: 2})
+	<-s.closed
+	return nil
+}
+
+// notify sends a NOTIFICATION and closes the connection, which ends run.
+func (s *Session) notify(n *bgp.Notification) *NotificationError {
+	nerr := &NotificationError{Notification: n, Sent: true}
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.sent = nerr
+		s.mu.Unlock()
+		s.write(n.Encode())
+		s.conn.Close()
+	})
+	return nerr
+}
+
+// run performs the OPEN exchange and reads messages until the session ends.
+// If established is not nil, it receives the result of the OPEN exchange.
+func (s *Session) run(established chan<- error) {
+	sp := s.sp
+	defer func() {
+		s.closeOnce.Do(func() { s.conn.Close() })
+		s.mu.Lock()
+		s.established = false
+		s.mu.Unlock()
+		sp.mu.Lock()
+		delete(sp.sessions, s)
+		sp.mu.Unlock()
+		close(s.closed)
+		sp.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(s.conn)
+	scanner.Split(bgp.SplitBGP)
+	scanbuffer := make([]byte, 1<<16)
+	scanner.Buffer(scanbuffer, cap(scanbuffer))
+
+	err := s.openExchange(scanner)
+	if established != nil {
+		established <- err
+	}
+	if err != nil {
+		s.reportError(err)
+		return
+	}
+	if sp.OnEstablished != nil {
+		sp.OnEstablished(s)
+	}
+	if s.hold > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go s.keepalives(stop)
+	}
+	s.reportError(s.receive(scanner))
+}
+
+func (s *Session) reportError(err error) {
+	if err == nil || s.sp.ErrorHandler == nil {
+		return
+	}
+	s.sp.ErrorHandler(s, err)
+}
+
+// next reads the next message waiting at most timeout, or forever if it is 0.
+func (s *Session) next(scanner *bufio.Scanner, timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		s.conn.SetReadDeadline(time.Time{})
+	}
+	if !scanner.Scan() {
+		err := scanner.Err()
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return nil, s.notify(&bgp.Notification{Code: 4})
+		}
+		s.mu.Lock()
+		sent := s.sent
+		s.mu.Unlock()
+		if sent != nil { //we closed it
+			return nil, sent
+		}
+		if err == nil {
+			err = fmt.Errorf("connection closed by peer")
+		}
+		return nil, err
+	}
+	return scanner.Bytes(), nil
+}
+
+func (s *Session) openExchange(scanner *bufio.Scanner) error {
+	local := s.sp.conf.open()
+	if err := s.write(local.Encode()); err != nil {
+		return err
+	}
+	msg, err := s.next(scanner, OPEN_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	switch msg[18] {
+	case bgp.MSG_OPEN:
+	case bgp.MSG_NOTIFICATION:
+		return receivedNotification(msg)
+	default:
+		return s.notify(&bgp.Notification{Code: 5, Subcode: 1}) //unexpected message in OpenSent
+	}
+	peer, err := bgp.ParseOpen(msg[bgp.BGP_HEADER_LEN:])
+	if err != nil {
+		return s.notify(&bgp.Notification{Code: 2})
+	}
+	switch {
+	case peer.Version != 4:
+		return s.notify(&bgp.Notification{Code: 2, Subcode: 1, Data: []byte{0, 4}})
+	case s.sp.conf.PeerAS != 0 && peer.AS != s.sp.conf.PeerAS:
+		return s.notify(&bgp.Notification{Code: 2, Subcode: 2})
+	case peer.BGPID.Equal(net.IPv4zero) || peer.BGPID.Equal(local.BGPID.To4()):
+		return s.notify(&bgp.Notification{Code: 2, Subcode: 3})
+	case peer.HoldTime == 1 || peer.HoldTime == 2:
+		return s.notify(&bgp.Notification{Code: 2, Subcode: 6})
+	}
+	s.peerOpen = peer
+	s.hold = time.Duration(peer.HoldTime) * time.Second
+	if local.HoldTime < peer.HoldTime {
+		s.hold = time.Duration(local.HoldTime) * time.Second
+	}
+	_, s.as4 = peer.AS4()
+	if err := s.write(bgp.NewMessage(bgp.MSG_KEEPALIVE, nil)); err != nil {
+		return err
+	}
+	// OpenConfirm
+	timeout := s.hold
+	if timeout == 0 {
+		timeout = OPEN_TIMEOUT
+	}
+	msg, err = s.next(scanner, timeout)
+	if err != nil {
+		return err
+	}
+	switch msg[18] {
+	case bgp.MSG_KEEPALIVE:
+	case bgp.MSG_NOTIFICATION:
+		return receivedNotification(msg)
+	default:
+		return s.notify(&bgp.Notification{Code: 5, Subcode: 2})
+	}
+	s.mu.Lock()
+	s.established = true
+	s.mu.Unlock()
+	return nil
+}
+
+func receivedNotification(msg []byte) error {
+	n, err := bgp.ParseNotification(msg[bgp.BGP_HEADER_LEN:])
+	if err != nil {
+		return err
+	}
+	return &NotificationError{Notification: n}
+}
+
+func (s *Session) keepalives(stop chan struct{}) {
+	ticker := time.NewTicker(s.hold / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write(bgp.NewMessage(bgp.MSG_KEEPALIVE, nil)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// receive reads messages of an established session until it ends.
+func (s *Session) receive(scanner *bufio.Scanner) error {
+	for {
+		msg, err := s.next(scanner, s.hold)
+		if err != nil {
+			select {
+			case <-s.sp.done: //closed by us
+				return nil
+			default:
+				return err
+			}
+		}
+		switch msg[18] {
+		case bgp.MSG_UPDATE:
+			s.deliver(msg)
+		case bgp.MSG_KEEPALIVE, bgp.MSG_ROUTE_REFRESH:
+		case bgp.MSG_NOTIFICATION:
+			return receivedNotification(msg)
+		default:
+			return s.notify(&bgp.Notification{Code: 1, Subcode: 3, Data: []byte{msg[18]}})
+		}
+	}
+}
+
+func (s *Session) peering() *mrt.BGP4MPPeering {
+	p := &mrt.BGP4MPPeering{
+		PeerAS:  s.peerOpen.AS,
+		LocalAS: s.sp.conf.LocalAS,
+	}
+	if addr, ok := s.conn.RemoteAddr().(*net.TCPAddr); ok {
+		p.PeerIP = addr.IP
+	}
+	if addr, ok := s.conn.LocalAddr().(*net.TCPAddr); ok {
+		p.LocalIP = addr.IP
+	}
+	return p
+}
+
+func (s *Session) deliver(msg []byte) {
+	up := &Update{
+		Session: s,
+		Record:  mrt.NewBGP4MPMessage(time.Now(), s.peering(), s.as4, msg),
+	}
+	capture, err := mrt.MrtToBGPCapturev2(up.Record)
+	if err != nil {
+		s.reportError(err)
+	} else {
+		up.Capture = capture
+	}
+	if s.sp.handler != nil {
+		s.sp.handler(up)
+	}
+}
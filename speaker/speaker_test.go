@@ -0,0 +1,145 @@
+package speaker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	bgp "github.com/CSUNetSec/protoparse/protocol/bgp"
+	util "github.com/CSUNetSec/protoparse/util"
+)
+
+// updateBody advertises 10.0.0.0/8 with an AS4 path of ases.
+func updateBody(ases ...uint32) []byte {
+	path := []byte{2, byte(len(ases))}
+	for _, as := range ases {
+		path = append(path, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(path[len(path)-4:], as)
+	}
+	attrs := []byte{0x40, 1, 1, 0, 0x40, 2, byte(len(path))}
+	attrs = append(attrs, path...)
+	attrs = append(attrs, 0x40, 3, 4, 127, 0, 0, 2)
+	body := []byte{0, 0, 0, byte(len(attrs))}
+	body = append(body, attrs...)
+	return append(body, 8, 10)
+}
+
+func listen(t *testing.T, sp *Speaker) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go sp.Serve(ln)
+	return ln.Addr().String()
+}
+
+func TestSession(t *testing.T) {
+	updates := make(chan *Update, 1)
+	errs := make(chan error, 1)
+	passive := New(Config{LocalAS: 65000, RouterID: net.ParseIP("10.0.0.1"), PeerAS: 4200000000}, func(u *Update) {
+		updates <- u
+	})
+	passive.ErrorHandler = func(s *Session, err error) {
+		errs <- err
+	}
+	defer passive.Close()
+	addr := listen(t, passive)
+
+	active := New(Config{LocalAS: 4200000000, RouterID: net.ParseIP("10.0.0.2"), HoldTime: 30 * time.Second}, nil)
+	defer active.Close()
+	s, err := active.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PeerOpen().AS != 65000 || s.HoldTime() != 30*time.Second || !s.AS4() {
+		t.Errorf("bad negotiation: open %s hold %s AS4 %v", s.PeerOpen(), s.HoldTime(), s.AS4())
+	}
+	if err := s.SendUpdate(updateBody(4200000000, 3356)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case u := <-updates:
+		if u.Capture == nil {
+			t.Fatal("update was not decoded")
+		}
+		if u.Capture.Peer_AS != 4200000000 || u.Capture.Local_AS != 65000 {
+			t.Errorf("bad capture ASes %d %d", u.Capture.Peer_AS, u.Capture.Local_AS)
+		}
+		if !net.IP(util.GetIP(u.Capture.Peer_IP)).Equal(net.ParseIP("127.0.0.1")) {
+			t.Errorf("bad peer IP %v", u.Capture.Peer_IP)
+		}
+		seq := u.Capture.Update.Attrs.ASPath[0].ASSeq
+		if len(seq) != 2 || seq[0] != 4200000000 {
+			t.Errorf("bad AS path %v", seq)
+		}
+		if u.Session.PeerOpen().AS != 4200000000 {
+			t.Errorf("bad peer AS in session %d", u.Session.PeerOpen().AS)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the update")
+	}
+	if n := len(passive.Sessions()); n != 1 {
+		t.Errorf("expected 1 established session, got %d", n)
+	}
+
+	s.Close()
+	select {
+	case err := <-errs:
+		var nerr *NotificationError
+		if !errors.As(err, &nerr) || nerr.Sent || nerr.Code != 6 {
+			t.Errorf("expected to receive a Cease, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the session to end")
+	}
+}
+
+func TestBadPeerAS(t *testing.T) {
+	passive := New(Config{LocalAS: 65000, RouterID: net.ParseIP("10.0.0.1"), PeerAS: 65001}, nil)
+	defer passive.Close()
+	addr := listen(t, passive)
+
+	active := New(Config{LocalAS: 65002, RouterID: net.ParseIP("10.0.0.2")}, nil)
+	defer active.Close()
+	_, err := active.Dial(addr)
+	var nerr *NotificationError
+	if !errors.As(err, &nerr) || nerr.Sent || nerr.Code != 2 || nerr.Subcode != 2 {
+		t.Errorf("expected to receive a Bad Peer AS NOTIFICATION, got %v", err)
+	}
+}
+
+func TestHoldTimerExpired(t *testing.T) {
+	passive := New(Config{LocalAS: 65000, RouterID: net.ParseIP("10.0.0.1"), HoldTime: 3 * time.Second}, nil)
+	defer passive.Close()
+	addr := listen(t, passive)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// a peer that establishes the session and then goes silent
+	open := &bgp.Open{Version: 4, AS: 65001, HoldTime: 3, BGPID: net.ParseIP("10.0.0.2")}
+	conn.Write(open.Encode())
+	conn.Write(bgp.NewMessage(bgp.MSG_KEEPALIVE, nil))
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(bgp.SplitBGP)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for scanner.Scan() {
+		msg := scanner.Bytes()
+		if msg[18] != bgp.MSG_NOTIFICATION {
+			continue
+		}
+		n, err := bgp.ParseNotification(msg[bgp.BGP_HEADER_LEN:])
+		if err != nil || n.Code != 4 {
+			t.Fatalf("expected a Hold Timer Expired NOTIFICATION, got %v %v", n, err)
+		}
+		return
+	}
+	t.Fatalf("no NOTIFICATION before the connection ended: %v", scanner.Err())
+}
@@ -61,30 +61,109 @@ func MaskStrToUint8(m string) (uint8, error) {
 
 // PrefixTree holds a radix tree which clients
 // can insert IPs and masks in , and  also lookup
-// for their existence.
+// for their existence. IPv4 and IPv6 prefixes are kept
+// in separate trees so that their keys don't collide.
 type PrefixTree struct {
-	rt *radix.Tree
+	rt  *radix.Tree
+	rt6 *radix.Tree
 }
 
 // NewPrefixTree creates a new PrefixTree with an empty radix tree.
 func NewPrefixTree() PrefixTree {
 	return PrefixTree{
-		rt: radix.New(),
+		rt:  radix.New(),
+		rt6: radix.New(),
 	}
 }
 
+// tree returns the tree for the family of IP.
+func (pt PrefixTree) tree(IP net.IP) *radix.Tree {
+	if IP.To4() != nil {
+		return pt.rt
+	}
+	return pt.rt6
+}
+
+func prefixNet(IP net.IP, mask uint8) *net.IPNet {
+	if ip4 := IP.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4.Mask(net.CIDRMask(int(mask), 32)), Mask: net.CIDRMask(int(mask), 32)}
+	}
+	return &net.IPNet{IP: IP.Mask(net.CIDRMask(int(mask), 128)), Mask: net.CIDRMask(int(mask), 128)}
+}
+
 // Add adds an IP and a mask to that PrefixTree.
 func (pt PrefixTree) Add(IP net.IP, mask uint8) {
 	keystr := IPToRadixkey(IP, mask)
-	pt.rt.Insert(keystr, true)
+	pt.tree(IP).Insert(keystr, prefixNet(IP, mask))
 }
 
 // ContainsIPMask checks for the existance of that IP and mask in the PrefixTree.
 // It performs a longest prefix match and if it is found it retuns true.
 func (pt PrefixTree) ContainsIPMask(IP net.IP, mask uint8) bool {
 	keystr := IPToRadixkey(IP, mask)
-	if _, _, found := pt.rt.LongestPrefix(keystr); found {
+	if _, _, found := pt.tree(IP).LongestPrefix(keystr); found {
 		return true
 	}
 	return false
 }
+
+// misparsed checks for the empty key IPToRadixkey returns for a bad IP or
+// mask, that would be mistaken for the key of a /0.
+func misparsed(keystr string, mask uint8) bool {
+	return keystr == "" && mask != 0
+}
+
+// Exact checks if exactly that IP and mask were added to the PrefixTree.
+func (pt PrefixTree) Exact(IP net.IP, mask uint8) bool {
+	keystr := IPToRadixkey(IP, mask)
+	if misparsed(keystr, mask) {
+		return false
+	}
+	_, found := pt.tree(IP).Get(keystr)
+	return found
+}
+
+// WalkAncestors calls fn with the prefixes of the tree that cover IP and
+// mask, the shortest first and including IP and mask if it is in the tree,
+// until fn returns true.
+func (pt PrefixTree) WalkAncestors(IP net.IP, mask uint8, fn func(*net.IPNet) bool) {
+	keystr := IPToRadixkey(IP, mask)
+	if misparsed(keystr, mask) {
+		return
+	}
+	pt.tree(IP).WalkPath(keystr, func(_ string, v interface{}) bool {
+		return fn(v.(*net.IPNet))
+	})
+}
+
+// WalkDescendants calls fn with the prefixes of the tree that IP and mask
+// cover, including IP and mask if it is in the tree, until fn returns true.
+func (pt PrefixTree) WalkDescendants(IP net.IP, mask uint8, fn func(*net.IPNet) bool) {
+	keystr := IPToRadixkey(IP, mask)
+	if misparsed(keystr, mask) {
+		return
+	}
+	pt.tree(IP).WalkPrefix(keystr, func(_ string, v interface{}) bool {
+		return fn(v.(*net.IPNet))
+	})
+}
+
+// Ancestors returns the prefixes of the tree that cover IP and mask.
+func (pt PrefixTree) Ancestors(IP net.IP, mask uint8) []*net.IPNet {
+	var ret []*net.IPNet
+	pt.WalkAncestors(IP, mask, func(n *net.IPNet) bool {
+		ret = append(ret, n)
+		return false
+	})
+	return ret
+}
+
+// Descendants returns the prefixes of the tree that IP and mask cover.
+func (pt PrefixTree) Descendants(IP net.IP, mask uint8) []*net.IPNet {
+	var ret []*net.IPNet
+	pt.WalkDescendants(IP, mask, func(n *net.IPNet) bool {
+		ret = append(ret, n)
+		return false
+	})
+	return ret
+}
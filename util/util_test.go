@@ -75,3 +75,38 @@ func TestEmptyPrefixTree(t *testing.T) {
 		t.Errorf("Contains error")
 	}
 }
+
+func TestPrefixTreeQueries(t *testing.T) {
+	pt := NewPrefixTree()
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.0.2.0/24", "2001:db8::/32"} {
+		im := parseIP(p)
+		pt.Add(im.IP, im.mask)
+	}
+	nets := func(ns []*net.IPNet) string {
+		s := []string{}
+		for _, n := range ns {
+			s = append(s, n.String())
+		}
+		return strings.Join(s, " ")
+	}
+	q := parseIP("10.1.2.128/25")
+	if got := nets(pt.Ancestors(q.IP, q.mask)); got != "10.0.0.0/8 10.1.0.0/16 10.1.2.0/24" {
+		t.Errorf("bad ancestors %s", got)
+	}
+	q = parseIP("10.1.0.0/16")
+	if got := nets(pt.Descendants(q.IP, q.mask)); got != "10.1.0.0/16 10.1.2.0/24" {
+		t.Errorf("bad descendants %s", got)
+	}
+	if !pt.Exact(q.IP, q.mask) || pt.Exact(q.IP, 15) {
+		t.Errorf("exact match error")
+	}
+	// 0a00::/8 has the key of 10.0.0.0/8, but not its family
+	q = parseIP("a00::/8")
+	if pt.ContainsIPMask(q.IP, q.mask) || len(pt.Ancestors(q.IP, q.mask)) != 0 {
+		t.Errorf("IPv6 prefix matched an IPv4 one")
+	}
+	q = parseIP("2001:db8:1::/48")
+	if got := nets(pt.Ancestors(q.IP, q.mask)); got != "2001:db8::/32" {
+		t.Errorf("bad IPv6 ancestors %s", got)
+	}
+}